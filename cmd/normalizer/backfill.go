@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/backfill"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/config"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const dateLayout = "2006-01-02"
+
+// runBackfill implements "normalizer backfill": it pulls history for a date
+// range into storage and prints the spans it could not fill. Interrupting it
+// is safe; running it again with the same arguments resumes. It returns the
+// process exit code.
+func runBackfill(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	devices := fs.String("devices", "", "Comma-separated normalized device IDs (default: all devices)")
+	from := fs.String("from", "", "First day to backfill, YYYY-MM-DD (required)")
+	to := fs.String("to", "", "Last day to backfill, YYYY-MM-DD (default: yesterday)")
+	granularity := fs.String("granularity", "day", "minute, hour, day, month or year")
+	budget := fs.Float64("rate-budget", 0.5, "Share of each provider's rate_limit_rps to use")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s backfill -from YYYY-MM-DD [flags]\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *from == "" {
+		fs.Usage()
+		return 2
+	}
+	start, err := time.Parse(dateLayout, *from)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid -from date")
+	}
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	if *to != "" {
+		last, err := time.Parse(dateLayout, *to)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Invalid -to date")
+		}
+		end = last.AddDate(0, 0, 1)
+	}
+
+	switch models.Granularity(*granularity) {
+	case models.GranularityMinute, models.GranularityHour, models.GranularityDay, models.GranularityMonth, models.GranularityYear:
+	default:
+		log.Fatal().Str("granularity", *granularity).Msg("Invalid -granularity")
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+	setupLogging(cfg.Logging.Level, cfg.Logging.Format)
+	if cfg.Storage.Path == "" {
+		log.Fatal().Msg("Backfill needs storage.path set in the configuration")
+	}
+
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		log.Fatal().Err(err).Str("path", cfg.Storage.Path).Msg("Failed to open storage")
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	engine := newEngine(ctx, cfg)
+	defer engine.Close()
+
+	// Backfilled history also goes to the sinks
+	if influx := openInflux(cfg, engine, store); influx != nil {
+		defer influx.Close()
+	}
+
+	opts := backfill.Options{
+		From:        start,
+		To:          end,
+		Granularity: models.Granularity(*granularity),
+	}
+	if *devices != "" {
+		for _, id := range strings.Split(*devices, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				opts.Devices = append(opts.Devices, id)
+			}
+		}
+	}
+
+	log.Info().Str("from", *from).Time("to", end).Str("granularity", *granularity).Msg("Starting backfill")
+	reports, err := backfill.New(engine, store, cfg.Providers, *budget).Run(ctx, opts)
+	if reports != nil {
+		printBackfillReport(os.Stdout, reports)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Warn().Msg("Backfill interrupted; run it again to resume")
+		return 1
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Backfill failed")
+		return 1
+	}
+	for _, r := range reports {
+		if r.Err != nil || len(r.Failed) > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printBackfillReport(out io.Writer, reports []backfill.DeviceReport) {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tCALLS\tSKIPPED\tPOINTS\tSTATUS")
+	for _, r := range reports {
+		status := "ok"
+		if r.Err != nil {
+			status = "stopped: " + r.Err.Error()
+		} else if len(r.Failed) > 0 {
+			status = fmt.Sprintf("%d gap(s)", len(r.Failed))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", r.DeviceID, r.Chunks, r.Skipped, r.Points, status)
+	}
+	tw.Flush()
+
+	for _, r := range reports {
+		for _, f := range r.Failed {
+			fmt.Fprintf(out, "gap      %s  %s – %s  %v\n", r.DeviceID, f.From.Format(time.RFC3339), f.To.Format(time.RFC3339), f.Err)
+		}
+		for _, s := range r.Empty {
+			fmt.Fprintf(out, "no data  %s  %s – %s\n", r.DeviceID, s.From.Format(time.RFC3339), s.To.Format(time.RFC3339))
+		}
+	}
+}
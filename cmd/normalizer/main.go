@@ -7,15 +7,26 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/alarms"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/api"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/collector"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/config"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/metrics"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/mqtt"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/sink"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
 
 	// Register all providers (side-effect imports)
+	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/enphase"
+	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/goodwe"
+	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/growatt"
 	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/huawei"
 	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/saj"
 	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/sma"
+	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/solaredge"
+	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/solis"
 	_ "github.com/muasiq/universal-inverter-data-normalizer/internal/provider/sungrow"
 
 	"github.com/rs/zerolog"
@@ -23,6 +34,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		os.Exit(runBackfill(os.Args[2:]))
+	}
+
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
 	flag.Parse()
 
@@ -40,39 +55,73 @@ func main() {
 		Int("providers_configured", len(cfg.Providers)).
 		Msg("Starting Universal Inverter Data Normalizer")
 
-	// List available provider types
-	available := provider.DefaultRegistry.ListProviders()
-	log.Info().Strs("available_providers", available).Msg("Registered provider types")
+	// Metrics; the HTTP client observer must be in place before providers log in
+	var m *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		m, err = metrics.New(cfg.Metrics)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up metrics")
+		}
+		provider.SetClientObserver(m)
+	}
 
 	// Create normalizer engine
-	engine := normalizer.NewEngine()
+	ctx := context.Background()
+	engine := newEngine(ctx, cfg)
+	engine.SetCache(cfg.Cache)
 	defer engine.Close()
 
-	// Initialize and register providers
-	ctx := context.Background()
-	for _, pc := range cfg.Providers {
-		if !pc.Enabled {
-			log.Info().Str("provider", pc.Name).Msg("Provider disabled, skipping")
-			continue
-		}
+	// Start API server
+	srv := api.NewServer(engine, cfg.Server.Addr())
 
-		p, err := provider.DefaultRegistry.Create(pc.Type)
+	// Open storage; the collector needs it even if not enabled explicitly
+	var store storage.Store
+	if cfg.Storage.Enabled || cfg.Collector.Enabled {
+		store, err = storage.Open(cfg.Storage)
 		if err != nil {
-			log.Error().Err(err).Str("type", pc.Type).Str("name", pc.Name).Msg("Failed to create provider")
-			continue
+			log.Fatal().Err(err).Str("path", cfg.Storage.Path).Msg("Failed to open storage")
 		}
+		defer store.Close()
+		srv.SetStore(store, cfg.Collector.MaxAge())
+	}
 
-		if err := p.Initialize(ctx, pc); err != nil {
-			log.Error().Err(err).Str("provider", pc.Name).Msg("Failed to initialize provider")
-			continue
+	// Expose metrics
+	if m != nil {
+		m.Watch(engine, store)
+		srv.SetMetrics(m, cfg.Metrics.Path)
+	}
+
+	// Publish realtime snapshots over MQTT
+	var mqttClient *mqtt.Client
+	var bridge *mqtt.Bridge
+	if cfg.MQTT.Enabled {
+		mqttClient, err = mqtt.Dial(cfg.MQTT)
+		if err != nil {
+			log.Fatal().Err(err).Str("broker", cfg.MQTT.Broker).Msg("Failed to connect to MQTT broker")
 		}
+		bridge = mqtt.NewBridge(engine, mqttClient, cfg.MQTT, store)
+	}
+
+	// Export to time series databases
+	influx := openInflux(cfg, engine, store)
 
-		engine.RegisterProvider(p)
-		log.Info().Str("provider", p.Name()).Msg("Provider registered successfully")
+	// Track alarm lifecycles and notify webhooks
+	var tracker *alarms.Tracker
+	if cfg.Alarms.Enabled {
+		tracker, err = alarms.New(engine, store, cfg.Alarms)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to set up alarm tracking")
+		}
+		tracker.Start(ctx)
+		srv.SetAlarmTracker(tracker)
 	}
 
-	// Start API server
-	srv := api.NewServer(engine, cfg.Server.Addr())
+	// Start background collector
+	var coll *collector.Collector
+	if cfg.Collector.Enabled {
+		coll = collector.New(engine, store, cfg.Collector, cfg.Providers)
+		coll.Start(ctx)
+	}
 
 	// Graceful shutdown
 	go func() {
@@ -80,6 +129,22 @@ func main() {
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		sig := <-sigCh
 		log.Info().Str("signal", sig.String()).Msg("Shutdown signal received")
+		if coll != nil {
+			coll.Stop()
+		}
+		if tracker != nil {
+			tracker.Stop()
+		}
+		if bridge != nil {
+			bridge.Stop()
+			mqttClient.Close()
+		}
+		if influx != nil {
+			influx.Close()
+		}
+		if store != nil {
+			store.Close()
+		}
 		engine.Close()
 		os.Exit(0)
 	}()
@@ -89,6 +154,56 @@ func main() {
 	}
 }
 
+// newEngine creates the normalizer engine and registers every enabled provider.
+func newEngine(ctx context.Context, cfg *config.Config) *normalizer.Engine {
+	// List available provider types
+	available := provider.DefaultRegistry.ListProviders()
+	log.Info().Strs("available_providers", available).Msg("Registered provider types")
+
+	engine := normalizer.NewEngine()
+
+	// Initialize and register providers
+	for _, pc := range cfg.Providers {
+		if !pc.Enabled {
+			log.Info().Str("provider", pc.Name).Msg("Provider disabled, skipping")
+			continue
+		}
+
+		p, err := provider.DefaultRegistry.Create(pc.Type)
+		if err != nil {
+			log.Error().Err(err).Str("type", pc.Type).Str("name", pc.Name).Msg("Failed to create provider")
+			continue
+		}
+
+		if err := p.Initialize(provider.WithInstance(ctx, pc.Name), pc); err != nil {
+			log.Error().Err(err).Str("provider", pc.Name).Msg("Failed to initialize provider")
+			continue
+		}
+
+		if err := engine.RegisterProvider(pc.Name, p, pc.CircuitBreaker); err != nil {
+			log.Error().Err(err).Str("provider", pc.Name).Msg("Failed to register provider")
+			p.Close()
+			continue
+		}
+		log.Info().Str("provider", pc.Name).Str("type", p.Name()).Msg("Provider registered successfully")
+	}
+	return engine
+}
+
+// openInflux starts the InfluxDB sink, if enabled, and attaches it to the engine.
+func openInflux(cfg *config.Config, engine *normalizer.Engine, store storage.Store) *sink.Influx {
+	if !cfg.Sinks.InfluxDB.Enabled {
+		return nil
+	}
+	influx, err := sink.NewInflux(cfg.Sinks.InfluxDB, store)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up InfluxDB sink")
+	}
+	sink.Attach(engine, influx)
+	log.Info().Str("url", cfg.Sinks.InfluxDB.URL).Str("bucket", cfg.Sinks.InfluxDB.Bucket).Msg("Writing to InfluxDB")
+	return influx
+}
+
 func setupLogging(level, format string) {
 	switch level {
 	case "debug":
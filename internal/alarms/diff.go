@@ -0,0 +1,107 @@
+package alarms
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+)
+
+// Differ turns successive alarm lists of provider instances into lifecycle
+// events. An alarm is active while the vendor lists it with a status other
+// than resolved. It is safe for concurrent use.
+type Differ struct {
+	mu     sync.Mutex
+	active map[string]map[string]models.NormalizedAlarm // instance → alarm key → alarm
+}
+
+// NewDiffer creates a Differ that knows of no active alarms.
+func NewDiffer() *Differ {
+	return &Differ{active: make(map[string]map[string]models.NormalizedAlarm)}
+}
+
+// restore marks a as active without raising it.
+func (d *Differ) restore(instance string, a models.NormalizedAlarm) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.activeOf(instance)[alarmKey(&a)] = a
+}
+
+// Diff compares an alarm list with the alarms seen before and returns the
+// differences, ordered by device and code. A list for a single device only
+// affects that device's alarms.
+func (d *Differ) Diff(snapshot normalizer.AlarmSnapshot, now time.Time) []models.AlarmEvent {
+	// Vendors may list past occurrences of an alarm too; the latest one
+	// counts.
+	current := make(map[string]models.NormalizedAlarm, len(snapshot.Alarms))
+	for _, a := range snapshot.Alarms {
+		if snapshot.DeviceID != "" && a.DeviceID != snapshot.DeviceID {
+			continue
+		}
+		key := alarmKey(&a)
+		if prev, ok := current[key]; ok && prev.StartTime.After(a.StartTime) {
+			continue
+		}
+		current[key] = a
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	active := d.activeOf(snapshot.Instance)
+
+	var events []models.AlarmEvent
+	for key, a := range current {
+		prev, wasActive := active[key]
+		switch {
+		case a.Status == models.AlarmStatusResolved:
+			if wasActive {
+				events = append(events, newEvent(models.AlarmEventCleared, snapshot.Instance, a, now))
+				delete(active, key)
+			}
+		case !wasActive:
+			events = append(events, newEvent(models.AlarmEventRaised, snapshot.Instance, a, now))
+			active[key] = a
+		default:
+			if changed := changes(&prev, &a); len(changed) > 0 {
+				ev := newEvent(models.AlarmEventUpdated, snapshot.Instance, a, now)
+				ev.Changed = changed
+				events = append(events, ev)
+			}
+			active[key] = a
+		}
+	}
+	for key, prev := range active {
+		if _, listed := current[key]; listed {
+			continue
+		}
+		if snapshot.DeviceID != "" && prev.DeviceID != snapshot.DeviceID {
+			continue
+		}
+		prev.Status = models.AlarmStatusResolved
+		if prev.EndTime == nil {
+			end := now
+			prev.EndTime = &end
+		}
+		events = append(events, newEvent(models.AlarmEventCleared, snapshot.Instance, prev, now))
+		delete(active, key)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].DeviceID != events[j].DeviceID {
+			return events[i].DeviceID < events[j].DeviceID
+		}
+		return events[i].Code < events[j].Code
+	})
+	return events
+}
+
+func (d *Differ) activeOf(instance string) map[string]models.NormalizedAlarm {
+	active, ok := d.active[instance]
+	if !ok {
+		active = make(map[string]models.NormalizedAlarm)
+		d.active[instance] = active
+	}
+	return active
+}
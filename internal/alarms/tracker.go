@@ -0,0 +1,315 @@
+// Package alarms turns the alarm lists fetched from the vendors into
+// lifecycle events (raised, updated, cleared) and delivers them to webhooks.
+package alarms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// queueSize bounds the events waiting to be stored and dispatched.
+const queueSize = 1024
+
+// Config controls alarm tracking.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// How often every instance's alarm list is polled (default 300). Alarm
+	// lists fetched by the collector and API requests are tracked as well;
+	// 0 relies on those alone.
+	PollIntervalSeconds int `yaml:"poll_interval_seconds"`
+
+	// Events kept in memory for /api/v1/alarms/events when storage is
+	// disabled (default 1000). With storage, events are stored and kept per
+	// storage.retention.alarms_days.
+	HistorySize int `yaml:"history_size"`
+
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+
+	// Events that could not be delivered to a webhook are logged and, if
+	// set, appended to this file as JSON lines.
+	DeadLetterPath string `yaml:"dead_letter_path"`
+}
+
+// DefaultConfig returns the alarm tracking settings used when the config file
+// sets none.
+func DefaultConfig() Config {
+	return Config{
+		PollIntervalSeconds: 300,
+		HistorySize:         1000,
+	}
+}
+
+// Tracker compares every alarm list the engine fetches with the alarms seen
+// before and records the differences as events.
+type Tracker struct {
+	engine   *normalizer.Engine
+	store    storage.Store // nil keeps events in memory
+	cfg      Config
+	webhooks []*webhook
+	dead     *deadLetters
+	diff     *Differ
+
+	mu       sync.Mutex
+	history  []models.AlarmEvent // newest last, without store
+	watchers []EventHook
+	stopped  bool
+
+	queue  chan []models.AlarmEvent
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// New creates a tracker and subscribes it to the engine's alarm lists. store
+// may be nil. With a store, the alarms active when the service last stopped
+// are restored from the stored events, so they are not raised again.
+func New(engine *normalizer.Engine, store storage.Store, cfg Config) (*Tracker, error) {
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = DefaultConfig().HistorySize
+	}
+	t := &Tracker{
+		engine: engine,
+		store:  store,
+		cfg:    cfg,
+		dead:   &deadLetters{path: cfg.DeadLetterPath},
+		diff:   NewDiffer(),
+		queue:  make(chan []models.AlarmEvent, queueSize),
+	}
+	for i, wc := range cfg.Webhooks {
+		wh, err := newWebhook(wc, i, t.dead)
+		if err != nil {
+			return nil, err
+		}
+		t.webhooks = append(t.webhooks, wh)
+	}
+	if store != nil {
+		if err := t.restore(); err != nil {
+			return nil, err
+		}
+	}
+	engine.OnAlarms(t.observe)
+	return t, nil
+}
+
+// restore rebuilds the active alarms from the latest open event of each.
+func (t *Tracker) restore() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	events, err := t.store.OpenAlarmEvents(ctx)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	restored := 0
+	for _, ev := range events { // newest first
+		key := alarmKey(&ev.Alarm)
+		if seen[ev.Provider+"\x00"+key] {
+			continue
+		}
+		seen[ev.Provider+"\x00"+key] = true
+		t.diff.restore(ev.Provider, ev.Alarm)
+		restored++
+	}
+	if restored > 0 {
+		log.Info().Int("alarms", restored).Msg("Restored active alarms")
+	}
+	return nil
+}
+
+// Start starts delivering events and, with a poll interval, polling the alarm
+// lists, until Stop is called or ctx is done.
+func (t *Tracker) Start(ctx context.Context) {
+	ctx, t.cancel = context.WithCancel(ctx)
+	for _, wh := range t.webhooks {
+		t.done.Add(1)
+		go func(wh *webhook) {
+			defer t.done.Done()
+			wh.run(ctx)
+		}(wh)
+	}
+	t.done.Add(1)
+	go t.deliver()
+	if t.cfg.PollIntervalSeconds > 0 {
+		t.done.Add(1)
+		go t.poll(ctx, time.Duration(t.cfg.PollIntervalSeconds)*time.Second)
+	}
+}
+
+// Stop stops polling, stores the events detected so far and stops the
+// webhooks. Events still waiting for a webhook are dead-lettered.
+func (t *Tracker) Stop() {
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return
+	}
+	t.stopped = true
+	close(t.queue)
+	t.mu.Unlock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.done.Wait()
+}
+
+func (t *Tracker) poll(ctx context.Context, interval time.Duration) {
+	defer t.done.Done()
+	log.Info().Dur("interval", interval).Int("webhooks", len(t.webhooks)).Msg("Alarm tracker started")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Instances that fail are left as they were; only lists fetched
+		// successfully reach observe.
+		if _, _, err := t.engine.GetAllAlarms(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Msg("Alarm tracker failed to get alarms")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver stores the detected events and hands them to the webhooks.
+func (t *Tracker) deliver() {
+	defer t.done.Done()
+	defer func() {
+		for _, wh := range t.webhooks {
+			close(wh.queue)
+		}
+	}()
+	for events := range t.queue {
+		if t.store != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := t.store.SaveAlarmEvents(ctx, events); err != nil {
+				log.Error().Err(err).Int("events", len(events)).Msg("Failed to store alarm events")
+			}
+			cancel()
+		}
+		for _, wh := range t.webhooks {
+			for _, ev := range events {
+				wh.enqueue(ev)
+			}
+		}
+	}
+}
+
+// Events returns the recorded events matching q, newest first.
+func (t *Tracker) Events(ctx context.Context, q storage.AlarmEventQuery) ([]models.AlarmEvent, error) {
+	if t.store != nil {
+		return t.store.AlarmEvents(ctx, q)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var events []models.AlarmEvent
+	for i := len(t.history) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(events) == q.Limit {
+			break
+		}
+		if q.Matches(&t.history[i]) {
+			events = append(events, t.history[i])
+		}
+	}
+	return events, nil
+}
+
+// EventHook observes the events a tracker detects. It runs synchronously
+// and must not block; the events are shared and must not be modified.
+type EventHook func(events []models.AlarmEvent)
+
+// OnEvents registers fn to be called with the events detected in every
+// alarm list.
+func (t *Tracker) OnEvents(fn EventHook) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.watchers = append(t.watchers, fn)
+}
+
+// observe records the differences between an alarm list and the alarms seen
+// before.
+func (t *Tracker) observe(snapshot normalizer.AlarmSnapshot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	events := t.diff.Diff(snapshot, time.Now().UTC())
+	if len(events) == 0 {
+		return
+	}
+
+	for _, ev := range events {
+		log.Info().Str("event", string(ev.Type)).Str("provider", ev.Provider).Str("device_id", ev.DeviceID).
+			Str("code", ev.Code).Str("severity", string(ev.Alarm.Severity)).Msg("Alarm " + string(ev.Type))
+	}
+	for _, fn := range t.watchers {
+		fn(events)
+	}
+
+	if t.store == nil {
+		t.history = append(t.history, events...)
+		if over := len(t.history) - t.cfg.HistorySize; over > 0 {
+			t.history = append(t.history[:0:0], t.history[over:]...)
+		}
+	}
+	select {
+	case t.queue <- events:
+	default:
+		log.Error().Int("events", len(events)).Msg("Alarm event queue full, dropping events")
+	}
+}
+
+// alarmKey identifies an alarm within its provider instance.
+func alarmKey(a *models.NormalizedAlarm) string {
+	return a.DeviceID + "\x00" + a.Code
+}
+
+// changes lists the fields of an active alarm that differ between two lists.
+func changes(prev, cur *models.NormalizedAlarm) []string {
+	var changed []string
+	if prev.Severity != cur.Severity {
+		changed = append(changed, "severity")
+	}
+	if prev.Status != cur.Status {
+		changed = append(changed, "status")
+	}
+	if prev.Name != cur.Name {
+		changed = append(changed, "name")
+	}
+	if prev.Message != cur.Message {
+		changed = append(changed, "message")
+	}
+	if !prev.StartTime.Equal(cur.StartTime) {
+		changed = append(changed, "startTime")
+	}
+	return changed
+}
+
+func newEvent(typ models.AlarmEventType, instance string, a models.NormalizedAlarm, now time.Time) models.AlarmEvent {
+	return models.AlarmEvent{
+		ID:       newEventID(),
+		Type:     typ,
+		Time:     now,
+		Provider: instance,
+		DeviceID: a.DeviceID,
+		PlantID:  a.PlantID,
+		Code:     a.Code,
+		Alarm:    a,
+	}
+}
+
+func newEventID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return "evt_" + hex.EncodeToString(b[:])
+}
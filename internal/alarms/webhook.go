@@ -0,0 +1,251 @@
+package alarms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// webhookQueueSize bounds the events waiting for one webhook; beyond it
+	// new events are dead-lettered.
+	webhookQueueSize = 1024
+
+	webhookMaxBackoff = 5 * time.Minute
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Alarm-Event"     // event type
+	HeaderDelivery  = "X-Alarm-Delivery"  // event ID, the same on every attempt
+	HeaderTimestamp = "X-Alarm-Timestamp" // Unix seconds the delivery was signed at
+	HeaderSignature = "X-Alarm-Signature" // "sha256=" + hex HMAC, with a secret
+)
+
+// WebhookConfig is an endpoint alarm events are POSTed to, one JSON event per
+// request.
+type WebhookConfig struct {
+	Name string `yaml:"name"` // used in logs (default the URL)
+	URL  string `yaml:"url"`
+
+	// With a secret, every request is signed with HMAC-SHA256 over
+	// "<timestamp>.<body>", where timestamp is the X-Alarm-Timestamp header.
+	Secret string `yaml:"secret"`
+
+	// Event types to send: raised, updated, cleared (default all).
+	Events []string `yaml:"events"`
+
+	Headers map[string]string `yaml:"headers"` // extra request headers
+
+	// A delivery is attempted up to max_attempts times (default 5), backing
+	// off exponentially from 1s, on network errors, 408, 429 and 5xx
+	// responses. Other responses are not retried.
+	MaxAttempts    int `yaml:"max_attempts"`
+	TimeoutSeconds int `yaml:"timeout_seconds"` // per attempt (default 10)
+}
+
+// webhook delivers events to one endpoint in the order they were detected.
+type webhook struct {
+	cfg    WebhookConfig
+	name   string
+	types  map[models.AlarmEventType]bool // nil sends every type
+	client *http.Client
+	dead   *deadLetters
+	queue  chan models.AlarmEvent
+}
+
+func newWebhook(cfg WebhookConfig, index int, dead *deadLetters) (*webhook, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("alarms.webhooks[%d]: url is required", index)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = 10
+	}
+	wh := &webhook{
+		cfg:    cfg,
+		name:   cfg.Name,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		dead:   dead,
+		queue:  make(chan models.AlarmEvent, webhookQueueSize),
+	}
+	if wh.name == "" {
+		wh.name = cfg.URL
+	}
+	if len(cfg.Events) > 0 {
+		wh.types = make(map[models.AlarmEventType]bool, len(cfg.Events))
+		for _, typ := range cfg.Events {
+			switch t := models.AlarmEventType(typ); t {
+			case models.AlarmEventRaised, models.AlarmEventUpdated, models.AlarmEventCleared:
+				wh.types[t] = true
+			default:
+				return nil, fmt.Errorf("alarms.webhooks[%d]: unknown event type %q (want raised, updated or cleared)", index, typ)
+			}
+		}
+	}
+	return wh, nil
+}
+
+func (wh *webhook) enqueue(ev models.AlarmEvent) {
+	if wh.types != nil && !wh.types[ev.Type] {
+		return
+	}
+	select {
+	case wh.queue <- ev:
+	default:
+		wh.dead.add(wh.name, ev, "queue full")
+	}
+}
+
+// run delivers queued events until the queue is closed. Once ctx is done the
+// remaining events are dead-lettered.
+func (wh *webhook) run(ctx context.Context) {
+	for ev := range wh.queue {
+		if ctx.Err() != nil {
+			wh.dead.add(wh.name, ev, "shutting down")
+			continue
+		}
+		if err := wh.deliver(ctx, ev); err != nil {
+			wh.dead.add(wh.name, ev, err.Error())
+		}
+	}
+}
+
+// deliver posts ev, retrying transient failures.
+func (wh *webhook) deliver(ctx context.Context, ev models.AlarmEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		retry, err := wh.post(ctx, ev, body)
+		if err == nil {
+			log.Debug().Str("webhook", wh.name).Str("event_id", ev.ID).Msg("Alarm event delivered")
+			return nil
+		}
+		if !retry || attempt >= wh.cfg.MaxAttempts {
+			return fmt.Errorf("attempt %d: %w", attempt, err)
+		}
+		log.Warn().Err(err).Str("webhook", wh.name).Str("event_id", ev.ID).Int("attempt", attempt).
+			Dur("backoff", backoff).Msg("Alarm webhook delivery failed, retrying")
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("attempt %d: %w (shutting down)", attempt, err)
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, webhookMaxBackoff)
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (wh *webhook) post(ctx context.Context, ev models.AlarmEvent, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range wh.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(ev.Type))
+	req.Header.Set(HeaderDelivery, ev.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if wh.cfg.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(wh.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500
+	return retry, fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// Sign returns the X-Alarm-Signature value for a delivery: the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with secret, prefixed with "sha256=".
+// Receivers recompute it to check a delivery is genuine, and reject old
+// timestamps to prevent replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deadLetters records events a webhook gave up on.
+type deadLetters struct {
+	path string // optional JSON lines file
+
+	mu sync.Mutex
+}
+
+type deadLetter struct {
+	Webhook string            `json:"webhook"`
+	Reason  string            `json:"reason"`
+	Time    time.Time         `json:"time"`
+	Event   models.AlarmEvent `json:"event"`
+}
+
+func (d *deadLetters) add(webhook string, ev models.AlarmEvent, reason string) {
+	log.Error().Str("webhook", webhook).Str("event_id", ev.ID).Str("event", string(ev.Type)).
+		Str("device_id", ev.DeviceID).Str("code", ev.Code).Str("reason", reason).
+		Msg("Alarm event not delivered to webhook")
+	if d.path == "" {
+		return
+	}
+
+	line, err := json.Marshal(deadLetter{Webhook: webhook, Reason: reason, Time: time.Now().UTC(), Event: ev})
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := appendLine(d.path, line); err != nil {
+		log.Error().Err(err).Str("path", d.path).Msg("Failed to write alarm dead letter")
+	}
+}
+
+func appendLine(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,28 +1,41 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
 	"github.com/rs/zerolog/log"
 )
 
 // --- Response helpers ---
 
 type apiResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-	Meta    *apiMeta    `json:"meta,omitempty"`
+	Success  bool        `json:"success"`
+	Data     interface{} `json:"data,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Code     string      `json:"code,omitempty"`     // machine-readable error code
+	Provider string      `json:"provider,omitempty"` // provider instance that failed
+	Meta     *apiMeta    `json:"meta,omitempty"`
 }
 
 type apiMeta struct {
 	Total     int    `json:"total,omitempty"`
 	Timestamp string `json:"timestamp"`
+
+	// Fan-out endpoints report how each provider instance fared.
+	Partial bool                      `json:"partial,omitempty"`
+	Sources []normalizer.SourceStatus `json:"sources,omitempty"`
 }
 
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
@@ -44,10 +57,68 @@ func writeSuccess(w http.ResponseWriter, data interface{}, total int) {
 	})
 }
 
-func writeError(w http.ResponseWriter, status int, msg string) {
+// writeAggregated writes the result of a fan-out query along with the
+// per-provider sources. Unless the client asked for ?strict=true, a failed
+// provider only marks the response as partial.
+func writeAggregated(w http.ResponseWriter, r *http.Request, data interface{}, total int, sources []normalizer.SourceStatus) {
+	failed, partial := normalizer.FirstFailure(sources)
+	if strict, _ := strconv.ParseBool(r.URL.Query().Get("strict")); partial && strict {
+		writeError(w, failed.Err(), "Provider "+failed.Provider+" failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResponse{
+		Success: true,
+		Data:    data,
+		Meta: &apiMeta{
+			Total:     total,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Partial:   partial,
+			Sources:   sources,
+		},
+	})
+}
+
+// writeError maps err onto an HTTP status and machine-readable code and
+// reports the provider instance involved. Provider errors are described by
+// kind, operation and vendor code only, and unclassified errors become a 500
+// with the generic fallback message, so internal details are not leaked;
+// callers log the full error.
+func writeError(w http.ResponseWriter, err error, fallback string) {
+	status, code, msg := http.StatusInternalServerError, "internal_error", fallback
+	switch {
+	case errors.Is(err, normalizer.ErrProviderNotFound):
+		status, code, msg = http.StatusNotFound, "provider_not_found", err.Error()
+	case errors.Is(err, normalizer.ErrInvalidID):
+		status, code, msg = http.StatusBadRequest, "invalid_id", err.Error()
+	case errors.Is(err, provider.ErrAuth):
+		status, code, msg = http.StatusUnauthorized, provider.ErrorCode(err), provider.PublicMessage(err)
+	case errors.Is(err, provider.ErrNotFound):
+		status, code, msg = http.StatusNotFound, provider.ErrorCode(err), provider.PublicMessage(err)
+	case errors.Is(err, provider.ErrRateLimited):
+		status, code, msg = http.StatusTooManyRequests, provider.ErrorCode(err), provider.PublicMessage(err)
+	case errors.Is(err, provider.ErrUpstreamUnavailable), errors.Is(err, provider.ErrVendor):
+		status, code, msg = http.StatusBadGateway, provider.ErrorCode(err), provider.PublicMessage(err)
+	case errors.Is(err, provider.ErrNotSupported):
+		status, code, msg = http.StatusNotImplemented, provider.ErrorCode(err), provider.PublicMessage(err)
+	case errors.Is(err, provider.ErrCircuitOpen):
+		status, code, msg = http.StatusServiceUnavailable, provider.ErrorCode(err), provider.PublicMessage(err)
+	case errors.Is(err, provider.ErrInvalidRequest):
+		status, code, msg = http.StatusBadRequest, provider.ErrorCode(err), provider.PublicMessage(err)
+	}
 	writeJSON(w, status, apiResponse{
+		Success:  false,
+		Error:    msg,
+		Code:     code,
+		Provider: provider.InstanceOf(err),
+	})
+}
+
+// writeBadRequest rejects a request that failed parameter validation.
+func writeBadRequest(w http.ResponseWriter, msg string) {
+	writeJSON(w, http.StatusBadRequest, apiResponse{
 		Success: false,
 		Error:   msg,
+		Code:    "bad_request",
 	})
 }
 
@@ -57,7 +128,7 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	health := s.engine.HealthCheck(r.Context())
 	allHealthy := true
 	for _, h := range health {
-		if !h {
+		if !h.Healthy {
 			allHealthy = false
 			break
 		}
@@ -77,33 +148,33 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 // handleGetPlants returns all plants across all providers.
 func (s *Server) handleGetPlants(w http.ResponseWriter, r *http.Request) {
-	plants, err := s.engine.GetAllPlants(r.Context())
+	plants, sources, err := s.engine.GetAllPlants(r.Context())
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get plants")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve plants")
+		writeError(w, err, "Failed to retrieve plants")
 		return
 	}
-	writeSuccess(w, plants, len(plants))
+	writeAggregated(w, r, plants, len(plants), sources)
 }
 
 // handleGetPlantDetails returns details for a specific plant.
 func (s *Server) handleGetPlantDetails(w http.ResponseWriter, r *http.Request) {
 	plantID := chi.URLParam(r, "plantId")
 	if plantID == "" {
-		writeError(w, http.StatusBadRequest, "Plant ID is required")
+		writeBadRequest(w, "Plant ID is required")
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		writeError(w, http.StatusBadRequest, "Query parameter 'provider' is required (e.g. ?provider=saj)")
+	target, err := s.resolveID(r, plantID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
 		return
 	}
 
-	plant, err := s.engine.GetPlantDetails(r.Context(), provider, plantID)
+	plant, err := s.engine.GetPlantDetails(r.Context(), target.Instance, target.RawID)
 	if err != nil {
-		log.Error().Err(err).Str("plant_id", plantID).Str("provider", provider).Msg("Failed to get plant details")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve plant details")
+		log.Error().Err(err).Str("plant_id", plantID).Str("provider", target.Instance).Msg("Failed to get plant details")
+		writeError(w, err, "Failed to retrieve plant details")
 		return
 	}
 	writeSuccess(w, plant, 1)
@@ -113,20 +184,20 @@ func (s *Server) handleGetPlantDetails(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleGetPlantDevices(w http.ResponseWriter, r *http.Request) {
 	plantID := chi.URLParam(r, "plantId")
 	if plantID == "" {
-		writeError(w, http.StatusBadRequest, "Plant ID is required")
+		writeBadRequest(w, "Plant ID is required")
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		writeError(w, http.StatusBadRequest, "Query parameter 'provider' is required")
+	target, err := s.resolveID(r, plantID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
 		return
 	}
 
-	devices, err := s.engine.GetDevices(r.Context(), provider, plantID)
+	devices, err := s.engine.GetDevices(r.Context(), target.Instance, target.RawID)
 	if err != nil {
-		log.Error().Err(err).Str("plant_id", plantID).Str("provider", provider).Msg("Failed to get devices")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve devices")
+		log.Error().Err(err).Str("plant_id", plantID).Str("provider", target.Instance).Msg("Failed to get devices")
+		writeError(w, err, "Failed to retrieve devices")
 		return
 	}
 	writeSuccess(w, devices, len(devices))
@@ -136,13 +207,13 @@ func (s *Server) handleGetPlantDevices(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleGetPlantEnergy(w http.ResponseWriter, r *http.Request) {
 	plantID := chi.URLParam(r, "plantId")
 	if plantID == "" {
-		writeError(w, http.StatusBadRequest, "Plant ID is required")
+		writeBadRequest(w, "Plant ID is required")
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		writeError(w, http.StatusBadRequest, "Query parameter 'provider' is required")
+	target, err := s.resolveID(r, plantID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
 		return
 	}
 
@@ -156,10 +227,10 @@ func (s *Server) handleGetPlantEnergy(w http.ResponseWriter, r *http.Request) {
 		date = time.Now().UTC().Format("2006-01-02")
 	}
 
-	energy, err := s.engine.GetEnergyStats(r.Context(), provider, plantID, period, date)
+	energy, err := s.engine.GetEnergyStats(r.Context(), target.Instance, target.RawID, period, date)
 	if err != nil {
-		log.Error().Err(err).Str("plant_id", plantID).Str("provider", provider).Msg("Failed to get energy stats")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve energy statistics")
+		log.Error().Err(err).Str("plant_id", plantID).Str("provider", target.Instance).Msg("Failed to get energy stats")
+		writeError(w, err, "Failed to retrieve energy statistics")
 		return
 	}
 	writeSuccess(w, energy, 1)
@@ -167,49 +238,84 @@ func (s *Server) handleGetPlantEnergy(w http.ResponseWriter, r *http.Request) {
 
 // handleGetDevices returns all devices across all providers.
 func (s *Server) handleGetDevices(w http.ResponseWriter, r *http.Request) {
-	devices, err := s.engine.GetAllDevices(r.Context())
+	devices, sources, err := s.engine.GetAllDevices(r.Context())
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get all devices")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve devices")
+		writeError(w, err, "Failed to retrieve devices")
 		return
 	}
-	writeSuccess(w, devices, len(devices))
+	writeAggregated(w, r, devices, len(devices), sources)
 }
 
-// handleGetRealTimeData returns real-time data for a specific device.
+// handleGetDeviceDetails returns details for a specific device.
+func (s *Server) handleGetDeviceDetails(w http.ResponseWriter, r *http.Request) {
+	deviceID := chi.URLParam(r, "deviceId")
+	if deviceID == "" {
+		writeBadRequest(w, "Device ID is required")
+		return
+	}
+
+	target, err := s.resolveID(r, deviceID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
+		return
+	}
+
+	device, err := s.engine.GetDeviceDetails(r.Context(), target.Instance, target.RawID)
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Str("provider", target.Instance).Msg("Failed to get device details")
+		writeError(w, err, "Failed to retrieve device details")
+		return
+	}
+	writeSuccess(w, device, 1)
+}
+
+// handleGetRealTimeData returns real-time data for a specific device. A fresh
+// snapshot from the collector's store is served without calling the vendor
+// unless the client sent "Cache-Control: no-cache".
 func (s *Server) handleGetRealTimeData(w http.ResponseWriter, r *http.Request) {
 	deviceID := chi.URLParam(r, "deviceId")
 	if deviceID == "" {
-		writeError(w, http.StatusBadRequest, "Device ID is required")
+		writeBadRequest(w, "Device ID is required")
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		writeError(w, http.StatusBadRequest, "Query parameter 'provider' is required")
+	target, err := s.resolveID(r, deviceID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
 		return
 	}
 
-	data, err := s.engine.GetRealTimeData(r.Context(), provider, deviceID)
+	if s.store != nil && !normalizer.CacheBypassed(r.Context()) {
+		stored, err := s.store.LatestRealtime(r.Context(), normalizer.FormatID(target.Instance, target.RawID))
+		if err == nil && time.Since(stored.Meta.FetchedAt) <= s.storeMaxAge {
+			writeSuccess(w, stored, 1)
+			return
+		}
+	}
+
+	data, err := s.engine.GetRealTimeData(r.Context(), target.Instance, target.RawID)
 	if err != nil {
-		log.Error().Err(err).Str("device_id", deviceID).Str("provider", provider).Msg("Failed to get real-time data")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve real-time data")
+		log.Error().Err(err).Str("device_id", deviceID).Str("provider", target.Instance).Msg("Failed to get real-time data")
+		writeError(w, err, "Failed to retrieve real-time data")
 		return
 	}
 	writeSuccess(w, data, 1)
 }
 
 // handleGetHistoricalData returns historical time-series data for a device.
+// With ?source=store it is built from the snapshots stored by the collector
+// instead of the vendor's history API.
 func (s *Server) handleGetHistoricalData(w http.ResponseWriter, r *http.Request) {
 	deviceID := chi.URLParam(r, "deviceId")
 	if deviceID == "" {
-		writeError(w, http.StatusBadRequest, "Device ID is required")
+		writeBadRequest(w, "Device ID is required")
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		writeError(w, http.StatusBadRequest, "Query parameter 'provider' is required")
+	target, err := s.resolveID(r, deviceID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
 		return
 	}
 
@@ -245,7 +351,7 @@ func (s *Server) handleGetHistoricalData(w http.ResponseWriter, r *http.Request)
 	}
 
 	req := models.HistoryRequest{
-		DeviceID:    deviceID,
+		DeviceID:    target.RawID,
 		Granularity: models.Granularity(granularity),
 		StartTime:   startTime,
 		EndTime:     endTime,
@@ -258,61 +364,204 @@ func (s *Server) handleGetHistoricalData(w http.ResponseWriter, r *http.Request)
 		req.Metrics = splitCSV(metrics)
 	}
 
-	resp, err := s.engine.GetHistoricalData(r.Context(), provider, req)
+	if r.URL.Query().Get("source") == "store" {
+		s.writeStoredHistory(w, r, target, req)
+		return
+	}
+
+	resp, err := s.engine.GetHistoricalData(r.Context(), target.Instance, req)
 	if err != nil {
-		log.Error().Err(err).Str("device_id", deviceID).Str("provider", provider).Msg("Failed to get historical data")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve historical data")
+		log.Error().Err(err).Str("device_id", deviceID).Str("provider", target.Instance).Msg("Failed to get historical data")
+		writeError(w, err, "Failed to retrieve historical data")
 		return
 	}
 	writeSuccess(w, resp, resp.TotalPoints)
 }
 
+// writeStoredHistory answers a history request from storage: vendor history
+// stored at the requested granularity, plus the collector's realtime snapshots
+// for minute granularity.
+func (s *Server) writeStoredHistory(w http.ResponseWriter, r *http.Request, target normalizer.ResolvedID, req models.HistoryRequest) {
+	if s.store == nil {
+		writeBadRequest(w, "Storage is not enabled; source=store is unavailable")
+		return
+	}
+	start, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		writeBadRequest(w, "Invalid start time, expected RFC 3339")
+		return
+	}
+	end, err := time.Parse(time.RFC3339, req.EndTime)
+	if err != nil {
+		writeBadRequest(w, "Invalid end time, expected RFC 3339")
+		return
+	}
+
+	deviceID := normalizer.FormatID(target.Instance, target.RawID)
+	points, err := s.store.TimeSeriesRange(r.Context(), deviceID, req.Granularity, start, end)
+	if err == nil && req.Granularity == models.GranularityMinute {
+		var snaps []models.NormalizedRealtime
+		snaps, err = s.store.RealtimeRange(r.Context(), deviceID, start, end)
+		points = mergeSnapshots(points, snaps)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("device_id", deviceID).Msg("Failed to read stored history")
+		writeError(w, err, "Failed to retrieve historical data")
+		return
+	}
+
+	resp := &models.HistoryResponse{
+		DeviceID:    deviceID,
+		Provider:    target.Type,
+		Granularity: req.Granularity,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+		TotalPoints: len(points),
+		DataPoints:  []models.NormalizedTimeSeries{},
+	}
+	if from := (req.Page - 1) * req.PageSize; from < len(points) {
+		to := from + req.PageSize
+		if to > len(points) {
+			to = len(points)
+		}
+		resp.DataPoints = points[from:to]
+	}
+	writeSuccess(w, resp, resp.TotalPoints)
+}
+
+// mergeSnapshots adds realtime snapshots to stored minute points, in time
+// order. Vendor points win where both exist for the same timestamp.
+func mergeSnapshots(points []models.NormalizedTimeSeries, snaps []models.NormalizedRealtime) []models.NormalizedTimeSeries {
+	if len(snaps) == 0 {
+		return points
+	}
+	seen := make(map[int64]bool, len(points))
+	for _, dp := range points {
+		seen[dp.Timestamp.UnixMilli()] = true
+	}
+	for i := range snaps {
+		if !seen[snaps[i].Timestamp.UnixMilli()] {
+			points = append(points, normalizer.RealtimeToTimeSeries(&snaps[i]))
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	return points
+}
+
 // handleGetDeviceAlarms returns alarms for a specific device.
 func (s *Server) handleGetDeviceAlarms(w http.ResponseWriter, r *http.Request) {
 	deviceID := chi.URLParam(r, "deviceId")
 	if deviceID == "" {
-		writeError(w, http.StatusBadRequest, "Device ID is required")
+		writeBadRequest(w, "Device ID is required")
 		return
 	}
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		writeError(w, http.StatusBadRequest, "Query parameter 'provider' is required")
+	target, err := s.resolveID(r, deviceID)
+	if err != nil {
+		writeError(w, err, "Invalid ID")
 		return
 	}
 
-	alarms, err := s.engine.GetDeviceAlarms(r.Context(), provider, deviceID)
+	alarms, err := s.engine.GetDeviceAlarms(r.Context(), target.Instance, target.RawID)
 	if err != nil {
-		log.Error().Err(err).Str("device_id", deviceID).Str("provider", provider).Msg("Failed to get device alarms")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve device alarms")
+		log.Error().Err(err).Str("device_id", deviceID).Str("provider", target.Instance).Msg("Failed to get device alarms")
+		writeError(w, err, "Failed to retrieve device alarms")
 		return
 	}
+	s.saveAlarms(r, alarms)
+	alarms = filterAlarms(r, alarms)
 	writeSuccess(w, alarms, len(alarms))
 }
 
-// handleGetAllAlarms returns all alarms across all providers.
+// handleGetAllAlarms returns all alarms across all providers, optionally
+// filtered by ?severity=, ?category= and ?code= (normalized code).
 func (s *Server) handleGetAllAlarms(w http.ResponseWriter, r *http.Request) {
-	alarms, err := s.engine.GetAllAlarms(r.Context())
+	alarms, sources, err := s.engine.GetAllAlarms(r.Context())
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get all alarms")
-		writeError(w, http.StatusInternalServerError, "Failed to retrieve alarms")
+		writeError(w, err, "Failed to retrieve alarms")
 		return
 	}
-	writeSuccess(w, alarms, len(alarms))
+	s.saveAlarms(r, alarms)
+	alarms = filterAlarms(r, alarms)
+	writeAggregated(w, r, alarms, len(alarms), sources)
+}
+
+// handleGetAlarmCatalogue returns the normalized alarm codes alarms are
+// classified into, with their category and recommended action.
+func (s *Server) handleGetAlarmCatalogue(w http.ResponseWriter, r *http.Request) {
+	codes := normalizer.AlarmCatalogue()
+	writeSuccess(w, codes, len(codes))
+}
+
+// handleGetAlarmEvents returns the alarm lifecycle events recorded by the
+// alarm tracker, newest first. Filters: provider, device, plant, type, from
+// and to (RFC 3339), limit (default 100, at most 1000).
+func (s *Server) handleGetAlarmEvents(w http.ResponseWriter, r *http.Request) {
+	if s.alarms == nil {
+		writeBadRequest(w, "Alarm tracking is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	q := storage.AlarmEventQuery{
+		Provider: query.Get("provider"),
+		DeviceID: query.Get("device"),
+		PlantID:  query.Get("plant"),
+		Type:     models.AlarmEventType(query.Get("type")),
+		Limit:    100,
+	}
+	switch q.Type {
+	case "", models.AlarmEventRaised, models.AlarmEventUpdated, models.AlarmEventCleared:
+	default:
+		writeBadRequest(w, "Invalid type: want raised, updated or cleared")
+		return
+	}
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if v := query.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeBadRequest(w, "Invalid "+param.name+": want an RFC 3339 time")
+				return
+			}
+			*param.dst = t
+		}
+	}
+	if l := query.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			writeBadRequest(w, "Invalid limit: want 1 to 1000")
+			return
+		}
+		q.Limit = parsed
+	}
+
+	events, err := s.alarms.Events(r.Context(), q)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get alarm events")
+		writeError(w, err, "Failed to retrieve alarm events")
+		return
+	}
+	writeSuccess(w, events, len(events))
 }
 
-// handleGetProviders returns list of registered providers and their health.
+// handleGetProviders returns the registered provider instances with their type,
+// health, circuit breaker state and capability matrix.
 func (s *Server) handleGetProviders(w http.ResponseWriter, r *http.Request) {
 	health := s.engine.HealthCheck(r.Context())
 	type providerInfo struct {
-		Name    string `json:"name"`
-		Healthy bool   `json:"healthy"`
+		normalizer.ProviderInfo
+		normalizer.ProviderHealth
 	}
-	providers := make([]providerInfo, 0, len(health))
-	for name, healthy := range health {
+	instances := s.engine.Providers()
+	providers := make([]providerInfo, 0, len(instances))
+	for _, inst := range instances {
 		providers = append(providers, providerInfo{
-			Name:    name,
-			Healthy: healthy,
+			ProviderInfo:   inst,
+			ProviderHealth: health[inst.Name],
 		})
 	}
 	writeSuccess(w, providers, len(providers))
@@ -320,6 +569,80 @@ func (s *Server) handleGetProviders(w http.ResponseWriter, r *http.Request) {
 
 // --- Helpers ---
 
+// saveAlarms keeps alarms returned by a vendor so they outlive the vendor's
+// own retention.
+func (s *Server) saveAlarms(r *http.Request, alarms []models.NormalizedAlarm) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.SaveAlarms(r.Context(), alarms); err != nil {
+		log.Error().Err(err).Msg("Failed to store alarms")
+	}
+}
+
+// saveHistory keeps history fetched from a vendor so it outlives the vendor's
+// own retention. It runs as an engine hook, which must not block, so the
+// write happens on its own goroutine.
+func (s *Server) saveHistory(history *models.HistoryResponse) {
+	if len(history.DataPoints) == 0 {
+		return
+	}
+	go func(points []models.NormalizedTimeSeries) {
+		if err := s.store.SaveTimeSeries(context.Background(), points); err != nil {
+			log.Error().Err(err).Str("device_id", history.DeviceID).Msg("Failed to store historical data")
+		}
+	}(history.DataPoints)
+}
+
+// filterAlarms keeps the alarms matching the severity, category and code
+// (normalized code) query parameters; each takes a comma-separated list.
+func filterAlarms(r *http.Request, alarms []models.NormalizedAlarm) []models.NormalizedAlarm {
+	query := r.URL.Query()
+	severities := toSet(splitCSV(query.Get("severity")))
+	categories := toSet(splitCSV(query.Get("category")))
+	codes := toSet(splitCSV(query.Get("code")))
+	if len(severities) == 0 && len(categories) == 0 && len(codes) == 0 {
+		return alarms
+	}
+
+	filtered := make([]models.NormalizedAlarm, 0, len(alarms))
+	for _, a := range alarms {
+		if (len(severities) == 0 || severities[string(a.Severity)]) &&
+			(len(categories) == 0 || categories[string(a.Category)]) &&
+			(len(codes) == 0 || codes[a.NormalizedCode]) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// resolveID maps an ID from the request path to its provider instance and raw
+// vendor ID. Normalized IDs as returned by the API ("<instance>_<rawId>") are
+// resolved by the engine; the legacy form of a raw vendor ID together with
+// ?provider=<instance> is still accepted.
+func (s *Server) resolveID(r *http.Request, id string) (normalizer.ResolvedID, error) {
+	instance := r.URL.Query().Get("provider")
+	if instance == "" {
+		return s.engine.ResolveID(id)
+	}
+	if resolved, err := s.engine.ResolveID(id); err == nil && resolved.Instance == instance {
+		return resolved, nil
+	}
+	p, ok := s.engine.GetProvider(instance)
+	if !ok {
+		return normalizer.ResolvedID{}, fmt.Errorf("%w: %q", normalizer.ErrProviderNotFound, instance)
+	}
+	return normalizer.ResolvedID{Instance: instance, Type: p.Name(), RawID: id}, nil
+}
+
 func splitCSV(s string) []string {
 	var result []string
 	current := ""
@@ -6,7 +6,10 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/alarms"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/metrics"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
 	"github.com/rs/zerolog/log"
 )
 
@@ -15,6 +18,14 @@ type Server struct {
 	engine *normalizer.Engine
 	router chi.Router
 	addr   string
+	hub    *hub
+
+	// Snapshot store filled by the background collector, if enabled.
+	store       storage.Store
+	storeMaxAge time.Duration
+
+	metrics *metrics.Metrics
+	alarms  *alarms.Tracker
 }
 
 // NewServer creates a new API server.
@@ -22,11 +33,34 @@ func NewServer(engine *normalizer.Engine, addr string) *Server {
 	s := &Server{
 		engine: engine,
 		addr:   addr,
+		hub:    newHub(engine),
 	}
 	s.setupRoutes()
 	return s
 }
 
+// SetStore lets the realtime and history endpoints answer from store.
+// Realtime snapshots older than maxAge are fetched from the vendor instead.
+// History fetched from a vendor is kept in store.
+func (s *Server) SetStore(store storage.Store, maxAge time.Duration) {
+	s.store = store
+	s.storeMaxAge = maxAge
+	s.engine.OnHistory(s.saveHistory)
+}
+
+// SetMetrics records every API request in m and serves m at path.
+func (s *Server) SetMetrics(m *metrics.Metrics, path string) {
+	s.metrics = m
+	s.router.Method(http.MethodGet, path, m.Handler())
+}
+
+// SetAlarmTracker serves the events recorded by t at /api/v1/alarms/events
+// and streams them.
+func (s *Server) SetAlarmTracker(t *alarms.Tracker) {
+	s.alarms = t
+	s.hub.useTracker(t)
+}
+
 func (s *Server) setupRoutes() {
 	r := chi.NewRouter()
 
@@ -34,32 +68,43 @@ func (s *Server) setupRoutes() {
 	r.Use(chimiddleware.RequestID)
 	r.Use(chimiddleware.RealIP)
 	r.Use(RequestLogger)
+	r.Use(s.instrument)
 	r.Use(chimiddleware.Recoverer)
 	r.Use(CORS)
-	r.Use(chimiddleware.Timeout(60 * time.Second))
-
-	// Health check
-	r.Get("/health", s.handleHealth)
-
-	// API v1
-	r.Route("/api/v1", func(r chi.Router) {
-		// Plants
-		r.Get("/plants", s.handleGetPlants)
-		r.Get("/plants/{plantId}", s.handleGetPlantDetails)
-		r.Get("/plants/{plantId}/devices", s.handleGetPlantDevices)
-		r.Get("/plants/{plantId}/energy", s.handleGetPlantEnergy)
-
-		// Devices
-		r.Get("/devices", s.handleGetDevices)
-		r.Get("/devices/{deviceId}/realtime", s.handleGetRealTimeData)
-		r.Get("/devices/{deviceId}/history", s.handleGetHistoricalData)
-		r.Get("/devices/{deviceId}/alarms", s.handleGetDeviceAlarms)
-
-		// Alarms
-		r.Get("/alarms", s.handleGetAllAlarms)
-
-		// Provider info
-		r.Get("/providers", s.handleGetProviders)
+	r.Use(NoCache)
+
+	// Live stream; long-lived, so outside the request timeout
+	r.Get("/api/v1/stream", s.handleStream)
+
+	r.Group(func(r chi.Router) {
+		r.Use(chimiddleware.Timeout(60 * time.Second))
+
+		// Health check
+		r.Get("/health", s.handleHealth)
+
+		// API v1
+		r.Route("/api/v1", func(r chi.Router) {
+			// Plants
+			r.Get("/plants", s.handleGetPlants)
+			r.Get("/plants/{plantId}", s.handleGetPlantDetails)
+			r.Get("/plants/{plantId}/devices", s.handleGetPlantDevices)
+			r.Get("/plants/{plantId}/energy", s.handleGetPlantEnergy)
+
+			// Devices
+			r.Get("/devices", s.handleGetDevices)
+			r.Get("/devices/{deviceId}", s.handleGetDeviceDetails)
+			r.Get("/devices/{deviceId}/realtime", s.handleGetRealTimeData)
+			r.Get("/devices/{deviceId}/history", s.handleGetHistoricalData)
+			r.Get("/devices/{deviceId}/alarms", s.handleGetDeviceAlarms)
+
+			// Alarms
+			r.Get("/alarms", s.handleGetAllAlarms)
+			r.Get("/alarms/events", s.handleGetAlarmEvents)
+			r.Get("/alarms/catalogue", s.handleGetAlarmCatalogue)
+
+			// Provider info
+			r.Get("/providers", s.handleGetProviders)
+		})
 	})
 
 	s.router = r
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/alarms"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// streamHeartbeat is how often an idle stream gets a comment line, so
+	// proxies keep the connection open and clients notice a dead server.
+	streamHeartbeat = 15 * time.Second
+
+	// streamWriteTimeout bounds a single write to a client; a client that
+	// cannot take an event in this time is disconnected.
+	streamWriteTimeout = 10 * time.Second
+
+	// streamMaxAlarms is how many alarm events a client may leave unread
+	// before it is considered too slow and disconnected.
+	streamMaxAlarms = 256
+)
+
+// hub fans realtime snapshots fetched by the engine and alarm lifecycle
+// events out to the connected stream clients. The events come from the alarm
+// tracker if there is one, so they match its webhooks and event log, or else
+// from the hub's own diff of the alarm lists the engine fetches.
+type hub struct {
+	mu      sync.RWMutex
+	clients map[*streamClient]struct{}
+
+	diff    *alarms.Differ
+	tracked atomic.Bool // events come from the tracker
+}
+
+func newHub(engine *normalizer.Engine) *hub {
+	h := &hub{
+		clients: make(map[*streamClient]struct{}),
+		diff:    alarms.NewDiffer(),
+	}
+	engine.OnRealtime(h.publishRealtime)
+	engine.OnAlarms(h.observeAlarms)
+	return h
+}
+
+// useTracker takes alarm events from t instead of diffing alarm lists.
+func (h *hub) useTracker(t *alarms.Tracker) {
+	h.tracked.Store(true)
+	t.OnEvents(h.publishAlarms)
+}
+
+func (h *hub) add(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+}
+
+func (h *hub) remove(c *streamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+func (h *hub) publishRealtime(rt *models.NormalizedRealtime) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		if c.wantsDevice(rt.DeviceID) {
+			c.pushRealtime(rt)
+		}
+	}
+}
+
+func (h *hub) observeAlarms(snapshot normalizer.AlarmSnapshot) {
+	if h.tracked.Load() {
+		return
+	}
+	if events := h.diff.Diff(snapshot, time.Now().UTC()); len(events) > 0 {
+		h.publishAlarms(events)
+	}
+}
+
+func (h *hub) publishAlarms(events []models.AlarmEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		var wanted []*models.AlarmEvent
+		for i := range events {
+			if ev := &events[i]; c.wantsDevice(ev.DeviceID) || c.plants[ev.PlantID] {
+				wanted = append(wanted, ev)
+			}
+		}
+		if len(wanted) > 0 {
+			c.pushAlarms(wanted)
+		}
+	}
+}
+
+// streamClient is one connected subscriber. Realtime updates are coalesced
+// per device, so a client that reads slowly receives the latest snapshot of
+// each device rather than a growing backlog. Alarm events are queued; a
+// client still holding streamMaxAlarms unread events when more arrive is too
+// slow.
+type streamClient struct {
+	all     bool // no filter: every device
+	devices map[string]bool
+	plants  map[string]bool
+
+	mu       sync.Mutex
+	realtime map[string]*models.NormalizedRealtime // latest unsent snapshot per device
+	order    []string                              // devices in realtime, oldest update first
+	alarms   []*models.AlarmEvent
+	overflow bool
+	notify   chan struct{}
+}
+
+func newStreamClient(devices, plants map[string]bool) *streamClient {
+	return &streamClient{
+		all:      len(devices) == 0 && len(plants) == 0,
+		devices:  devices,
+		plants:   plants,
+		realtime: make(map[string]*models.NormalizedRealtime),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (c *streamClient) wantsDevice(id string) bool {
+	return c.all || c.devices[id]
+}
+
+func (c *streamClient) pushRealtime(rt *models.NormalizedRealtime) {
+	c.mu.Lock()
+	if _, pending := c.realtime[rt.DeviceID]; !pending {
+		c.order = append(c.order, rt.DeviceID)
+	}
+	c.realtime[rt.DeviceID] = rt
+	c.mu.Unlock()
+	c.wake()
+}
+
+// pushAlarms queues the events detected in one alarm list. However many
+// there are, they are queued whole unless the client has not read the
+// previous ones.
+func (c *streamClient) pushAlarms(events []*models.AlarmEvent) {
+	c.mu.Lock()
+	if len(c.alarms) >= streamMaxAlarms {
+		c.overflow = true
+	} else {
+		c.alarms = append(c.alarms, events...)
+	}
+	c.mu.Unlock()
+	c.wake()
+}
+
+func (c *streamClient) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take removes and returns everything pending.
+func (c *streamClient) take() (realtime []*models.NormalizedRealtime, alarms []*models.AlarmEvent, overflow bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range c.order {
+		realtime = append(realtime, c.realtime[id])
+		delete(c.realtime, id)
+	}
+	c.order = c.order[:0]
+	alarms, c.alarms = c.alarms, nil
+	return realtime, alarms, c.overflow
+}
+
+// handleStream streams realtime snapshots and alarm lifecycle events as
+// Server-Sent Events.
+// Clients subscribe with ?devices= and/or ?plants= (comma-separated
+// normalized IDs); without either they receive every device. A plant
+// subscription covers the devices the plant has when the stream starts.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	devices := make(map[string]bool)
+	plants := make(map[string]bool)
+	for _, id := range splitCSV(r.URL.Query().Get("devices")) {
+		if _, err := s.engine.ResolveID(id); err != nil {
+			writeError(w, err, "Invalid device ID")
+			return
+		}
+		devices[id] = true
+	}
+	for _, id := range splitCSV(r.URL.Query().Get("plants")) {
+		target, err := s.engine.ResolveID(id)
+		if err != nil {
+			writeError(w, err, "Invalid plant ID")
+			return
+		}
+		plantDevices, err := s.engine.GetDevices(r.Context(), target.Instance, target.RawID)
+		if err != nil {
+			log.Error().Err(err).Str("plant_id", id).Msg("Failed to resolve plant devices for stream")
+			writeError(w, err, "Failed to retrieve plant devices")
+			return
+		}
+		plants[id] = true
+		for _, dev := range plantDevices {
+			devices[dev.ID] = true
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	client := newStreamClient(devices, plants)
+	s.hub.add(client)
+	defer s.hub.remove(client)
+
+	// Start subscribers off with the latest stored snapshots.
+	if s.store != nil && !client.all {
+		for id := range devices {
+			if rt, err := s.store.LatestRealtime(r.Context(), id); err == nil {
+				client.pushRealtime(rt)
+			}
+		}
+	}
+
+	var seq uint64
+	send := func(event string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		seq++
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", seq, event, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	comment := func(text string) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, ": %s\n\n", text); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := comment("connected"); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := comment("heartbeat"); err != nil {
+				return
+			}
+		case <-client.notify:
+			realtime, events, overflow := client.take()
+			for _, rt := range realtime {
+				if err := send("realtime", rt); err != nil {
+					return
+				}
+			}
+			for _, ev := range events {
+				if err := send("alarm", ev); err != nil {
+					return
+				}
+			}
+			if overflow {
+				log.Warn().Str("remote", r.RemoteAddr).Msg("Stream client too slow, disconnecting")
+				send("error", apiResponse{Success: false, Error: "client too slow, alarm events dropped", Code: "slow_client"})
+				return
+			}
+		}
+	}
+}
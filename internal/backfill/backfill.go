@@ -0,0 +1,250 @@
+// Package backfill pulls historical data from the vendors into storage,
+// split into the windows each vendor serves per call. Progress is
+// checkpointed in the store so an interrupted run resumes where it stopped.
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Options selects what to backfill.
+type Options struct {
+	Devices     []string // normalized device IDs; empty backfills every device
+	From        time.Time
+	To          time.Time // exclusive
+	Granularity models.Granularity
+}
+
+// DeviceReport summarises the backfill of one device.
+type DeviceReport struct {
+	DeviceID string
+	Chunks   int // vendor calls made in this run
+	Skipped  int // chunks already done by an earlier run
+	Points   int
+
+	// Failed spans are left out of the checkpoint and retried by the next
+	// run; empty spans are ones the vendor had no data for.
+	Failed []Failure
+	Empty  []storage.Span
+
+	// Err is set when the device was abandoned before the end of the range.
+	Err error
+}
+
+// Failure is a span that could not be fetched.
+type Failure struct {
+	storage.Span
+	Err error
+}
+
+// Backfiller runs backfills against the engine's provider instances.
+type Backfiller struct {
+	engine  *normalizer.Engine
+	store   storage.Store
+	configs map[string]provider.ProviderConfig
+	budget  float64
+}
+
+// New creates a backfiller. rateBudget is the share of each instance's
+// rate_limit_rps it may use, so a running server keeps the rest.
+func New(engine *normalizer.Engine, store storage.Store, providers []provider.ProviderConfig, rateBudget float64) *Backfiller {
+	configs := make(map[string]provider.ProviderConfig, len(providers))
+	for _, pc := range providers {
+		configs[pc.Name] = pc
+	}
+	return &Backfiller{engine: engine, store: store, configs: configs, budget: rateBudget}
+}
+
+// Run backfills every selected device and returns one report per device,
+// sorted by device ID. Devices of different provider instances are processed
+// in parallel; each instance's devices one after the other.
+func (b *Backfiller) Run(ctx context.Context, opts Options) ([]DeviceReport, error) {
+	if !opts.From.Before(opts.To) {
+		return nil, fmt.Errorf("empty range %s – %s", opts.From.Format(time.RFC3339), opts.To.Format(time.RFC3339))
+	}
+
+	devices := opts.Devices
+	if len(devices) == 0 {
+		all, sources, err := b.engine.GetAllDevices(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list devices: %w", err)
+		}
+		for _, src := range sources {
+			if src.Status != normalizer.SourceOK {
+				log.Warn().Str("provider", src.Provider).Str("error", src.Error).Msg("Backfill could not list devices of provider")
+			}
+		}
+		for _, dev := range all {
+			devices = append(devices, dev.ID)
+		}
+	}
+
+	byInstance := make(map[string][]normalizer.ResolvedID)
+	var reports []DeviceReport
+	for _, id := range devices {
+		target, err := b.engine.ResolveID(id)
+		if err != nil {
+			reports = append(reports, DeviceReport{DeviceID: id, Err: err})
+			continue
+		}
+		byInstance[target.Instance] = append(byInstance[target.Instance], target)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for instance, targets := range byInstance {
+		wg.Add(1)
+		go func(instance string, targets []normalizer.ResolvedID) {
+			defer wg.Done()
+			pace := b.configs[instance].CallInterval(b.budget)
+			for _, target := range targets {
+				r := b.device(ctx, target, opts, pace)
+				mu.Lock()
+				reports = append(reports, r)
+				mu.Unlock()
+				if ctx.Err() != nil {
+					return
+				}
+			}
+		}(instance, targets)
+	}
+	wg.Wait()
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].DeviceID < reports[j].DeviceID })
+	return reports, ctx.Err()
+}
+
+// device backfills one device chunk by chunk, saving the checkpoint after
+// each chunk.
+func (b *Backfiller) device(ctx context.Context, target normalizer.ResolvedID, opts Options, pace time.Duration) DeviceReport {
+	deviceID := normalizer.FormatID(target.Instance, target.RawID)
+	report := DeviceReport{DeviceID: deviceID}
+
+	p, ok := b.engine.GetProvider(target.Instance)
+	if !ok {
+		report.Err = fmt.Errorf("%w: %q", normalizer.ErrProviderNotFound, target.Instance)
+		return report
+	}
+	window := p.Capabilities().HistoryWindow(opts.Granularity)
+	loc := b.location(target.Instance)
+
+	key := fmt.Sprintf("backfill/%s/%s", deviceID, opts.Granularity)
+	cp, err := b.store.Checkpoint(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		cp, err = &storage.Checkpoint{Key: key}, nil
+	}
+	if err != nil {
+		report.Err = fmt.Errorf("load checkpoint: %w", err)
+		return report
+	}
+
+	logger := log.With().Str("device_id", deviceID).Str("granularity", string(opts.Granularity)).Logger()
+	var last time.Time
+	for start := window.Align(opts.From.In(loc)); start.Before(opts.To); start = window.After(start) {
+		chunk := storage.Span{From: start, To: window.After(start)}
+		if cp.Covers(chunk) {
+			report.Skipped++
+			continue
+		}
+
+		if wait := pace - time.Since(last); !last.IsZero() && wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				report.Err = ctx.Err()
+				return report
+			}
+		}
+		last = time.Now()
+
+		report.Chunks++
+		resp, err := b.engine.GetHistoricalData(ctx, target.Instance, models.HistoryRequest{
+			DeviceID:    target.RawID,
+			StartTime:   chunk.From.Format(time.RFC3339),
+			EndTime:     chunk.To.Format(time.RFC3339),
+			Granularity: opts.Granularity,
+			Page:        1,
+			PageSize:    1000,
+		})
+		switch {
+		case errors.Is(err, provider.ErrNotFound):
+			resp, err = &models.HistoryResponse{}, nil
+		case err != nil && abandon(ctx, err):
+			// Retrying the next chunk would fail the same way; the
+			// checkpoint lets a later run pick up from here.
+			report.Err = err
+			return report
+		case err != nil:
+			logger.Warn().Err(err).Time("from", chunk.From).Msg("Backfill chunk failed")
+			report.Failed = appendFailure(report.Failed, Failure{Span: chunk, Err: err})
+			continue
+		}
+
+		if err := b.store.SaveTimeSeries(ctx, resp.DataPoints); err != nil {
+			report.Err = fmt.Errorf("store history: %w", err)
+			return report
+		}
+		report.Points += len(resp.DataPoints)
+		if len(resp.DataPoints) == 0 {
+			report.Empty = appendSpan(report.Empty, chunk)
+		}
+
+		cp.Add(chunk)
+		if err := b.store.SaveCheckpoint(ctx, cp); err != nil {
+			report.Err = fmt.Errorf("save checkpoint: %w", err)
+			return report
+		}
+		logger.Debug().Time("from", chunk.From).Int("points", len(resp.DataPoints)).Msg("Backfill chunk stored")
+	}
+	return report
+}
+
+// abandon reports whether err ends the device's backfill: the run was
+// cancelled, or the instance cannot serve more history right now.
+func abandon(ctx context.Context, err error) bool {
+	return ctx.Err() != nil ||
+		errors.Is(err, provider.ErrAuth) ||
+		errors.Is(err, provider.ErrNotSupported) ||
+		errors.Is(err, provider.ErrRateLimited) ||
+		errors.Is(err, provider.ErrCircuitOpen)
+}
+
+// location returns the instance's configured timezone, used to align chunks
+// with the vendor's calendar days.
+func (b *Backfiller) location(instance string) *time.Location {
+	if tz := b.configs[instance].Timezone; tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+func appendSpan(spans []storage.Span, s storage.Span) []storage.Span {
+	if n := len(spans); n > 0 && spans[n-1].To.Equal(s.From) {
+		spans[n-1].To = s.To
+		return spans
+	}
+	return append(spans, s)
+}
+
+func appendFailure(failures []Failure, f Failure) []Failure {
+	if n := len(failures); n > 0 && failures[n-1].To.Equal(f.From) && failures[n-1].Err.Error() == f.Err.Error() {
+		failures[n-1].To = f.To
+		return failures
+	}
+	return append(failures, f)
+}
@@ -0,0 +1,354 @@
+// Package collector polls realtime data for every known device in the
+// background and writes the snapshots to a store, so API requests and
+// downstream consumers do not have to wait for the vendor clouds.
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Config controls the background collector.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// How often each device's realtime data is polled (default 300).
+	RealtimeIntervalSeconds int `yaml:"realtime_interval_seconds"`
+
+	// How often the device list is refreshed (default 3600).
+	DiscoveryIntervalSeconds int `yaml:"discovery_interval_seconds"`
+
+	// Share of each instance's rate_limit_rps the collector may use, leaving
+	// the rest for API requests (default 0.5).
+	RateBudget float64 `yaml:"rate_budget"`
+
+	// Also poll every instance's alarm list each round (default true).
+	Alarms bool `yaml:"alarms"`
+
+	// Stored snapshots younger than this are served by the realtime endpoint
+	// instead of calling the vendor (default 2x the realtime interval).
+	MaxAgeSeconds int `yaml:"max_age_seconds"`
+
+	// Normalized plant and device IDs to collect. Empty means all; a device
+	// is collected if either its plant or the device itself is listed.
+	Plants  []string `yaml:"plants"`
+	Devices []string `yaml:"devices"`
+}
+
+// DefaultConfig returns the collector settings used when the config file sets none.
+func DefaultConfig() Config {
+	return Config{
+		RealtimeIntervalSeconds:  300,
+		DiscoveryIntervalSeconds: 3600,
+		RateBudget:               0.5,
+		Alarms:                   true,
+	}
+}
+
+// MaxAge returns how old a stored snapshot may be to still be served.
+func (c Config) MaxAge() time.Duration {
+	if c.MaxAgeSeconds > 0 {
+		return time.Duration(c.MaxAgeSeconds) * time.Second
+	}
+	return 2 * c.realtimeInterval()
+}
+
+func (c Config) realtimeInterval() time.Duration {
+	if c.RealtimeIntervalSeconds <= 0 {
+		return 300 * time.Second
+	}
+	return time.Duration(c.RealtimeIntervalSeconds) * time.Second
+}
+
+func (c Config) discoveryInterval() time.Duration {
+	if c.DiscoveryIntervalSeconds <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.DiscoveryIntervalSeconds) * time.Second
+}
+
+// Collector periodically discovers devices through the engine and stores
+// their realtime snapshots. Each provider instance is polled by its own
+// worker, paced to the instance's share of its rate limit.
+type Collector struct {
+	engine *normalizer.Engine
+	store  storage.Store
+	cfg    Config
+	pace   map[string]time.Duration // minimum gap between calls per instance
+
+	plants  map[string]bool
+	devices map[string]bool
+
+	mu      sync.Mutex
+	targets map[string][]string  // instance → raw device IDs
+	next    map[string]time.Time // instance → earliest start of its next round
+	now     func() time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a collector. providers are the instance configs, used to derive
+// each instance's polling pace from its rate limit.
+func New(engine *normalizer.Engine, store storage.Store, cfg Config, providers []provider.ProviderConfig) *Collector {
+	budget := cfg.RateBudget
+	if budget <= 0 || budget > 1 {
+		budget = DefaultConfig().RateBudget
+	}
+	pace := make(map[string]time.Duration, len(providers))
+	for _, pc := range providers {
+		pace[pc.Name] = pc.CallInterval(budget)
+	}
+
+	return &Collector{
+		engine:  engine,
+		store:   store,
+		cfg:     cfg,
+		pace:    pace,
+		plants:  toSet(cfg.Plants),
+		devices: toSet(cfg.Devices),
+		targets: make(map[string][]string),
+		next:    make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Start runs the collector in the background until Stop is called or ctx is done.
+func (c *Collector) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.done = make(chan struct{})
+	go c.run(ctx)
+}
+
+// Stop stops the collector and waits for in-flight polls to finish.
+func (c *Collector) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+}
+
+func (c *Collector) run(ctx context.Context) {
+	defer close(c.done)
+
+	log.Info().
+		Dur("interval", c.cfg.realtimeInterval()).
+		Dur("discovery_interval", c.cfg.discoveryInterval()).
+		Msg("Collector started")
+
+	c.discover(ctx)
+	c.collect(ctx)
+
+	discovery := time.NewTicker(c.cfg.discoveryInterval())
+	defer discovery.Stop()
+	realtime := time.NewTicker(c.cfg.realtimeInterval())
+	defer realtime.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Collector stopped")
+			return
+		case <-discovery.C:
+			c.discover(ctx)
+		case <-realtime.C:
+			c.collect(ctx)
+		}
+	}
+}
+
+// discover refreshes the devices to poll and stores the current plant and
+// device lists. Instances that fail keep their previous device list.
+func (c *Collector) discover(ctx context.Context) {
+	ctx = normalizer.WithoutCache(ctx)
+	if plants, _, err := c.engine.GetAllPlants(ctx); err == nil {
+		if err := c.store.SavePlants(ctx, plants); err != nil {
+			log.Error().Err(err).Msg("Collector failed to store plants")
+		}
+	}
+
+	devices, sources, err := c.engine.GetAllDevices(ctx)
+	if err != nil && len(sources) == 0 {
+		log.Error().Err(err).Msg("Collector device discovery failed")
+		return
+	}
+	if err := c.store.SaveDevices(ctx, devices); err != nil {
+		log.Error().Err(err).Msg("Collector failed to store devices")
+	}
+
+	found := make(map[string][]string)
+	for _, dev := range devices {
+		if !c.selected(dev) {
+			continue
+		}
+		id, err := c.engine.ResolveID(dev.ID)
+		if err != nil {
+			continue
+		}
+		found[id.Instance] = append(found[id.Instance], id.RawID)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, src := range sources {
+		if src.Status != normalizer.SourceOK {
+			log.Warn().Str("provider", src.Provider).Str("error", src.Error).Msg("Collector device discovery failed for provider")
+			continue
+		}
+		c.targets[src.Provider] = found[src.Provider]
+		log.Debug().Str("provider", src.Provider).Int("devices", len(found[src.Provider])).Msg("Collector discovered devices")
+	}
+}
+
+func (c *Collector) selected(dev models.NormalizedDevice) bool {
+	if len(c.plants) == 0 && len(c.devices) == 0 {
+		return true
+	}
+	return c.plants[dev.PlantID] || c.devices[dev.ID]
+}
+
+// collect polls the alarm lists, then every target once, one worker per
+// provider instance, and returns when all workers are done. Instances with a
+// daily quota sit out rounds until their remaining calls allow another one.
+func (c *Collector) collect(ctx context.Context) {
+	if c.cfg.Alarms {
+		c.collectAlarms(ctx)
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	targets := make(map[string][]string, len(c.targets))
+	for instance, ids := range c.targets {
+		if now.Before(c.next[instance]) {
+			continue
+		}
+		targets[instance] = ids
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for instance, ids := range targets {
+		wg.Add(1)
+		go func(instance string, ids []string) {
+			defer wg.Done()
+			c.collectInstance(ctx, instance, ids)
+			c.schedule(instance, ids, now)
+		}(instance, ids)
+	}
+	wg.Wait()
+}
+
+// collectAlarms fetches the alarm list of every instance and stores it.
+func (c *Collector) collectAlarms(ctx context.Context) {
+	alarms, _, err := c.engine.GetAllAlarms(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Collector failed to get alarms")
+		return
+	}
+	if err := c.store.SaveAlarms(ctx, alarms); err != nil {
+		log.Error().Err(err).Msg("Collector failed to store alarms")
+	}
+}
+
+func (c *Collector) collectInstance(ctx context.Context, instance string, ids []string) {
+	pace, ok := c.pace[instance]
+	if !ok {
+		pace = provider.ProviderConfig{}.CallInterval(c.cfg.RateBudget)
+	}
+	if rounds := pace * time.Duration(len(ids)); rounds > c.cfg.realtimeInterval() {
+		log.Warn().Str("provider", instance).Int("devices", len(ids)).Dur("round", rounds).
+			Msg("Collector cannot poll every device within the interval at the configured rate budget")
+	}
+
+	ctx = normalizer.WithoutCache(ctx)
+	stored := 0
+	for i, rawID := range ids {
+		if i > 0 {
+			timer := time.NewTimer(pace)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		rt, err := c.engine.GetRealTimeData(ctx, instance, rawID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Warn().Err(err).Str("provider", instance).Str("device_id", rawID).Msg("Collector failed to get real-time data")
+			// Throttled or tripped instances are left alone until the next round.
+			if errors.Is(err, provider.ErrRateLimited) || errors.Is(err, provider.ErrCircuitOpen) {
+				return
+			}
+			continue
+		}
+		if err := c.store.SaveRealtime(ctx, rt); err != nil {
+			log.Error().Err(err).Str("device_id", rt.DeviceID).Msg("Collector failed to store real-time data")
+			continue
+		}
+		stored++
+	}
+	log.Debug().Str("provider", instance).Int("stored", stored).Int("devices", len(ids)).Msg("Collector round complete")
+}
+
+// schedule sets when an instance with a daily quota may start its next
+// round, so that its remaining calls last until the quota resets.
+func (c *Collector) schedule(instance string, ids []string, started time.Time) {
+	p, ok := c.engine.GetProvider(instance)
+	if !ok {
+		return
+	}
+	limited, ok := p.(provider.QuotaLimited)
+	if !ok || limited.Quota() == nil {
+		return
+	}
+
+	gap := quotaInterval(limited.Quota(), limited.RealtimeCost(ids), c.now())
+	if gap <= c.cfg.realtimeInterval() {
+		return
+	}
+	log.Debug().Str("provider", instance).Dur("gap", gap).Msg("Collector pacing rounds to the daily quota")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next[instance] = started.Add(gap)
+}
+
+// quotaInterval returns the time between rounds costing cost calls per quota
+// key that spreads each key's remaining calls until the quota resets.
+func quotaInterval(q *provider.Quota, cost map[string]int, now time.Time) time.Duration {
+	var gap time.Duration
+	for key, calls := range cost {
+		if calls <= 0 {
+			continue
+		}
+		remaining, reset := q.Remaining(key, now)
+		until := reset.Sub(now)
+		keyGap := until
+		if rounds := remaining / calls; rounds > 0 {
+			keyGap = until / time.Duration(rounds)
+		}
+		gap = max(gap, keyGap)
+	}
+	return gap
+}
+
+func toSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+)
+
+// quotaProvider is a provider on a daily quota, like SolarEdge. It only
+// serves realtime data.
+type quotaProvider struct {
+	provider.Provider
+	quota *provider.Quota
+	cost  map[string]int
+	calls atomic.Int32
+}
+
+func (p *quotaProvider) Name() string { return "fake" }
+
+func (p *quotaProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{Operations: provider.AllOperations}
+}
+
+func (p *quotaProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	p.calls.Add(1)
+	return &models.NormalizedRealtime{DeviceID: deviceID, Timestamp: time.Now()}, nil
+}
+
+func (p *quotaProvider) Quota() *provider.Quota { return p.quota }
+
+func (p *quotaProvider) RealtimeCost(deviceIDs []string) map[string]int { return p.cost }
+
+// newTestCollector returns a collector polling one device of p every 300s,
+// on a clock the test moves by hand.
+func newTestCollector(t *testing.T, p *quotaProvider, start time.Time) (*Collector, *time.Time) {
+	t.Helper()
+	engine := normalizer.NewEngine()
+	if err := engine.RegisterProvider("se", p, provider.BreakerConfig{}); err != nil {
+		t.Fatalf("RegisterProvider: %v", err)
+	}
+	store, err := storage.OpenSQLite("", storage.RetentionConfig{})
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	c := New(engine, store, Config{RealtimeIntervalSeconds: 300, RateBudget: 0.5}, nil)
+	c.targets["se"] = []string{"1-INV1"}
+	now := start
+	c.now = func() time.Time { return now }
+	return c, &now
+}
+
+func TestCollectorPacesRoundsToQuota(t *testing.T) {
+	// 300 calls a day at 2 a round: 150 rounds, one every 576s from midnight
+	p := &quotaProvider{quota: provider.NewQuota(300, time.UTC), cost: map[string]int{"1": 2}}
+	midnight := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	c, now := newTestCollector(t, p, midnight)
+	ctx := context.Background()
+
+	c.collect(ctx)
+	if n := p.calls.Load(); n != 1 {
+		t.Fatalf("%d calls in the first round, want 1", n)
+	}
+	if next := c.next["se"]; !next.Equal(midnight.Add(576 * time.Second)) {
+		t.Errorf("next round at %s, want %s", next, midnight.Add(576*time.Second))
+	}
+
+	// The regular interval is too early
+	*now = midnight.Add(300 * time.Second)
+	c.collect(ctx)
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("%d calls after 300s, want the round skipped", n)
+	}
+
+	*now = midnight.Add(576 * time.Second)
+	c.collect(ctx)
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("%d calls after 576s, want a second round", n)
+	}
+}
+
+func TestCollectorUnpacedWhenQuotaSuffices(t *testing.T) {
+	// At noon 150 rounds fit every 288s, within the regular interval
+	p := &quotaProvider{quota: provider.NewQuota(300, time.UTC), cost: map[string]int{"1": 2}}
+	noon := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	c, now := newTestCollector(t, p, noon)
+
+	c.collect(context.Background())
+	if _, paced := c.next["se"]; paced {
+		t.Errorf("round paced to %s although the quota suffices", c.next["se"])
+	}
+	*now = noon.Add(time.Second)
+	c.collect(context.Background())
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("%d calls, want 2", n)
+	}
+}
+
+func TestCollectorWaitsForQuotaReset(t *testing.T) {
+	// Not even one round left: wait for midnight UTC
+	p := &quotaProvider{quota: provider.NewQuota(2, time.UTC), cost: map[string]int{"1": 3}}
+	midnight := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	c, now := newTestCollector(t, p, midnight.Add(-10*time.Minute))
+	ctx := context.Background()
+
+	c.collect(ctx)
+	if next := c.next["se"]; !next.Equal(midnight) {
+		t.Errorf("next round at %s, want midnight", next)
+	}
+	*now = midnight.Add(-5 * time.Minute)
+	c.collect(ctx)
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("%d calls before midnight, want 1", n)
+	}
+	*now = midnight
+	c.collect(ctx)
+	if n := p.calls.Load(); n != 2 {
+		t.Errorf("%d calls at midnight, want 2", n)
+	}
+}
+
+func TestQuotaInterval(t *testing.T) {
+	q := provider.NewQuota(300, time.UTC)
+	now := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		cost map[string]int
+		want time.Duration
+	}{
+		{"one key", map[string]int{"1": 2}, 576 * time.Second},
+		{"busiest key wins", map[string]int{"1": 2, "2": 4, "": 1}, 1152 * time.Second},
+		{"more than the quota", map[string]int{"1": 301}, 24 * time.Hour},
+		{"no calls", map[string]int{"1": 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := quotaInterval(q, tt.cost, now); got != tt.want {
+			t.Errorf("%s: quotaInterval = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,14 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/alarms"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/collector"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/metrics"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/mqtt"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/sink"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
 	"gopkg.in/yaml.v3"
 )
 
@@ -13,6 +20,13 @@ type Config struct {
 	Server    ServerConfig            `yaml:"server"`
 	Providers []provider.ProviderConfig `yaml:"providers"`
 	Logging   LoggingConfig           `yaml:"logging"`
+	Cache     normalizer.CacheConfig  `yaml:"cache"`
+	Collector collector.Config        `yaml:"collector"`
+	Storage   storage.Config          `yaml:"storage"`
+	MQTT      mqtt.Config             `yaml:"mqtt"`
+	Metrics   metrics.Config          `yaml:"metrics"`
+	Sinks     sink.Config             `yaml:"sinks"`
+	Alarms    alarms.Config           `yaml:"alarms"`
 }
 
 type ServerConfig struct {
@@ -45,11 +59,42 @@ func Load(path string) (*Config, error) {
 			Level:  "info",
 			Format: "console",
 		},
+		Cache:     normalizer.DefaultCacheConfig(),
+		Collector: collector.DefaultConfig(),
+		Storage:   storage.DefaultConfig(),
+		MQTT:      mqtt.DefaultConfig(),
+		Metrics:   metrics.DefaultConfig(),
+		Sinks:     sink.DefaultConfig(),
+		Alarms:    alarms.DefaultConfig(),
 	}
 
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parse config file %s: %w", path, err)
 	}
 
+	if err := cfg.validateProviders(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
 	return cfg, nil
 }
+
+// validateProviders defaults missing instance names to the provider type and
+// rejects duplicates, since the engine and API route by instance name.
+func (c *Config) validateProviders() error {
+	seen := make(map[string]bool, len(c.Providers))
+	for i := range c.Providers {
+		pc := &c.Providers[i]
+		if pc.Type == "" {
+			return fmt.Errorf("providers[%d]: type is required", i)
+		}
+		if pc.Name == "" {
+			pc.Name = pc.Type
+		}
+		if seen[pc.Name] {
+			return fmt.Errorf("providers[%d]: duplicate provider name %q", i, pc.Name)
+		}
+		seen[pc.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	labelProvider = "provider"
+	labelPlant    = "plant"
+	labelDevice   = "device"
+	labelPhase    = "phase"
+)
+
+// aggregation says how the values of devices sharing a series are combined.
+type aggregation int
+
+const (
+	aggSum aggregation = iota
+	aggMean
+	aggMax
+)
+
+// gauge is a telemetry value read from a snapshot.
+type gauge struct {
+	desc  *prometheus.Desc
+	agg   aggregation
+	value func(rt *models.NormalizedRealtime) (float64, bool)
+}
+
+// phaseGauge is a telemetry value read from one grid phase.
+type phaseGauge struct {
+	desc  *prometheus.Desc
+	agg   aggregation
+	value func(ph *models.PhaseData) (float64, bool)
+}
+
+// fleet is a collector exporting the latest snapshot of every device as
+// gauges, computed at scrape time.
+type fleet struct {
+	labels     []string // device labels, canonical order, without phase
+	phases     bool
+	staleAfter time.Duration
+	store      storage.Store
+
+	gauges      []gauge
+	phaseGauges []phaseGauge
+
+	mu     sync.Mutex
+	latest map[string]*models.NormalizedRealtime // by device ID
+}
+
+func newFleet(cfg FleetConfig) (*fleet, error) {
+	labels, err := validateLabels(cfg.Labels)
+	if err != nil {
+		return nil, err
+	}
+	f := &fleet{
+		staleAfter: time.Duration(cfg.StaleAfterSeconds) * time.Second,
+		latest:     make(map[string]*models.NormalizedRealtime),
+	}
+	if f.staleAfter <= 0 {
+		f.staleAfter = 15 * time.Minute
+	}
+	for _, l := range labels {
+		if l == labelPhase {
+			f.phases = true
+			continue
+		}
+		f.labels = append(f.labels, l)
+	}
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("inverter_"+name, help, f.labels, nil)
+	}
+	phaseDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("inverter_"+name, help, append(append([]string(nil), f.labels...), labelPhase), nil)
+	}
+
+	f.gauges = []gauge{
+		{desc("device_online", "1 if the device is not offline; summed, the number of online devices."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Status == models.DeviceStatusOffline {
+					return 0, true
+				}
+				return 1, true
+			}},
+		{desc("last_update_timestamp_seconds", "Time of the latest realtime snapshot."), aggMax,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				return float64(rt.Timestamp.UnixMilli()) / 1000, !rt.Timestamp.IsZero()
+			}},
+		{desc("pv_power_watts", "PV generation power."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.PV == nil {
+					return 0, false
+				}
+				return rt.PV.TotalPowerW, true
+			}},
+		{desc("pv_energy_today_kilowatt_hours", "PV energy generated today."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.PV == nil {
+					return 0, false
+				}
+				return deref(rt.PV.TodayEnergyKWh)
+			}},
+		{desc("pv_energy_total_kilowatt_hours", "PV energy generated over the device's lifetime."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.PV == nil {
+					return 0, false
+				}
+				return deref(rt.PV.TotalEnergyKWh)
+			}},
+		{desc("battery_power_watts", "Battery power; see battery.direction in the API for its sign."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Battery == nil {
+					return 0, false
+				}
+				return rt.Battery.PowerW, true
+			}},
+		{desc("battery_soc_percent", "Battery state of charge."), aggMean,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Battery == nil {
+					return 0, false
+				}
+				return deref(rt.Battery.SOCPercent)
+			}},
+		{desc("battery_temperature_celsius", "Battery temperature."), aggMean,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Battery == nil {
+					return 0, false
+				}
+				return deref(rt.Battery.TemperatureC)
+			}},
+		{desc("grid_power_watts", "Grid power; see grid.direction in the API for its sign."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Grid == nil {
+					return 0, false
+				}
+				return rt.Grid.TotalPowerW, true
+			}},
+		{desc("grid_frequency_hertz", "Grid frequency."), aggMean,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Grid == nil {
+					return 0, false
+				}
+				return deref(rt.Grid.FrequencyHz)
+			}},
+		{desc("grid_import_today_kilowatt_hours", "Energy imported from the grid today."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Grid == nil {
+					return 0, false
+				}
+				return deref(rt.Grid.TodayImportKWh)
+			}},
+		{desc("grid_export_today_kilowatt_hours", "Energy exported to the grid today."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Grid == nil {
+					return 0, false
+				}
+				return deref(rt.Grid.TodayExportKWh)
+			}},
+		{desc("load_power_watts", "Consumption power."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Load == nil {
+					return 0, false
+				}
+				return rt.Load.TotalPowerW, true
+			}},
+		{desc("load_energy_today_kilowatt_hours", "Energy consumed today."), aggSum,
+			func(rt *models.NormalizedRealtime) (float64, bool) {
+				if rt.Load == nil {
+					return 0, false
+				}
+				return deref(rt.Load.TodayEnergyKWh)
+			}},
+	}
+
+	if f.phases {
+		f.phaseGauges = []phaseGauge{
+			{phaseDesc("grid_phase_voltage_volts", "Grid phase voltage."), aggMean,
+				func(ph *models.PhaseData) (float64, bool) { return deref(ph.VoltageV) }},
+			{phaseDesc("grid_phase_current_amperes", "Grid phase current."), aggSum,
+				func(ph *models.PhaseData) (float64, bool) { return deref(ph.CurrentA) }},
+			{phaseDesc("grid_phase_power_watts", "Grid phase power."), aggSum,
+				func(ph *models.PhaseData) (float64, bool) { return deref(ph.PowerW) }},
+		}
+	}
+	return f, nil
+}
+
+func (f *fleet) update(rt *models.NormalizedRealtime) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latest[rt.DeviceID] = rt
+}
+
+func (f *fleet) Describe(ch chan<- *prometheus.Desc) {
+	for _, g := range f.gauges {
+		ch <- g.desc
+	}
+	for _, g := range f.phaseGauges {
+		ch <- g.desc
+	}
+}
+
+// series accumulates the values of one label combination.
+type series struct {
+	labels []string
+	value  float64
+	n      int
+}
+
+func (s *series) add(agg aggregation, v float64) {
+	switch {
+	case s.n == 0:
+		s.value = v
+	case agg == aggMax:
+		if v > s.value {
+			s.value = v
+		}
+	default:
+		s.value += v
+	}
+	s.n++
+}
+
+func (s *series) result(agg aggregation) float64 {
+	if agg == aggMean {
+		return s.value / float64(s.n)
+	}
+	return s.value
+}
+
+func (f *fleet) Collect(ch chan<- prometheus.Metric) {
+	f.mu.Lock()
+	snapshots := make([]*models.NormalizedRealtime, 0, len(f.latest))
+	for id, rt := range f.latest {
+		if time.Since(rt.Meta.FetchedAt) > f.staleAfter {
+			delete(f.latest, id)
+			continue
+		}
+		snapshots = append(snapshots, rt)
+	}
+	f.mu.Unlock()
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].DeviceID < snapshots[j].DeviceID })
+
+	plants := f.plants(snapshots)
+	gauges := make([]map[string]*series, len(f.gauges))
+	phaseGauges := make([]map[string]*series, len(f.phaseGauges))
+	for _, rt := range snapshots {
+		labels := f.labelValues(rt, plants)
+		for i, g := range f.gauges {
+			if v, ok := g.value(rt); ok {
+				accumulate(&gauges[i], labels, g.agg, v)
+			}
+		}
+		if len(f.phaseGauges) == 0 || rt.Grid == nil {
+			continue
+		}
+		for p := range rt.Grid.Phases {
+			ph := &rt.Grid.Phases[p]
+			phaseLabels := append(append([]string(nil), labels...), ph.Phase)
+			for i, g := range f.phaseGauges {
+				if v, ok := g.value(ph); ok {
+					accumulate(&phaseGauges[i], phaseLabels, g.agg, v)
+				}
+			}
+		}
+	}
+
+	for i, g := range f.gauges {
+		for _, s := range gauges[i] {
+			ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, s.result(g.agg), s.labels...)
+		}
+	}
+	for i, g := range f.phaseGauges {
+		for _, s := range phaseGauges[i] {
+			ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, s.result(g.agg), s.labels...)
+		}
+	}
+}
+
+func accumulate(m *map[string]*series, labels []string, agg aggregation, v float64) {
+	if *m == nil {
+		*m = make(map[string]*series)
+	}
+	key := strings.Join(labels, "\x00")
+	s, ok := (*m)[key]
+	if !ok {
+		s = &series{labels: labels}
+		(*m)[key] = s
+	}
+	s.add(agg, v)
+}
+
+func (f *fleet) labelValues(rt *models.NormalizedRealtime, plants map[string]string) []string {
+	values := make([]string, len(f.labels))
+	for i, l := range f.labels {
+		switch l {
+		case labelProvider:
+			values[i] = rt.Meta.Instance
+		case labelPlant:
+			values[i] = plants[rt.DeviceID]
+		case labelDevice:
+			values[i] = rt.DeviceID
+		}
+	}
+	return values
+}
+
+// plants maps the devices to their plants, from the store if there is one,
+// else from the plant ID the vendor put in the snapshot, if any.
+func (f *fleet) plants(snapshots []*models.NormalizedRealtime) map[string]string {
+	plants := make(map[string]string, len(snapshots))
+	needed := false
+	for _, l := range f.labels {
+		needed = needed || l == labelPlant
+	}
+	if !needed {
+		return plants
+	}
+	for _, rt := range snapshots {
+		if rt.Meta.ProviderPlantID != "" {
+			plants[rt.DeviceID] = normalizer.FormatID(rt.Meta.Instance, rt.Meta.ProviderPlantID)
+		}
+	}
+	if f.store == nil {
+		return plants
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	devices, err := f.store.Devices(ctx, "")
+	if err != nil {
+		log.Warn().Err(err).Msg("Metrics could not read devices from store")
+		return plants
+	}
+	for _, dev := range devices {
+		if dev.PlantID != "" {
+			plants[dev.ID] = dev.PlantID
+		}
+	}
+	return plants
+}
+
+func deref(v *float64) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	return *v, true
+}
@@ -0,0 +1,242 @@
+// Package metrics exports Prometheus metrics: the service's own health (API
+// requests, vendor calls, retries, rate limiting, logins) and fleet
+// telemetry taken from the latest realtime snapshot of every device.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Config controls the metrics endpoint.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Path the metrics are served at (default "/metrics").
+	Path string `yaml:"path"`
+
+	Fleet FleetConfig `yaml:"fleet"`
+}
+
+// FleetConfig controls the telemetry gauges.
+type FleetConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Labels of the telemetry gauges, any of "provider", "plant", "device"
+	// and "phase" (default provider, plant, device). Devices that share the
+	// remaining labels are combined into one series: powers, energies and
+	// currents are summed, other values averaged. Per-phase gauges are only
+	// exported with "phase".
+	Labels []string `yaml:"labels"`
+
+	// Devices whose latest snapshot is older than this are left out
+	// (default 900).
+	StaleAfterSeconds int `yaml:"stale_after_seconds"`
+}
+
+// DefaultConfig returns the metrics settings used when the config file sets none.
+func DefaultConfig() Config {
+	return Config{
+		Path: "/metrics",
+		Fleet: FleetConfig{
+			Enabled:           true,
+			Labels:            []string{labelProvider, labelPlant, labelDevice},
+			StaleAfterSeconds: 900,
+		},
+	}
+}
+
+// Metrics holds the registry behind the metrics endpoint. It implements
+// provider.ClientObserver; install it with provider.SetClientObserver to
+// record vendor HTTP traffic.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	providerCalls    *prometheus.CounterVec
+	providerErrors   *prometheus.CounterVec
+	providerDuration *prometheus.HistogramVec
+
+	upstreamRequests *prometheus.CounterVec
+	upstreamDuration *prometheus.HistogramVec
+	upstreamRetries  *prometheus.CounterVec
+	rateLimitWait    *prometheus.HistogramVec
+	authRefreshes    *prometheus.CounterVec
+
+	fleet *fleet // nil if fleet telemetry is disabled
+}
+
+// New creates the metrics. Engine metrics are only recorded once Watch is
+// called.
+func New(cfg Config) (*Metrics, error) {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "normalizer_http_requests_total",
+			Help: "API requests served, by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "normalizer_http_request_duration_seconds",
+			Help:    "API request latency, by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+
+		providerCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "normalizer_provider_calls_total",
+			Help: "Calls made to provider instances, by operation.",
+		}, []string{"provider", "operation"}),
+		providerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "normalizer_provider_errors_total",
+			Help: "Failed provider calls, by operation and error code.",
+		}, []string{"provider", "operation", "code"}),
+		providerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "normalizer_provider_call_duration_seconds",
+			Help:    "Provider call latency including retries and logins, by operation.",
+			Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"provider", "operation"}),
+
+		upstreamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "normalizer_upstream_requests_total",
+			Help: "HTTP requests sent to vendor APIs, each retry counted, by status code (\"error\" if no response).",
+		}, []string{"provider", "code"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "normalizer_upstream_request_duration_seconds",
+			Help:    "Latency of single HTTP requests to vendor APIs.",
+			Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"provider"}),
+		upstreamRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "normalizer_upstream_retries_total",
+			Help: "Retried vendor requests, by reason (transient or throttled).",
+		}, []string{"provider", "reason"}),
+		rateLimitWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "normalizer_rate_limiter_wait_seconds",
+			Help:    "Time vendor requests waited for the rate limiter.",
+			Buckets: []float64{.001, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"provider"}),
+		authRefreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "normalizer_auth_refreshes_total",
+			Help: "Logins to vendor APIs, by result (success or failure).",
+		}, []string{"provider", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration,
+		m.providerCalls, m.providerErrors, m.providerDuration,
+		m.upstreamRequests, m.upstreamDuration, m.upstreamRetries, m.rateLimitWait, m.authRefreshes,
+	)
+
+	if cfg.Fleet.Enabled {
+		f, err := newFleet(cfg.Fleet)
+		if err != nil {
+			return nil, err
+		}
+		m.fleet = f
+		m.registry.MustRegister(f)
+	}
+	return m, nil
+}
+
+// Watch subscribes the metrics to the engine's provider calls and, with
+// fleet telemetry, its realtime snapshots. store may be nil; when set, it
+// maps devices to their plants for the plant label.
+func (m *Metrics) Watch(engine *normalizer.Engine, store storage.Store) {
+	engine.OnCall(m.observeCall)
+	if m.fleet != nil {
+		m.fleet.store = store
+		engine.OnRealtime(m.fleet.update)
+	}
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP records an API request. route is the matched route pattern,
+// not the request path, to keep the number of series bounded.
+func (m *Metrics) ObserveHTTP(route, method string, status int, d time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+func (m *Metrics) observeCall(ev normalizer.CallEvent) {
+	op := string(ev.Op)
+	m.providerCalls.WithLabelValues(ev.Instance, op).Inc()
+	if ev.Err != nil {
+		m.providerErrors.WithLabelValues(ev.Instance, op, provider.ErrorCode(ev.Err)).Inc()
+	}
+	if ev.Duration > 0 {
+		m.providerDuration.WithLabelValues(ev.Instance, op).Observe(ev.Duration.Seconds())
+	}
+}
+
+// UpstreamRequest implements provider.ClientObserver, counting vendor calls by status.
+func (m *Metrics) UpstreamRequest(instance string, status int, err error, d time.Duration) {
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(status)
+	}
+	m.upstreamRequests.WithLabelValues(instance, code).Inc()
+	m.upstreamDuration.WithLabelValues(instance).Observe(d.Seconds())
+}
+
+// UpstreamRetry implements provider.ClientObserver, counting retries by reason.
+func (m *Metrics) UpstreamRetry(instance string, throttled bool) {
+	reason := "transient"
+	if throttled {
+		reason = "throttled"
+	}
+	m.upstreamRetries.WithLabelValues(instance, reason).Inc()
+}
+
+// RateLimitWait implements provider.ClientObserver, timing rate limiter waits.
+func (m *Metrics) RateLimitWait(instance string, d time.Duration) {
+	m.rateLimitWait.WithLabelValues(instance).Observe(d.Seconds())
+}
+
+// AuthRefresh implements provider.ClientObserver, counting logins by outcome.
+func (m *Metrics) AuthRefresh(instance string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.authRefreshes.WithLabelValues(instance, result).Inc()
+}
+
+// validateLabels returns the fleet labels in canonical order, rejecting
+// unknown ones.
+func validateLabels(labels []string) ([]string, error) {
+	set := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		switch l {
+		case labelProvider, labelPlant, labelDevice, labelPhase:
+			set[l] = true
+		default:
+			return nil, fmt.Errorf("metrics.fleet.labels: unknown label %q (want provider, plant, device or phase)", l)
+		}
+	}
+	var ordered []string
+	for _, l := range []string{labelProvider, labelPlant, labelDevice, labelPhase} {
+		if set[l] {
+			ordered = append(ordered, l)
+		}
+	}
+	return ordered, nil
+}
@@ -16,6 +16,11 @@ type NormalizedAlarm struct {
 	Severity AlarmSeverity `json:"severity"`
 	Status   AlarmStatus   `json:"status"`
 
+	// Brand-agnostic classification from the alarm catalogue
+	Category          AlarmCategory `json:"category,omitempty"`
+	NormalizedCode    string        `json:"normalizedCode,omitempty"` // e.g. "grid_overvoltage"
+	RecommendedAction string        `json:"recommendedAction,omitempty"`
+
 	// Device context
 	DeviceSerialNumber string     `json:"deviceSerialNumber,omitempty"`
 	DeviceType         DeviceType `json:"deviceType,omitempty"`
@@ -40,6 +45,21 @@ const (
 	AlarmSeverityUnknown  AlarmSeverity = "unknown"
 )
 
+// AlarmCategory groups normalized alarm codes by the part of the system
+// affected.
+type AlarmCategory string
+
+const (
+	AlarmCategoryGrid          AlarmCategory = "grid"
+	AlarmCategoryPV            AlarmCategory = "pv"
+	AlarmCategorySafety        AlarmCategory = "safety"
+	AlarmCategoryThermal       AlarmCategory = "thermal"
+	AlarmCategoryBattery       AlarmCategory = "battery"
+	AlarmCategoryCommunication AlarmCategory = "communication"
+	AlarmCategoryHardware      AlarmCategory = "hardware"
+	AlarmCategoryOther         AlarmCategory = "other"
+)
+
 // AlarmStatus tracks the lifecycle of an alarm.
 type AlarmStatus string
 
@@ -49,3 +69,33 @@ const (
 	AlarmStatusAcknowledged AlarmStatus = "acknowledged"
 	AlarmStatusUnknown   AlarmStatus = "unknown"
 )
+
+// AlarmEvent records a change in an alarm's lifecycle, found by comparing
+// successive alarm lists of a provider instance. Alarms are told apart by
+// provider instance, device and code.
+type AlarmEvent struct {
+	ID   string         `json:"id"`
+	Type AlarmEventType `json:"type"`
+	Time time.Time      `json:"time"` // when the change was detected
+
+	Provider string `json:"provider"` // provider instance
+	DeviceID string `json:"deviceId"`
+	PlantID  string `json:"plantId,omitempty"`
+	Code     string `json:"code"`
+
+	// Fields that changed, for updated events.
+	Changed []string `json:"changed,omitempty"`
+
+	// The alarm as last reported by the vendor. Cleared alarms the vendor
+	// no longer lists carry their last reported state, marked resolved.
+	Alarm NormalizedAlarm `json:"alarm"`
+}
+
+// AlarmEventType is the kind of lifecycle change.
+type AlarmEventType string
+
+const (
+	AlarmEventRaised  AlarmEventType = "raised"
+	AlarmEventUpdated AlarmEventType = "updated"
+	AlarmEventCleared AlarmEventType = "cleared"
+)
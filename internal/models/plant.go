@@ -5,7 +5,7 @@ import "time"
 // NormalizedPlant represents a solar installation / power station
 // in a brand-agnostic format.
 type NormalizedPlant struct {
-	// Normalized unique ID: "provider_originalID"
+	// Normalized unique ID: "instance_originalID"
 	ID       string `json:"id"`
 	Provider string `json:"provider"`
 
@@ -60,6 +60,7 @@ const (
 // so data can always be traced back to the source.
 type ProviderMeta struct {
 	Provider         string            `json:"provider"`
+	Instance         string            `json:"instance,omitempty"`
 	ProviderPlantID  string            `json:"providerPlantId,omitempty"`
 	ProviderDeviceID string            `json:"providerDeviceId,omitempty"`
 	ProviderPlantUID string            `json:"providerPlantUid,omitempty"`
@@ -67,6 +67,8 @@ type PVData struct {
 	MonthEnergyKWh  *float64   `json:"monthEnergyKWh,omitempty"`
 	YearEnergyKWh   *float64   `json:"yearEnergyKWh,omitempty"`
 	Strings         []PVString `json:"strings,omitempty"`
+	// Per-module readings, for module-level electronics (microinverters)
+	Modules         []PVModule `json:"modules,omitempty"`
 }
 
 type PVString struct {
@@ -76,6 +78,15 @@ type PVString struct {
 	PowerW   *float64 `json:"powerW,omitempty"`
 }
 
+// PVModule is the reading of a single panel's module-level power electronics,
+// e.g. an Enphase microinverter.
+type PVModule struct {
+	SerialNumber string     `json:"serialNumber"`
+	PowerW       *float64   `json:"powerW,omitempty"`
+	EnergyKWh    *float64   `json:"energyKWh,omitempty"` // lifetime
+	LastReportAt *time.Time `json:"lastReportAt,omitempty"`
+}
+
 // ── Battery Data ──
 
 // EnergyDirection is a unified direction enum.
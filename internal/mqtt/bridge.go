@@ -0,0 +1,391 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// queueSize is how many snapshots may wait to be published; beyond that new
+// snapshots are dropped so the engine is never held up by a slow broker.
+const queueSize = 256
+
+// Bridge publishes every realtime snapshot the engine fetches. For a device
+// <id> (its normalized ID, with characters not allowed in topics replaced by
+// "_") it publishes, all retained:
+//
+//	<prefix>/<id>/availability   "online", or "offline" when the device is offline
+//	<prefix>/<id>/status         the device status
+//	<prefix>/<id>/pv             PV section as JSON
+//	<prefix>/<id>/battery        battery section as JSON
+//	<prefix>/<id>/grid           grid section as JSON
+//	<prefix>/<id>/grid/phase/<p> one grid phase as JSON, p being a, b or c
+//	<prefix>/<id>/load           load section as JSON
+//
+// Sections the snapshot does not have are not published. The JSON uses the
+// field names of the REST API.
+type Bridge struct {
+	pub   Publisher
+	cfg   Config
+	store storage.Store // optional, for device names
+
+	queue chan *models.NormalizedRealtime
+	done  chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+
+	// Only touched by the publishing goroutine.
+	announced map[string]bool // discovery configs sent, by unique ID
+	devices   map[string]models.NormalizedDevice
+}
+
+// NewBridge creates a bridge and subscribes it to the engine's realtime
+// snapshots. store may be nil; when set, device names and models are taken
+// from it for the Home Assistant device registry.
+func NewBridge(engine *normalizer.Engine, pub Publisher, cfg Config, store storage.Store) *Bridge {
+	if cfg.TopicPrefix == "" {
+		cfg.TopicPrefix = DefaultConfig().TopicPrefix
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = DefaultConfig().DiscoveryPrefix
+	}
+	b := &Bridge{
+		pub:       pub,
+		cfg:       cfg,
+		store:     store,
+		queue:     make(chan *models.NormalizedRealtime, queueSize),
+		done:      make(chan struct{}),
+		announced: make(map[string]bool),
+		devices:   make(map[string]models.NormalizedDevice),
+	}
+	engine.OnRealtime(b.enqueue)
+	go b.run()
+	return b
+}
+
+// Stop publishes the snapshots already queued and stops the bridge. It does
+// not close the publisher.
+func (b *Bridge) Stop() {
+	b.mu.Lock()
+	if b.stopped {
+		b.mu.Unlock()
+		return
+	}
+	b.stopped = true
+	close(b.queue)
+	b.mu.Unlock()
+	<-b.done
+}
+
+func (b *Bridge) enqueue(rt *models.NormalizedRealtime) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stopped {
+		return
+	}
+	select {
+	case b.queue <- rt:
+	default:
+		log.Warn().Str("device_id", rt.DeviceID).Msg("MQTT queue full, dropping realtime snapshot")
+	}
+}
+
+func (b *Bridge) run() {
+	defer close(b.done)
+	for rt := range b.queue {
+		b.publishRealtime(rt)
+	}
+}
+
+func (b *Bridge) publishRealtime(rt *models.NormalizedRealtime) {
+	base := b.cfg.TopicPrefix + "/" + topicID(rt.DeviceID)
+
+	if b.cfg.Discovery {
+		b.announce(rt, base)
+	}
+
+	availability := "online"
+	if rt.Status == models.DeviceStatusOffline {
+		availability = "offline"
+	}
+	b.publish(base+"/availability", []byte(availability))
+	b.publish(base+"/status", []byte(rt.Status))
+
+	if rt.PV != nil {
+		b.publishJSON(base+"/pv", rt.PV)
+	}
+	if rt.Battery != nil {
+		b.publishJSON(base+"/battery", rt.Battery)
+	}
+	if rt.Grid != nil {
+		b.publishJSON(base+"/grid", rt.Grid)
+		for i := range rt.Grid.Phases {
+			ph := &rt.Grid.Phases[i]
+			b.publishJSON(base+"/grid/phase/"+phaseID(ph.Phase), ph)
+		}
+	}
+	if rt.Load != nil {
+		b.publishJSON(base+"/load", rt.Load)
+	}
+}
+
+// announce publishes the discovery configs of the snapshot's values that have
+// not been announced yet, so sensors appear as a device starts reporting them.
+func (b *Bridge) announce(rt *models.NormalizedRealtime, base string) {
+	dev := topicID(rt.DeviceID)
+	var device *haDevice
+	for _, s := range sensors(rt) {
+		uniqueID := topicID(b.cfg.TopicPrefix) + "_" + dev + "_" + s.key
+		if b.announced[uniqueID] {
+			continue
+		}
+		if device == nil {
+			device = b.haDevice(rt)
+		}
+		availability := []haAvailability{{Topic: b.cfg.StatusTopic()}}
+		if !s.showsOffline {
+			availability = append(availability, haAvailability{Topic: base + "/availability"})
+		}
+		cfg := haSensor{
+			Name:             s.name,
+			UniqueID:         uniqueID,
+			StateTopic:       base + "/" + s.topic,
+			ValueTemplate:    s.template,
+			DeviceClass:      s.deviceClass,
+			StateClass:       s.stateClass,
+			Unit:             s.unit,
+			Options:          s.options,
+			Availability:     availability,
+			AvailabilityMode: "all",
+			Device:           device,
+			Precision:        s.precision,
+		}
+		topic := b.cfg.DiscoveryPrefix + "/sensor/" + dev + "/" + s.key + "/config"
+		if b.publishJSON(topic, cfg) {
+			b.announced[uniqueID] = true
+		}
+	}
+}
+
+// haDevice describes the device for the Home Assistant device registry.
+func (b *Bridge) haDevice(rt *models.NormalizedRealtime) *haDevice {
+	d := &haDevice{
+		Identifiers:  []string{rt.DeviceID},
+		Name:         rt.DeviceID,
+		Manufacturer: rt.Provider,
+	}
+	if b.store != nil {
+		if _, ok := b.devices[rt.DeviceID]; !ok {
+			if all, err := b.store.Devices(context.Background(), ""); err == nil {
+				for _, dev := range all {
+					b.devices[dev.ID] = dev
+				}
+			}
+		}
+	}
+	if dev, ok := b.devices[rt.DeviceID]; ok {
+		if dev.Name != "" {
+			d.Name = dev.Name
+		}
+		d.Model = dev.Model
+		d.SerialNumber = dev.SerialNumber
+	}
+	return d
+}
+
+func (b *Bridge) publishJSON(topic string, v interface{}) bool {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Str("topic", topic).Msg("Failed to encode MQTT payload")
+		return false
+	}
+	return b.publish(topic, payload)
+}
+
+func (b *Bridge) publish(topic string, payload []byte) bool {
+	if err := b.pub.Publish(topic, payload, true); err != nil {
+		log.Warn().Err(err).Str("topic", topic).Msg("MQTT publish failed")
+		return false
+	}
+	return true
+}
+
+// phaseID returns the topic level of a phase: "a", "b", "c".
+func phaseID(phase string) string {
+	if phase == "" {
+		return "unknown"
+	}
+	return topicID(strings.ToLower(phase))
+}
+
+// ── Home Assistant discovery ──
+
+type haSensor struct {
+	Name             string           `json:"name"`
+	UniqueID         string           `json:"unique_id"`
+	StateTopic       string           `json:"state_topic"`
+	ValueTemplate    string           `json:"value_template,omitempty"`
+	DeviceClass      string           `json:"device_class,omitempty"`
+	StateClass       string           `json:"state_class,omitempty"`
+	Unit             string           `json:"unit_of_measurement,omitempty"`
+	Options          []string         `json:"options,omitempty"`
+	Precision        *int             `json:"suggested_display_precision,omitempty"`
+	Availability     []haAvailability `json:"availability"`
+	AvailabilityMode string           `json:"availability_mode"`
+	Device           *haDevice        `json:"device"`
+}
+
+type haAvailability struct {
+	Topic string `json:"topic"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+}
+
+// sensor is one value of a snapshot exposed as a Home Assistant sensor.
+type sensor struct {
+	key         string // object ID, unique per device
+	name        string
+	topic       string // state topic below the device
+	template    string
+	deviceClass string
+	stateClass  string
+	unit        string
+	options     []string
+	precision   *int
+
+	// showsOffline sensors stay available while the device is offline,
+	// rather than going unavailable with its other values.
+	showsOffline bool
+}
+
+var (
+	zeroDecimals = 0
+	twoDecimals  = 2
+)
+
+// field reads a JSON field of the section published on the state topic.
+func field(name string) string {
+	return "{{ value_json." + name + " }}"
+}
+
+// power is an instantaneous power reading in W.
+func power(key, name, topic, jsonField string) sensor {
+	return sensor{key: key, name: name, topic: topic, template: field(jsonField),
+		deviceClass: "power", stateClass: "measurement", unit: "W", precision: &zeroDecimals}
+}
+
+// energy is an energy counter in kWh. Home Assistant's energy dashboard needs
+// device_class energy with state_class total_increasing, which also handles
+// the daily counters dropping back to zero at midnight.
+func energy(key, name, topic, jsonField string) sensor {
+	return sensor{key: key, name: name, topic: topic, template: field(jsonField),
+		deviceClass: "energy", stateClass: "total_increasing", unit: "kWh", precision: &twoDecimals}
+}
+
+func measurement(key, name, topic, jsonField, deviceClass, unit string) sensor {
+	return sensor{key: key, name: name, topic: topic, template: field(jsonField),
+		deviceClass: deviceClass, stateClass: "measurement", unit: unit}
+}
+
+// sensors lists the values present in rt.
+func sensors(rt *models.NormalizedRealtime) []sensor {
+	s := []sensor{{
+		key: "status", name: "Status", topic: "status",
+		deviceClass: "enum", showsOffline: true,
+		options: []string{
+			string(models.DeviceStatusOnline), string(models.DeviceStatusOffline),
+			string(models.DeviceStatusStandby), string(models.DeviceStatusNormal),
+			string(models.DeviceStatusWarning), string(models.DeviceStatusFault),
+			string(models.DeviceStatusUpgrade), string(models.DeviceStatusUnknown),
+		},
+	}}
+
+	if pv := rt.PV; pv != nil {
+		s = append(s, power("pv_power", "PV power", "pv", "totalPowerW"))
+		if pv.TodayEnergyKWh != nil {
+			s = append(s, energy("pv_energy_today", "PV energy today", "pv", "todayEnergyKWh"))
+		}
+		if pv.TotalEnergyKWh != nil {
+			s = append(s, energy("pv_energy_total", "PV energy total", "pv", "totalEnergyKWh"))
+		}
+	}
+
+	if bat := rt.Battery; bat != nil {
+		s = append(s, power("battery_power", "Battery power", "battery", "powerW"))
+		if bat.SOCPercent != nil {
+			s = append(s, measurement("battery_soc", "Battery state of charge", "battery", "socPercent", "battery", "%"))
+		}
+		if bat.TemperatureC != nil {
+			s = append(s, measurement("battery_temperature", "Battery temperature", "battery", "temperatureC", "temperature", "°C"))
+		}
+		if bat.TodayChargeKWh != nil {
+			s = append(s, energy("battery_charge_today", "Battery charge today", "battery", "todayChargeKWh"))
+		}
+		if bat.TodayDischargeKWh != nil {
+			s = append(s, energy("battery_discharge_today", "Battery discharge today", "battery", "todayDischargeKWh"))
+		}
+		if bat.TotalChargeKWh != nil {
+			s = append(s, energy("battery_charge_total", "Battery charge total", "battery", "totalChargeKWh"))
+		}
+		if bat.TotalDischargeKWh != nil {
+			s = append(s, energy("battery_discharge_total", "Battery discharge total", "battery", "totalDischargeKWh"))
+		}
+	}
+
+	if grid := rt.Grid; grid != nil {
+		s = append(s, power("grid_power", "Grid power", "grid", "totalPowerW"))
+		if grid.FrequencyHz != nil {
+			s = append(s, measurement("grid_frequency", "Grid frequency", "grid", "frequencyHz", "frequency", "Hz"))
+		}
+		if grid.TodayImportKWh != nil {
+			s = append(s, energy("grid_import_today", "Grid import today", "grid", "todayImportKWh"))
+		}
+		if grid.TodayExportKWh != nil {
+			s = append(s, energy("grid_export_today", "Grid export today", "grid", "todayExportKWh"))
+		}
+		if grid.TotalImportKWh != nil {
+			s = append(s, energy("grid_import_total", "Grid import total", "grid", "totalImportKWh"))
+		}
+		if grid.TotalExportKWh != nil {
+			s = append(s, energy("grid_export_total", "Grid export total", "grid", "totalExportKWh"))
+		}
+		for _, ph := range grid.Phases {
+			id := phaseID(ph.Phase)
+			topic := "grid/phase/" + id
+			label := "Grid phase " + strings.ToUpper(id)
+			if ph.VoltageV != nil {
+				s = append(s, measurement("grid_"+id+"_voltage", label+" voltage", topic, "voltageV", "voltage", "V"))
+			}
+			if ph.CurrentA != nil {
+				s = append(s, measurement("grid_"+id+"_current", label+" current", topic, "currentA", "current", "A"))
+			}
+			if ph.PowerW != nil {
+				s = append(s, power("grid_"+id+"_power", label+" power", topic, "powerW"))
+			}
+		}
+	}
+
+	if load := rt.Load; load != nil {
+		s = append(s, power("load_power", "Load power", "load", "totalPowerW"))
+		if load.TodayEnergyKWh != nil {
+			s = append(s, energy("load_energy_today", "Load energy today", "load", "todayEnergyKWh"))
+		}
+		if load.TotalEnergyKWh != nil {
+			s = append(s, energy("load_energy_total", "Load energy total", "load", "totalEnergyKWh"))
+		}
+	}
+	return s
+}
@@ -0,0 +1,195 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func testSnapshot(status models.DeviceStatus) *models.NormalizedRealtime {
+	return &models.NormalizedRealtime{
+		DeviceID: "huawei_NE=1234",
+		Provider: "huawei",
+		Status:   status,
+		PV: &models.PVData{
+			TotalPowerW:    4200,
+			TodayEnergyKWh: ptr(12.5),
+		},
+		Battery: &models.BatteryData{
+			PowerW:     -800,
+			Direction:  models.DirectionDischarging,
+			SOCPercent: ptr(64),
+		},
+		Grid: &models.GridData{
+			TotalPowerW:    -1500,
+			Direction:      models.GridDirectionExporting,
+			TotalExportKWh: ptr(3120.4),
+			Phases: []models.PhaseData{
+				{Phase: "A", VoltageV: ptr(231.2), CurrentA: ptr(2.1), PowerW: ptr(490)},
+				{Phase: "B", VoltageV: ptr(229.8)},
+			},
+		},
+	}
+}
+
+// publishAll runs snapshots through a bridge and returns what a subscriber
+// would see.
+func publishAll(t *testing.T, cfg Config, snapshots ...*models.NormalizedRealtime) *MemoryPublisher {
+	t.Helper()
+	pub := NewMemoryPublisher()
+	b := NewBridge(normalizer.NewEngine(), pub, cfg, nil)
+	for _, rt := range snapshots {
+		b.enqueue(rt)
+	}
+	b.Stop()
+	return pub
+}
+
+func retainedJSON(t *testing.T, pub *MemoryPublisher, topic string, v interface{}) {
+	t.Helper()
+	msg, ok := pub.Retained(topic)
+	if !ok {
+		t.Fatalf("nothing retained on %s", topic)
+	}
+	if err := json.Unmarshal(msg.Payload, v); err != nil {
+		t.Fatalf("%s: %v", topic, err)
+	}
+}
+
+func TestBridgePublishesRetainedSections(t *testing.T) {
+	pub := publishAll(t, Config{TopicPrefix: "solar"}, testSnapshot(models.DeviceStatusNormal))
+
+	for _, msg := range pub.Messages() {
+		if !msg.Retained {
+			t.Errorf("%s published without retain", msg.Topic)
+		}
+	}
+
+	// The device ID is made topic-safe
+	const base = "solar/huawei_NE_1234"
+	if msg, _ := pub.Retained(base + "/status"); string(msg.Payload) != "normal" {
+		t.Errorf("status = %q", msg.Payload)
+	}
+
+	var pv models.PVData
+	retainedJSON(t, pub, base+"/pv", &pv)
+	if pv.TotalPowerW != 4200 || pv.TodayEnergyKWh == nil || *pv.TodayEnergyKWh != 12.5 {
+		t.Errorf("pv = %+v", pv)
+	}
+
+	var battery models.BatteryData
+	retainedJSON(t, pub, base+"/battery", &battery)
+	if battery.PowerW != -800 || battery.Direction != models.DirectionDischarging {
+		t.Errorf("battery = %+v", battery)
+	}
+
+	var grid models.GridData
+	retainedJSON(t, pub, base+"/grid", &grid)
+	if grid.TotalPowerW != -1500 || len(grid.Phases) != 2 {
+		t.Errorf("grid = %+v", grid)
+	}
+
+	var phaseA, phaseB models.PhaseData
+	retainedJSON(t, pub, base+"/grid/phase/a", &phaseA)
+	retainedJSON(t, pub, base+"/grid/phase/b", &phaseB)
+	if *phaseA.VoltageV != 231.2 || *phaseA.PowerW != 490 || *phaseB.VoltageV != 229.8 {
+		t.Errorf("phases = %+v, %+v", phaseA, phaseB)
+	}
+
+	// No load section in the snapshot, no load topic
+	if _, ok := pub.Retained(base + "/load"); ok {
+		t.Error("load published for a snapshot without load")
+	}
+}
+
+func TestBridgeDiscovery(t *testing.T) {
+	cfg := Config{TopicPrefix: "solar", DiscoveryPrefix: "ha", Discovery: true}
+	// The second snapshot must not announce anything again
+	pub := publishAll(t, cfg, testSnapshot(models.DeviceStatusNormal), testSnapshot(models.DeviceStatusNormal))
+
+	tests := []struct {
+		key         string
+		stateTopic  string
+		template    string
+		deviceClass string
+		stateClass  string
+		unit        string
+	}{
+		{"pv_power", "solar/huawei_NE_1234/pv", "{{ value_json.totalPowerW }}", "power", "measurement", "W"},
+		{"pv_energy_today", "solar/huawei_NE_1234/pv", "{{ value_json.todayEnergyKWh }}", "energy", "total_increasing", "kWh"},
+		{"battery_soc", "solar/huawei_NE_1234/battery", "{{ value_json.socPercent }}", "battery", "measurement", "%"},
+		{"grid_export_total", "solar/huawei_NE_1234/grid", "{{ value_json.totalExportKWh }}", "energy", "total_increasing", "kWh"},
+		{"grid_a_voltage", "solar/huawei_NE_1234/grid/phase/a", "{{ value_json.voltageV }}", "voltage", "measurement", "V"},
+		{"grid_a_current", "solar/huawei_NE_1234/grid/phase/a", "{{ value_json.currentA }}", "current", "measurement", "A"},
+		{"grid_b_voltage", "solar/huawei_NE_1234/grid/phase/b", "{{ value_json.voltageV }}", "voltage", "measurement", "V"},
+	}
+	for _, tt := range tests {
+		var s haSensor
+		retainedJSON(t, pub, "ha/sensor/huawei_NE_1234/"+tt.key+"/config", &s)
+		if s.UniqueID != "solar_huawei_NE_1234_"+tt.key || s.StateTopic != tt.stateTopic || s.ValueTemplate != tt.template {
+			t.Errorf("%s: unique ID %q, state topic %q, template %q", tt.key, s.UniqueID, s.StateTopic, s.ValueTemplate)
+		}
+		if s.DeviceClass != tt.deviceClass || s.StateClass != tt.stateClass || s.Unit != tt.unit {
+			t.Errorf("%s: device_class %q, state_class %q, unit %q; want %q, %q, %q",
+				tt.key, s.DeviceClass, s.StateClass, s.Unit, tt.deviceClass, tt.stateClass, tt.unit)
+		}
+		if s.Device == nil || s.Device.Identifiers[0] != "huawei_NE=1234" || s.Device.Manufacturer != "huawei" {
+			t.Errorf("%s: device = %+v", tt.key, s.Device)
+		}
+	}
+
+	// Phase B has no current or power, so no sensors for them
+	for _, key := range []string{"grid_b_current", "grid_b_power", "load_power"} {
+		if _, ok := pub.Retained("ha/sensor/huawei_NE_1234/" + key + "/config"); ok {
+			t.Errorf("%s announced without a value", key)
+		}
+	}
+
+	configs := map[string]int{}
+	for _, msg := range pub.Messages() {
+		if strings.HasPrefix(msg.Topic, "ha/") {
+			configs[msg.Topic]++
+		}
+	}
+	for topic, n := range configs {
+		if n != 1 {
+			t.Errorf("%s announced %d times", topic, n)
+		}
+	}
+}
+
+func TestBridgeAvailabilityFollowsDeviceStatus(t *testing.T) {
+	cfg := Config{TopicPrefix: "solar", DiscoveryPrefix: "ha", Discovery: true}
+	const availability = "solar/huawei_NE_1234/availability"
+
+	pub := publishAll(t, cfg, testSnapshot(models.DeviceStatusNormal))
+	if msg, _ := pub.Retained(availability); string(msg.Payload) != "online" {
+		t.Errorf("availability = %q, want online", msg.Payload)
+	}
+
+	offline := testSnapshot(models.DeviceStatusOffline)
+	pub = publishAll(t, cfg, testSnapshot(models.DeviceStatusNormal), offline)
+	if msg, _ := pub.Retained(availability); string(msg.Payload) != "offline" {
+		t.Errorf("availability = %q, want offline", msg.Payload)
+	}
+	if msg, _ := pub.Retained("solar/huawei_NE_1234/status"); string(msg.Payload) != "offline" {
+		t.Errorf("status = %q, want offline", msg.Payload)
+	}
+
+	// Values go unavailable with the device, the status itself stays
+	// available to show it is offline
+	var status, power haSensor
+	retainedJSON(t, pub, "ha/sensor/huawei_NE_1234/status/config", &status)
+	retainedJSON(t, pub, "ha/sensor/huawei_NE_1234/pv_power/config", &power)
+	if status.AvailabilityMode != "all" || len(status.Availability) != 1 || status.Availability[0].Topic != "solar/status" {
+		t.Errorf("status availability = %+v (%s)", status.Availability, status.AvailabilityMode)
+	}
+	if len(power.Availability) != 2 || power.Availability[1].Topic != availability {
+		t.Errorf("pv_power availability = %+v", power.Availability)
+	}
+}
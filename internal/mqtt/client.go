@@ -0,0 +1,67 @@
+package mqtt
+
+import (
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	connectTimeout = 10 * time.Second
+	publishTimeout = 10 * time.Second
+)
+
+// Client is a Publisher backed by a broker connection. It registers the
+// status topic as the connection's last will, so subscribers see the service
+// go "offline" when it dies, and reconnects on its own.
+type Client struct {
+	client paho.Client
+	cfg    Config
+}
+
+// Dial connects to the broker in cfg.
+func Dial(cfg Config) (*Client, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectTimeout(connectTimeout).
+		SetWill(cfg.StatusTopic(), "offline", cfg.QoS, true)
+	opts.SetOnConnectHandler(func(c paho.Client) {
+		// Also runs after a reconnect, when the broker has published the will.
+		c.Publish(cfg.StatusTopic(), cfg.QoS, true, "online")
+		log.Info().Str("broker", cfg.Broker).Msg("Connected to MQTT broker")
+	})
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		log.Warn().Err(err).Str("broker", cfg.Broker).Msg("Lost connection to MQTT broker, reconnecting")
+	})
+
+	client := paho.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		return nil, fmt.Errorf("connect to %s: timed out", cfg.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", cfg.Broker, err)
+	}
+	return &Client{client: client, cfg: cfg}, nil
+}
+
+func (c *Client) Publish(topic string, payload []byte, retained bool) error {
+	token := c.client.Publish(topic, c.cfg.QoS, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("publish %s: timed out", topic)
+	}
+	return token.Error()
+}
+
+// Close announces the service "offline" and disconnects.
+func (c *Client) Close() error {
+	c.client.Publish(c.cfg.StatusTopic(), c.cfg.QoS, true, "offline").WaitTimeout(time.Second)
+	c.client.Disconnect(250)
+	return nil
+}
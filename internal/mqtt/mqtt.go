@@ -0,0 +1,124 @@
+// Package mqtt publishes realtime snapshots to an MQTT broker as retained
+// topics, with Home Assistant discovery configs so the values show up as
+// sensors, and in the energy dashboard, without manual configuration.
+package mqtt
+
+import (
+	"strings"
+	"sync"
+)
+
+// Config controls the MQTT output.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Broker URL, e.g. "tcp://localhost:1883", "ssl://broker:8883" or
+	// "ws://broker:9001".
+	Broker   string `yaml:"broker"`
+	ClientID string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// QoS of every message (0 or 1, default 1).
+	QoS byte `yaml:"qos"`
+
+	// Root of the state topics (default "inverters"): snapshots are published
+	// under <topic_prefix>/<device>/..., and the service's own availability
+	// at <topic_prefix>/status.
+	TopicPrefix string `yaml:"topic_prefix"`
+
+	// Publish Home Assistant discovery configs (default true) under
+	// discovery_prefix (default "homeassistant").
+	Discovery       bool   `yaml:"discovery"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+}
+
+// DefaultConfig returns the MQTT settings used when the config file sets none.
+func DefaultConfig() Config {
+	return Config{
+		Broker:          "tcp://localhost:1883",
+		ClientID:        "inverter-normalizer",
+		QoS:             1,
+		TopicPrefix:     "inverters",
+		Discovery:       true,
+		DiscoveryPrefix: "homeassistant",
+	}
+}
+
+// StatusTopic is where the service announces itself "online", and where the
+// broker publishes "offline" when the connection is lost.
+func (c Config) StatusTopic() string {
+	return c.TopicPrefix + "/status"
+}
+
+// Publisher sends messages to a broker.
+type Publisher interface {
+	Publish(topic string, payload []byte, retained bool) error
+	Close() error
+}
+
+// Message is a published MQTT message.
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// MemoryPublisher is an in-process stand-in for a broker. It records every
+// message and, like a broker, keeps the last retained message of each topic.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+	retained map[string]Message
+}
+
+// NewMemoryPublisher creates an empty in-process publisher.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{retained: make(map[string]Message)}
+}
+
+func (m *MemoryPublisher) Publish(topic string, payload []byte, retained bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg := Message{Topic: topic, Payload: append([]byte(nil), payload...), Retained: retained}
+	m.messages = append(m.messages, msg)
+	if retained {
+		// An empty retained message clears the topic.
+		if len(payload) == 0 {
+			delete(m.retained, topic)
+		} else {
+			m.retained[topic] = msg
+		}
+	}
+	return nil
+}
+
+// Messages returns every message published so far, oldest first.
+func (m *MemoryPublisher) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Retained returns the retained message of a topic, as a subscriber joining
+// now would receive it.
+func (m *MemoryPublisher) Retained(topic string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, ok := m.retained[topic]
+	return msg, ok
+}
+
+func (m *MemoryPublisher) Close() error { return nil }
+
+// topicID makes a normalized ID safe to use as a topic level and as a Home
+// Assistant object ID, which only allow [a-zA-Z0-9_-].
+func topicID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, id)
+}
@@ -0,0 +1,157 @@
+package normalizer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig sets how long normalized responses are served from memory
+// before the vendor API is asked again. A TTL of 0 disables caching for that
+// kind of data; concurrent identical requests are still collapsed into one
+// vendor call.
+type CacheConfig struct {
+	PlantsTTLSeconds   int `yaml:"plants_ttl_seconds"`   // plant lists and details
+	DevicesTTLSeconds  int `yaml:"devices_ttl_seconds"`  // device lists and details
+	RealtimeTTLSeconds int `yaml:"realtime_ttl_seconds"` // realtime snapshots
+	EnergyTTLSeconds   int `yaml:"energy_ttl_seconds"`   // energy statistics
+	HistoryTTLSeconds  int `yaml:"history_ttl_seconds"`  // historical time series
+}
+
+// DefaultCacheConfig returns the TTLs used when the config file sets none.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		PlantsTTLSeconds:   600,
+		DevicesTTLSeconds:  600,
+		RealtimeTTLSeconds: 30,
+		EnergyTTLSeconds:   300,
+		HistoryTTLSeconds:  900,
+	}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose engine queries skip cached responses
+// and always fetch from the vendor. The fresh result still refreshes the cache.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// CacheBypassed reports whether ctx was marked by WithoutCache.
+func CacheBypassed(ctx context.Context) bool {
+	return ctx.Value(noCacheKey{}) != nil
+}
+
+// sweepInterval is how often expired entries are dropped.
+const sweepInterval = time.Minute
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cache is a TTL cache of normalized responses keyed by provider instance,
+// operation and arguments. Cached values are shared between callers and must
+// not be modified.
+type cache struct {
+	mu        sync.Mutex
+	ttls      map[provider.Operation]time.Duration
+	entries   map[string]cacheEntry
+	lastSweep time.Time
+	flights   singleflight.Group
+	now       func() time.Time
+}
+
+func newCache(cfg CacheConfig) *cache {
+	c := &cache{entries: make(map[string]cacheEntry), lastSweep: time.Now(), now: time.Now}
+	c.configure(cfg)
+	return c
+}
+
+func (c *cache) configure(cfg CacheConfig) {
+	seconds := func(n int) time.Duration { return time.Duration(n) * time.Second }
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttls = map[provider.Operation]time.Duration{
+		provider.OpGetPlants:         seconds(cfg.PlantsTTLSeconds),
+		provider.OpGetPlantDetails:   seconds(cfg.PlantsTTLSeconds),
+		provider.OpGetDevices:        seconds(cfg.DevicesTTLSeconds),
+		provider.OpGetDeviceDetails:  seconds(cfg.DevicesTTLSeconds),
+		provider.OpGetRealTimeData:   seconds(cfg.RealtimeTTLSeconds),
+		provider.OpGetEnergyStats:    seconds(cfg.EnergyTTLSeconds),
+		provider.OpGetHistoricalData: seconds(cfg.HistoryTTLSeconds),
+	}
+	c.entries = make(map[string]cacheEntry)
+}
+
+func (c *cache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *cache) set(key string, op provider.Operation, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) > sweepInterval {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	ttl := c.ttls[op]
+	if ttl <= 0 {
+		return
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+func cacheKey(instance string, op provider.Operation, args ...string) string {
+	return instance + "\x00" + string(op) + "\x00" + strings.Join(args, "\x00")
+}
+
+// cached serves key from the cache or calls fetch, sharing one fetch among
+// concurrent callers. The shared fetch is detached from the first caller's
+// cancellation so that caller going away does not fail the others; each
+// caller still stops waiting when its own ctx is done.
+func cached[T any](ctx context.Context, c *cache, op provider.Operation, key string, fetch func(context.Context) (T, error)) (T, error) {
+	if !CacheBypassed(ctx) {
+		if v, ok := c.get(key); ok {
+			return v.(T), nil
+		}
+	}
+
+	ch := c.flights.DoChan(key, func() (interface{}, error) {
+		v, err := fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, op, v)
+		return v, nil
+	})
+
+	var zero T
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
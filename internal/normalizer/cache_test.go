@@ -0,0 +1,178 @@
+package normalizer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// testCache returns a cache keeping realtime data for 30s, on a clock the
+// test moves by hand.
+func testCache() (*cache, *time.Time) {
+	now := time.Date(2024, 6, 14, 11, 5, 0, 0, time.UTC)
+	c := newCache(CacheConfig{RealtimeTTLSeconds: 30})
+	c.now = func() time.Time { return now }
+	c.lastSweep = now
+	return c, &now
+}
+
+func TestCachedSharesOneFetch(t *testing.T) {
+	c, _ := testCache()
+	key := cacheKey("huawei", provider.OpGetRealTimeData, "inv1")
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "snapshot", nil
+	}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make(chan string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cached(context.Background(), c, provider.OpGetRealTimeData, key, fetch)
+			if err != nil {
+				t.Errorf("cached: %v", err)
+			}
+			results <- v
+		}()
+	}
+	// Let the callers pile up behind the fetch in flight; late ones are
+	// served from the cache
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d vendor calls for %d concurrent callers, want 1", n, callers)
+	}
+	for v := range results {
+		if v != "snapshot" {
+			t.Errorf("caller got %q", v)
+		}
+	}
+}
+
+func TestCachedRefetchesExpired(t *testing.T) {
+	c, now := testCache()
+	key := cacheKey("huawei", provider.OpGetRealTimeData, "inv1")
+	calls := 0
+	fetch := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+	get := func() int {
+		t.Helper()
+		v, err := cached(context.Background(), c, provider.OpGetRealTimeData, key, fetch)
+		if err != nil {
+			t.Fatalf("cached: %v", err)
+		}
+		return v
+	}
+
+	if v := get(); v != 1 {
+		t.Fatalf("first call = %d", v)
+	}
+	*now = now.Add(30 * time.Second)
+	if v := get(); v != 1 || calls != 1 {
+		t.Errorf("within the TTL: value %d after %d calls, want the cached 1", v, calls)
+	}
+	*now = now.Add(time.Second)
+	if v := get(); v != 2 || calls != 2 {
+		t.Errorf("after the TTL: value %d after %d calls, want a new fetch", v, calls)
+	}
+
+	// WithoutCache fetches anyway and refreshes the entry
+	v, _ := cached(WithoutCache(context.Background()), c, provider.OpGetRealTimeData, key, fetch)
+	if v != 3 || get() != 3 {
+		t.Errorf("bypass returned %d, cache then holds %d; want 3, 3", v, get())
+	}
+}
+
+func TestCachedSkipsErrorsAndUncachedOperations(t *testing.T) {
+	c, _ := testCache()
+	calls := 0
+	failing := func(ctx context.Context) (int, error) {
+		calls++
+		return 0, errors.New("upstream down")
+	}
+	key := cacheKey("huawei", provider.OpGetRealTimeData, "inv1")
+	for i := 0; i < 2; i++ {
+		if _, err := cached(context.Background(), c, provider.OpGetRealTimeData, key, failing); err == nil {
+			t.Fatal("error not returned")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("%d fetches for 2 failing calls, want 2: errors must not be cached", calls)
+	}
+
+	// Plants have no TTL in this config
+	calls = 0
+	ok := func(ctx context.Context) (int, error) {
+		calls++
+		return calls, nil
+	}
+	key = cacheKey("huawei", provider.OpGetPlants)
+	cached(context.Background(), c, provider.OpGetPlants, key, ok)
+	cached(context.Background(), c, provider.OpGetPlants, key, ok)
+	if calls != 2 {
+		t.Errorf("%d fetches with a TTL of 0, want 2", calls)
+	}
+}
+
+func TestCachedCallerCancellation(t *testing.T) {
+	c, _ := testCache()
+	key := cacheKey("huawei", provider.OpGetRealTimeData, "inv1")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	fetch := func(ctx context.Context) (string, error) {
+		once.Do(func() { close(started) })
+		<-release
+		// The first caller is gone by now, the fetch must go on
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "snapshot", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cached(ctx, c, provider.OpGetRealTimeData, key, fetch)
+		first <- err
+	}()
+	<-started
+
+	second := make(chan string, 1)
+	go func() {
+		v, err := cached(context.Background(), c, provider.OpGetRealTimeData, key, fetch)
+		if err != nil {
+			t.Errorf("second caller: %v", err)
+		}
+		second <- v
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if v := <-second; v != "snapshot" {
+		t.Errorf("second caller got %q", v)
+	}
+}
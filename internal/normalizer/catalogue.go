@@ -0,0 +1,235 @@
+package normalizer
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// The alarm catalogue maps every vendor's alarms onto one taxonomy of
+// normalized codes, so alarms can be triaged the same way across brands. The
+// engine classifies every alarm it returns; the mapping tables live in
+// alarm_catalogue.yaml.
+
+//go:embed alarm_catalogue.yaml
+var alarmCatalogueYAML []byte
+
+// unknownAlarmCode is the normalized code of alarms the catalogue does not map.
+const unknownAlarmCode = "unknown"
+
+// AlarmCode is an entry of the alarm taxonomy.
+type AlarmCode struct {
+	Code     string               `json:"code"`
+	Category models.AlarmCategory `json:"category" yaml:"category"`
+	Title    string               `json:"title" yaml:"title"`
+	Severity models.AlarmSeverity `json:"severity" yaml:"severity"` // used when the vendor reports none
+	Action   string               `json:"action" yaml:"action"`
+}
+
+type catalogueFile struct {
+	Codes   map[string]AlarmCode `yaml:"codes"`
+	Vendors map[string]struct {
+		Codes map[string]string `yaml:"codes"`
+		Names []nameRuleFile    `yaml:"names"`
+	} `yaml:"vendors"`
+	Common []nameRuleFile `yaml:"common"`
+}
+
+type nameRuleFile struct {
+	Code  string   `yaml:"code"`
+	Match []string `yaml:"match"`
+}
+
+// nameRule maps alarms whose name or message contains all words of any of
+// its alternatives.
+type nameRule struct {
+	code         *AlarmCode
+	alternatives [][]string
+}
+
+type vendorAlarms struct {
+	codes map[string]*AlarmCode
+	names []nameRule
+}
+
+type alarmCatalogue struct {
+	codes   map[string]*AlarmCode
+	vendors map[string]*vendorAlarms // by provider type
+	common  []nameRule
+}
+
+var catalogue = mustLoadCatalogue(alarmCatalogueYAML)
+
+func mustLoadCatalogue(data []byte) *alarmCatalogue {
+	c, err := loadCatalogue(data)
+	if err != nil {
+		panic("alarm catalogue: " + err.Error())
+	}
+	return c
+}
+
+func loadCatalogue(data []byte) (*alarmCatalogue, error) {
+	var file catalogueFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	c := &alarmCatalogue{
+		codes:   make(map[string]*AlarmCode, len(file.Codes)),
+		vendors: make(map[string]*vendorAlarms, len(file.Vendors)),
+	}
+	for code, entry := range file.Codes {
+		switch entry.Category {
+		case models.AlarmCategoryGrid, models.AlarmCategoryPV, models.AlarmCategorySafety, models.AlarmCategoryThermal,
+			models.AlarmCategoryBattery, models.AlarmCategoryCommunication, models.AlarmCategoryHardware, models.AlarmCategoryOther:
+		default:
+			return nil, fmt.Errorf("code %s: unknown category %q", code, entry.Category)
+		}
+		switch entry.Severity {
+		case models.AlarmSeverityInfo, models.AlarmSeverityWarning, models.AlarmSeverityCritical, models.AlarmSeverityUnknown:
+		default:
+			return nil, fmt.Errorf("code %s: unknown severity %q", code, entry.Severity)
+		}
+		entry.Code = code
+		entry.Action = strings.TrimSpace(entry.Action)
+		c.codes[code] = &entry
+	}
+	if c.codes[unknownAlarmCode] == nil {
+		return nil, fmt.Errorf("code %s is not defined", unknownAlarmCode)
+	}
+
+	rules := func(where string, files []nameRuleFile) ([]nameRule, error) {
+		var rules []nameRule
+		for _, rf := range files {
+			entry, ok := c.codes[rf.Code]
+			if !ok {
+				return nil, fmt.Errorf("%s: undefined code %q", where, rf.Code)
+			}
+			rule := nameRule{code: entry}
+			for _, alt := range rf.Match {
+				words := alarmWords(alt)
+				if len(words) == 0 {
+					return nil, fmt.Errorf("%s: empty match for %s", where, rf.Code)
+				}
+				rule.alternatives = append(rule.alternatives, words)
+			}
+			rules = append(rules, rule)
+		}
+		return rules, nil
+	}
+
+	for vendor, vf := range file.Vendors {
+		v := &vendorAlarms{codes: make(map[string]*AlarmCode, len(vf.Codes))}
+		for vendorCode, code := range vf.Codes {
+			entry, ok := c.codes[code]
+			if !ok {
+				return nil, fmt.Errorf("vendor %s code %s: undefined code %q", vendor, vendorCode, code)
+			}
+			v.codes[vendorCode] = entry
+		}
+		var err error
+		if v.names, err = rules("vendor "+vendor, vf.Names); err != nil {
+			return nil, err
+		}
+		c.vendors[vendor] = v
+	}
+	var err error
+	if c.common, err = rules("common", file.Common); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AlarmCatalogue returns the normalized alarm codes, sorted by category and
+// code.
+func AlarmCatalogue() []AlarmCode {
+	codes := make([]AlarmCode, 0, len(catalogue.codes))
+	for _, entry := range catalogue.codes {
+		codes = append(codes, *entry)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].Category != codes[j].Category {
+			return codes[i].Category < codes[j].Category
+		}
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
+
+// classifyAlarm sets the category, normalized code and recommended action of
+// an alarm from a vendor of provider type typ. An adapter may set
+// NormalizedCode itself when it knows better; the rest is filled in from the
+// catalogue. The vendor's severity is kept unless it is unknown.
+func classifyAlarm(alarm *models.NormalizedAlarm, typ string) {
+	entry := catalogue.codes[alarm.NormalizedCode]
+	if entry == nil {
+		entry = catalogue.lookup(typ, alarm)
+	}
+	alarm.NormalizedCode = entry.Code
+	alarm.Category = entry.Category
+	alarm.RecommendedAction = entry.Action
+	if alarm.Severity == "" || alarm.Severity == models.AlarmSeverityUnknown {
+		alarm.Severity = entry.Severity
+	}
+}
+
+func (c *alarmCatalogue) lookup(typ string, alarm *models.NormalizedAlarm) *AlarmCode {
+	vendor := c.vendors[typ]
+	if vendor != nil {
+		if entry, ok := vendor.codes[alarm.Code]; ok {
+			return entry
+		}
+	}
+
+	words := alarmWords(alarm.Name + " " + alarm.Message)
+	if vendor != nil {
+		if entry := matchRules(vendor.names, words); entry != nil {
+			return entry
+		}
+	}
+	if entry := matchRules(c.common, words); entry != nil {
+		return entry
+	}
+	return c.codes[unknownAlarmCode]
+}
+
+func matchRules(rules []nameRule, words []string) *AlarmCode {
+	for _, rule := range rules {
+		for _, alt := range rule.alternatives {
+			if containsWords(words, alt) {
+				return rule.code
+			}
+		}
+	}
+	return nil
+}
+
+// containsWords reports whether every word of want is among words. Words of
+// four letters or more also match longer words they begin.
+func containsWords(words, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, word := range words {
+			if word == w || (len(w) >= 4 && strings.HasPrefix(word, w)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// alarmWords splits s into lower-case words of letters and digits.
+func alarmWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -2,8 +2,13 @@ package normalizer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
@@ -14,34 +19,119 @@ import (
 // and exposes a unified interface for querying normalized data.
 type Engine struct {
 	mu        sync.RWMutex
-	providers map[string]provider.Provider
+	providers map[string]*registered
+	cache     *cache
+	hooks     hooks
+}
+
+// registered is a provider instance guarded by its own circuit breaker.
+type registered struct {
+	provider.Provider
+	breaker *provider.CircuitBreaker
+}
+
+// call is a vendor call in progress, see begin.
+type call struct {
+	hooks    *hooks
+	p        *registered
+	instance string
+	op       provider.Operation
+	start    time.Time
+}
+
+// begin asks the circuit breaker whether a vendor call may proceed and
+// returns the context to make it with, which names the instance for the
+// HTTP client (see provider.WithInstance). Every allowed call must report its
+// outcome with call.end.
+func (e *Engine) begin(ctx context.Context, p *registered, name string, op provider.Operation) (context.Context, *call, error) {
+	if err := p.breaker.Allow(); err != nil {
+		e.hooks.emitCall(CallEvent{Instance: name, Type: p.Name(), Op: op, Err: err})
+		return ctx, nil, annotateError(err, p.Name(), name)
+	}
+	c := &call{hooks: &e.hooks, p: p, instance: name, op: op, start: time.Now()}
+	return provider.WithInstance(ctx, name), c, nil
+}
+
+// end records the outcome of the call with the circuit breaker and reports
+// it to the call hooks.
+func (c *call) end(err error) {
+	c.p.breaker.Record(err)
+	c.hooks.emitCall(CallEvent{
+		Instance: c.instance,
+		Type:     c.p.Name(),
+		Op:       c.op,
+		Duration: time.Since(c.start),
+		Err:      err,
+	})
 }
 
 // NewEngine creates a new normalization engine.
 func NewEngine() *Engine {
 	return &Engine{
-		providers: make(map[string]provider.Provider),
+		providers: make(map[string]*registered),
+		cache:     newCache(CacheConfig{}),
 	}
 }
 
-// RegisterProvider adds an initialized provider to the engine.
-func (e *Engine) RegisterProvider(p provider.Provider) {
+// SetCache sets the response cache TTLs and drops anything cached so far.
+// A new engine caches nothing until SetCache is called.
+func (e *Engine) SetCache(cfg CacheConfig) {
+	e.cache.configure(cfg)
+}
+
+// ProviderInfo describes a provider instance registered with the engine.
+type ProviderInfo struct {
+	Name string `json:"name"` // configured instance name (e.g. "saj-production")
+	Type string `json:"type"` // provider type (e.g. "saj")
+
+	Capabilities provider.Capabilities `json:"capabilities"`
+}
+
+// RegisterProvider adds an initialized provider to the engine under the given
+// instance name, guarded by a circuit breaker configured by breaker. Several
+// instances of the same provider type may be registered side by side as long
+// as their names differ. If name is empty the provider type is used.
+func (e *Engine) RegisterProvider(name string, p provider.Provider, breaker provider.BreakerConfig) error {
+	if name == "" {
+		name = p.Name()
+	}
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	name := p.Name()
-	e.providers[name] = p
-	log.Info().Str("provider", name).Msg("Provider registered with engine")
+	if _, exists := e.providers[name]; exists {
+		return fmt.Errorf("provider instance %q already registered", name)
+	}
+	e.providers[name] = &registered{Provider: p, breaker: provider.NewCircuitBreaker(breaker)}
+	log.Info().Str("provider", name).Str("type", p.Name()).Msg("Provider registered with engine")
+	return nil
 }
 
-// GetProvider returns a specific provider by name.
+// GetProvider returns a specific provider by instance name.
 func (e *Engine) GetProvider(name string) (provider.Provider, bool) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 	p, ok := e.providers[name]
-	return p, ok
+	if !ok {
+		return nil, false
+	}
+	return p.Provider, true
+}
+
+// lookup returns the provider registered under name, provided it supports op.
+func (e *Engine) lookup(name string, op provider.Operation) (*registered, error) {
+	e.mu.RLock()
+	p, ok := e.providers[name]
+	e.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrProviderNotFound, name)
+	}
+	if !p.Capabilities().Supports(op) {
+		return nil, annotateError(provider.NotSupported(p.Name(), op, ""), p.Name(), name)
+	}
+	return p, nil
 }
 
-// ProviderNames returns the names of all registered providers.
+// ProviderNames returns the instance names of all registered providers.
 func (e *Engine) ProviderNames() []string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
@@ -49,181 +139,403 @@ func (e *Engine) ProviderNames() []string {
 	for name := range e.providers {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
+// Providers describes all registered provider instances, sorted by name.
+func (e *Engine) Providers() []ProviderInfo {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	infos := make([]ProviderInfo, 0, len(e.providers))
+	for name, p := range e.providers {
+		infos = append(infos, ProviderInfo{Name: name, Type: p.Name(), Capabilities: p.Capabilities()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
 // ── Aggregated queries across all providers ──
 
-// GetAllPlants returns plants from all configured providers, fetched concurrently.
-func (e *Engine) GetAllPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
+// GetAllPlants returns plants from all configured providers, fetched
+// concurrently, together with the outcome for each provider instance.
+// It only fails if every provider failed.
+func (e *Engine) GetAllPlants(ctx context.Context) ([]models.NormalizedPlant, []SourceStatus, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	type result struct {
-		plants []models.NormalizedPlant
-		err    error
-		name   string
+		plants  []models.NormalizedPlant
+		err     error
+		name    string
+		skipped bool
+		latency time.Duration
 	}
 
 	ch := make(chan result, len(e.providers))
 	for name, p := range e.providers {
-		go func(name string, p provider.Provider) {
-			plants, err := p.GetPlants(ctx)
-			ch <- result{plants: plants, err: err, name: name}
+		go func(name string, p *registered) {
+			if !p.Capabilities().Supports(provider.OpGetPlants) {
+				ch <- result{name: name, skipped: true}
+				return
+			}
+			start := time.Now()
+			plants, err := cached(ctx, e.cache, provider.OpGetPlants, cacheKey(name, provider.OpGetPlants), func(ctx context.Context) ([]models.NormalizedPlant, error) {
+				ctx, call, err := e.begin(ctx, p, name, provider.OpGetPlants)
+				if err != nil {
+					return nil, err
+				}
+				plants, err := p.GetPlants(ctx)
+				call.end(err)
+				if err != nil {
+					return nil, annotateError(err, p.Name(), name)
+				}
+				for i := range plants {
+					stampPlant(&plants[i], p.Name(), name)
+				}
+				return plants, nil
+			})
+			ch <- result{plants: plants, err: err, name: name, latency: time.Since(start)}
 		}(name, p)
 	}
 
 	var allPlants []models.NormalizedPlant
-	var errors []error
+	var errs []error
+	sources := make([]SourceStatus, 0, len(e.providers))
 	for i := 0; i < len(e.providers); i++ {
 		r := <-ch
+		if r.skipped {
+			continue
+		}
+		sources = append(sources, newSourceStatus(r.name, r.err, r.latency))
 		if r.err != nil {
 			log.Error().Err(r.err).Str("provider", r.name).Msg("Failed to fetch plants")
-			errors = append(errors, fmt.Errorf("%s: %w", r.name, r.err))
+			errs = append(errs, r.err)
 			continue
 		}
 		allPlants = append(allPlants, r.plants...)
 	}
+	sortSources(sources)
 
-	if len(allPlants) == 0 && len(errors) > 0 {
-		return nil, fmt.Errorf("all providers failed: %v", errors)
+	if len(allPlants) == 0 && len(errs) > 0 && len(errs) == len(sources) {
+		if len(errs) == 1 {
+			return nil, sources, errs[0]
+		}
+		return nil, sources, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
 	}
 
-	return allPlants, nil
+	return allPlants, sources, nil
 }
 
-// GetAllDevices returns all devices from all providers (from a specific plant or all).
-func (e *Engine) GetAllDevices(ctx context.Context) ([]models.NormalizedDevice, error) {
-	plants, err := e.GetAllPlants(ctx)
+// GetAllDevices returns all devices from all plants of all providers, with the
+// outcome for each provider instance. An instance is reported failed if
+// listing its plants or the devices of any of its plants failed.
+func (e *Engine) GetAllDevices(ctx context.Context) ([]models.NormalizedDevice, []SourceStatus, error) {
+	start := time.Now()
+	plants, sources, err := e.GetAllPlants(ctx)
 	if err != nil {
-		return nil, err
+		return nil, sources, err
 	}
 
 	type result struct {
-		devices []models.NormalizedDevice
-		err     error
+		devices  []models.NormalizedDevice
+		err      error
+		instance string
+		done     time.Time
 	}
 
 	ch := make(chan result, len(plants))
 	for _, plant := range plants {
 		go func(plant models.NormalizedPlant) {
-			p, ok := e.providers[plant.Provider]
-			if !ok {
-				ch <- result{err: fmt.Errorf("provider %s not found", plant.Provider)}
-				return
-			}
-			devices, err := p.GetDevices(ctx, plant.Meta.ProviderPlantID)
-			ch <- result{devices: devices, err: err}
+			devices, err := e.GetDevices(ctx, plant.Meta.Instance, plant.Meta.ProviderPlantID)
+			ch <- result{devices: devices, err: err, instance: plant.Meta.Instance, done: time.Now()}
 		}(plant)
 	}
 
+	index := make(map[string]int, len(sources))
+	for i, src := range sources {
+		index[src.Provider] = i
+	}
+
 	var allDevices []models.NormalizedDevice
 	for i := 0; i < len(plants); i++ {
 		r := <-ch
+		idx, tracked := index[r.instance]
+		if tracked {
+			if latency := r.done.Sub(start).Milliseconds(); latency > sources[idx].LatencyMs {
+				sources[idx].LatencyMs = latency
+			}
+		}
+		if errors.Is(r.err, provider.ErrNotSupported) {
+			continue
+		}
 		if r.err != nil {
-			log.Warn().Err(r.err).Msg("Failed to fetch devices for a plant")
+			log.Warn().Err(r.err).Str("provider", r.instance).Msg("Failed to fetch devices for a plant")
+			if tracked && sources[idx].Status == SourceOK {
+				latency := sources[idx].LatencyMs
+				sources[idx] = newSourceStatus(r.instance, r.err, 0)
+				sources[idx].LatencyMs = latency
+			}
 			continue
 		}
 		allDevices = append(allDevices, r.devices...)
 	}
 
-	return allDevices, nil
+	return allDevices, sources, nil
 }
 
 // GetRealTimeData fetches real-time data from the appropriate provider.
 func (e *Engine) GetRealTimeData(ctx context.Context, providerName, deviceID string) (*models.NormalizedRealtime, error) {
-	p, ok := e.GetProvider(providerName)
-	if !ok {
-		return nil, fmt.Errorf("provider %q not registered", providerName)
+	p, err := e.lookup(providerName, provider.OpGetRealTimeData)
+	if err != nil {
+		return nil, err
 	}
-	return p.GetRealTimeData(ctx, deviceID)
+	key := cacheKey(providerName, provider.OpGetRealTimeData, deviceID)
+	return cached(ctx, e.cache, provider.OpGetRealTimeData, key, func(ctx context.Context) (*models.NormalizedRealtime, error) {
+		ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetRealTimeData)
+		if err != nil {
+			return nil, err
+		}
+		rt, err := p.GetRealTimeData(ctx, deviceID)
+		call.end(err)
+		if err != nil {
+			return nil, annotateError(err, p.Name(), providerName)
+		}
+		stampRealtime(rt, p.Name(), providerName, deviceID)
+		e.hooks.emitRealtime(rt)
+		return rt, nil
+	})
 }
 
 // GetPlantDetails fetches details for a specific plant from the given provider.
 func (e *Engine) GetPlantDetails(ctx context.Context, providerName, plantID string) (*models.NormalizedPlant, error) {
-	p, ok := e.GetProvider(providerName)
-	if !ok {
-		return nil, fmt.Errorf("provider %q not registered", providerName)
+	p, err := e.lookup(providerName, provider.OpGetPlantDetails)
+	if err != nil {
+		return nil, err
 	}
-	return p.GetPlantDetails(ctx, plantID)
+	key := cacheKey(providerName, provider.OpGetPlantDetails, plantID)
+	return cached(ctx, e.cache, provider.OpGetPlantDetails, key, func(ctx context.Context) (*models.NormalizedPlant, error) {
+		ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetPlantDetails)
+		if err != nil {
+			return nil, err
+		}
+		plant, err := p.GetPlantDetails(ctx, plantID)
+		call.end(err)
+		if err != nil {
+			return nil, annotateError(err, p.Name(), providerName)
+		}
+		stampPlant(plant, p.Name(), providerName)
+		return plant, nil
+	})
 }
 
 // GetDevices fetches all devices from a specific plant/provider.
 func (e *Engine) GetDevices(ctx context.Context, providerName, plantID string) ([]models.NormalizedDevice, error) {
-	p, ok := e.GetProvider(providerName)
-	if !ok {
-		return nil, fmt.Errorf("provider %q not registered", providerName)
+	p, err := e.lookup(providerName, provider.OpGetDevices)
+	if err != nil {
+		return nil, err
 	}
-	return p.GetDevices(ctx, plantID)
+	key := cacheKey(providerName, provider.OpGetDevices, plantID)
+	return cached(ctx, e.cache, provider.OpGetDevices, key, func(ctx context.Context) ([]models.NormalizedDevice, error) {
+		ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetDevices)
+		if err != nil {
+			return nil, err
+		}
+		devices, err := p.GetDevices(ctx, plantID)
+		call.end(err)
+		if err != nil {
+			return nil, annotateError(err, p.Name(), providerName)
+		}
+		for i := range devices {
+			stampDevice(&devices[i], p.Name(), providerName)
+		}
+		return devices, nil
+	})
+}
+
+// GetDeviceDetails fetches details for a single device from the given provider.
+func (e *Engine) GetDeviceDetails(ctx context.Context, providerName, deviceID string) (*models.NormalizedDevice, error) {
+	p, err := e.lookup(providerName, provider.OpGetDeviceDetails)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(providerName, provider.OpGetDeviceDetails, deviceID)
+	return cached(ctx, e.cache, provider.OpGetDeviceDetails, key, func(ctx context.Context) (*models.NormalizedDevice, error) {
+		ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetDeviceDetails)
+		if err != nil {
+			return nil, err
+		}
+		dev, err := p.GetDeviceDetails(ctx, deviceID)
+		call.end(err)
+		if err != nil {
+			return nil, annotateError(err, p.Name(), providerName)
+		}
+		stampDevice(dev, p.Name(), providerName)
+		return dev, nil
+	})
 }
 
 // GetEnergyStats fetches energy stats from the appropriate provider.
 func (e *Engine) GetEnergyStats(ctx context.Context, providerName, plantID, period, date string) (*models.NormalizedEnergy, error) {
-	p, ok := e.GetProvider(providerName)
-	if !ok {
-		return nil, fmt.Errorf("provider %q not registered", providerName)
+	p, err := e.lookup(providerName, provider.OpGetEnergyStats)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Capabilities().SupportsPeriod(models.Period(period)) {
+		err := provider.NotSupported(p.Name(), provider.OpGetEnergyStats, fmt.Sprintf("for period %q", period))
+		return nil, annotateError(err, p.Name(), providerName)
 	}
-	return p.GetEnergyStats(ctx, plantID, models.Period(period))
+	key := cacheKey(providerName, provider.OpGetEnergyStats, plantID, period, date)
+	return cached(ctx, e.cache, provider.OpGetEnergyStats, key, func(ctx context.Context) (*models.NormalizedEnergy, error) {
+		ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetEnergyStats)
+		if err != nil {
+			return nil, err
+		}
+		energy, err := p.GetEnergyStats(ctx, plantID, models.Period(period))
+		call.end(err)
+		if err != nil {
+			return nil, annotateError(err, p.Name(), providerName)
+		}
+		stampEnergy(energy, p.Name(), providerName, plantID)
+		return energy, nil
+	})
 }
 
 // GetHistoricalData fetches historical data from the appropriate provider.
 func (e *Engine) GetHistoricalData(ctx context.Context, providerName string, req models.HistoryRequest) (*models.HistoryResponse, error) {
-	p, ok := e.GetProvider(providerName)
-	if !ok {
-		return nil, fmt.Errorf("provider %q not registered", providerName)
+	p, err := e.lookup(providerName, provider.OpGetHistoricalData)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Capabilities().SupportsGranularity(req.Granularity) {
+		err := provider.NotSupported(p.Name(), provider.OpGetHistoricalData, fmt.Sprintf("at granularity %q", req.Granularity))
+		return nil, annotateError(err, p.Name(), providerName)
 	}
-	return p.GetHistoricalData(ctx, req.DeviceID, req)
+	key := cacheKey(providerName, provider.OpGetHistoricalData, req.DeviceID, req.StartTime, req.EndTime,
+		string(req.Granularity), strings.Join(req.Metrics, ","), strconv.Itoa(req.Page), strconv.Itoa(req.PageSize))
+	return cached(ctx, e.cache, provider.OpGetHistoricalData, key, func(ctx context.Context) (*models.HistoryResponse, error) {
+		ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetHistoricalData)
+		if err != nil {
+			return nil, err
+		}
+		history, err := p.GetHistoricalData(ctx, req.DeviceID, req)
+		call.end(err)
+		if err != nil {
+			return nil, annotateError(err, p.Name(), providerName)
+		}
+		stampHistory(history, p.Name(), providerName, req.DeviceID)
+		e.hooks.emitHistory(history)
+		return history, nil
+	})
 }
 
-// GetAllAlarms returns alarms from all providers concurrently.
-func (e *Engine) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
+// GetAllAlarms returns alarms from all providers concurrently, with the
+// outcome for each provider instance. It fails if every instance failed.
+func (e *Engine) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, []SourceStatus, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	type result struct {
-		alarms []models.NormalizedAlarm
-		err    error
-		name   string
+		alarms  []models.NormalizedAlarm
+		err     error
+		name    string
+		skipped bool
+		latency time.Duration
 	}
 
 	ch := make(chan result, len(e.providers))
 	for name, p := range e.providers {
-		go func(name string, p provider.Provider) {
+		go func(name string, p *registered) {
+			if !p.Capabilities().Supports(provider.OpGetAllAlarms) {
+				ch <- result{name: name, skipped: true}
+				return
+			}
+			start := time.Now()
+			ctx, call, err := e.begin(ctx, p, name, provider.OpGetAllAlarms)
+			if err != nil {
+				ch <- result{err: err, name: name}
+				return
+			}
 			alarms, err := p.GetAllAlarms(ctx)
-			ch <- result{alarms: alarms, err: err, name: name}
+			call.end(err)
+			for i := range alarms {
+				stampAlarm(&alarms[i], p.Name(), name)
+			}
+			ch <- result{alarms: alarms, err: annotateError(err, p.Name(), name), name: name, latency: time.Since(start)}
 		}(name, p)
 	}
 
 	var allAlarms []models.NormalizedAlarm
+	var errs []error
+	sources := make([]SourceStatus, 0, len(e.providers))
 	for i := 0; i < len(e.providers); i++ {
 		r := <-ch
+		if r.skipped {
+			continue
+		}
+		sources = append(sources, newSourceStatus(r.name, r.err, r.latency))
 		if r.err != nil {
 			log.Warn().Err(r.err).Str("provider", r.name).Msg("Failed to fetch alarms")
+			errs = append(errs, r.err)
 			continue
 		}
+		e.hooks.emitAlarms(AlarmSnapshot{Instance: r.name, Alarms: r.alarms})
 		allAlarms = append(allAlarms, r.alarms...)
 	}
+	sortSources(sources)
 
-	return allAlarms, nil
+	// No alarms because every source failed is not "no alarms"
+	if len(allAlarms) == 0 && len(errs) > 0 && len(errs) == len(sources) {
+		if len(errs) == 1 {
+			return nil, sources, errs[0]
+		}
+		return nil, sources, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+	}
+
+	return allAlarms, sources, nil
 }
 
 // GetDeviceAlarms fetches alarms for a specific device.
 func (e *Engine) GetDeviceAlarms(ctx context.Context, providerName, deviceID string) ([]models.NormalizedAlarm, error) {
-	p, ok := e.GetProvider(providerName)
-	if !ok {
-		return nil, fmt.Errorf("provider %q not registered", providerName)
+	p, err := e.lookup(providerName, provider.OpGetAlarms)
+	if err != nil {
+		return nil, err
+	}
+	ctx, call, err := e.begin(ctx, p, providerName, provider.OpGetAlarms)
+	if err != nil {
+		return nil, err
 	}
-	return p.GetAlarms(ctx, deviceID)
+	alarms, err := p.GetAlarms(ctx, deviceID)
+	call.end(err)
+	if err != nil {
+		return nil, annotateError(err, p.Name(), providerName)
+	}
+	for i := range alarms {
+		stampAlarm(&alarms[i], p.Name(), providerName)
+	}
+	e.hooks.emitAlarms(AlarmSnapshot{Instance: providerName, DeviceID: FormatID(providerName, deviceID), Alarms: alarms})
+	return alarms, nil
 }
 
-// HealthCheck returns the health status of all providers.
-func (e *Engine) HealthCheck(ctx context.Context) map[string]bool {
+// ProviderHealth is the health of a provider instance.
+type ProviderHealth struct {
+	Healthy bool                  `json:"healthy"`
+	Circuit provider.BreakerState `json:"circuit"`
+}
+
+// HealthCheck returns the health status of all providers, keyed by instance
+// name. A provider whose circuit is open is reported unhealthy.
+func (e *Engine) HealthCheck(ctx context.Context) map[string]ProviderHealth {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	status := make(map[string]bool, len(e.providers))
+	status := make(map[string]ProviderHealth, len(e.providers))
 	for name, p := range e.providers {
-		status[name] = p.Healthy(ctx)
+		circuit := p.breaker.State()
+		status[name] = ProviderHealth{
+			Healthy: circuit != provider.BreakerOpen && p.Healthy(ctx),
+			Circuit: circuit,
+		}
 	}
 	return status
 }
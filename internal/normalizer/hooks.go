@@ -0,0 +1,115 @@
+package normalizer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// AlarmSnapshot is the alarm list of a provider instance, or of a single
+// device when DeviceID is set, as just fetched from the vendor.
+type AlarmSnapshot struct {
+	Instance string
+	DeviceID string // normalized ID; empty for instance-wide lists
+	Alarms   []models.NormalizedAlarm
+}
+
+// CallEvent describes a call the engine made to a provider instance. Calls
+// rejected by the circuit breaker are reported with ErrCircuitOpen and no
+// duration.
+type CallEvent struct {
+	Instance string
+	Type     string // provider type
+	Op       provider.Operation
+	Duration time.Duration
+	Err      error // nil on success
+}
+
+// RealtimeHook observes realtime snapshots fetched from a vendor.
+type RealtimeHook func(rt *models.NormalizedRealtime)
+
+// AlarmHook observes alarm lists fetched from a vendor.
+type AlarmHook func(snapshot AlarmSnapshot)
+
+// HistoryHook observes history responses fetched from a vendor.
+type HistoryHook func(history *models.HistoryResponse)
+
+// CallHook observes the outcome of every provider call.
+type CallHook func(ev CallEvent)
+
+// hooks holds the observers registered with the engine. Hooks run
+// synchronously on the fetching goroutine, so they must not block; responses
+// served from the cache are not reported. The data passed in is shared and
+// must not be modified.
+type hooks struct {
+	mu       sync.RWMutex
+	realtime []RealtimeHook
+	alarms   []AlarmHook
+	history  []HistoryHook
+	calls    []CallHook
+}
+
+// OnRealtime registers fn to be called with every realtime snapshot the
+// engine fetches, whether for an API request or the collector.
+func (e *Engine) OnRealtime(fn RealtimeHook) {
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	e.hooks.realtime = append(e.hooks.realtime, fn)
+}
+
+// OnAlarms registers fn to be called with every alarm list the engine fetches.
+func (e *Engine) OnAlarms(fn AlarmHook) {
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	e.hooks.alarms = append(e.hooks.alarms, fn)
+}
+
+// OnHistory registers fn to be called with every history response the
+// engine fetches, whether for an API request or a backfill.
+func (e *Engine) OnHistory(fn HistoryHook) {
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	e.hooks.history = append(e.hooks.history, fn)
+}
+
+// OnCall registers fn to be called after every provider call, including
+// calls answered with an error and calls the circuit breaker rejected.
+func (e *Engine) OnCall(fn CallHook) {
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	e.hooks.calls = append(e.hooks.calls, fn)
+}
+
+func (h *hooks) emitRealtime(rt *models.NormalizedRealtime) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.realtime {
+		fn(rt)
+	}
+}
+
+func (h *hooks) emitAlarms(snapshot AlarmSnapshot) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.alarms {
+		fn(snapshot)
+	}
+}
+
+func (h *hooks) emitHistory(history *models.HistoryResponse) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.history {
+		fn(history)
+	}
+}
+
+func (h *hooks) emitCall(ev CallEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.calls {
+		fn(ev)
+	}
+}
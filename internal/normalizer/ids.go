@@ -0,0 +1,99 @@
+package normalizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Normalized IDs have the form "<instance>_<rawID>". Both parts are escaped so
+// that the first unescaped underscore always separates them, whatever
+// characters the vendor uses in its own IDs:
+//
+//	"~" → "~7E"
+//	"_" → "~5F"
+//
+// "~" is an unreserved URL character, so escaped IDs can be used verbatim in
+// request paths (e.g. /api/v1/devices/saj-production_HSS2502J2351E34643/realtime).
+
+var (
+	// ErrInvalidID is returned when a normalized ID cannot be parsed.
+	ErrInvalidID = errors.New("invalid normalized ID")
+
+	// ErrProviderNotFound is returned when an ID or request refers to a
+	// provider instance that is not registered with the engine.
+	ErrProviderNotFound = errors.New("provider instance not registered")
+)
+
+const idSeparator = "_"
+
+var idEscaper = strings.NewReplacer("~", "~7E", "_", "~5F")
+
+// FormatID builds the normalized ID for a raw vendor ID owned by a provider instance.
+func FormatID(instance, rawID string) string {
+	return idEscaper.Replace(instance) + idSeparator + idEscaper.Replace(rawID)
+}
+
+// ParseID splits a normalized ID into its provider instance and raw vendor ID.
+func ParseID(id string) (instance, rawID string, err error) {
+	encInstance, encRaw, ok := strings.Cut(id, idSeparator)
+	if !ok || encInstance == "" || encRaw == "" {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	if instance, err = unescapeID(encInstance); err != nil {
+		return "", "", fmt.Errorf("%w: %q: %v", ErrInvalidID, id, err)
+	}
+	if rawID, err = unescapeID(encRaw); err != nil {
+		return "", "", fmt.Errorf("%w: %q: %v", ErrInvalidID, id, err)
+	}
+	return instance, rawID, nil
+}
+
+func unescapeID(s string) (string, error) {
+	if !strings.Contains(s, "~") {
+		return s, nil
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '~' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("truncated escape at offset %d", i)
+		}
+		switch s[i+1 : i+3] {
+		case "7E":
+			b.WriteByte('~')
+		case "5F":
+			b.WriteByte('_')
+		default:
+			return "", fmt.Errorf("unknown escape %q at offset %d", s[i:i+3], i)
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// ResolvedID is a normalized plant or device ID mapped back to the provider
+// instance that owns it.
+type ResolvedID struct {
+	Instance string // provider instance name
+	Type     string // provider type (e.g. "saj")
+	RawID    string // vendor ID as understood by the adapter
+}
+
+// ResolveID parses a normalized plant or device ID (as returned by the API)
+// and validates that its provider instance is registered.
+func (e *Engine) ResolveID(id string) (ResolvedID, error) {
+	instance, rawID, err := ParseID(id)
+	if err != nil {
+		return ResolvedID{}, err
+	}
+	p, ok := e.GetProvider(instance)
+	if !ok {
+		return ResolvedID{}, fmt.Errorf("%w: %q (from ID %q)", ErrProviderNotFound, instance, id)
+	}
+	return ResolvedID{Instance: instance, Type: p.Name(), RawID: rawID}, nil
+}
@@ -0,0 +1,79 @@
+package normalizer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatParseID(t *testing.T) {
+	tests := []struct {
+		instance, rawID string
+		id              string
+	}{
+		{"saj-production", "HSS2502J2351E34643", "saj-production_HSS2502J2351E34643"},
+		{"huawei", "NE=33685734", "huawei_NE=33685734"},
+		// Underscores and tildes in either part
+		{"huawei_eu", "NE=1", "huawei~5Feu_NE=1"},
+		{"growatt", "ABC_123_4", "growatt_ABC~5F123~5F4"},
+		{"sma~test", "dev~1", "sma~7Etest_dev~7E1"},
+		{"a_b~c", "x~_y", "a~5Fb~7Ec_x~7E~5Fy"},
+		// Text that looks like an escape is escaped itself
+		{"enphase", "~5F", "enphase_~7E5F"},
+	}
+	for _, tt := range tests {
+		id := FormatID(tt.instance, tt.rawID)
+		if id != tt.id {
+			t.Errorf("FormatID(%q, %q) = %q, want %q", tt.instance, tt.rawID, id, tt.id)
+		}
+		instance, rawID, err := ParseID(id)
+		if err != nil || instance != tt.instance || rawID != tt.rawID {
+			t.Errorf("ParseID(%q) = %q, %q, %v; want %q, %q", id, instance, rawID, err, tt.instance, tt.rawID)
+		}
+	}
+}
+
+// IDs from before escaping was introduced were "<instance>_<rawID>" as is;
+// those of instances without "_" or "~" parse to the same parts.
+func TestParseLegacyID(t *testing.T) {
+	tests := []struct {
+		id              string
+		instance, rawID string
+	}{
+		{"saj-production_HSS2502J2351E34643", "saj-production", "HSS2502J2351E34643"},
+		{"growatt_ABC_123", "growatt", "ABC_123"},
+		{"sungrow_1234_1_1", "sungrow", "1234_1_1"},
+	}
+	for _, tt := range tests {
+		instance, rawID, err := ParseID(tt.id)
+		if err != nil || instance != tt.instance || rawID != tt.rawID {
+			t.Errorf("ParseID(%q) = %q, %q, %v; want %q, %q", tt.id, instance, rawID, err, tt.instance, tt.rawID)
+		}
+	}
+}
+
+func TestParseMalformedID(t *testing.T) {
+	for _, id := range []string{
+		"",
+		"huawei",        // no separator
+		"_NE=1",         // no instance
+		"huawei_",       // no raw ID
+		"huawei_NE~",    // truncated escape
+		"huawei_NE~5",   // truncated escape
+		"huawei_NE~41",  // unknown escape
+		"hua~xxwei_NE1", // unknown escape in the instance
+	} {
+		if instance, rawID, err := ParseID(id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ParseID(%q) = %q, %q, %v; want ErrInvalidID", id, instance, rawID, err)
+		}
+	}
+}
+
+func TestResolveIDUnknownInstance(t *testing.T) {
+	e := NewEngine()
+	if _, err := e.ResolveID("nowhere_dev1"); !errors.Is(err, ErrProviderNotFound) {
+		t.Errorf("ResolveID of an unregistered instance = %v, want ErrProviderNotFound", err)
+	}
+	if _, err := e.ResolveID("nowhere"); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("ResolveID of a malformed ID = %v, want ErrInvalidID", err)
+	}
+}
@@ -0,0 +1,94 @@
+package normalizer
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// Adapters mint normalized IDs as "<type>_<originalID>" because they only
+// know their own provider type. Several instances of the same type may be
+// registered with the engine (e.g. two SAJ installer accounts), so the engine
+// rewrites every ID into the "<instance>_<rawID>" form understood by ParseID
+// and records the instance in ProviderMeta before handing data to callers.
+
+// instanceID rebuilds a normalized ID from its raw vendor ID. When the raw ID
+// is unknown it is recovered by stripping the adapter's type prefix.
+func instanceID(typ, instance, rawID, adapterID string) string {
+	if rawID == "" {
+		rawID = strings.TrimPrefix(adapterID, typ+"_")
+		if rawID == "" {
+			return ""
+		}
+	}
+	return FormatID(instance, rawID)
+}
+
+func stampMeta(meta *models.ProviderMeta, typ, instance string) {
+	if meta.Provider == "" {
+		meta.Provider = typ
+	}
+	meta.Instance = instance
+	if meta.FetchedAt.IsZero() {
+		meta.FetchedAt = time.Now().UTC()
+	}
+}
+
+func stampPlant(plant *models.NormalizedPlant, typ, instance string) {
+	plant.ID = instanceID(typ, instance, plant.Meta.ProviderPlantID, plant.ID)
+	stampMeta(&plant.Meta, typ, instance)
+}
+
+func stampDevice(dev *models.NormalizedDevice, typ, instance string) {
+	dev.ID = instanceID(typ, instance, dev.Meta.ProviderDeviceID, dev.ID)
+	dev.PlantID = instanceID(typ, instance, dev.Meta.ProviderPlantID, dev.PlantID)
+	stampMeta(&dev.Meta, typ, instance)
+}
+
+func stampRealtime(rt *models.NormalizedRealtime, typ, instance, rawDeviceID string) {
+	rt.DeviceID = FormatID(instance, rawDeviceID)
+	stampMeta(&rt.Meta, typ, instance)
+}
+
+func stampEnergy(energy *models.NormalizedEnergy, typ, instance, rawPlantID string) {
+	energy.ID = FormatID(instance, rawPlantID)
+	stampMeta(&energy.Meta, typ, instance)
+}
+
+func stampHistory(history *models.HistoryResponse, typ, instance, rawDeviceID string) {
+	history.DeviceID = FormatID(instance, rawDeviceID)
+	for i := range history.DataPoints {
+		dp := &history.DataPoints[i]
+		dp.DeviceID = history.DeviceID
+		stampMeta(&dp.Meta, typ, instance)
+	}
+}
+
+func stampAlarm(alarm *models.NormalizedAlarm, typ, instance string) {
+	alarm.ID = instanceID(typ, instance, "", alarm.ID)
+	alarm.DeviceID = instanceID(typ, instance, alarm.Meta.ProviderDeviceID, alarm.DeviceID)
+	alarm.PlantID = instanceID(typ, instance, alarm.Meta.ProviderPlantID, alarm.PlantID)
+	stampMeta(&alarm.Meta, typ, instance)
+	classifyAlarm(alarm, typ)
+}
+
+// annotateError records the provider instance on err so the API can report
+// which account failed. Unclassified errors are wrapped in a *provider.Error
+// without a Kind.
+func annotateError(err error, typ, instance string) error {
+	if err == nil {
+		return nil
+	}
+	var perr *provider.Error
+	if errors.As(err, &perr) {
+		if perr.Provider == "" {
+			perr.Provider = typ
+		}
+		perr.Instance = instance
+		return err
+	}
+	return &provider.Error{Provider: typ, Instance: instance, Err: err}
+}
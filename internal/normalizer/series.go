@@ -0,0 +1,46 @@
+package normalizer
+
+import (
+	"math"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+)
+
+// RealtimeToTimeSeries turns a realtime snapshot into a minute-granularity
+// time series point, so stored snapshots can answer history queries.
+func RealtimeToTimeSeries(rt *models.NormalizedRealtime) models.NormalizedTimeSeries {
+	dp := models.NormalizedTimeSeries{
+		DeviceID:    rt.DeviceID,
+		Provider:    rt.Provider,
+		Timestamp:   rt.Timestamp,
+		Granularity: models.GranularityMinute,
+		Meta:        rt.Meta,
+	}
+
+	if rt.PV != nil {
+		dp.PVPowerW = FloatPtr(rt.PV.TotalPowerW)
+		dp.PVStrings = rt.PV.Strings
+	}
+	if rt.Load != nil {
+		dp.LoadPowerW = FloatPtr(rt.Load.TotalPowerW)
+	}
+	if rt.Grid != nil {
+		dp.GridPowerW = FloatPtr(rt.Grid.TotalPowerW)
+		dp.GridPhases = rt.Grid.Phases
+		switch rt.Grid.Direction {
+		case models.GridDirectionImporting:
+			dp.GridImportPowerW = FloatPtr(math.Abs(rt.Grid.TotalPowerW))
+			dp.GridExportPowerW = FloatPtr(0)
+		case models.GridDirectionExporting:
+			dp.GridImportPowerW = FloatPtr(0)
+			dp.GridExportPowerW = FloatPtr(math.Abs(rt.Grid.TotalPowerW))
+		}
+	}
+	if rt.Battery != nil {
+		dp.BatteryPowerW = FloatPtr(rt.Battery.PowerW)
+		dp.BatterySOC = rt.Battery.SOCPercent
+		dir := rt.Battery.Direction
+		dp.BatteryDirection = &dir
+	}
+	return dp
+}
@@ -0,0 +1,62 @@
+package normalizer
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// Source statuses reported by the aggregated queries.
+const (
+	SourceOK      = "ok"
+	SourceError   = "error"
+	SourceTimeout = "timeout"
+)
+
+// SourceStatus reports how one provider instance fared in an aggregated
+// query, so clients can tell "no data" from "this provider failed".
+// Instances that do not support the operation are not listed.
+type SourceStatus struct {
+	Provider  string `json:"provider"` // instance name
+	Status    string `json:"status"`   // ok, error or timeout
+	Code      string `json:"code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+
+	err error
+}
+
+// Err returns the error behind a failed source, or nil.
+func (s SourceStatus) Err() error { return s.err }
+
+func newSourceStatus(name string, err error, latency time.Duration) SourceStatus {
+	s := SourceStatus{Provider: name, Status: SourceOK, LatencyMs: latency.Milliseconds()}
+	if err != nil {
+		s.Status = SourceError
+		if errors.Is(err, context.DeadlineExceeded) {
+			s.Status = SourceTimeout
+		}
+		s.Code = provider.ErrorCode(err)
+		// The full error is logged by the caller
+		s.Error = provider.PublicMessage(err)
+		s.err = err
+	}
+	return s
+}
+
+func sortSources(sources []SourceStatus) {
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Provider < sources[j].Provider })
+}
+
+// FirstFailure returns the first failed source, if any.
+func FirstFailure(sources []SourceStatus) (SourceStatus, bool) {
+	for _, s := range sources {
+		if s.Status != SourceOK {
+			return s, true
+		}
+	}
+	return SourceStatus{}, false
+}
@@ -1,5 +1,10 @@
 package normalizer
 
+import (
+	"strconv"
+	"strings"
+)
+
 // UnitConversion provides utilities for converting between different
 // unit systems used by various inverter brands.
 
@@ -113,3 +118,125 @@ func FloatPtr(v float64) *float64 {
 func IntPtr(v int) *int {
 	return &v
 }
+
+// ── Readings with units ──
+
+// readingUnit converts a unit to the base unit of its quantity:
+// base = value*factor + offset.
+type readingUnit struct {
+	quantity string
+	factor   float64
+	offset   float64
+}
+
+// readingUnits is matched case-sensitively first, so "MW" and "mW" stay
+// apart, then in lower case through readingUnitsFold.
+var readingUnits = map[string]readingUnit{
+	"W": {"power", 1, 0}, "kW": {"power", 1e3, 0}, "MW": {"power", 1e6, 0}, "GW": {"power", 1e9, 0},
+	"Wh": {"energy", 1, 0}, "kWh": {"energy", 1e3, 0}, "MWh": {"energy", 1e6, 0}, "GWh": {"energy", 1e9, 0},
+	"VA": {"apparent_power", 1, 0}, "kVA": {"apparent_power", 1e3, 0},
+	"var": {"reactive_power", 1, 0}, "kvar": {"reactive_power", 1e3, 0},
+	"V": {"voltage", 1, 0}, "kV": {"voltage", 1e3, 0}, "mV": {"voltage", 1e-3, 0},
+	"A": {"current", 1, 0}, "mA": {"current", 1e-3, 0},
+	"Hz": {"frequency", 1, 0},
+	"°C": {"temperature", 1, 0}, "℃": {"temperature", 1, 0}, "C": {"temperature", 1, 0},
+	"°F": {"temperature", 5.0 / 9, -32 * 5.0 / 9}, "℉": {"temperature", 5.0 / 9, -32 * 5.0 / 9},
+	"%": {"percent", 1, 0},
+}
+
+var readingUnitsFold = func() map[string]readingUnit {
+	fold := make(map[string]readingUnit)
+	for unit, ru := range readingUnits {
+		// Lower-case "m" means milli; leave mega/milli to exact matches
+		if strings.HasPrefix(unit, "M") || strings.HasPrefix(unit, "m") || unit == "C" {
+			continue
+		}
+		fold[strings.ToLower(unit)] = ru
+	}
+	return fold
+}()
+
+// ParseReading reads a vendor value that carries its unit in the string,
+// such as "5.2kW", "1,234.5 kWh", "-300 W" or "2461(W)", and converts it to
+// unit (e.g. "W", "kWh", "V", "°C", "%"). A bare number is taken to be in
+// unit already. ok is false for empty or placeholder values ("--", "N/A")
+// and for readings of another quantity.
+func ParseReading(s, unit string) (value float64, ok bool) {
+	if _, known := readingUnits[unit]; !known {
+		return 0, false
+	}
+
+	num, rest := splitReading(s)
+	if num == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	rest = strings.TrimSpace(strings.Trim(rest, " ()[]"))
+	if rest == "" {
+		return v, true
+	}
+	return ConvertReading(v, rest, unit)
+}
+
+// ConvertReading converts value from one unit to another of the same
+// quantity, e.g. 5.2 "kW" to 5200 "W". ok is false for unknown units and
+// mismatched quantities.
+func ConvertReading(value float64, from, to string) (float64, bool) {
+	target, known := readingUnits[to]
+	if !known {
+		return 0, false
+	}
+	source, known := readingUnits[from]
+	if !known {
+		source, known = readingUnitsFold[strings.ToLower(from)]
+	}
+	if !known || source.quantity != target.quantity {
+		return 0, false
+	}
+	base := value*source.factor + source.offset
+	return (base - target.offset) / target.factor, true
+}
+
+// ReadingPtr is ParseReading for optional fields: nil when the reading is
+// missing or unusable.
+func ReadingPtr(s, unit string) *float64 {
+	v, ok := ParseReading(s, unit)
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+// splitReading splits s into its number, without thousands separators, and
+// the text after it.
+func splitReading(s string) (num, rest string) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if (c >= '0' && c <= '9') || c == '.' || c == ',' || (end == 0 && (c == '-' || c == '+')) {
+			end++
+			continue
+		}
+		break
+	}
+	num, rest = s[:end], s[end:]
+	if strings.IndexAny(num, "0123456789") < 0 {
+		return "", s
+	}
+
+	// "1,234.5" and "1,234,567" group thousands; a lone comma not followed
+	// by three digits ("5,2") is a decimal comma.
+	if strings.Contains(num, ",") {
+		if i := strings.Index(num, ","); !strings.Contains(num, ".") && strings.Count(num, ",") == 1 && len(num)-i-1 != 3 {
+			num = strings.Replace(num, ",", ".", 1)
+		} else {
+			num = strings.ReplaceAll(num, ",", "")
+		}
+	}
+	return num, rest
+}
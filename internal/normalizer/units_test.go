@@ -0,0 +1,74 @@
+package normalizer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseReading(t *testing.T) {
+	tests := []struct {
+		in, unit string
+		want     float64
+		ok       bool
+	}{
+		// Power
+		{"5.2kW", "W", 5200, true},
+		{"5.2 kW", "kW", 5.2, true},
+		{"300 W", "kW", 0.3, true},
+		{"-300 W", "W", -300, true},
+		{"2461(W)", "W", 2461, true},
+		{"1.5 MW", "kW", 1500, true},
+		{"1.5 mW", "W", 0, false}, // milliwatts are no unit we know
+		{"5.2KW", "W", 5200, true},
+		{"5.2 kw", "W", 5200, true},
+
+		// Energy
+		{"12500 Wh", "kWh", 12.5, true},
+		{"12.5kWh", "Wh", 12500, true},
+		{"12.5 KWH", "kWh", 12.5, true},
+		{"3.2 MWh", "kWh", 3200, true},
+
+		// Thousands separators and decimal commas
+		{"1,234.5 kWh", "kWh", 1234.5, true},
+		{"1,234,567 Wh", "kWh", 1234.567, true},
+		{"1,234 W", "W", 1234, true},
+		{"5,2 kW", "W", 5200, true},
+		{"+1,000.25", "W", 1000.25, true},
+
+		// A bare number is in the requested unit
+		{"42", "V", 42, true},
+		{" 230.1 ", "V", 230.1, true},
+
+		// Other quantities
+		{"45 °C", "°C", 45, true},
+		{"113 °F", "°C", 45, true},
+		{"98 %", "%", 98, true},
+		{"50.01Hz", "Hz", 50.01, true},
+
+		// Missing and unusable values
+		{"", "W", 0, false},
+		{"   ", "W", 0, false},
+		{"--", "W", 0, false},
+		{"N/A", "kWh", 0, false},
+		{"kW", "W", 0, false},
+		{"5.2 kWh", "W", 0, false}, // energy is not power
+		{"230 V", "A", 0, false},   // nor voltage current
+		{"5.2 kW", "bananas", 0, false},
+		{"1.2.3 kW", "W", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseReading(tt.in, tt.unit)
+		if ok != tt.ok || (ok && math.Abs(got-tt.want) > 1e-9) {
+			t.Errorf("ParseReading(%q, %q) = %v, %t; want %v, %t", tt.in, tt.unit, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadingPtr(t *testing.T) {
+	if p := ReadingPtr("2.5 kW", "W"); p == nil || *p != 2500 {
+		t.Errorf("ReadingPtr(2.5 kW) = %v, want 2500", p)
+	}
+	if p := ReadingPtr("--", "W"); p != nil {
+		t.Errorf("ReadingPtr(--) = %v, want nil", *p)
+	}
+}
@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // calls flow normally
+	BreakerOpen     BreakerState = "open"      // calls fail fast with ErrCircuitOpen
+	BreakerHalfOpen BreakerState = "half_open" // a single probe call is let through
+)
+
+// BreakerConfig configures the circuit breaker of a provider instance.
+type BreakerConfig struct {
+	// Consecutive upstream failures that open the circuit (default 5).
+	FailureThreshold int `yaml:"failure_threshold"`
+
+	// How long the circuit stays open before a probe call is allowed (default 30).
+	OpenSeconds int `yaml:"open_seconds"`
+}
+
+// CircuitBreaker stops calls to a vendor that keeps failing, so one cloud
+// outage does not slow down every request that fans out to it. Only upstream
+// failures (unreachable API, 5xx, timeouts) count; vendor answers such as
+// "not found", "invalid request" or an unrecognised error code prove the API
+// is up.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a closed breaker, applying defaults for unset fields.
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenSeconds <= 0 {
+		cfg.OpenSeconds = 30
+	}
+	return &CircuitBreaker{
+		threshold: cfg.FailureThreshold,
+		openFor:   time.Duration(cfg.OpenSeconds) * time.Second,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+// State returns the current state, reporting an open circuit whose cool-down
+// has elapsed as half-open.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.openFor {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Allow reports whether a call may proceed. Every allowed call must be
+// followed by exactly one Record.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return nil
+	case BreakerOpen:
+		remaining := b.openFor - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return &Error{Kind: ErrCircuitOpen, Message: fmt.Sprintf("circuit open, retrying in %s", remaining.Round(time.Second))}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = false
+	}
+
+	// Half-open: let one probe through at a time.
+	if b.probing {
+		return &Error{Kind: ErrCircuitOpen, Message: "circuit half-open, probe in progress"}
+	}
+	b.probing = true
+	return nil
+}
+
+// Record reports the outcome of an allowed call.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.state == BreakerHalfOpen
+	b.probing = false
+
+	switch {
+	case isUpstreamFailure(err):
+		b.failures++
+		if probe || b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+		}
+	case errors.Is(err, context.Canceled):
+		// The caller gave up; says nothing about the vendor.
+	default:
+		b.failures = 0
+		b.state = BreakerClosed
+	}
+}
+
+func isUpstreamFailure(err error) bool {
+	return errors.Is(err, ErrUpstreamUnavailable) || errors.Is(err, context.DeadlineExceeded)
+}
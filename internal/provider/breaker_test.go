@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testBreaker returns a breaker opening after 3 failures for 30s, on a clock
+// the test moves by hand.
+func testBreaker() (*CircuitBreaker, *time.Time) {
+	now := time.Date(2024, 6, 14, 11, 5, 0, 0, time.UTC)
+	b := NewCircuitBreaker(BreakerConfig{FailureThreshold: 3, OpenSeconds: 30})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+// call runs one call through the breaker, as the engine does.
+func call(b *CircuitBreaker, err error) error {
+	if open := b.Allow(); open != nil {
+		return open
+	}
+	b.Record(err)
+	return nil
+}
+
+var errUpstream = &Error{Kind: ErrUpstreamUnavailable, Op: "GET /plants", Message: "HTTP 503"}
+
+func TestBreakerTransitions(t *testing.T) {
+	b, now := testBreaker()
+
+	// Failures below the threshold keep it closed; a success resets the count
+	call(b, errUpstream)
+	call(b, errUpstream)
+	call(b, nil)
+	call(b, errUpstream)
+	call(b, errUpstream)
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("state %s after 2 consecutive failures, want closed", s)
+	}
+
+	// The third consecutive failure opens it
+	call(b, errUpstream)
+	if s := b.State(); s != BreakerOpen {
+		t.Fatalf("state %s after 3 consecutive failures, want open", s)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow while open = %v, want ErrCircuitOpen", err)
+	}
+
+	// After the cool-down one probe is let through
+	*now = now.Add(30 * time.Second)
+	if s := b.State(); s != BreakerHalfOpen {
+		t.Fatalf("state %s after the cool-down, want half_open", s)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second call during the probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// A failed probe opens it again at once
+	b.Record(errUpstream)
+	if s := b.State(); s != BreakerOpen {
+		t.Fatalf("state %s after a failed probe, want open", s)
+	}
+	*now = now.Add(29 * time.Second)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Allow before the new cool-down ends = %v, want ErrCircuitOpen", err)
+	}
+
+	// A successful probe closes it
+	*now = now.Add(time.Second)
+	if err := call(b, nil); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if s := b.State(); s != BreakerClosed {
+		t.Fatalf("state %s after a successful probe, want closed", s)
+	}
+	call(b, errUpstream)
+	call(b, errUpstream)
+	if s := b.State(); s != BreakerClosed {
+		t.Errorf("state %s: failures before the probe still counted", s)
+	}
+}
+
+func TestBreakerCountsUpstreamFailuresOnly(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		counts bool
+	}{
+		{"upstream unavailable", errUpstream, true},
+		{"wrapped upstream", fmt.Errorf("GetPlants: %w", errUpstream), true},
+		{"timeout", fmt.Errorf("fetch: %w", context.DeadlineExceeded), true},
+		{"unknown vendor code", VendorError(ErrVendor, "huawei", "getStationList", "99999", "unknown"), false},
+		{"auth", VendorError(ErrAuth, "huawei", "login", "20001", "bad password"), false},
+		{"rate limited", VendorError(ErrRateLimited, "huawei", "getStationList", "407", "too frequent"), false},
+		{"not found", NewError(ErrNotFound, "sma", "GET /plants/1", "HTTP 404"), false},
+		{"invalid request", NewError(ErrInvalidRequest, "sma", "GET /plants", "HTTP 400"), false},
+		{"not supported", NotSupported("sma", OpGetDeviceDetails, ""), false},
+		{"unclassified", errors.New("decode response"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := testBreaker()
+			for i := 0; i < 3; i++ {
+				call(b, tt.err)
+			}
+			want := BreakerClosed
+			if tt.counts {
+				want = BreakerOpen
+			}
+			if s := b.State(); s != want {
+				t.Errorf("state %s after 3 of %v, want %s", s, tt.err, want)
+			}
+		})
+	}
+
+	// Calls the caller gave up on neither count nor reset the count
+	b, _ := testBreaker()
+	call(b, errUpstream)
+	call(b, errUpstream)
+	call(b, context.Canceled)
+	call(b, errUpstream)
+	if s := b.State(); s != BreakerOpen {
+		t.Errorf("state %s: a cancelled call reset the failure count", s)
+	}
+}
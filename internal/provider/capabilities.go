@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+)
+
+// Operation identifies a Provider method in a capability matrix.
+type Operation string
+
+const (
+	OpGetPlants         Operation = "plants"
+	OpGetPlantDetails   Operation = "plant_details"
+	OpGetDevices        Operation = "devices"
+	OpGetDeviceDetails  Operation = "device_details"
+	OpGetRealTimeData   Operation = "realtime"
+	OpGetEnergyStats    Operation = "energy"
+	OpGetHistoricalData Operation = "history"
+	OpGetAlarms         Operation = "device_alarms"
+	OpGetAllAlarms      Operation = "alarms"
+)
+
+// AllOperations lists every operation of the Provider interface.
+var AllOperations = []Operation{
+	OpGetPlants,
+	OpGetPlantDetails,
+	OpGetDevices,
+	OpGetDeviceDetails,
+	OpGetRealTimeData,
+	OpGetEnergyStats,
+	OpGetHistoricalData,
+	OpGetAlarms,
+	OpGetAllAlarms,
+}
+
+// Metric names a section of NormalizedRealtime that a provider populates.
+type Metric string
+
+const (
+	MetricPV          Metric = "pv"
+	MetricPVStrings   Metric = "pv_strings"
+	MetricPVModules   Metric = "pv_modules"
+	MetricBattery     Metric = "battery"
+	MetricGrid        Metric = "grid"
+	MetricGridPhases  Metric = "grid_phases"
+	MetricLoad        Metric = "load"
+	MetricBackup      Metric = "backup"
+	MetricMeters      Metric = "meters"
+	MetricEnvironment Metric = "environment"
+)
+
+// Capabilities describes what a provider can actually deliver, so the engine
+// can refuse unsupported requests up front and clients can hide features.
+type Capabilities struct {
+	Operations    []Operation          `json:"operations"`
+	Granularities []models.Granularity `json:"granularities"`
+	Periods       []models.Period      `json:"periods"`
+	Metrics       []Metric             `json:"metrics"`
+
+	// HistoryWindows overrides how much history one GetHistoricalData call
+	// returns per granularity; see HistoryWindow for the defaults.
+	HistoryWindows map[models.Granularity]Window `json:"historyWindows,omitempty"`
+}
+
+// Window is a calendar span of days, months and years.
+type Window struct {
+	Days   int `json:"days,omitempty"`
+	Months int `json:"months,omitempty"`
+	Years  int `json:"years,omitempty"`
+}
+
+// After returns t advanced by the window.
+func (w Window) After(t time.Time) time.Time {
+	return t.AddDate(w.Years, w.Months, w.Days)
+}
+
+// Align returns the start of the calendar period containing t that windows
+// of this size start on: the year for whole years, the month for whole
+// months, otherwise the day.
+func (w Window) Align(t time.Time) time.Time {
+	y, m, d := t.Date()
+	switch {
+	case w.Days == 0 && w.Months == 0:
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, t.Location())
+	case w.Days == 0:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// HistoryWindow returns the span one GetHistoricalData call covers at
+// granularity g. Unless the provider says otherwise, minute and hour data is
+// fetched a day at a time, daily data a month at a time and monthly or yearly
+// data a year at a time.
+func (c Capabilities) HistoryWindow(g models.Granularity) Window {
+	if w, ok := c.HistoryWindows[g]; ok && w != (Window{}) {
+		return w
+	}
+	switch g {
+	case models.GranularityDay:
+		return Window{Months: 1}
+	case models.GranularityMonth, models.GranularityYear:
+		return Window{Years: 1}
+	default:
+		return Window{Days: 1}
+	}
+}
+
+// Supports reports whether the operation is available.
+func (c Capabilities) Supports(op Operation) bool {
+	for _, o := range c.Operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsGranularity reports whether historical data is available at granularity g.
+func (c Capabilities) SupportsGranularity(g models.Granularity) bool {
+	for _, v := range c.Granularities {
+		if v == g {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsPeriod reports whether energy statistics are available for period p.
+func (c Capabilities) SupportsPeriod(p models.Period) bool {
+	for _, v := range c.Periods {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+// OperationsExcept returns AllOperations minus the given ones.
+func OperationsExcept(excluded ...Operation) []Operation {
+	ops := make([]Operation, 0, len(AllOperations))
+	for _, op := range AllOperations {
+		skip := false
+		for _, ex := range excluded {
+			if op == ex {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
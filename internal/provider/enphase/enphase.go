@@ -0,0 +1,1084 @@
+package enphase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBaseURL = "https://api.enphaseenergy.com"
+	providerName   = "enphase"
+
+	apiPrefix = "/api/v4"
+)
+
+func init() {
+	provider.Register(providerName, func() provider.Provider {
+		return &EnphaseProvider{}
+	})
+}
+
+// EnphaseProvider implements the Provider interface for the Enphase
+// Enlighten API v4. Calls carry the application's API key as the key query
+// parameter and an OAuth2 access token as a Bearer header.
+// Key endpoints:
+//   - /systems, /systems/{id} — plants
+//   - /systems/{id}/devices — micros, meters, gateways, batteries
+//   - /systems/{id}/summary — current power and energy
+//   - /systems/inverters_summary_by_envoy_or_site — per-micro power
+//   - /systems/{id}/energy_lifetime — daily production
+//   - /systems/{id}/telemetry/{production_micro,consumption_meter,battery}
+//   - /systems/{id}/devices/micros/{sn}/telemetry
+//
+// Access tokens live a day and are renewed with the refresh token, which
+// Enphase replaces on every use. The current pair is written to a token file
+// so a restart does not need a new authorization code.
+//
+// Device IDs are "<systemId>-<serial>". The gateway (IQ Gateway / Envoy)
+// stands for the whole system: its real-time data and history cover every
+// micro, the meters and the batteries.
+type EnphaseProvider struct {
+	client     *provider.HTTPClient
+	authClient *provider.HTTPClient
+	config     provider.ProviderConfig
+	apiKey     string
+	tokenFile  string
+
+	mu     sync.Mutex
+	token  enphaseToken
+	stored bool                         // token was loaded from the file and not used for a login yet
+	kinds  map[string]enphaseDeviceKind // device ID → kind
+}
+
+func (p *EnphaseProvider) Name() string { return providerName }
+
+func (p *EnphaseProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		// v4 exposes no alarms or single-device endpoint
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails, provider.OpGetAlarms, provider.OpGetAllAlarms),
+		// Telemetry comes in 15-minute intervals
+		Granularities: []models.Granularity{
+			models.GranularityMinute,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodYear, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVModules, provider.MetricBattery, provider.MetricLoad,
+		},
+	}
+}
+
+func (p *EnphaseProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
+	p.config = cfg
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	// The free plan allows 10 calls a minute; the client backs off on 429
+	rps := cfg.RateLimitRPS
+	if rps <= 0 {
+		rps = 1
+	}
+
+	p.apiKey = cfg.GetCredential("apiKey")
+	clientID := cfg.GetCredential("clientId")
+	clientSecret := cfg.GetCredential("clientSecret")
+	if p.apiKey == "" || clientID == "" || clientSecret == "" {
+		return provider.NewError(provider.ErrAuth, providerName, "auth", "credentials apiKey, clientId and clientSecret are required")
+	}
+
+	p.tokenFile = cfg.GetCredential("tokenFile")
+	if p.tokenFile == "" {
+		p.tokenFile = filepath.Join("data", "enphase", cfg.Name+".token.json")
+	}
+	p.kinds = make(map[string]enphaseDeviceKind)
+	if err := p.loadToken(); err != nil {
+		return fmt.Errorf("Enphase: %w", err)
+	}
+
+	p.authClient = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
+	p.authClient.SetHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(clientID+":"+clientSecret)))
+
+	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
+	p.client.SetSession(provider.Session{
+		Login: p.authenticate,
+		// Expired tokens get HTTP 401
+	})
+
+	return p.client.Authenticate(ctx)
+}
+
+// authenticate installs an access token: the stored one while it is still
+// valid, otherwise one obtained with the refresh token or, the first time,
+// the authorization code.
+func (p *EnphaseProvider) authenticate(ctx context.Context) (time.Time, error) {
+	p.mu.Lock()
+	tok, stored := p.token, p.stored
+	p.stored = false
+	p.mu.Unlock()
+
+	if stored && time.Until(tok.ExpiresAt) > 10*time.Minute {
+		p.client.SetHeader("Authorization", "Bearer "+tok.AccessToken)
+		log.Info().Str("provider", providerName).Msg("Using stored access token")
+		return tok.ExpiresAt, nil
+	}
+
+	var params url.Values
+	switch {
+	case tok.RefreshToken != "":
+		params = url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tok.RefreshToken}}
+	case p.config.GetCredential("refreshToken") != "":
+		params = url.Values{"grant_type": {"refresh_token"}, "refresh_token": {p.config.GetCredential("refreshToken")}}
+	case p.config.GetCredential("authCode") != "":
+		params = url.Values{
+			"grant_type":   {"authorization_code"},
+			"code":         {p.config.GetCredential("authCode")},
+			"redirect_uri": {p.config.GetCredential("redirectUri")},
+		}
+	default:
+		return time.Time{}, provider.NewError(provider.ErrAuth, providerName, "auth",
+			"no token in "+p.tokenFile+"; set credential authCode or refreshToken")
+	}
+
+	// Sent as a form body: in the query string the refresh token or code
+	// would end up in errors and proxy logs
+	var resp enphaseTokenResponse
+	if err := p.authClient.Post(ctx, "/oauth/token", params, &resp); err != nil {
+		return time.Time{}, fmt.Errorf("Enphase auth (%s): %w", params.Get("grant_type"), err)
+	}
+	if resp.AccessToken == "" {
+		return time.Time{}, provider.NewError(provider.ErrAuth, providerName, "auth", "token response without access_token")
+	}
+
+	tok = enphaseToken{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second).UTC(),
+	}
+	p.mu.Lock()
+	p.token = tok
+	p.mu.Unlock()
+	// Enphase has already invalidated the old refresh token, so a token
+	// that cannot be saved is still used; it is lost on restart.
+	if err := p.saveToken(tok); err != nil {
+		log.Error().Err(err).Str("provider", providerName).Str("path", p.tokenFile).Msg("Failed to save OAuth token")
+	}
+
+	p.client.SetHeader("Authorization", "Bearer "+tok.AccessToken)
+	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
+	return tok.ExpiresAt, nil
+}
+
+func (p *EnphaseProvider) loadToken() error {
+	data, err := os.ReadFile(p.tokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read token file: %w", err)
+	}
+	var tok enphaseToken
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return fmt.Errorf("token file %s: %w", p.tokenFile, err)
+	}
+	p.token, p.stored = tok, tok.AccessToken != ""
+	return nil
+}
+
+// saveToken replaces the token file, readable by the owner only.
+func (p *EnphaseProvider) saveToken(tok enphaseToken) error {
+	data, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.tokenFile), 0o700); err != nil {
+		return err
+	}
+	tmp := p.tokenFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.tokenFile)
+}
+
+// params adds the API key to a call's query parameters.
+func (p *EnphaseProvider) params(v url.Values) url.Values {
+	if v == nil {
+		v = url.Values{}
+	}
+	v.Set("key", p.apiKey)
+	return v
+}
+
+// ── Plants ──
+
+func (p *EnphaseProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
+	var plants []models.NormalizedPlant
+	for page := 1; ; page++ {
+		params := p.params(url.Values{
+			"page": {strconv.Itoa(page)},
+			"size": {"100"},
+		})
+
+		var resp enphaseSystemListResponse
+		if err := p.client.Get(ctx, apiPrefix+"/systems", params, &resp); err != nil {
+			return nil, fmt.Errorf("Enphase GetPlants: %w", err)
+		}
+
+		for _, raw := range resp.Systems {
+			plants = append(plants, normalizeEnphasePlant(raw))
+		}
+		if len(resp.Systems) == 0 || len(plants) >= resp.Total {
+			break
+		}
+	}
+	return plants, nil
+}
+
+func (p *EnphaseProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
+	var resp enphaseSystem
+	if err := p.client.Get(ctx, apiPrefix+"/systems/"+plantID, p.params(nil), &resp); err != nil {
+		return nil, fmt.Errorf("Enphase GetPlantDetails: %w", err)
+	}
+
+	plant := normalizeEnphasePlant(resp)
+	plant.Meta.RawDataAvailable = true
+	return &plant, nil
+}
+
+// ── Devices ──
+
+func (p *EnphaseProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
+	devices, err := p.listDevices(ctx, "GetDevices", plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var normalized []models.NormalizedDevice
+	for _, d := range devices {
+		normalized = append(normalized, normalizeEnphaseDevice(d.raw, plantID, d.kind))
+	}
+	return normalized, nil
+}
+
+type enphaseListedDevice struct {
+	raw  enphaseDevice
+	kind enphaseDeviceKind
+}
+
+// listDevices returns the devices of a system and records their kinds.
+func (p *EnphaseProvider) listDevices(ctx context.Context, op, systemID string) ([]enphaseListedDevice, error) {
+	var resp enphaseDevicesResponse
+	if err := p.client.Get(ctx, fmt.Sprintf("%s/systems/%s/devices", apiPrefix, systemID), p.params(nil), &resp); err != nil {
+		return nil, fmt.Errorf("Enphase %s: %w", op, err)
+	}
+
+	var devices []enphaseListedDevice
+	for _, group := range []struct {
+		list []enphaseDevice
+		kind enphaseDeviceKind
+	}{
+		{resp.Devices.Gateways, kindGateway},
+		{resp.Devices.Micros, kindMicro},
+		{resp.Devices.Meters, kindMeter},
+		{resp.Devices.Encharges, kindBattery},
+		{resp.Devices.Enpowers, kindEnpower},
+	} {
+		for _, raw := range group.list {
+			devices = append(devices, enphaseListedDevice{raw: raw, kind: group.kind})
+		}
+	}
+
+	p.mu.Lock()
+	for _, d := range devices {
+		p.kinds[enphaseDeviceID(systemID, d.raw.SerialNumber)] = d.kind
+	}
+	p.mu.Unlock()
+	return devices, nil
+}
+
+// deviceKind returns the kind of a device, listing its system's devices if
+// it has not been seen yet.
+func (p *EnphaseProvider) deviceKind(ctx context.Context, op, deviceID string) (enphaseDeviceKind, error) {
+	p.mu.Lock()
+	kind, ok := p.kinds[deviceID]
+	p.mu.Unlock()
+	if ok {
+		return kind, nil
+	}
+
+	systemID, _, err := splitEnphaseDeviceID(op, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.listDevices(ctx, op, systemID); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	kind, ok = p.kinds[deviceID]
+	p.mu.Unlock()
+	if !ok {
+		return "", provider.NewError(provider.ErrNotFound, providerName, op, "unknown device "+deviceID)
+	}
+	return kind, nil
+}
+
+func (p *EnphaseProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
+	// Details come with the system's device list
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
+}
+
+// ── Real-Time Data ──
+
+// GetRealTimeData returns the latest readings Enphase has, which lag the
+// devices by up to 15 minutes. A gateway reports the whole system.
+func (p *EnphaseProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	kind, err := p.deviceKind(ctx, "GetRealTimeData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	systemID, serial, _ := splitEnphaseDeviceID("GetRealTimeData", deviceID)
+
+	switch kind {
+	case kindGateway:
+		var summary enphaseSummary
+		if err := p.client.Get(ctx, fmt.Sprintf("%s/systems/%s/summary", apiPrefix, systemID), p.params(nil), &summary); err != nil {
+			return nil, fmt.Errorf("Enphase GetRealTimeData: %w", err)
+		}
+		micros, err := p.microSummaries(ctx, systemID)
+		if err != nil {
+			return nil, fmt.Errorf("Enphase GetRealTimeData: %w", err)
+		}
+		rt := normalizeEnphaseSystemRealtime(summary, micros, deviceID)
+		return &rt, nil
+
+	case kindMicro:
+		micros, err := p.microSummaries(ctx, systemID)
+		if err != nil {
+			return nil, fmt.Errorf("Enphase GetRealTimeData: %w", err)
+		}
+		for _, m := range micros {
+			if m.SerialNumber == serial {
+				rt := normalizeEnphaseMicroRealtime(m, deviceID)
+				return &rt, nil
+			}
+		}
+		return nil, provider.NewError(provider.ErrNotFound, providerName, "GetRealTimeData", "no data for device "+deviceID)
+
+	case kindBattery:
+		var resp enphaseBatteryTelemetryResponse
+		params := p.params(url.Values{"granularity": {"day"}})
+		if err := p.client.Get(ctx, fmt.Sprintf("%s/systems/%s/telemetry/battery", apiPrefix, systemID), params, &resp); err != nil {
+			return nil, fmt.Errorf("Enphase GetRealTimeData: %w", err)
+		}
+		if len(resp.Intervals) == 0 {
+			return nil, provider.NewError(provider.ErrNotFound, providerName, "GetRealTimeData", "no data for device "+deviceID)
+		}
+		rt := normalizeEnphaseBatteryRealtime(resp.Intervals[len(resp.Intervals)-1], deviceID)
+		return &rt, nil
+
+	default:
+		return nil, provider.NotSupported(providerName, provider.OpGetRealTimeData, "device type "+string(kind))
+	}
+}
+
+// microSummaries returns the latest reading of every micro of a system.
+func (p *EnphaseProvider) microSummaries(ctx context.Context, systemID string) ([]enphaseMicroSummary, error) {
+	var resp []struct {
+		MicroInverters []enphaseMicroSummary `json:"micro_inverters"`
+	}
+	params := p.params(url.Values{"site_id": {systemID}})
+	if err := p.client.Get(ctx, apiPrefix+"/systems/inverters_summary_by_envoy_or_site", params, &resp); err != nil {
+		return nil, err
+	}
+	var micros []enphaseMicroSummary
+	for _, envoy := range resp {
+		micros = append(micros, envoy.MicroInverters...)
+	}
+	return micros, nil
+}
+
+// ── Energy Stats ──
+
+func (p *EnphaseProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
+	switch period {
+	case models.PeriodDay, models.PeriodTotal:
+		var summary enphaseSummary
+		if err := p.client.Get(ctx, fmt.Sprintf("%s/systems/%s/summary", apiPrefix, plantID), p.params(nil), &summary); err != nil {
+			return nil, fmt.Errorf("Enphase GetEnergyStats: %w", err)
+		}
+		energy := normalizeEnphaseSummaryEnergy(summary, plantID, period)
+		return &energy, nil
+
+	case models.PeriodMonth, models.PeriodYear:
+		// Daily production since the start of the period, in the
+		// system's own days
+		loc := p.location()
+		now := time.Now().In(loc)
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		if period == models.PeriodYear {
+			start = time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, loc)
+		}
+		params := p.params(url.Values{
+			"start_date": {start.Format("2006-01-02")},
+			"end_date":   {now.Format("2006-01-02")},
+		})
+
+		var resp enphaseEnergyLifetimeResponse
+		if err := p.client.Get(ctx, fmt.Sprintf("%s/systems/%s/energy_lifetime", apiPrefix, plantID), params, &resp); err != nil {
+			return nil, fmt.Errorf("Enphase GetEnergyStats: %w", err)
+		}
+		energy := normalizeEnphaseLifetimeEnergy(resp, plantID, period, start, now)
+		return &energy, nil
+
+	default:
+		return nil, provider.NotSupported(providerName, provider.OpGetEnergyStats, "period "+string(period))
+	}
+}
+
+func (p *EnphaseProvider) location() *time.Location {
+	if p.config.Timezone != "" {
+		if loc, err := time.LoadLocation(p.config.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// ── Historical Data ──
+
+// GetHistoricalData returns the 15-minute telemetry of a micro or, for a
+// gateway, of the whole system: production, consumption and battery. Each
+// call covers one day from the start time.
+func (p *EnphaseProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
+	if req.Granularity != models.GranularityMinute {
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "granularity "+string(req.Granularity))
+	}
+	kind, err := p.deviceKind(ctx, "GetHistoricalData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	systemID, serial, _ := splitEnphaseDeviceID("GetHistoricalData", deviceID)
+	start, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return nil, provider.NewError(provider.ErrInvalidRequest, providerName, "GetHistoricalData", "invalid start time: "+err.Error())
+	}
+	params := func() url.Values {
+		return p.params(url.Values{
+			"granularity": {"day"},
+			"start_at":    {strconv.FormatInt(start.Unix(), 10)},
+		})
+	}
+
+	series := newEnphaseSeries(deviceID, req)
+	switch kind {
+	case kindMicro:
+		var resp enphaseTelemetryResponse
+		path := fmt.Sprintf("%s/systems/%s/devices/micros/%s/telemetry", apiPrefix, systemID, serial)
+		if err := p.client.Get(ctx, path, params(), &resp); err != nil {
+			return nil, fmt.Errorf("Enphase GetHistoricalData: %w", err)
+		}
+		series.addProduction(resp.Intervals)
+
+	case kindGateway:
+		var production enphaseTelemetryResponse
+		path := fmt.Sprintf("%s/systems/%s/telemetry/production_micro", apiPrefix, systemID)
+		if err := p.client.Get(ctx, path, params(), &production); err != nil {
+			return nil, fmt.Errorf("Enphase GetHistoricalData: %w", err)
+		}
+		series.addProduction(production.Intervals)
+
+		// Systems without a consumption meter or batteries answer 4xx;
+		// production alone is still a useful history.
+		var consumption enphaseTelemetryResponse
+		path = fmt.Sprintf("%s/systems/%s/telemetry/consumption_meter", apiPrefix, systemID)
+		if err := p.client.Get(ctx, path, params(), &consumption); err == nil {
+			series.addConsumption(consumption.Intervals)
+		} else {
+			log.Debug().Err(err).Str("systemId", systemID).Msg("Enphase consumption telemetry unavailable")
+		}
+		var battery enphaseBatteryTelemetryResponse
+		path = fmt.Sprintf("%s/systems/%s/telemetry/battery", apiPrefix, systemID)
+		if err := p.client.Get(ctx, path, params(), &battery); err == nil {
+			series.addBattery(battery.Intervals)
+		} else {
+			log.Debug().Err(err).Str("systemId", systemID).Msg("Enphase battery telemetry unavailable")
+		}
+
+	default:
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "device type "+string(kind))
+	}
+
+	history := series.response()
+	return &history, nil
+}
+
+// ── Alarms ──
+
+func (p *EnphaseProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
+	return nil, provider.NotSupported(providerName, provider.OpGetAlarms, "")
+}
+
+func (p *EnphaseProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
+	return nil, provider.NotSupported(providerName, provider.OpGetAllAlarms, "")
+}
+
+func (p *EnphaseProvider) Healthy(ctx context.Context) bool {
+	return p.client.HasSession()
+}
+
+func (p *EnphaseProvider) Close() error {
+	return nil
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Enphase raw response types
+// ══════════════════════════════════════════════════════════════════
+
+// enphaseToken is the token file's content.
+type enphaseToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type enphaseTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // seconds
+}
+
+type enphaseSystemListResponse struct {
+	Total   int             `json:"total"`
+	Systems []enphaseSystem `json:"systems"`
+}
+
+type enphaseSystem struct {
+	SystemID       int64   `json:"system_id"`
+	Name           string  `json:"name"`
+	PublicName     string  `json:"public_name"`
+	Timezone       string  `json:"timezone"`
+	SystemSize     float64 `json:"system_size"` // W
+	Status         string  `json:"status"`
+	ConnectionType string  `json:"connection_type"`
+	Address        struct {
+		City       string `json:"city"`
+		State      string `json:"state"`
+		Country    string `json:"country"`
+		PostalCode string `json:"postal_code"`
+	} `json:"address"`
+}
+
+type enphaseDevicesResponse struct {
+	Devices struct {
+		Micros    []enphaseDevice `json:"micros"`
+		Meters    []enphaseDevice `json:"meters"`
+		Gateways  []enphaseDevice `json:"gateways"`
+		Encharges []enphaseDevice `json:"encharges"` // IQ Batteries
+		Enpowers  []enphaseDevice `json:"enpowers"`  // IQ System Controllers
+	} `json:"devices"`
+}
+
+type enphaseDevice struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	SerialNumber string `json:"serial_number"`
+	Model        string `json:"model"`
+	PartNumber   string `json:"part_number"`
+	SKU          string `json:"sku"`
+	Status       string `json:"status"` // "normal", "micro", "power", "comm", …
+	Active       bool   `json:"active"`
+	LastReportAt int64  `json:"last_report_at"` // Unix seconds
+	ProductName  string `json:"product_name"`
+}
+
+type enphaseSummary struct {
+	SystemID          int64    `json:"system_id"`
+	CurrentPower      float64  `json:"current_power"`   // W
+	EnergyToday       *float64 `json:"energy_today"`    // Wh
+	EnergyLifetime    *float64 `json:"energy_lifetime"` // Wh
+	LastIntervalEndAt int64    `json:"last_interval_end_at"`
+	LastReportAt      int64    `json:"last_report_at"`
+	Modules           int      `json:"modules"`
+	SizeW             float64  `json:"size_w"`
+	Status            string   `json:"status"`
+}
+
+type enphaseMicroSummary struct {
+	SerialNumber  string          `json:"serial_number"`
+	Model         string          `json:"model"`
+	Status        string          `json:"status"`
+	PowerProduced enphaseQuantity `json:"power_produced"`
+	Energy        enphaseQuantity `json:"energy"` // lifetime
+	LastReportAt  string          `json:"last_report_date"`
+}
+
+type enphaseQuantity struct {
+	Value *float64 `json:"value"`
+	Units string   `json:"units"` // "W", "Wh", "kWh", …
+}
+
+type enphaseEnergyLifetimeResponse struct {
+	StartDate  string    `json:"start_date"`
+	Production []float64 `json:"production"` // Wh per day from start_date
+}
+
+type enphaseTelemetryResponse struct {
+	Intervals []enphaseInterval `json:"intervals"`
+}
+
+type enphaseInterval struct {
+	EndAt int64    `json:"end_at"` // Unix seconds
+	Powr  *float64 `json:"powr"`   // average W
+	Enwh  *float64 `json:"enwh"`   // Wh
+}
+
+type enphaseBatteryTelemetryResponse struct {
+	Intervals []enphaseBatteryInterval `json:"intervals"`
+}
+
+type enphaseBatteryInterval struct {
+	EndAt  int64 `json:"end_at"`
+	Charge struct {
+		Enwh *float64 `json:"enwh"`
+	} `json:"charge"`
+	Discharge struct {
+		Enwh *float64 `json:"enwh"`
+	} `json:"discharge"`
+	SOC struct {
+		Percent *float64 `json:"percent"`
+	} `json:"soc"`
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Normalization functions
+// ══════════════════════════════════════════════════════════════════
+
+func normalizeEnphasePlant(raw enphaseSystem) models.NormalizedPlant {
+	systemID := strconv.FormatInt(raw.SystemID, 10)
+	var address []string
+	for _, part := range []string{raw.Address.PostalCode, raw.Address.City, raw.Address.State} {
+		if part != "" {
+			address = append(address, part)
+		}
+	}
+
+	plant := models.NormalizedPlant{
+		ID:       fmt.Sprintf("%s_%s", providerName, systemID),
+		Provider: providerName,
+		Name:     raw.Name,
+		Timezone: raw.Timezone,
+		Address:  strings.Join(address, " "),
+		Country:  raw.Address.Country,
+		// The system list does not say whether it has batteries
+		PlantType: models.PlantTypeUnknown,
+		Meta: models.ProviderMeta{
+			Provider:        providerName,
+			ProviderPlantID: systemID,
+			FetchedAt:       time.Now().UTC(),
+			Extra:           map[string]string{},
+		},
+	}
+	if raw.SystemSize > 0 {
+		kwp := raw.SystemSize / 1000
+		plant.PeakPowerKWp = &kwp
+	}
+	if raw.Status != "" {
+		plant.Meta.Extra["status"] = raw.Status
+	}
+	return plant
+}
+
+func normalizeEnphaseDevice(raw enphaseDevice, systemID string, kind enphaseDeviceKind) models.NormalizedDevice {
+	rawID := enphaseDeviceID(systemID, raw.SerialNumber)
+	name := raw.Name
+	if name == "" {
+		name = raw.ProductName
+	}
+	model := raw.Model
+	if model == "" {
+		model = raw.SKU
+	}
+	status := enphaseDeviceStatus(raw.Status)
+
+	dev := models.NormalizedDevice{
+		ID:           fmt.Sprintf("%s_%s", providerName, rawID),
+		Provider:     providerName,
+		PlantID:      fmt.Sprintf("%s_%s", providerName, systemID),
+		Name:         name,
+		SerialNumber: raw.SerialNumber,
+		Model:        model,
+		DeviceType:   kind.deviceType(),
+		Manufacturer: "Enphase",
+		Status:       status,
+		IsOnline:     status != models.DeviceStatusOffline && status != models.DeviceStatusUnknown,
+		HasAlarm:     status == models.DeviceStatusFault || status == models.DeviceStatusWarning,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: rawID,
+			ProviderPlantID:  systemID,
+			FetchedAt:        time.Now().UTC(),
+			Extra: map[string]string{
+				"deviceType": string(kind),
+				"status":     raw.Status,
+			},
+		},
+	}
+	if raw.PartNumber != "" {
+		dev.Meta.Extra["partNumber"] = raw.PartNumber
+	}
+	if kind == kindBattery {
+		dev.BatteryInfo = &models.DeviceBatteryInfo{Count: 1, SerialNumbers: []string{raw.SerialNumber}}
+	}
+	return dev
+}
+
+func newEnphaseRealtime(deviceID string, reportedAt int64) models.NormalizedRealtime {
+	now := time.Now().UTC()
+	rt := models.NormalizedRealtime{
+		DeviceID:      fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:      providerName,
+		Timestamp:     now,
+		Status:        models.DeviceStatusUnknown,
+		OperatingMode: models.OperatingModeUnknown,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: deviceID,
+			RawDataAvailable: true,
+			FetchedAt:        now,
+		},
+	}
+	if reportedAt > 0 {
+		rt.Timestamp = time.Unix(reportedAt, 0).UTC()
+		rt.OriginalTimestamp = strconv.FormatInt(reportedAt, 10)
+	}
+	return rt
+}
+
+// normalizeEnphaseSystemRealtime reports a whole system for its gateway, with
+// one module per micro.
+func normalizeEnphaseSystemRealtime(summary enphaseSummary, micros []enphaseMicroSummary, deviceID string) models.NormalizedRealtime {
+	reportedAt := summary.LastIntervalEndAt
+	if reportedAt == 0 {
+		reportedAt = summary.LastReportAt
+	}
+	rt := newEnphaseRealtime(deviceID, reportedAt)
+	rt.Status = enphaseDeviceStatus(summary.Status)
+	rt.OperatingMode = enphaseOperatingMode(rt.Status)
+
+	modules := make([]models.PVModule, 0, len(micros))
+	for _, m := range micros {
+		modules = append(modules, enphaseModule(m))
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].SerialNumber < modules[j].SerialNumber })
+
+	rt.PV = &models.PVData{
+		TotalPowerW:    summary.CurrentPower,
+		TodayEnergyKWh: whToKWh(summary.EnergyToday),
+		TotalEnergyKWh: whToKWh(summary.EnergyLifetime),
+		Modules:        modules,
+	}
+	return rt
+}
+
+func normalizeEnphaseMicroRealtime(m enphaseMicroSummary, deviceID string) models.NormalizedRealtime {
+	module := enphaseModule(m)
+	rt := newEnphaseRealtime(deviceID, 0)
+	if module.LastReportAt != nil {
+		rt.Timestamp = *module.LastReportAt
+		rt.OriginalTimestamp = m.LastReportAt
+	}
+	rt.Status = enphaseDeviceStatus(m.Status)
+	rt.OperatingMode = enphaseOperatingMode(rt.Status)
+
+	rt.PV = &models.PVData{
+		TotalPowerW:    deref(module.PowerW),
+		TotalEnergyKWh: module.EnergyKWh,
+		Modules:        []models.PVModule{module},
+	}
+	return rt
+}
+
+func normalizeEnphaseBatteryRealtime(iv enphaseBatteryInterval, deviceID string) models.NormalizedRealtime {
+	rt := newEnphaseRealtime(deviceID, iv.EndAt)
+
+	// The interval's net energy over 15 minutes gives its average power
+	power := (deref(iv.Charge.Enwh) - deref(iv.Discharge.Enwh)) * 4
+	rt.Battery = &models.BatteryData{
+		SOCPercent: iv.SOC.Percent,
+		PowerW:     power,
+		Direction:  enphaseBatteryDirection(power),
+	}
+	return rt
+}
+
+func normalizeEnphaseSummaryEnergy(summary enphaseSummary, plantID string, period models.Period) models.NormalizedEnergy {
+	energy := newEnphaseEnergy(plantID, period)
+	switch period {
+	case models.PeriodDay:
+		energy.PVGenerationKWh = whToKWh(summary.EnergyToday)
+	case models.PeriodTotal:
+		energy.PVGenerationKWh = whToKWh(summary.EnergyLifetime)
+	}
+	power := summary.CurrentPower
+	energy.CurrentPowerW = &power
+	status := enphaseDeviceStatus(summary.Status)
+	energy.DeviceStatus = &status
+	return energy
+}
+
+func normalizeEnphaseLifetimeEnergy(resp enphaseEnergyLifetimeResponse, plantID string, period models.Period, start, end time.Time) models.NormalizedEnergy {
+	energy := newEnphaseEnergy(plantID, period)
+	energy.PeriodStart = start.UTC()
+	energy.PeriodEnd = end.UTC()
+
+	var total float64
+	for _, wh := range resp.Production {
+		total += wh
+	}
+	energy.PVGenerationKWh = whToKWh(&total)
+	return energy
+}
+
+func newEnphaseEnergy(plantID string, period models.Period) models.NormalizedEnergy {
+	return models.NormalizedEnergy{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Period:    period,
+		Timestamp: time.Now().UTC(),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+}
+
+// enphaseSeries merges the telemetry streams of a device into one point per
+// interval end.
+type enphaseSeries struct {
+	deviceID string
+	req      models.HistoryRequest
+	points   map[int64]*models.NormalizedTimeSeries
+}
+
+func newEnphaseSeries(deviceID string, req models.HistoryRequest) *enphaseSeries {
+	return &enphaseSeries{deviceID: deviceID, req: req, points: make(map[int64]*models.NormalizedTimeSeries)}
+}
+
+func (s *enphaseSeries) point(endAt int64) *models.NormalizedTimeSeries {
+	dp, ok := s.points[endAt]
+	if !ok {
+		dp = &models.NormalizedTimeSeries{
+			DeviceID:    fmt.Sprintf("%s_%s", providerName, s.deviceID),
+			Provider:    providerName,
+			Timestamp:   time.Unix(endAt, 0).UTC(),
+			Granularity: s.req.Granularity,
+			Meta: models.ProviderMeta{
+				Provider:         providerName,
+				ProviderDeviceID: s.deviceID,
+				FetchedAt:        time.Now().UTC(),
+			},
+		}
+		s.points[endAt] = dp
+	}
+	return dp
+}
+
+func (s *enphaseSeries) addProduction(intervals []enphaseInterval) {
+	for _, iv := range intervals {
+		dp := s.point(iv.EndAt)
+		dp.PVPowerW = iv.Powr
+		dp.PVEnergyKWh = whToKWh(iv.Enwh)
+	}
+}
+
+func (s *enphaseSeries) addConsumption(intervals []enphaseInterval) {
+	for _, iv := range intervals {
+		dp := s.point(iv.EndAt)
+		dp.LoadEnergyKWh = whToKWh(iv.Enwh)
+		if iv.Enwh != nil {
+			power := *iv.Enwh * 4 // Wh per 15 minutes
+			dp.LoadPowerW = &power
+		}
+	}
+}
+
+func (s *enphaseSeries) addBattery(intervals []enphaseBatteryInterval) {
+	for _, iv := range intervals {
+		dp := s.point(iv.EndAt)
+		dp.BatteryChargeKWh = whToKWh(iv.Charge.Enwh)
+		dp.BatteryDischargeKWh = whToKWh(iv.Discharge.Enwh)
+		dp.BatterySOC = iv.SOC.Percent
+		if iv.Charge.Enwh != nil || iv.Discharge.Enwh != nil {
+			power := (deref(iv.Charge.Enwh) - deref(iv.Discharge.Enwh)) * 4
+			dir := enphaseBatteryDirection(power)
+			dp.BatteryPowerW = &power
+			dp.BatteryDirection = &dir
+		}
+	}
+}
+
+func (s *enphaseSeries) response() models.HistoryResponse {
+	result := models.HistoryResponse{
+		DeviceID:    fmt.Sprintf("%s_%s", providerName, s.deviceID),
+		Provider:    providerName,
+		Granularity: s.req.Granularity,
+		StartTime:   s.req.StartTime,
+		EndTime:     s.req.EndTime,
+	}
+	var end time.Time
+	if s.req.EndTime != "" {
+		end, _ = time.Parse(time.RFC3339, s.req.EndTime)
+	}
+	for _, dp := range s.points {
+		if !end.IsZero() && dp.Timestamp.After(end) {
+			continue
+		}
+		result.DataPoints = append(result.DataPoints, *dp)
+	}
+	sort.Slice(result.DataPoints, func(i, j int) bool {
+		return result.DataPoints[i].Timestamp.Before(result.DataPoints[j].Timestamp)
+	})
+	result.TotalPoints = len(result.DataPoints)
+	return result
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Mapping helpers
+// ══════════════════════════════════════════════════════════════════
+
+// enphaseDeviceKind is the device list group a device was listed in.
+type enphaseDeviceKind string
+
+const (
+	kindMicro   enphaseDeviceKind = "micro"
+	kindGateway enphaseDeviceKind = "gateway"
+	kindMeter   enphaseDeviceKind = "meter"
+	kindBattery enphaseDeviceKind = "encharge"
+	kindEnpower enphaseDeviceKind = "enpower"
+)
+
+func (k enphaseDeviceKind) deviceType() models.DeviceType {
+	switch k {
+	case kindMicro:
+		return models.DeviceTypeMicroInverter
+	case kindGateway:
+		return models.DeviceTypeGateway
+	case kindMeter:
+		return models.DeviceTypeMeter
+	case kindBattery:
+		return models.DeviceTypeBattery
+	case kindEnpower:
+		return models.DeviceTypeEMS
+	default:
+		return models.DeviceTypeUnknown
+	}
+}
+
+func enphaseDeviceID(systemID, serial string) string {
+	return systemID + "-" + serial
+}
+
+// splitEnphaseDeviceID splits "<systemId>-<serial>"; system IDs are numeric.
+func splitEnphaseDeviceID(op, deviceID string) (systemID, serial string, err error) {
+	systemID, serial, ok := strings.Cut(deviceID, "-")
+	if !ok || systemID == "" || serial == "" {
+		return "", "", provider.NewError(provider.ErrInvalidRequest, providerName, op,
+			fmt.Sprintf("device ID %q is not of the form <systemId>-<serial>", deviceID))
+	}
+	return systemID, serial, nil
+}
+
+func enphaseModule(m enphaseMicroSummary) models.PVModule {
+	module := models.PVModule{
+		SerialNumber: m.SerialNumber,
+		PowerW:       m.PowerProduced.Value,
+	}
+	if v := m.Energy.Value; v != nil {
+		kwh := *v
+		switch strings.ToLower(m.Energy.Units) {
+		case "wh":
+			kwh /= 1000
+		case "mwh":
+			kwh *= 1000
+		}
+		module.EnergyKWh = &kwh
+	}
+	if t, err := time.Parse(time.RFC3339, m.LastReportAt); err == nil {
+		t = t.UTC()
+		module.LastReportAt = &t
+	}
+	return module
+}
+
+// enphaseDeviceStatus maps the system and device status: "normal", or the
+// part with a problem ("comm", "micro", "meter", "battery", "power", …).
+func enphaseDeviceStatus(status string) models.DeviceStatus {
+	switch strings.ToLower(status) {
+	case "normal", "active":
+		return models.DeviceStatusNormal
+	case "comm", "retired", "no_data":
+		return models.DeviceStatusOffline
+	case "power", "error":
+		return models.DeviceStatusFault
+	case "micro", "meter", "battery", "storage", "meter_issue", "warning":
+		return models.DeviceStatusWarning
+	default:
+		return models.DeviceStatusUnknown
+	}
+}
+
+func enphaseOperatingMode(status models.DeviceStatus) models.OperatingMode {
+	switch status {
+	case models.DeviceStatusNormal, models.DeviceStatusWarning:
+		return models.OperatingModeGridConnected
+	case models.DeviceStatusFault:
+		return models.OperatingModeFault
+	default:
+		return models.OperatingModeUnknown
+	}
+}
+
+func enphaseBatteryDirection(power float64) models.EnergyDirection {
+	if power > 0 {
+		return models.DirectionCharging
+	} else if power < 0 {
+		return models.DirectionDischarging
+	}
+	return models.DirectionIdle
+}
+
+func whToKWh(wh *float64) *float64 {
+	if wh == nil {
+		return nil
+	}
+	kwh := *wh / 1000
+	return &kwh
+}
+
+func deref(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
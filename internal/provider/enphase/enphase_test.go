@@ -0,0 +1,62 @@
+package enphase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+func TestTokenRequestSendsFormBody(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/token" {
+			t.Errorf("unexpected call %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		calls++
+		if r.Method != http.MethodPost || r.URL.RawQuery != "" {
+			t.Errorf("token request %s with query %q, want POST without query", r.Method, r.URL.RawQuery)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("ParseForm: %v", err)
+		}
+		if g, rt := r.PostForm.Get("grant_type"), r.PostForm.Get("refresh_token"); g != "refresh_token" || rt != "refresh-1" {
+			t.Errorf("form grant_type %q, refresh_token %q", g, rt)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"access-2","refresh_token":"refresh-2","expires_in":86400}`)
+	}))
+	defer srv.Close()
+
+	p := &EnphaseProvider{}
+	err := p.Initialize(context.Background(), provider.ProviderConfig{
+		Name:    "enphase-test",
+		BaseURL: srv.URL,
+		Credentials: map[string]string{
+			"apiKey":       "key",
+			"clientId":     "client",
+			"clientSecret": "secret",
+			"refreshToken": "refresh-1",
+			"tokenFile":    filepath.Join(t.TempDir(), "token.json"),
+		},
+		RateLimitRPS: 1000,
+	})
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("%d token requests, want 1", calls)
+	}
+	if p.token.AccessToken != "access-2" || p.token.RefreshToken != "refresh-2" {
+		t.Errorf("token = %+v", p.token)
+	}
+}
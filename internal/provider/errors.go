@@ -0,0 +1,163 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error kinds. Every error a provider or the shared HTTP client returns for a
+// failed vendor call is an *Error whose Kind is one of these sentinels, so
+// callers can branch with errors.Is regardless of the vendor's own codes.
+var (
+	ErrAuth                = errors.New("authentication failed")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrNotFound            = errors.New("not found")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+	ErrVendor              = errors.New("vendor error") // unrecognised vendor error code
+	ErrInvalidRequest      = errors.New("invalid request")
+	ErrNotSupported        = errors.New("not supported")
+	ErrCircuitOpen         = errors.New("circuit open")
+)
+
+// Error is the typed error produced by providers and the HTTP client.
+type Error struct {
+	Kind       error  // one of the Err* sentinels; nil if unclassified
+	Provider   string // provider type (e.g. "saj")
+	Instance   string // provider instance name, filled in by the engine
+	Op         string // operation or endpoint that failed
+	VendorCode string // vendor-specific error code, if any
+	Message    string // human-readable detail
+	Err        error  // underlying cause, if any
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Provider != "" {
+		b.WriteString(e.Provider)
+		b.WriteString(": ")
+	}
+	if e.Op != "" {
+		b.WriteString(e.Op)
+		b.WriteString(": ")
+	}
+	switch {
+	case e.Message != "":
+		b.WriteString(e.Message)
+	case e.Err != nil:
+		b.WriteString(e.Err.Error())
+	case e.Kind != nil:
+		b.WriteString(e.Kind.Error())
+	}
+	if e.VendorCode != "" {
+		fmt.Fprintf(&b, " (code=%s)", e.VendorCode)
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is makes errors.Is(err, ErrRateLimited) etc. match on Kind.
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// NewError builds a classified provider error.
+func NewError(kind error, providerType, op, message string) *Error {
+	return &Error{Kind: kind, Provider: providerType, Op: op, Message: message}
+}
+
+// VendorError builds a classified error carrying the vendor's own error code.
+func VendorError(kind error, providerType, op, code, message string) *Error {
+	return &Error{Kind: kind, Provider: providerType, Op: op, VendorCode: code, Message: message}
+}
+
+// NotSupported reports an operation, granularity or period a provider cannot serve.
+func NotSupported(providerType string, op Operation, detail string) error {
+	msg := "not supported"
+	if detail != "" {
+		msg = detail + " not supported"
+	}
+	return NewError(ErrNotSupported, providerType, string(op), msg)
+}
+
+// KindForStatus classifies an HTTP status code returned by a vendor API.
+// It returns nil for statuses below 400.
+func KindForStatus(status int) error {
+	switch {
+	case status < 400:
+		return nil
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrUpstreamUnavailable
+	default:
+		return ErrInvalidRequest
+	}
+}
+
+// ErrorCode returns the machine-readable code for an error's kind, e.g.
+// "rate_limited". Unclassified errors yield "internal_error".
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrAuth):
+		return "auth_failed"
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return "upstream_unavailable"
+	case errors.Is(err, ErrVendor):
+		return "vendor_error"
+	case errors.Is(err, ErrInvalidRequest):
+		return "invalid_request"
+	case errors.Is(err, ErrNotSupported):
+		return "not_supported"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	default:
+		return "internal_error"
+	}
+}
+
+// PublicMessage describes err for API clients from its kind, operation and
+// vendor code alone, e.g. "huawei: getStationList: rate limited (code=407)".
+// Messages and causes can quote vendor responses, URLs or credentials, so
+// the full error belongs in the server log only.
+func PublicMessage(err error) string {
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Kind == nil {
+		for _, kind := range kinds {
+			if errors.Is(err, kind) {
+				return kind.Error()
+			}
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "timed out"
+		}
+		return "internal error"
+	}
+	return (&Error{Kind: perr.Kind, Provider: perr.Provider, Op: perr.Op, VendorCode: perr.VendorCode}).Error()
+}
+
+// kinds lists the error kinds for PublicMessage.
+var kinds = []error{
+	ErrAuth, ErrRateLimited, ErrNotFound, ErrUpstreamUnavailable, ErrVendor,
+	ErrInvalidRequest, ErrNotSupported, ErrCircuitOpen,
+}
+
+// InstanceOf returns the provider instance recorded on err, if any.
+func InstanceOf(err error) string {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return perr.Instance
+	}
+	return ""
+}
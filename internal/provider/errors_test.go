@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPublicMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "vendor error",
+			err:  VendorError(ErrRateLimited, "huawei", "getStationList", "407", "ACCESS_FREQUENCY_IS_TOO_HIGH for user api-user"),
+			want: "huawei: getStationList: rate limited (code=407)",
+		},
+		{
+			name: "transport error",
+			err: fmt.Errorf("fetch: %w", &Error{Kind: ErrUpstreamUnavailable, Provider: "solaredge", Op: "GET /site/1/overview",
+				Err: &url.Error{Op: "Get", URL: "https://monitoringapi.solaredge.com/site/1/overview?api_key=SECRET", Err: errors.New("EOF")}}),
+			want: "solaredge: GET /site/1/overview: upstream unavailable",
+		},
+		{
+			name: "wrapped sentinel",
+			err:  fmt.Errorf("token for refresh-SECRET: %w", ErrAuth),
+			want: "authentication failed",
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("call with key SECRET: %w", context.DeadlineExceeded),
+			want: "timed out",
+		},
+		{
+			name: "unclassified",
+			err:  errors.New("decode response SECRET"),
+			want: "internal error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PublicMessage(tt.err)
+			if got != tt.want {
+				t.Errorf("PublicMessage = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, "SECRET") {
+				t.Errorf("PublicMessage leaks %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,1276 @@
+package goodwe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBaseURL = "https://www.semsportal.com/api"
+	providerName   = "goodwe"
+
+	// semsClientToken identifies the client before login; the login
+	// response replaces it with the session token.
+	semsClientToken = `{"version":"v2.1.0","client":"ios","language":"en"}`
+
+	semsTimeLayout = "01/02/2006 15:04:05"
+	semsDateLayout = "2006-01-02"
+)
+
+func init() {
+	provider.Register(providerName, func() provider.Provider {
+		return &GoodWeProvider{}
+	})
+}
+
+// GoodWeProvider implements the Provider interface for the GoodWe SEMS
+// Portal API. Every call carries a "Token" header holding a JSON object;
+// CrossLogin exchanges the account and password for one with a session
+// token, and names the regional server the account lives on.
+// Key endpoints:
+//   - /v2/Common/CrossLogin — login
+//   - /PowerStationMonitor/QueryPowerStationMonitorForApp — plants
+//   - /v2/PowerStation/GetMonitorDetailByPowerstationId — plant detail,
+//     KPIs, power flow and every inverter's readings
+//   - /v2/PowerStation/GetInverterAllPoint — inverters
+//   - /v2/Charts/GetPlantPowerChart — a day's power curves
+//   - /v1/warning/GetWarningDetailList — alarms
+//
+// SEMS returns most readings as strings with units ("5.2kW", "300.1V/4.1A"),
+// read with normalizer.ParseReading. Device IDs are inverter serials; the
+// provider remembers which power station each one belongs to.
+type GoodWeProvider struct {
+	client      *provider.HTTPClient
+	loginClient *provider.HTTPClient
+	config      provider.ProviderConfig
+	loc         *time.Location // station-local times are read in this zone
+
+	mu       sync.Mutex
+	stations map[string]string // inverter serial → power station ID
+}
+
+func (p *GoodWeProvider) Name() string { return providerName }
+
+func (p *GoodWeProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		// Inverter details come with the device list
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails),
+		// The power chart has a point every 5 minutes
+		Granularities: []models.Granularity{
+			models.GranularityMinute,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricBattery, provider.MetricGrid,
+			provider.MetricGridPhases, provider.MetricLoad, provider.MetricEnvironment,
+		},
+	}
+}
+
+func (p *GoodWeProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
+	p.config = cfg
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	rps := cfg.RateLimitRPS
+	if rps <= 0 {
+		rps = 2
+	}
+
+	p.loc = time.UTC
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("GoodWe: timezone: %w", err)
+		}
+		p.loc = loc
+	}
+
+	if cfg.GetCredential("account") == "" || cfg.GetCredential("password") == "" {
+		return provider.NewError(provider.ErrAuth, providerName, "auth", "credentials account and password are required")
+	}
+
+	// Logins always go to the global server; the session moves the
+	// client to the account's region.
+	p.loginClient = provider.NewHTTPClient(strings.TrimSuffix(baseURL, "/"), cfg.TimeoutSeconds, rps)
+	p.loginClient.SetHeader("Token", semsClientToken)
+
+	p.client = provider.NewHTTPClient(strings.TrimSuffix(baseURL, "/"), cfg.TimeoutSeconds, rps)
+	p.client.SetSession(provider.Session{
+		Login:   p.authenticate,
+		Expired: semsSessionExpired,
+	})
+	p.stations = make(map[string]string)
+
+	return p.client.Authenticate(ctx)
+}
+
+// authenticate calls CrossLogin and installs the returned token object as
+// the Token header. SEMS does not report a lifetime; expiry is detected
+// from codes 100001 and 100002.
+func (p *GoodWeProvider) authenticate(ctx context.Context) (time.Time, error) {
+	body := map[string]interface{}{
+		"account": p.config.GetCredential("account"),
+		"pwd":     p.config.GetCredential("password"),
+	}
+
+	var resp semsLoginResponse
+	if err := p.loginClient.Post(ctx, "/v2/Common/CrossLogin", body, &resp); err != nil {
+		return time.Time{}, fmt.Errorf("GoodWe auth: %w", err)
+	}
+	if resp.failed() {
+		return time.Time{}, semsError("auth", resp.semsBaseResponse)
+	}
+	if len(resp.Data) == 0 || string(resp.Data) == "null" {
+		return time.Time{}, provider.NewError(provider.ErrAuth, providerName, "auth", "login response without token")
+	}
+
+	api := resp.API
+	if api == "" {
+		api = resp.Components.API
+	}
+	if api != "" {
+		p.client.SetBaseURL(strings.TrimSuffix(api, "/"))
+	}
+	p.client.SetHeader("Token", string(resp.Data))
+
+	log.Info().Str("provider", providerName).Str("api", api).Msg("Authenticated successfully")
+	return time.Time{}, nil
+}
+
+// ── Plants ──
+
+func (p *GoodWeProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
+	var plants []models.NormalizedPlant
+	for page := 1; ; page++ {
+		body := map[string]interface{}{
+			"page_index":          page,
+			"page_size":           100,
+			"key":                 "",
+			"orderby":             "",
+			"powerstation_type":   "",
+			"powerstation_status": "",
+		}
+
+		var resp semsStationListResponse
+		if err := p.client.Post(ctx, "/PowerStationMonitor/QueryPowerStationMonitorForApp", body, &resp); err != nil {
+			return nil, fmt.Errorf("GoodWe GetPlants: %w", err)
+		}
+		if resp.failed() {
+			return nil, semsError("GetPlants", resp.semsBaseResponse)
+		}
+
+		for _, raw := range resp.Data.List {
+			plants = append(plants, normalizeSemsPlant(raw))
+		}
+		if len(resp.Data.List) == 0 || len(plants) >= resp.Data.Record {
+			break
+		}
+	}
+	return plants, nil
+}
+
+func (p *GoodWeProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
+	detail, err := p.monitorDetail(ctx, "GetPlantDetails", plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	plant := normalizeSemsPlantDetail(detail, plantID)
+	return &plant, nil
+}
+
+// monitorDetail fetches the monitoring page of a power station and records
+// which station its inverters belong to.
+func (p *GoodWeProvider) monitorDetail(ctx context.Context, op, stationID string) (*semsMonitorDetail, error) {
+	body := map[string]interface{}{"powerStationId": stationID}
+
+	var resp semsMonitorDetailResponse
+	if err := p.client.Post(ctx, "/v2/PowerStation/GetMonitorDetailByPowerstationId", body, &resp); err != nil {
+		return nil, fmt.Errorf("GoodWe %s: %w", op, err)
+	}
+	if resp.failed() {
+		return nil, semsError(op, resp.semsBaseResponse)
+	}
+
+	p.mu.Lock()
+	for _, inv := range resp.Data.Inverter {
+		p.stations[inv.SN] = stationID
+	}
+	p.mu.Unlock()
+	return &resp.Data, nil
+}
+
+// ── Devices ──
+
+func (p *GoodWeProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
+	body := map[string]interface{}{"powerStationId": plantID}
+
+	var resp semsInverterPointsResponse
+	if err := p.client.Post(ctx, "/v2/PowerStation/GetInverterAllPoint", body, &resp); err != nil {
+		return nil, fmt.Errorf("GoodWe GetDevices: %w", err)
+	}
+	if resp.failed() {
+		return nil, semsError("GetDevices", resp.semsBaseResponse)
+	}
+
+	var devices []models.NormalizedDevice
+	p.mu.Lock()
+	for _, raw := range resp.Data.InverterPoints {
+		p.stations[raw.SN] = plantID
+		devices = append(devices, normalizeSemsDevice(raw, plantID))
+	}
+	p.mu.Unlock()
+	return devices, nil
+}
+
+// stationOf returns the power station of an inverter, looking through every
+// station if it has not been seen yet.
+func (p *GoodWeProvider) stationOf(ctx context.Context, op, sn string) (string, error) {
+	p.mu.Lock()
+	stationID, ok := p.stations[sn]
+	p.mu.Unlock()
+	if ok {
+		return stationID, nil
+	}
+
+	plants, err := p.GetPlants(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, plant := range plants {
+		detail, err := p.monitorDetail(ctx, op, plant.Meta.ProviderPlantID)
+		if err != nil {
+			return "", err
+		}
+		for _, inv := range detail.Inverter {
+			if inv.SN == sn {
+				return plant.Meta.ProviderPlantID, nil
+			}
+		}
+	}
+	return "", provider.NewError(provider.ErrNotFound, providerName, op, "unknown device "+sn)
+}
+
+func (p *GoodWeProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
+	// Details come with GetInverterAllPoint
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
+}
+
+// ── Real-Time Data ──
+
+func (p *GoodWeProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	stationID, err := p.stationOf(ctx, "GetRealTimeData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	detail, err := p.monitorDetail(ctx, "GetRealTimeData", stationID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inv := range detail.Inverter {
+		if inv.SN == deviceID {
+			rt := normalizeSemsRealtime(inv, detail, deviceID, p.loc)
+			return &rt, nil
+		}
+	}
+	return nil, provider.NewError(provider.ErrNotFound, providerName, "GetRealTimeData", "no data for device "+deviceID)
+}
+
+// ── Energy Stats ──
+
+func (p *GoodWeProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
+	switch period {
+	case models.PeriodDay, models.PeriodMonth, models.PeriodTotal:
+	default:
+		return nil, provider.NotSupported(providerName, provider.OpGetEnergyStats, "period "+string(period))
+	}
+
+	detail, err := p.monitorDetail(ctx, "GetEnergyStats", plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	energy := normalizeSemsEnergy(detail, plantID, period)
+	return &energy, nil
+}
+
+// ── Historical Data ──
+
+// GetHistoricalData returns the power curves of the inverter's power
+// station for the station-local day of the start time. SEMS charts whole
+// stations only, so every inverter of a station shares them.
+func (p *GoodWeProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
+	if req.Granularity != models.GranularityMinute {
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "granularity "+string(req.Granularity))
+	}
+	start, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return nil, provider.NewError(provider.ErrInvalidRequest, providerName, "GetHistoricalData", "invalid start time: "+err.Error())
+	}
+	stationID, err := p.stationOf(ctx, "GetHistoricalData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	day := start.In(p.loc)
+	body := map[string]interface{}{
+		"id":          stationID,
+		"date":        day.Format(semsDateLayout),
+		"full_script": false,
+	}
+
+	var resp semsPowerChartResponse
+	if err := p.client.Post(ctx, "/v2/Charts/GetPlantPowerChart", body, &resp); err != nil {
+		return nil, fmt.Errorf("GoodWe GetHistoricalData: %w", err)
+	}
+	if resp.failed() {
+		return nil, semsError("GetHistoricalData", resp.semsBaseResponse)
+	}
+
+	history := normalizeSemsHistory(resp.Data.Lines, deviceID, stationID, req, day, p.loc)
+	return &history, nil
+}
+
+// ── Alarms ──
+
+func (p *GoodWeProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
+	stationID, err := p.stationOf(ctx, "GetAlarms", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	alarms, err := p.stationAlarms(ctx, "GetAlarms", stationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var deviceAlarms []models.NormalizedAlarm
+	for _, a := range alarms {
+		if a.DeviceSerialNumber == deviceID {
+			deviceAlarms = append(deviceAlarms, a)
+		}
+	}
+	return deviceAlarms, nil
+}
+
+func (p *GoodWeProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
+	plants, err := p.GetPlants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var allAlarms []models.NormalizedAlarm
+	for _, plant := range plants {
+		alarms, err := p.stationAlarms(ctx, "GetAllAlarms", plant.Meta.ProviderPlantID)
+		if err != nil {
+			log.Warn().Err(err).Str("stationId", plant.Meta.ProviderPlantID).Msg("Failed to fetch GoodWe station alarms")
+			continue
+		}
+		allAlarms = append(allAlarms, alarms...)
+	}
+	return allAlarms, nil
+}
+
+// stationAlarms returns the warnings of a power station, active and
+// recovered.
+func (p *GoodWeProvider) stationAlarms(ctx context.Context, op, stationID string) ([]models.NormalizedAlarm, error) {
+	var alarms []models.NormalizedAlarm
+	for page := 1; ; page++ {
+		body := map[string]interface{}{
+			"pw_id":      stationID,
+			"status":     "", // all
+			"page_index": page,
+			"page_size":  100,
+		}
+
+		var resp semsWarningListResponse
+		if err := p.client.Post(ctx, "/v1/warning/GetWarningDetailList", body, &resp); err != nil {
+			return nil, fmt.Errorf("GoodWe %s: %w", op, err)
+		}
+		if resp.failed() {
+			return nil, semsError(op, resp.semsBaseResponse)
+		}
+
+		for _, raw := range resp.Data.List {
+			alarms = append(alarms, normalizeSemsAlarm(raw, stationID, p.loc))
+		}
+		if len(resp.Data.List) == 0 || len(alarms) >= resp.Data.Record {
+			break
+		}
+	}
+	return alarms, nil
+}
+
+func (p *GoodWeProvider) Healthy(ctx context.Context) bool {
+	return p.client.HasSession()
+}
+
+func (p *GoodWeProvider) Close() error {
+	return nil
+}
+
+// ══════════════════════════════════════════════════════════════════
+// SEMS raw response types
+// ══════════════════════════════════════════════════════════════════
+
+type semsBaseResponse struct {
+	HasError bool     `json:"hasError"`
+	Code     semsCode `json:"code"` // 0 = success
+	Msg      string   `json:"msg"`
+}
+
+func (r semsBaseResponse) failed() bool {
+	return r.HasError || (r.Code != "" && r.Code != "0")
+}
+
+// semsCode is a result or warning code, sent as a number or a string
+// depending on the endpoint.
+type semsCode string
+
+func (c *semsCode) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*c = ""
+		return nil
+	}
+	*c = semsCode(strings.Trim(string(data), `"`))
+	return nil
+}
+
+func (c semsCode) String() string { return string(c) }
+
+type semsLoginResponse struct {
+	semsBaseResponse
+	// The token object (uid, timestamp, token, client, version,
+	// language), sent back verbatim as the Token header
+	Data       json.RawMessage `json:"data"`
+	API        string          `json:"api"` // regional server
+	Components struct {
+		API string `json:"api"`
+	} `json:"components"`
+}
+
+type semsStationListResponse struct {
+	semsBaseResponse
+	Data struct {
+		Record int           `json:"record"`
+		List   []semsStation `json:"list"`
+	} `json:"data"`
+}
+
+type semsStation struct {
+	PowerStationID string      `json:"powerstation_id"`
+	StationName    string      `json:"stationname"`
+	Location       string      `json:"location"`
+	Capacity       interface{} `json:"capacity"` // kW, a number or "5kW"
+	Status         int         `json:"status"`   // see semsDeviceStatus
+	Pac            interface{} `json:"pac"`
+	EDay           interface{} `json:"eday"`
+}
+
+type semsMonitorDetailResponse struct {
+	semsBaseResponse
+	Data semsMonitorDetail `json:"data"`
+}
+
+type semsMonitorDetail struct {
+	Info struct {
+		PowerStationID   string      `json:"powerstation_id"`
+		Time             string      `json:"time"` // station-local
+		StationName      string      `json:"stationname"`
+		Address          string      `json:"address"`
+		Capacity         interface{} `json:"capacity"`         // kW
+		BatteryCapacity  interface{} `json:"battery_capacity"` // kWh
+		PowerStationType string      `json:"powerstation_type"`
+		Status           int         `json:"status"`
+		IsStored         bool        `json:"is_stored"`
+		Longitude        interface{} `json:"longitude"`
+		Latitude         interface{} `json:"latitude"`
+		CreateTime       string      `json:"create_time"`
+	} `json:"info"`
+	KPI struct {
+		MonthGeneration float64 `json:"month_generation"` // kWh
+		Pac             float64 `json:"pac"`              // W
+		Power           float64 `json:"power"`            // today, kWh
+		TotalPower      float64 `json:"total_power"`      // lifetime, kWh
+		DayIncome       float64 `json:"day_income"`
+		TotalIncome     float64 `json:"total_income"`
+		Currency        string  `json:"currency"`
+	} `json:"kpi"`
+	Inverter  []semsInverter `json:"inverter"`
+	PowerFlow *struct {
+		PV            string      `json:"pv"` // "1234(W)"
+		PVStatus      int         `json:"pvStatus"`
+		Battery       string      `json:"bettery"`
+		BatteryStatus int         `json:"betteryStatus"` // 1 = discharging, -1 = charging
+		Load          string      `json:"load"`
+		LoadStatus    int         `json:"loadStatus"`
+		Grid          string      `json:"grid"`
+		GridStatus    int         `json:"gridStatus"` // 1 = exporting, -1 = importing
+		SOC           interface{} `json:"soc"`
+	} `json:"powerflow"`
+	// Today's energy balance in kWh: "sum" (generation), "buy", "sell",
+	// "selfUseOfPv", "consumptionOfLoad", "charge", "disCharge"
+	EnergyStatistics map[string]interface{} `json:"energeStatisticsCharts"`
+}
+
+type semsInverter struct {
+	SN          string      `json:"sn"`
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // model
+	Status      int         `json:"status"`
+	OutPac      interface{} `json:"out_pac"`
+	EDay        interface{} `json:"eday"`
+	EMonth      interface{} `json:"emonth"`
+	ETotal      interface{} `json:"etotal"`
+	Temperature interface{} `json:"tempperature"` // sic
+	// Display values with units, e.g. "output_power": "1234W",
+	// "dc_input1": "300.1V/4.1A", "battery": "52.1V/-10.0A/-521W"
+	D map[string]interface{} `json:"d"`
+}
+
+type semsInverterPointsResponse struct {
+	semsBaseResponse
+	Data struct {
+		InverterPoints []semsInverterPoint `json:"inverterPoints"`
+	} `json:"data"`
+}
+
+type semsInverterPoint struct {
+	SN       string      `json:"sn"`
+	Name     string      `json:"name"`
+	Status   int         `json:"status"`
+	Capacity interface{} `json:"capacity"`
+	Dict     struct {
+		Left  []semsPoint `json:"left"`
+		Right []semsPoint `json:"right"`
+	} `json:"dict"`
+}
+
+type semsPoint struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit"`
+}
+
+type semsPowerChartResponse struct {
+	semsBaseResponse
+	Data struct {
+		Lines []semsChartLine `json:"lines"`
+	} `json:"data"`
+}
+
+type semsChartLine struct {
+	Key   string `json:"key"`   // "PCurve_Power_PV", "…_Battery", "…_Meter", "…_Load", "…_SOC"
+	Label string `json:"label"` // "PV(W)"
+	Unit  string `json:"unit"`
+	XY    []struct {
+		X string   `json:"x"` // "HH:mm", station-local
+		Y *float64 `json:"y"`
+	} `json:"xy"`
+}
+
+type semsWarningListResponse struct {
+	semsBaseResponse
+	Data struct {
+		Record int           `json:"record"`
+		List   []semsWarning `json:"list"`
+	} `json:"data"`
+}
+
+type semsWarning struct {
+	WarningID    string   `json:"warningid"`
+	SN           string   `json:"sn"`
+	DeviceName   string   `json:"devicename"`
+	StationName  string   `json:"stationname"`
+	WarningCode  semsCode `json:"warning_code"`
+	WarningName  string   `json:"warningname"`
+	HappenTime   string   `json:"happentime"`   // station-local
+	RecoveryTime string   `json:"recoverytime"` // empty while active
+	Status       int      `json:"status"`       // 0 = active, 1 = recovered
+	WarningLevel int      `json:"warninglevel"` // 1 = notice, 2 = warning, 3 = fault
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Normalization functions
+// ══════════════════════════════════════════════════════════════════
+
+func normalizeSemsPlant(raw semsStation) models.NormalizedPlant {
+	plant := models.NormalizedPlant{
+		ID:        fmt.Sprintf("%s_%s", providerName, raw.PowerStationID),
+		Provider:  providerName,
+		Name:      raw.StationName,
+		Address:   raw.Location,
+		PlantType: models.PlantTypeUnknown,
+		Meta: models.ProviderMeta{
+			Provider:        providerName,
+			ProviderPlantID: raw.PowerStationID,
+			FetchedAt:       time.Now().UTC(),
+		},
+	}
+	plant.PeakPowerKWp = semsReading(raw.Capacity, "kW")
+	return plant
+}
+
+func normalizeSemsPlantDetail(detail *semsMonitorDetail, plantID string) models.NormalizedPlant {
+	info := detail.Info
+	plant := models.NormalizedPlant{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Name:      info.StationName,
+		Address:   info.Address,
+		Currency:  detail.KPI.Currency,
+		PlantType: semsPlantType(info.PowerStationType, info.IsStored),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+			Extra:            map[string]string{},
+		},
+	}
+
+	plant.PeakPowerKWp = semsReading(info.Capacity, "kW")
+	lat := semsReading(info.Latitude, "")
+	lng := semsReading(info.Longitude, "")
+	if lat != nil && lng != nil && (*lat != 0 || *lng != 0) {
+		plant.Location = &models.LatLng{Latitude: *lat, Longitude: *lng}
+	}
+	if battery := semsReading(info.BatteryCapacity, "kWh"); battery != nil && *battery > 0 {
+		plant.Meta.Extra["batteryCapacityKWh"] = strconv.FormatFloat(*battery, 'f', -1, 64)
+	}
+	if info.PowerStationType != "" {
+		plant.Meta.Extra["powerstationType"] = info.PowerStationType
+	}
+	return plant
+}
+
+func normalizeSemsDevice(raw semsInverterPoint, plantID string) models.NormalizedDevice {
+	points := semsPoints(raw)
+	model := extractStr(points, "dmDeviceType")
+	status := semsDeviceStatus(raw.Status)
+	name := raw.Name
+	if name == "" {
+		name = raw.SN
+	}
+
+	dev := models.NormalizedDevice{
+		ID:           fmt.Sprintf("%s_%s", providerName, raw.SN),
+		Provider:     providerName,
+		PlantID:      fmt.Sprintf("%s_%s", providerName, plantID),
+		Name:         name,
+		SerialNumber: raw.SN,
+		Model:        model,
+		DeviceType:   semsDeviceType(model, points),
+		Manufacturer: "GoodWe",
+		Status:       status,
+		IsOnline:     status != models.DeviceStatusOffline,
+		HasAlarm:     status == models.DeviceStatusFault,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: raw.SN,
+			ProviderPlantID:  plantID,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	if capacity := semsReading(raw.Capacity, "kW"); capacity != nil {
+		w := *capacity * 1000
+		dev.RatedPowerW = &w
+	}
+	if fw := extractStr(points, "firmwareversion"); fw != "" {
+		dev.FirmwareInfo = &models.FirmwareInfo{MainVersion: fw}
+	}
+	return dev
+}
+
+// normalizeSemsRealtime maps an inverter of GetMonitorDetailByPowerstationId.
+// The station's power flow adds grid and load for single-inverter stations,
+// where it describes that inverter.
+func normalizeSemsRealtime(inv semsInverter, detail *semsMonitorDetail, deviceID string, loc *time.Location) models.NormalizedRealtime {
+	now := time.Now().UTC()
+	d := inv.D
+
+	rt := models.NormalizedRealtime{
+		DeviceID:         fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:         providerName,
+		Timestamp:        now,
+		OriginalTimezone: loc.String(),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: deviceID,
+			ProviderPlantID:  detail.Info.PowerStationID,
+			RawDataAvailable: true,
+			FetchedAt:        now,
+		},
+	}
+	rt.Status, rt.OperatingMode = semsRunStatus(inv.Status, extractStr(d, "work_mode"))
+
+	if ts := extractStr(d, "last_refresh_time"); ts != "" {
+		rt.OriginalTimestamp = ts
+		if t, err := time.ParseInLocation(semsTimeLayout, ts, loc); err == nil {
+			rt.Timestamp = t.UTC()
+		}
+	}
+
+	// SEMS keys in "d":
+	// "output_power" / "pac" (W), "eDay", "eTotal" (kWh)
+	// "dc_input1".."dc_input4" ("V/A" per MPPT)
+	// "vac1".."vac3", "iac1".."iac3", "fac1".."fac3" (per phase)
+	// "battery" ("V/A/W", negative = charging), "soc", "soh"
+	// "tempperature" (°C)
+	acPower := semsFirstReading(d, "W", "output_power", "pac")
+	if acPower == nil {
+		acPower = semsReading(inv.OutPac, "W")
+	}
+	pvStrings := semsPVStrings(d)
+	pvPower := 0.0
+	for _, s := range pvStrings {
+		pvPower += normalizer.SafeFloat(s.PowerW)
+	}
+	if len(pvStrings) == 0 {
+		pvPower = normalizer.SafeFloat(acPower)
+	}
+	rt.PV = &models.PVData{
+		TotalPowerW:    pvPower,
+		TodayEnergyKWh: semsFirstReading(d, "kWh", "eDay"),
+		TotalEnergyKWh: semsFirstReading(d, "kWh", "eTotal"),
+		Strings:        pvStrings,
+	}
+	if rt.PV.TodayEnergyKWh == nil {
+		rt.PV.TodayEnergyKWh = semsReading(inv.EDay, "kWh")
+	}
+	if rt.PV.TotalEnergyKWh == nil {
+		rt.PV.TotalEnergyKWh = semsReading(inv.ETotal, "kWh")
+	}
+	rt.PV.MonthEnergyKWh = semsReading(inv.EMonth, "kWh")
+
+	freq := semsFirstReading(d, "Hz", "fac1")
+	rt.Grid = &models.GridData{
+		// The inverter's own output flows to the grid
+		TotalPowerW: -normalizer.SafeFloat(acPower),
+		Direction:   semsGridDirection(-normalizer.SafeFloat(acPower)),
+		FrequencyHz: freq,
+		Phases:      semsPhases(d, freq),
+	}
+
+	if parts := semsSplit(d, "battery"); len(parts) == 3 {
+		// "V/A/W", positive when discharging
+		power := -normalizer.SafeFloat(normalizer.ReadingPtr(parts[2], "W"))
+		rt.Battery = &models.BatteryData{
+			SOCPercent: semsFirstReading(d, "%", "soc"),
+			PowerW:     power,
+			Direction:  semsBatteryDirection(power),
+			VoltageDC:  normalizer.ReadingPtr(parts[0], "V"),
+			CurrentDC:  normalizer.ReadingPtr(parts[1], "A"),
+		}
+	}
+
+	if flow := detail.PowerFlow; flow != nil && len(detail.Inverter) == 1 {
+		// Strings without a reading are missing from the sum above
+		if pv := normalizer.ReadingPtr(flow.PV, "W"); pv != nil {
+			rt.PV.TotalPowerW = *pv
+		}
+		if grid := normalizer.ReadingPtr(flow.Grid, "W"); grid != nil {
+			power := -*grid * float64(flow.GridStatus)
+			rt.Grid.TotalPowerW = power
+			rt.Grid.Direction = semsGridDirection(power)
+		}
+		if load := normalizer.ReadingPtr(flow.Load, "W"); load != nil {
+			rt.Load = &models.LoadData{
+				TotalPowerW:    *load,
+				TodayEnergyKWh: semsKWh(detail.EnergyStatistics, "consumptionOfLoad"),
+			}
+		}
+		if detail.EnergyStatistics != nil {
+			rt.Grid.TodayImportKWh = semsKWh(detail.EnergyStatistics, "buy")
+			rt.Grid.TodayExportKWh = semsKWh(detail.EnergyStatistics, "sell")
+		}
+	}
+
+	temp := semsFirstReading(d, "°C", "tempperature")
+	if temp == nil {
+		temp = semsReading(inv.Temperature, "°C")
+	}
+	if temp != nil {
+		rt.Environment = &models.EnvironmentData{InverterTemperatureC: temp}
+	}
+
+	return rt
+}
+
+func normalizeSemsEnergy(detail *semsMonitorDetail, plantID string, period models.Period) models.NormalizedEnergy {
+	kpi := detail.KPI
+	energy := models.NormalizedEnergy{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Period:    period,
+		Timestamp: time.Now().UTC(),
+		Currency:  kpi.Currency,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	switch period {
+	case models.PeriodDay:
+		generation := kpi.Power
+		energy.PVGenerationKWh = &generation
+		income := kpi.DayIncome
+		energy.Revenue = &income
+
+		stats := detail.EnergyStatistics
+		energy.GridImportKWh = semsKWh(stats, "buy")
+		energy.GridExportKWh = semsKWh(stats, "sell")
+		energy.LoadConsumptionKWh = semsKWh(stats, "consumptionOfLoad")
+		energy.SelfConsumptionKWh = semsKWh(stats, "selfUseOfPv")
+		energy.BatteryChargeKWh = semsKWh(stats, "charge")
+		energy.BatteryDischargeKWh = semsKWh(stats, "disCharge")
+		if energy.GridExportKWh != nil && generation > 0 {
+			rate := normalizer.CalculateSelfConsumptionRate(generation, *energy.GridExportKWh)
+			energy.SelfConsumptionRate = &rate
+		}
+		if energy.LoadConsumptionKWh != nil && energy.GridImportKWh != nil && *energy.LoadConsumptionKWh > 0 {
+			rate := normalizer.CalculateSelfSufficiencyRate(*energy.LoadConsumptionKWh, *energy.GridImportKWh)
+			energy.SelfSufficiencyRate = &rate
+		}
+	case models.PeriodMonth:
+		generation := kpi.MonthGeneration
+		energy.PVGenerationKWh = &generation
+	case models.PeriodTotal:
+		generation := kpi.TotalPower
+		energy.PVGenerationKWh = &generation
+		income := kpi.TotalIncome
+		energy.Revenue = &income
+		co2 := normalizer.CalculateCO2Savings(generation)
+		energy.CO2SavedKg = &co2
+	}
+
+	power := kpi.Pac
+	energy.CurrentPowerW = &power
+	status := semsDeviceStatus(detail.Info.Status)
+	energy.DeviceStatus = &status
+	if flow := detail.PowerFlow; flow != nil {
+		energy.BatterySOC = semsReading(flow.SOC, "%")
+	}
+
+	return energy
+}
+
+// normalizeSemsHistory merges the chart lines of a day into one point per
+// time of day.
+func normalizeSemsHistory(lines []semsChartLine, deviceID, stationID string, req models.HistoryRequest, day time.Time, loc *time.Location) models.HistoryResponse {
+	result := models.HistoryResponse{
+		DeviceID:    fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:    providerName,
+		Granularity: req.Granularity,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+	}
+
+	var points []*models.NormalizedTimeSeries
+	byTime := make(map[string]*models.NormalizedTimeSeries)
+	for _, line := range lines {
+		unit := line.Unit
+		if unit == "" {
+			unit = semsLabelUnit(line.Label)
+		}
+		for _, xy := range line.XY {
+			if xy.Y == nil {
+				continue
+			}
+			dp, ok := byTime[xy.X]
+			if !ok {
+				t, err := time.ParseInLocation(semsDateLayout+" 15:04", day.Format(semsDateLayout)+" "+xy.X, loc)
+				if err != nil {
+					continue
+				}
+				dp = &models.NormalizedTimeSeries{
+					DeviceID:    result.DeviceID,
+					Provider:    providerName,
+					Timestamp:   t.UTC(),
+					Granularity: req.Granularity,
+					Meta: models.ProviderMeta{
+						Provider:         providerName,
+						ProviderDeviceID: deviceID,
+						ProviderPlantID:  stationID,
+						FetchedAt:        time.Now().UTC(),
+					},
+				}
+				byTime[xy.X] = dp
+				points = append(points, dp)
+			}
+
+			// Convert from the line's unit (kW on some accounts)
+			value := *xy.Y
+			if w, ok := normalizer.ConvertReading(value, unit, "W"); ok {
+				value = w
+			}
+			switch line.Key {
+			case "PCurve_Power_PV":
+				dp.PVPowerW = &value
+			case "PCurve_Power_Load":
+				dp.LoadPowerW = &value
+			case "PCurve_Power_Meter":
+				// Positive when exporting
+				grid := -value
+				dp.GridPowerW = &grid
+			case "PCurve_Power_Battery":
+				// Positive when discharging
+				battery := -value
+				dir := semsBatteryDirection(battery)
+				dp.BatteryPowerW = &battery
+				dp.BatteryDirection = &dir
+			case "PCurve_Power_SOC":
+				dp.BatterySOC = &value
+			}
+		}
+	}
+
+	var end time.Time
+	if req.EndTime != "" {
+		end, _ = time.Parse(time.RFC3339, req.EndTime)
+	}
+	for _, dp := range points {
+		if !end.IsZero() && dp.Timestamp.After(end) {
+			continue
+		}
+		result.DataPoints = append(result.DataPoints, *dp)
+	}
+	result.TotalPoints = len(result.DataPoints)
+	return result
+}
+
+func normalizeSemsAlarm(raw semsWarning, stationID string, loc *time.Location) models.NormalizedAlarm {
+	code := raw.WarningCode.String()
+	ts := time.Now()
+	if t, err := time.ParseInLocation(semsTimeLayout, raw.HappenTime, loc); err == nil {
+		ts = t.UTC()
+	}
+
+	alarm := models.NormalizedAlarm{
+		ID:                 fmt.Sprintf("%s_alarm_%s_%s_%d", providerName, raw.SN, code, ts.Unix()),
+		Provider:           providerName,
+		DeviceID:           fmt.Sprintf("%s_%s", providerName, raw.SN),
+		PlantID:            fmt.Sprintf("%s_%s", providerName, stationID),
+		Code:               code,
+		Name:               raw.WarningName,
+		Severity:           semsSeverity(raw.WarningLevel),
+		Status:             semsAlarmStatus(raw.Status),
+		DeviceSerialNumber: raw.SN,
+		DeviceType:         models.DeviceTypeInverter,
+		PlantName:          raw.StationName,
+		StartTime:          ts,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: raw.SN,
+			ProviderPlantID:  stationID,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+	if raw.WarningID != "" {
+		alarm.Meta.Extra = map[string]string{"warningId": raw.WarningID}
+	}
+
+	if raw.RecoveryTime != "" {
+		if t, err := time.ParseInLocation(semsTimeLayout, raw.RecoveryTime, loc); err == nil {
+			t = t.UTC()
+			alarm.EndTime = &t
+		}
+	}
+
+	return alarm
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Mapping helpers
+// ══════════════════════════════════════════════════════════════════
+
+// semsDeviceStatus maps the station and inverter status: -1=offline,
+// 0=waiting, 1=generating, 2=fault.
+func semsDeviceStatus(s int) models.DeviceStatus {
+	switch s {
+	case -1:
+		return models.DeviceStatusOffline
+	case 0:
+		return models.DeviceStatusStandby
+	case 1:
+		return models.DeviceStatusNormal
+	case 2:
+		return models.DeviceStatusFault
+	default:
+		return models.DeviceStatusUnknown
+	}
+}
+
+// semsRunStatus refines the inverter status with the displayed work mode
+// ("Normal", "Wait Mode", "Fault Mode", "Off-grid", …).
+func semsRunStatus(s int, workMode string) (models.DeviceStatus, models.OperatingMode) {
+	status := semsDeviceStatus(s)
+	mode := strings.ToLower(workMode)
+	switch {
+	case status == models.DeviceStatusOffline:
+		return status, models.OperatingModeShutdown
+	case status == models.DeviceStatusFault || strings.Contains(mode, "fault"):
+		return models.DeviceStatusFault, models.OperatingModeFault
+	case strings.Contains(mode, "off-grid") || strings.Contains(mode, "off grid") || strings.Contains(mode, "backup"):
+		return status, models.OperatingModeOffGrid
+	case strings.Contains(mode, "check") || strings.Contains(mode, "self-test"):
+		return status, models.OperatingModeInitializing
+	case strings.Contains(mode, "upgrad") || strings.Contains(mode, "flash"):
+		return models.DeviceStatusUpgrade, models.OperatingModeUpgrading
+	case status == models.DeviceStatusStandby || strings.Contains(mode, "wait"):
+		return status, models.OperatingModeWaiting
+	case status == models.DeviceStatusNormal:
+		return status, models.OperatingModeGridConnected
+	default:
+		return status, models.OperatingModeUnknown
+	}
+}
+
+// semsDeviceType tells hybrid (storage) inverters apart by their model
+// series (ET, EH, BT, BH, ES, EM, SBP) or a reported battery.
+func semsDeviceType(model string, points map[string]interface{}) models.DeviceType {
+	m := strings.ToUpper(model)
+	for _, series := range []string{"-ET", "-EH", "-BT", "-BH", "-ES", "-EM", "-SBP"} {
+		if strings.Contains(m, series) {
+			return models.DeviceTypeHybridInverter
+		}
+	}
+	if _, ok := points["soc"]; ok {
+		return models.DeviceTypeHybridInverter
+	}
+	if m == "" {
+		return models.DeviceTypeInverter
+	}
+	return models.DeviceTypeStringInverter
+}
+
+func semsPlantType(stationType string, stored bool) models.PlantType {
+	switch {
+	case stored || strings.Contains(strings.ToLower(stationType), "storage"):
+		return models.PlantTypeHybrid
+	case strings.Contains(strings.ToLower(stationType), "commercial"):
+		return models.PlantTypeCommercial
+	case stationType != "":
+		return models.PlantTypeGridTied
+	default:
+		return models.PlantTypeUnknown
+	}
+}
+
+func semsSeverity(level int) models.AlarmSeverity {
+	switch level {
+	case 1:
+		return models.AlarmSeverityInfo
+	case 2:
+		return models.AlarmSeverityWarning
+	case 3:
+		return models.AlarmSeverityCritical
+	default:
+		return models.AlarmSeverityUnknown
+	}
+}
+
+func semsAlarmStatus(status int) models.AlarmStatus {
+	switch status {
+	case 0:
+		return models.AlarmStatusActive
+	case 1:
+		return models.AlarmStatusResolved
+	default:
+		return models.AlarmStatusUnknown
+	}
+}
+
+// semsPoints flattens the left and right columns of an inverter's points.
+func semsPoints(raw semsInverterPoint) map[string]interface{} {
+	points := make(map[string]interface{})
+	for _, pt := range append(raw.Dict.Left, raw.Dict.Right...) {
+		if s, ok := pt.Value.(string); ok && pt.Unit != "" {
+			points[pt.Key] = s + pt.Unit
+			continue
+		}
+		points[pt.Key] = pt.Value
+	}
+	return points
+}
+
+// semsPVStrings reads "dc_input1".."dc_input4" ("300.1V/4.1A").
+func semsPVStrings(d map[string]interface{}) []models.PVString {
+	var pvStrings []models.PVString
+	for i := 1; i <= 4; i++ {
+		parts := semsSplit(d, fmt.Sprintf("dc_input%d", i))
+		if len(parts) < 2 {
+			continue
+		}
+		v := normalizer.ReadingPtr(parts[0], "V")
+		c := normalizer.ReadingPtr(parts[1], "A")
+		if v == nil && c == nil {
+			continue
+		}
+		var pw *float64
+		if v != nil && c != nil {
+			p := *v * *c
+			pw = &p
+		}
+		pvStrings = append(pvStrings, models.PVString{ID: i, VoltageV: v, CurrentA: c, PowerW: pw})
+	}
+	return pvStrings
+}
+
+// semsPhases reads "vac1".."vac3" and "iac1".."iac3" as phases A to C.
+func semsPhases(d map[string]interface{}, freq *float64) []models.PhaseData {
+	var phases []models.PhaseData
+	for i, phase := range []string{"A", "B", "C"} {
+		voltage := semsFirstReading(d, "V", fmt.Sprintf("vac%d", i+1))
+		current := semsFirstReading(d, "A", fmt.Sprintf("iac%d", i+1))
+		if (voltage == nil || *voltage == 0) && (current == nil || *current == 0) {
+			continue
+		}
+		phaseFreq := semsFirstReading(d, "Hz", fmt.Sprintf("fac%d", i+1))
+		if phaseFreq == nil {
+			phaseFreq = freq
+		}
+		phases = append(phases, models.PhaseData{Phase: phase, VoltageV: voltage, CurrentA: current, FrequencyHz: phaseFreq})
+	}
+	return phases
+}
+
+// semsLabelUnit reads the unit of a chart label such as "PV(W)".
+func semsLabelUnit(label string) string {
+	open, end := strings.LastIndex(label, "("), strings.LastIndex(label, ")")
+	if open < 0 || end <= open {
+		return ""
+	}
+	return label[open+1 : end]
+}
+
+func semsGridDirection(power float64) models.GridDirection {
+	if power > 0 {
+		return models.GridDirectionImporting
+	} else if power < 0 {
+		return models.GridDirectionExporting
+	}
+	return models.GridDirectionIdle
+}
+
+func semsBatteryDirection(power float64) models.EnergyDirection {
+	if power > 0 {
+		return models.DirectionCharging
+	} else if power < 0 {
+		return models.DirectionDischarging
+	}
+	return models.DirectionIdle
+}
+
+// semsSessionExpired recognizes the "authorization has expired" codes.
+func semsSessionExpired(status int, body []byte) bool {
+	if status == 401 {
+		return true
+	}
+	var resp semsBaseResponse
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	return resp.Code == "100001" || resp.Code == "100002"
+}
+
+// semsError classifies a SEMS error code into the provider error taxonomy.
+func semsError(op string, resp semsBaseResponse) error {
+	var kind error
+	msg := strings.ToLower(resp.Msg)
+	switch {
+	case resp.Code == "100001" || resp.Code == "100002" || resp.Code == "100005" ||
+		strings.Contains(msg, "password") || strings.Contains(msg, "authorization"):
+		kind = provider.ErrAuth
+	case strings.Contains(msg, "frequent") || strings.Contains(msg, "too many"):
+		kind = provider.ErrRateLimited
+	case strings.Contains(msg, "not exist") || strings.Contains(msg, "not found"):
+		kind = provider.ErrNotFound
+	case strings.Contains(msg, "param"):
+		kind = provider.ErrInvalidRequest
+	default:
+		// an answer, so the API is up
+		kind = provider.ErrVendor
+	}
+	return provider.VendorError(kind, providerName, op, resp.Code.String(), resp.Msg)
+}
+
+// ── Extraction helpers ──
+
+// semsReading reads a value that is either a number or a string with a
+// unit, converted to unit; an empty unit takes a bare number.
+func semsReading(v interface{}, unit string) *float64 {
+	switch val := v.(type) {
+	case float64:
+		return &val
+	case string:
+		if unit == "" {
+			f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				return nil
+			}
+			return &f
+		}
+		return normalizer.ReadingPtr(val, unit)
+	default:
+		return nil
+	}
+}
+
+// semsFirstReading returns the first of keys that holds a reading of unit.
+func semsFirstReading(m map[string]interface{}, unit string, keys ...string) *float64 {
+	if m == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if f := semsReading(m[key], unit); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// semsSplit splits a compound reading such as "300.1V/4.1A".
+func semsSplit(m map[string]interface{}, key string) []string {
+	s := extractStr(m, key)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "/")
+}
+
+func extractStr(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	v, ok := m[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// semsKWh reads an energy value, in kWh unless it says otherwise.
+func semsKWh(m map[string]interface{}, key string) *float64 {
+	return semsFirstReading(m, "kWh", key)
+}
@@ -0,0 +1,1061 @@
+package growatt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBaseURL = "https://openapi.growatt.com"
+	providerName   = "growatt"
+)
+
+func init() {
+	provider.Register(providerName, func() provider.Provider {
+		return &GrowattProvider{}
+	})
+}
+
+// GrowattProvider implements the Provider interface for the Growatt
+// ShineServer OpenAPI (v1). Growatt issues a static API token per account,
+// sent in the "token" header; there is no login.
+// Key endpoints:
+//   - /v1/plant/list, /v1/plant/details — plants
+//   - /v1/plant/data — plant energy overview
+//   - /v1/device/list — devices of a plant, with their type
+//   - /v1/device/{inverter,storage,mix}/…last_…data — real-time data
+//   - /v1/device/{inverter,storage,mix}/alarm_data — alarms
+//
+// Real-time data and alarms are served per device type, so the provider
+// remembers the type of every device it has listed.
+type GrowattProvider struct {
+	client *provider.HTTPClient
+	config provider.ProviderConfig
+	token  string
+	loc    *time.Location // the plants' timezone; alarm dates and times are local
+
+	mu    sync.Mutex
+	types map[string]*growattDeviceKind // device serial → kind
+}
+
+func (p *GrowattProvider) Name() string { return providerName }
+
+func (p *GrowattProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		// The OpenAPI has no device detail or history endpoints covering
+		// every device type
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails, provider.OpGetHistoricalData),
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodYear, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricBattery, provider.MetricGrid,
+			provider.MetricGridPhases, provider.MetricLoad, provider.MetricEnvironment,
+		},
+	}
+}
+
+func (p *GrowattProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
+	p.config = cfg
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	// Growatt throttles aggressively (error 10012); stay well below it
+	rps := cfg.RateLimitRPS
+	if rps <= 0 {
+		rps = 2
+	}
+
+	p.loc = time.UTC
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("Growatt: timezone: %w", err)
+		}
+		p.loc = loc
+	}
+
+	p.token = cfg.GetCredential("token")
+	if p.token == "" {
+		return provider.NewError(provider.ErrAuth, providerName, "auth", "credential token is required")
+	}
+
+	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
+	p.client.SetHeader("token", p.token)
+	p.client.SetRetryClassifier(growattRetryClass)
+	p.types = make(map[string]*growattDeviceKind)
+
+	// The token never expires; a cheap call validates it
+	var resp growattPlantListResponse
+	params := url.Values{"page": {"1"}, "perpage": {"1"}}
+	if err := p.client.Get(ctx, "/v1/plant/list", params, &resp); err != nil {
+		return fmt.Errorf("Growatt auth: %w", err)
+	}
+	if resp.ErrorCode != 0 {
+		return growattError("auth", resp.growattBaseResponse)
+	}
+
+	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
+	return nil
+}
+
+// ── Plants ──
+
+func (p *GrowattProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
+	var plants []models.NormalizedPlant
+	for page := 1; ; page++ {
+		params := url.Values{
+			"page":    {strconv.Itoa(page)},
+			"perpage": {"100"},
+		}
+
+		var resp growattPlantListResponse
+		if err := p.client.Get(ctx, "/v1/plant/list", params, &resp); err != nil {
+			return nil, fmt.Errorf("Growatt GetPlants: %w", err)
+		}
+		if resp.ErrorCode != 0 {
+			return nil, growattError("GetPlants", resp.growattBaseResponse)
+		}
+
+		for _, raw := range resp.Data.Plants {
+			plants = append(plants, normalizeGrowattPlant(raw))
+		}
+		if len(resp.Data.Plants) == 0 || len(plants) >= resp.Data.Count {
+			break
+		}
+	}
+	return plants, nil
+}
+
+func (p *GrowattProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
+	params := url.Values{"plant_id": {plantID}}
+
+	var resp growattDataResponse
+	if err := p.client.Get(ctx, "/v1/plant/details", params, &resp); err != nil {
+		return nil, fmt.Errorf("Growatt GetPlantDetails: %w", err)
+	}
+	if resp.ErrorCode != 0 {
+		return nil, growattError("GetPlantDetails", resp.growattBaseResponse)
+	}
+
+	plant := normalizeGrowattPlantDetail(resp.Data, plantID)
+	return &plant, nil
+}
+
+// ── Devices ──
+
+func (p *GrowattProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
+	raws, err := p.listDevices(ctx, "GetDevices", plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []models.NormalizedDevice
+	for _, raw := range raws {
+		devices = append(devices, normalizeGrowattDevice(raw, plantID))
+	}
+	return devices, nil
+}
+
+// listDevices returns the devices of a plant and records their types.
+func (p *GrowattProvider) listDevices(ctx context.Context, op, plantID string) ([]growattDevice, error) {
+	var devices []growattDevice
+	for page := 1; ; page++ {
+		params := url.Values{
+			"plant_id": {plantID},
+			"page":     {strconv.Itoa(page)},
+			"perpage":  {"100"},
+		}
+
+		var resp growattDeviceListResponse
+		if err := p.client.Get(ctx, "/v1/device/list", params, &resp); err != nil {
+			return nil, fmt.Errorf("Growatt %s: %w", op, err)
+		}
+		if resp.ErrorCode != 0 {
+			return nil, growattError(op, resp.growattBaseResponse)
+		}
+
+		devices = append(devices, resp.Data.Devices...)
+		if len(resp.Data.Devices) == 0 || len(devices) >= resp.Data.Count {
+			break
+		}
+	}
+
+	p.mu.Lock()
+	for _, d := range devices {
+		p.types[d.DeviceSN] = growattKind(d.Type)
+	}
+	p.mu.Unlock()
+	return devices, nil
+}
+
+// deviceKind returns the kind of a device, listing the devices of every
+// plant if it has not been seen yet.
+func (p *GrowattProvider) deviceKind(ctx context.Context, op, deviceSN string) (*growattDeviceKind, error) {
+	p.mu.Lock()
+	kind, ok := p.types[deviceSN]
+	p.mu.Unlock()
+	if ok {
+		return kind, nil
+	}
+
+	plants, err := p.GetPlants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, plant := range plants {
+		devices, err := p.listDevices(ctx, op, plant.Meta.ProviderPlantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			if d.DeviceSN == deviceSN {
+				return growattKind(d.Type), nil
+			}
+		}
+	}
+	return nil, provider.NewError(provider.ErrNotFound, providerName, op, "unknown device "+deviceSN)
+}
+
+func (p *GrowattProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
+	// Details come with /v1/device/list
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
+}
+
+// ── Real-Time Data ──
+
+func (p *GrowattProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	kind, err := p.deviceKind(ctx, "GetRealTimeData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if kind.realtimePath == "" {
+		return nil, provider.NotSupported(providerName, provider.OpGetRealTimeData, "device type "+kind.name)
+	}
+
+	params := url.Values{kind.snParam: {deviceID}}
+	var resp growattDataResponse
+	if err := p.client.Get(ctx, kind.realtimePath, params, &resp); err != nil {
+		return nil, fmt.Errorf("Growatt GetRealTimeData: %w", err)
+	}
+	if resp.ErrorCode != 0 {
+		return nil, growattError("GetRealTimeData", resp.growattBaseResponse)
+	}
+	if len(resp.Data) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, "GetRealTimeData", "no data for device "+deviceID)
+	}
+
+	var rt models.NormalizedRealtime
+	switch kind {
+	case kindStorage:
+		rt = normalizeGrowattStorageRealtime(resp.Data, deviceID, p.loc)
+	case kindMix:
+		rt = normalizeGrowattMixRealtime(resp.Data, deviceID, p.loc)
+	default:
+		rt = normalizeGrowattInverterRealtime(resp.Data, deviceID, p.loc)
+	}
+	return &rt, nil
+}
+
+// ── Energy Stats ──
+
+func (p *GrowattProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
+	params := url.Values{"plant_id": {plantID}}
+
+	var resp growattDataResponse
+	if err := p.client.Get(ctx, "/v1/plant/data", params, &resp); err != nil {
+		return nil, fmt.Errorf("Growatt GetEnergyStats: %w", err)
+	}
+	if resp.ErrorCode != 0 {
+		return nil, growattError("GetEnergyStats", resp.growattBaseResponse)
+	}
+
+	energy := normalizeGrowattEnergy(resp.Data, plantID, period)
+	return &energy, nil
+}
+
+// ── Historical Data ──
+
+func (p *GrowattProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
+	return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "")
+}
+
+// ── Alarms ──
+
+func (p *GrowattProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
+	kind, err := p.deviceKind(ctx, "GetAlarms", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return p.deviceAlarms(ctx, "GetAlarms", deviceID, "", kind)
+}
+
+// deviceAlarms returns the alarms of a device from yesterday and today in
+// the plants' timezone. The OpenAPI lists alarms by the day they started,
+// so an alarm raised before midnight would otherwise vanish at midnight
+// while still active. Devices without an alarm endpoint have none.
+func (p *GrowattProvider) deviceAlarms(ctx context.Context, op, deviceSN, plantID string, kind *growattDeviceKind) ([]models.NormalizedAlarm, error) {
+	if kind.alarmPath == "" {
+		return nil, nil
+	}
+
+	today := time.Now().In(p.loc)
+	var alarms []models.NormalizedAlarm
+	for _, day := range []time.Time{today.AddDate(0, 0, -1), today} {
+		listed := 0
+		for page := 1; ; page++ {
+			params := url.Values{
+				kind.snParam: {deviceSN},
+				"date":       {day.Format("2006-01-02")},
+				"page":       {strconv.Itoa(page)},
+				"perpage":    {"100"},
+			}
+
+			var resp growattAlarmResponse
+			if err := p.client.Get(ctx, kind.alarmPath, params, &resp); err != nil {
+				return nil, fmt.Errorf("Growatt %s: %w", op, err)
+			}
+			if resp.ErrorCode != 0 {
+				return nil, growattError(op, resp.growattBaseResponse)
+			}
+
+			for _, raw := range resp.Data.Alarms {
+				alarms = append(alarms, normalizeGrowattAlarm(raw, deviceSN, plantID, kind, p.loc))
+			}
+			listed += len(resp.Data.Alarms)
+			if len(resp.Data.Alarms) == 0 || listed >= resp.Data.Count {
+				break
+			}
+		}
+	}
+	return alarms, nil
+}
+
+func (p *GrowattProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
+	// The OpenAPI lists alarms per device; walk every plant's devices
+	plants, err := p.GetPlants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A list missing a device's alarms would read as those alarms having
+	// cleared, so any failure fails the whole list
+	var allAlarms []models.NormalizedAlarm
+	var firstErr error
+	failed, total := 0, 0
+	for _, plant := range plants {
+		plantID := plant.Meta.ProviderPlantID
+		devices, err := p.listDevices(ctx, "GetAllAlarms", plantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			total++
+			alarms, err := p.deviceAlarms(ctx, "GetAllAlarms", d.DeviceSN, plantID, growattKind(d.Type))
+			if err != nil {
+				log.Warn().Err(err).Str("deviceSn", d.DeviceSN).Msg("Failed to fetch Growatt device alarms")
+				if firstErr == nil {
+					firstErr = err
+				}
+				failed++
+				continue
+			}
+			allAlarms = append(allAlarms, alarms...)
+		}
+	}
+	if firstErr != nil {
+		return nil, fmt.Errorf("Growatt GetAllAlarms: %d of %d devices failed: %w", failed, total, firstErr)
+	}
+	return allAlarms, nil
+}
+
+func (p *GrowattProvider) Healthy(ctx context.Context) bool {
+	return p.token != ""
+}
+
+func (p *GrowattProvider) Close() error {
+	return nil
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Growatt raw response types
+// ══════════════════════════════════════════════════════════════════
+
+type growattBaseResponse struct {
+	ErrorCode int    `json:"error_code"` // 0 = success
+	ErrorMsg  string `json:"error_msg"`
+}
+
+type growattDataResponse struct {
+	growattBaseResponse
+	Data map[string]interface{} `json:"data"`
+}
+
+type growattPlantListResponse struct {
+	growattBaseResponse
+	Data struct {
+		Count  int            `json:"count"`
+		Plants []growattPlant `json:"plants"`
+	} `json:"data"`
+}
+
+type growattPlant struct {
+	PlantID      json.Number `json:"plant_id"`
+	Name         string      `json:"name"`
+	Status       int         `json:"status"` // 0=offline, 1=online, 2=waiting, 3=fault
+	Country      string      `json:"country"`
+	City         string      `json:"city"`
+	Latitude     string      `json:"latitude"`
+	Longitude    string      `json:"longitude"`
+	PeakPower    float64     `json:"peak_power"` // kWp
+	CurrentPower float64     `json:"current_power"`
+	TotalEnergy  string      `json:"total_energy"`
+	CreateDate   string      `json:"create_date"`
+}
+
+type growattDeviceListResponse struct {
+	growattBaseResponse
+	Data struct {
+		Count   int             `json:"count"`
+		Devices []growattDevice `json:"devices"`
+	} `json:"data"`
+}
+
+type growattDevice struct {
+	DeviceID       json.Number `json:"device_id"`
+	DeviceSN       string      `json:"device_sn"`
+	DataloggerSN   string      `json:"datalogger_sn"`
+	Type           int         `json:"type"` // see growattKind
+	Model          string      `json:"model"`
+	Manufacturer   string      `json:"manufacturer"`
+	Status         int         `json:"status"`
+	Lost           bool        `json:"lost"` // no contact with the datalogger
+	LastUpdateTime string      `json:"last_update_time"`
+}
+
+type growattAlarmResponse struct {
+	growattBaseResponse
+	Data struct {
+		Count  int            `json:"count"`
+		Alarms []growattAlarm `json:"alarms"`
+	} `json:"data"`
+}
+
+type growattAlarm struct {
+	AlarmCode    json.Number `json:"alarm_code"`
+	AlarmMessage string      `json:"alarm_message"`
+	Status       int         `json:"status"` // 1=active, 0=recovered
+	StartTime    string      `json:"start_time"`
+	EndTime      string      `json:"end_time"`
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Normalization functions
+// ══════════════════════════════════════════════════════════════════
+
+func normalizeGrowattPlant(raw growattPlant) models.NormalizedPlant {
+	plantID := raw.PlantID.String()
+	plant := models.NormalizedPlant{
+		ID:       fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider: providerName,
+		Name:     raw.Name,
+		Address:  raw.City,
+		Country:  raw.Country,
+		Meta: models.ProviderMeta{
+			Provider:        providerName,
+			ProviderPlantID: plantID,
+			FetchedAt:       time.Now().UTC(),
+		},
+	}
+
+	if lat, err := strconv.ParseFloat(raw.Latitude, 64); err == nil {
+		if lng, err := strconv.ParseFloat(raw.Longitude, 64); err == nil {
+			plant.Location = &models.LatLng{Latitude: lat, Longitude: lng}
+		}
+	}
+	if raw.PeakPower > 0 {
+		peak := raw.PeakPower
+		plant.PeakPowerKWp = &peak
+	}
+	plant.PlantType = models.PlantTypeUnknown
+
+	return plant
+}
+
+func normalizeGrowattPlantDetail(data map[string]interface{}, plantID string) models.NormalizedPlant {
+	plant := models.NormalizedPlant{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Name:      extractStr(data, "name"),
+		Address:   extractStr(data, "city"),
+		Country:   extractStr(data, "country"),
+		Timezone:  extractStr(data, "timezone"),
+		Currency:  extractStr(data, "currency"),
+		PlantType: models.PlantTypeUnknown,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	lat := extractFlP(data, "latitude")
+	lng := extractFlP(data, "longitude")
+	if lat != nil && lng != nil {
+		plant.Location = &models.LatLng{Latitude: *lat, Longitude: *lng}
+	}
+	plant.PeakPowerKWp = extractFlP(data, "peak_power")
+
+	return plant
+}
+
+func normalizeGrowattDevice(raw growattDevice, plantID string) models.NormalizedDevice {
+	kind := growattKind(raw.Type)
+	manufacturer := raw.Manufacturer
+	if manufacturer == "" {
+		manufacturer = "Growatt"
+	}
+	status := growattDeviceStatus(raw.Status)
+	if raw.Lost {
+		status = models.DeviceStatusOffline
+	}
+
+	return models.NormalizedDevice{
+		ID:           fmt.Sprintf("%s_%s", providerName, raw.DeviceSN),
+		Provider:     providerName,
+		PlantID:      fmt.Sprintf("%s_%s", providerName, plantID),
+		Name:         raw.DeviceSN,
+		SerialNumber: raw.DeviceSN,
+		Model:        raw.Model,
+		DeviceType:   kind.deviceType,
+		Manufacturer: manufacturer,
+		Status:       status,
+		IsOnline:     !raw.Lost,
+		HasAlarm:     status == models.DeviceStatusFault,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: raw.DeviceSN,
+			ProviderPlantID:  plantID,
+			FetchedAt:        time.Now().UTC(),
+			Extra: map[string]string{
+				"deviceType":   kind.name,
+				"deviceId":     raw.DeviceID.String(),
+				"dataloggerSn": raw.DataloggerSN,
+			},
+		},
+	}
+}
+
+// newGrowattRealtime returns the common part of a real-time snapshot.
+func newGrowattRealtime(data map[string]interface{}, deviceID string, loc *time.Location) models.NormalizedRealtime {
+	now := time.Now().UTC()
+
+	rt := models.NormalizedRealtime{
+		DeviceID:      fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:      providerName,
+		Timestamp:     now,
+		Status:        models.DeviceStatusUnknown,
+		OperatingMode: models.OperatingModeUnknown,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: deviceID,
+			RawDataAvailable: true,
+			FetchedAt:        now,
+		},
+	}
+
+	// Times are in the plant's local time, without a zone
+	if ts := extractStr(data, "time"); ts != "" {
+		rt.OriginalTimestamp = ts
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", ts, loc); err == nil {
+			rt.Timestamp = t.UTC()
+		}
+	}
+	if s, ok := data["status"]; ok && s != nil {
+		rt.Status, rt.OperatingMode = growattRunStatus(int(extractFl(data, "status")))
+	}
+	return rt
+}
+
+// normalizeGrowattInverterRealtime maps /v1/device/inverter/last_new_data.
+func normalizeGrowattInverterRealtime(data map[string]interface{}, deviceID string, loc *time.Location) models.NormalizedRealtime {
+	rt := newGrowattRealtime(data, deviceID, loc)
+
+	// Growatt inverter keys:
+	// "ppv" (PV power W), "ppv1".."ppv8", "vpv1".., "ipv1".. (per MPPT)
+	// "pac" (AC output W), "fac" (Hz), "pf"
+	// "vacr", "vacs", "vact" / "iacr", "iacs", "iact" (R/S/T phase)
+	// "e_today", "e_total" (kWh), "temperature" (°C)
+	rt.PV = &models.PVData{
+		TotalPowerW:    extractFl(data, "ppv"),
+		TodayEnergyKWh: firstFlP(data, "e_today", "eToday"),
+		TotalEnergyKWh: firstFlP(data, "e_total", "eTotal"),
+		Strings:        growattPVStrings(data),
+	}
+
+	acPower := extractFl(data, "pac")
+	freq := extractFlP(data, "fac")
+	rt.Grid = &models.GridData{
+		// The inverter sees its own output only; it flows to the grid
+		TotalPowerW: -acPower,
+		Direction:   growattGridDirection(-acPower),
+		FrequencyHz: freq,
+		PowerFactor: extractFlP(data, "pf"),
+		Phases:      growattPhases(data, freq),
+	}
+
+	if temp := extractFlP(data, "temperature"); temp != nil {
+		rt.Environment = &models.EnvironmentData{InverterTemperatureC: temp}
+	}
+
+	return rt
+}
+
+// normalizeGrowattStorageRealtime maps /v1/device/storage/storage_last_data.
+func normalizeGrowattStorageRealtime(data map[string]interface{}, deviceID string, loc *time.Location) models.NormalizedRealtime {
+	rt := newGrowattRealtime(data, deviceID, loc)
+
+	// Growatt storage keys:
+	// "capacity" (SOC %), "pCharge", "pDischarge" (W), "vBat" (V)
+	// "ppv" (W), "epvToday", "epvTotal" (kWh)
+	// "pacToGrid", "pacToUser" (W), "outPutPower" (load W)
+	// "eChargeToday", "eDischargeToday", "eChargeTotal", "eDischargeTotal" (kWh)
+	rt.PV = &models.PVData{
+		TotalPowerW:    extractFl(data, "ppv"),
+		TodayEnergyKWh: extractFlP(data, "epvToday"),
+		TotalEnergyKWh: extractFlP(data, "epvTotal"),
+		Strings:        growattPVStrings(data),
+	}
+
+	batPower := extractFl(data, "pCharge") - extractFl(data, "pDischarge")
+	rt.Battery = &models.BatteryData{
+		SOCPercent:        extractFlP(data, "capacity"),
+		PowerW:            batPower,
+		Direction:         growattBatteryDirection(batPower),
+		VoltageDC:         extractFlP(data, "vBat"),
+		TodayChargeKWh:    extractFlP(data, "eChargeToday"),
+		TodayDischargeKWh: extractFlP(data, "eDischargeToday"),
+		TotalChargeKWh:    extractFlP(data, "eChargeTotal"),
+		TotalDischargeKWh: extractFlP(data, "eDischargeTotal"),
+	}
+
+	gridPower := extractFl(data, "pacToUser") - extractFl(data, "pacToGrid")
+	rt.Grid = &models.GridData{
+		TotalPowerW: gridPower,
+		Direction:   growattGridDirection(gridPower),
+		FrequencyHz: extractFlP(data, "fGrid"),
+	}
+
+	rt.Load = &models.LoadData{
+		TotalPowerW: extractFl(data, "outPutPower"),
+	}
+
+	return rt
+}
+
+// normalizeGrowattMixRealtime maps /v1/device/mix/mix_last_data, served for
+// MIX and SPH hybrid inverters.
+func normalizeGrowattMixRealtime(data map[string]interface{}, deviceID string, loc *time.Location) models.NormalizedRealtime {
+	rt := newGrowattRealtime(data, deviceID, loc)
+
+	// Growatt MIX/SPH keys:
+	// "ppv1", "ppv2", "vpv1", "ipv1".. (per MPPT), "epv1Today", "epv2Today"
+	// "soc", "pcharge1", "pdischarge1" (W), "vbat" (V)
+	// "pactogrid", "pactouser" (W), "pLocalLoad" (W)
+	// "echarge1Today", "edischarge1Today", "elocalLoadToday",
+	// "etoGridToday", "etoUserToday" (kWh)
+	// "fac", "vac1".."vac3", "temp1" (°C)
+	pvStrings := growattPVStrings(data)
+	var pvPower float64
+	for _, s := range pvStrings {
+		if s.PowerW != nil {
+			pvPower += *s.PowerW
+		}
+	}
+	var pvToday *float64
+	if e1, e2 := extractFlP(data, "epv1Today"), extractFlP(data, "epv2Today"); e1 != nil || e2 != nil {
+		sum := deref(e1) + deref(e2)
+		pvToday = &sum
+	}
+	rt.PV = &models.PVData{
+		TotalPowerW:    pvPower,
+		TodayEnergyKWh: pvToday,
+		TotalEnergyKWh: extractFlP(data, "epvTotal"),
+		Strings:        pvStrings,
+	}
+
+	batPower := extractFl(data, "pcharge1") - extractFl(data, "pdischarge1")
+	rt.Battery = &models.BatteryData{
+		SOCPercent:        extractFlP(data, "soc"),
+		PowerW:            batPower,
+		Direction:         growattBatteryDirection(batPower),
+		VoltageDC:         extractFlP(data, "vbat"),
+		TodayChargeKWh:    extractFlP(data, "echarge1Today"),
+		TodayDischargeKWh: extractFlP(data, "edischarge1Today"),
+		TotalChargeKWh:    extractFlP(data, "echarge1Total"),
+		TotalDischargeKWh: extractFlP(data, "edischarge1Total"),
+	}
+
+	gridPower := extractFl(data, "pactouser") - extractFl(data, "pactogrid")
+	freq := extractFlP(data, "fac")
+	var phases []models.PhaseData
+	for i, ph := range []string{"A", "B", "C"} {
+		if v := extractFlP(data, fmt.Sprintf("vac%d", i+1)); v != nil {
+			phases = append(phases, models.PhaseData{Phase: ph, VoltageV: v, FrequencyHz: freq})
+		}
+	}
+	rt.Grid = &models.GridData{
+		TotalPowerW:    gridPower,
+		Direction:      growattGridDirection(gridPower),
+		FrequencyHz:    freq,
+		TodayImportKWh: extractFlP(data, "etoUserToday"),
+		TodayExportKWh: extractFlP(data, "etoGridToday"),
+		TotalImportKWh: extractFlP(data, "etoUserTotal"),
+		TotalExportKWh: extractFlP(data, "etoGridTotal"),
+		Phases:         phases,
+	}
+
+	rt.Load = &models.LoadData{
+		TotalPowerW:    extractFl(data, "pLocalLoad"),
+		TodayEnergyKWh: extractFlP(data, "elocalLoadToday"),
+		TotalEnergyKWh: extractFlP(data, "elocalLoadTotal"),
+	}
+
+	if temp := extractFlP(data, "temp1"); temp != nil {
+		rt.Environment = &models.EnvironmentData{InverterTemperatureC: temp}
+	}
+
+	return rt
+}
+
+func normalizeGrowattEnergy(data map[string]interface{}, plantID string, period models.Period) models.NormalizedEnergy {
+	energy := models.NormalizedEnergy{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Period:    period,
+		Timestamp: time.Now().UTC(),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	// /v1/plant/data keys:
+	// "current_power" (W), "today_energy", "monthly_energy", "yearly_energy",
+	// "total_energy" (kWh), "carbon_offset" (kg), "last_update_time"
+	switch period {
+	case models.PeriodDay:
+		energy.PVGenerationKWh = extractFlP(data, "today_energy")
+	case models.PeriodMonth:
+		energy.PVGenerationKWh = extractFlP(data, "monthly_energy")
+	case models.PeriodYear:
+		energy.PVGenerationKWh = extractFlP(data, "yearly_energy")
+	case models.PeriodTotal:
+		energy.PVGenerationKWh = extractFlP(data, "total_energy")
+		energy.CO2SavedKg = extractFlP(data, "carbon_offset")
+	}
+
+	energy.CurrentPowerW = extractFlP(data, "current_power")
+
+	return energy
+}
+
+func normalizeGrowattAlarm(raw growattAlarm, deviceSN, plantID string, kind *growattDeviceKind, loc *time.Location) models.NormalizedAlarm {
+	code := raw.AlarmCode.String()
+	ts := time.Now().UTC()
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", raw.StartTime, loc); err == nil {
+		ts = t.UTC()
+	}
+
+	alarm := models.NormalizedAlarm{
+		ID:                 fmt.Sprintf("%s_alarm_%s_%s_%d", providerName, deviceSN, code, ts.Unix()),
+		Provider:           providerName,
+		DeviceID:           fmt.Sprintf("%s_%s", providerName, deviceSN),
+		Code:               code,
+		Name:               raw.AlarmMessage,
+		Severity:           models.AlarmSeverityUnknown, // the OpenAPI reports no level
+		Status:             growattAlarmStatus(raw.Status),
+		DeviceSerialNumber: deviceSN,
+		DeviceType:         kind.deviceType,
+		StartTime:          ts,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: deviceSN,
+			ProviderPlantID:  plantID,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+	if plantID != "" {
+		alarm.PlantID = fmt.Sprintf("%s_%s", providerName, plantID)
+	}
+
+	if raw.EndTime != "" {
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", raw.EndTime, loc); err == nil {
+			t = t.UTC()
+			alarm.EndTime = &t
+		}
+	}
+
+	return alarm
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Mapping helpers
+// ══════════════════════════════════════════════════════════════════
+
+// growattDeviceKind describes where the OpenAPI serves a device type's data.
+type growattDeviceKind struct {
+	name         string
+	deviceType   models.DeviceType
+	snParam      string
+	realtimePath string // empty: no real-time data
+	alarmPath    string // empty: no alarms
+}
+
+var (
+	kindInverter = &growattDeviceKind{
+		name:         "inverter",
+		deviceType:   models.DeviceTypeStringInverter,
+		snParam:      "device_sn",
+		realtimePath: "/v1/device/inverter/last_new_data",
+		alarmPath:    "/v1/device/inverter/alarm_data",
+	}
+	kindStorage = &growattDeviceKind{
+		name:         "storage",
+		deviceType:   models.DeviceTypeHybridInverter,
+		snParam:      "storage_sn",
+		realtimePath: "/v1/device/storage/storage_last_data",
+		alarmPath:    "/v1/device/storage/alarm_data",
+	}
+	kindMix = &growattDeviceKind{
+		name:         "mix",
+		deviceType:   models.DeviceTypeHybridInverter,
+		snParam:      "mix_sn",
+		realtimePath: "/v1/device/mix/mix_last_data",
+		alarmPath:    "/v1/device/mix/alarm_data",
+	}
+	kindOther = &growattDeviceKind{name: "other", deviceType: models.DeviceTypeUnknown}
+)
+
+// growattKind maps the /v1/device/list type: 1=inverter, 2=storage,
+// 3=other, 4=MAX, 5=MIX/SPH, 6=SPA, 7=MIN, 8=PCS, 9=HPS, 10=PBD.
+func growattKind(t int) *growattDeviceKind {
+	switch t {
+	case 1:
+		return kindInverter
+	case 2:
+		return kindStorage
+	case 5:
+		return kindMix
+	case 4:
+		return &growattDeviceKind{name: "max", deviceType: models.DeviceTypeStringInverter}
+	case 6:
+		return &growattDeviceKind{name: "spa", deviceType: models.DeviceTypeHybridInverter}
+	case 7:
+		return &growattDeviceKind{name: "min", deviceType: models.DeviceTypeStringInverter}
+	default:
+		return kindOther
+	}
+}
+
+func growattDeviceStatus(s int) models.DeviceStatus {
+	switch s {
+	case 0:
+		return models.DeviceStatusStandby
+	case 1:
+		return models.DeviceStatusNormal
+	case 2, 3:
+		return models.DeviceStatusFault
+	default:
+		return models.DeviceStatusUnknown
+	}
+}
+
+// growattRunStatus maps the real-time "status": 0=waiting, 1=normal,
+// 2 and 3=fault, 5 and 6=battery online (hybrid), 8=upgrading.
+func growattRunStatus(s int) (models.DeviceStatus, models.OperatingMode) {
+	switch s {
+	case 0:
+		return models.DeviceStatusStandby, models.OperatingModeWaiting
+	case 1, 5, 6:
+		return models.DeviceStatusNormal, models.OperatingModeGridConnected
+	case 2, 3:
+		return models.DeviceStatusFault, models.OperatingModeFault
+	case 8:
+		return models.DeviceStatusUpgrade, models.OperatingModeUpgrading
+	default:
+		return models.DeviceStatusUnknown, models.OperatingModeUnknown
+	}
+}
+
+func growattAlarmStatus(status int) models.AlarmStatus {
+	switch status {
+	case 1:
+		return models.AlarmStatusActive
+	case 0:
+		return models.AlarmStatusResolved
+	default:
+		return models.AlarmStatusUnknown
+	}
+}
+
+func growattPVStrings(data map[string]interface{}) []models.PVString {
+	var pvStrings []models.PVString
+	for i := 1; i <= 8; i++ {
+		v := extractFlP(data, fmt.Sprintf("vpv%d", i))
+		c := extractFlP(data, fmt.Sprintf("ipv%d", i))
+		pw := extractFlP(data, fmt.Sprintf("ppv%d", i))
+		if v == nil && c == nil && pw == nil {
+			continue
+		}
+		if pw == nil && v != nil && c != nil {
+			p := *v * *c
+			pw = &p
+		}
+		pvStrings = append(pvStrings, models.PVString{ID: i, VoltageV: v, CurrentA: c, PowerW: pw})
+	}
+	return pvStrings
+}
+
+// growattPhases reads the R/S/T phase values as A/B/C.
+func growattPhases(data map[string]interface{}, freq *float64) []models.PhaseData {
+	var phases []models.PhaseData
+	for _, ph := range []struct{ suffix, phase string }{{"r", "A"}, {"s", "B"}, {"t", "C"}} {
+		voltage := extractFlP(data, "vac"+ph.suffix)
+		current := extractFlP(data, "iac"+ph.suffix)
+		if (voltage == nil || *voltage == 0) && (current == nil || *current == 0) {
+			continue
+		}
+		phases = append(phases, models.PhaseData{
+			Phase: ph.phase, VoltageV: voltage, CurrentA: current,
+			PowerW: extractFlP(data, "pac"+ph.suffix), FrequencyHz: freq,
+		})
+	}
+	return phases
+}
+
+func growattGridDirection(power float64) models.GridDirection {
+	if power > 0 {
+		return models.GridDirectionImporting
+	} else if power < 0 {
+		return models.GridDirectionExporting
+	}
+	return models.GridDirectionIdle
+}
+
+func growattBatteryDirection(power float64) models.EnergyDirection {
+	if power > 0 {
+		return models.DirectionCharging
+	} else if power < 0 {
+		return models.DirectionDischarging
+	}
+	return models.DirectionIdle
+}
+
+// growattRetryClass treats the access-frequency error as throttling.
+func growattRetryClass(status int, body []byte) provider.RetryClass {
+	var resp growattBaseResponse
+	if json.Unmarshal(body, &resp) == nil && resp.ErrorCode == 10012 {
+		return provider.RetryThrottled
+	}
+	return provider.NoRetry
+}
+
+// growattError classifies an OpenAPI error_code into the provider error taxonomy.
+func growattError(op string, resp growattBaseResponse) error {
+	var kind error
+	switch {
+	case resp.ErrorCode == 10011:
+		// token invalid or no access to the resource
+		kind = provider.ErrAuth
+	case resp.ErrorCode == 10012:
+		// access frequency exceeded
+		kind = provider.ErrRateLimited
+	case strings.Contains(resp.ErrorMsg, "not_found") || strings.Contains(resp.ErrorMsg, "not_exist"):
+		kind = provider.ErrNotFound
+	case strings.Contains(resp.ErrorMsg, "param"):
+		kind = provider.ErrInvalidRequest
+	default:
+		// an answer, so the API is up
+		kind = provider.ErrVendor
+	}
+	return provider.VendorError(kind, providerName, op, strconv.Itoa(resp.ErrorCode), resp.ErrorMsg)
+}
+
+// ── Extraction helpers ──
+
+func extractStr(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	v, ok := m[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func extractFl(m map[string]interface{}, key string) float64 {
+	if f := extractFlP(m, key); f != nil {
+		return *f
+	}
+	return 0
+}
+
+func extractFlP(m map[string]interface{}, key string) *float64 {
+	if m == nil {
+		return nil
+	}
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	var f float64
+	switch val := v.(type) {
+	case float64:
+		f = val
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return nil
+		}
+		f = parsed
+	default:
+		return nil
+	}
+	return &f
+}
+
+// firstFlP returns the first of keys present; Growatt spells some keys
+// differently across firmware versions.
+func firstFlP(m map[string]interface{}, keys ...string) *float64 {
+	for _, key := range keys {
+		if f := extractFlP(m, key); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+func deref(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,14 +19,30 @@ import (
 // HTTPClient wraps http.Client with rate limiting, retries, and logging
 // that all provider adapters can share.
 type HTTPClient struct {
-	client      *http.Client
-	baseURL     string
-	rateLimiter *RateLimiter
-	headers     map[string]string
-	mu          sync.RWMutex
+	client         *http.Client
+	attemptTimeout time.Duration // bound on a single attempt
+	requestTimeout time.Duration // bound on a call including retries and backoff
+	baseURL        string
+	rateLimiter    *RateLimiter
+	headers        map[string]string
+	bodyFields     map[string]json.RawMessage
+	mu             sync.RWMutex
+
+	retryClassifier RetryClassifier // see retry.go
+	quota           *Quota          // see quota.go
+	signer          RequestSigner   // see signing.go
+
+	// session state, see session.go
+	session        *Session
+	sessionGen     uint64
+	sessionValid   bool
+	sessionExpires time.Time
+	authMu         sync.Mutex // serializes logins
 }
 
-// NewHTTPClient creates an HTTP client for API calls.
+// NewHTTPClient creates an HTTP client for API calls. timeoutSec bounds each
+// attempt; a call including its retries and backoff is bounded by
+// maxAttempts times that plus the backoff between attempts.
 func NewHTTPClient(baseURL string, timeoutSec int, rateRPS int) *HTTPClient {
 	if timeoutSec <= 0 {
 		timeoutSec = 30
@@ -33,13 +51,15 @@ func NewHTTPClient(baseURL string, timeoutSec int, rateRPS int) *HTTPClient {
 		rateRPS = 5
 	}
 
+	attemptTimeout := time.Duration(timeoutSec) * time.Second
 	return &HTTPClient{
-		client: &http.Client{
-			Timeout: time.Duration(timeoutSec) * time.Second,
-		},
-		baseURL:     baseURL,
-		rateLimiter: NewRateLimiter(rateRPS),
-		headers:     make(map[string]string),
+		client:         &http.Client{},
+		attemptTimeout: attemptTimeout,
+		requestTimeout: attemptTimeout*maxAttempts + backoffBudget(),
+		baseURL:        baseURL,
+		rateLimiter:    NewRateLimiter(rateRPS),
+		headers:        make(map[string]string),
+		bodyFields:     make(map[string]json.RawMessage),
 	}
 }
 
@@ -50,26 +70,121 @@ func (c *HTTPClient) SetHeader(key, value string) {
 	c.headers[key] = value
 }
 
+// SetBaseURL changes the URL requests are sent to, for vendors that assign
+// each account a regional server at login.
+func (c *HTTPClient) SetBaseURL(baseURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.baseURL = baseURL
+}
+
 // Get performs a GET request and decodes the JSON response.
 func (c *HTTPClient) Get(ctx context.Context, path string, params url.Values, result interface{}) error {
-	return c.do(ctx, http.MethodGet, path, params, nil, result)
+	_, err := c.do(ctx, http.MethodGet, path, params, nil, result)
+	return err
 }
 
-// Post performs a POST request with a JSON body and decodes the response.
+// Post performs a POST request with a JSON body, or a form body if body is
+// url.Values, and decodes the response.
 func (c *HTTPClient) Post(ctx context.Context, path string, body interface{}, result interface{}) error {
+	_, err := c.do(ctx, http.MethodPost, path, nil, body, result)
+	return err
+}
+
+// PostWithHeaders is Post that also returns the response headers, e.g. to
+// capture a session cookie set by a login endpoint.
+func (c *HTTPClient) PostWithHeaders(ctx context.Context, path string, body interface{}, result interface{}) (http.Header, error) {
 	return c.do(ctx, http.MethodPost, path, nil, body, result)
 }
 
-func (c *HTTPClient) do(ctx context.Context, method, path string, params url.Values, body interface{}, result interface{}) error {
-	// Rate limit
-	if err := c.rateLimiter.Wait(ctx); err != nil {
-		return fmt.Errorf("rate limiter: %w", err)
+func (c *HTTPClient) do(ctx context.Context, method, path string, params url.Values, body interface{}, result interface{}) (http.Header, error) {
+	op := method + " " + path
+
+	session := c.activeSession(ctx)
+	if session != nil {
+		if err := c.ensureSession(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.send(ctx, method, path, params, body, session != nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if session != nil && session.expired(resp.status, resp.body) {
+		log.Info().Str("request", op).Msg("Session expired, re-authenticating")
+		if err := c.reauthenticate(ctx, resp.sessionGen); err != nil {
+			return nil, err
+		}
+		if resp, err = c.send(ctx, method, path, params, body, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.status >= 400 {
+		return resp.header, &Error{
+			Kind:       KindForStatus(resp.status),
+			Op:         op,
+			VendorCode: strconv.Itoa(resp.status),
+			Message:    fmt.Sprintf("HTTP %d: %s", resp.status, string(resp.body[:min(len(resp.body), 200)])),
+		}
+	}
+
+	// Decode
+	if result != nil {
+		if err := json.Unmarshal(resp.body, result); err != nil {
+			return resp.header, &Error{
+				Kind:    ErrUpstreamUnavailable,
+				Op:      op,
+				Message: fmt.Sprintf("decode response: %v (body: %s)", err, string(resp.body[:min(len(resp.body), 200)])),
+				Err:     err,
+			}
+		}
+	}
+
+	return resp.header, nil
+}
+
+// response is a fully read HTTP response.
+type response struct {
+	status     int
+	header     http.Header
+	body       []byte
+	sessionGen uint64 // session generation the request was sent with
+}
+
+// send builds and executes a single request, retrying transient failures.
+// withSession merges the session body fields into the request body.
+func (c *HTTPClient) send(ctx context.Context, method, path string, params url.Values, body interface{}, withSession bool) (*response, error) {
+	// Snapshot headers and session state together so an expiry can be
+	// attributed to the session generation that was actually sent.
+	c.mu.RLock()
+	baseURL := c.baseURL
+	headers := make(map[string]string, len(c.headers))
+	for k, v := range c.headers {
+		headers[k] = v
+	}
+	var fields map[string]json.RawMessage
+	if withSession && len(c.bodyFields) > 0 {
+		fields = make(map[string]json.RawMessage, len(c.bodyFields))
+		for k, v := range c.bodyFields {
+			fields[k] = v
+		}
 	}
+	gen := c.sessionGen
+	quota := c.quota
+	signer := c.signer
+	c.mu.RUnlock()
 
 	// Build URL
-	u, err := url.Parse(c.baseURL + path)
+	u, err := url.Parse(baseURL + path)
 	if err != nil {
-		return fmt.Errorf("parse URL: %w", err)
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("parse URL: %w", err)
 	}
 	if params != nil {
 		u.RawQuery = params.Encode()
@@ -77,93 +192,217 @@ func (c *HTTPClient) do(ctx context.Context, method, path string, params url.Val
 
 	// Build body
 	var bodyReader io.Reader
+	var data []byte
 	if body != nil {
-		data, err := json.Marshal(body)
+		data, err = encodeBody(body, fields)
 		if err != nil {
-			return fmt.Errorf("marshal request body: %w", err)
+			return nil, fmt.Errorf("marshal request body: %w", err)
 		}
 		bodyReader = bytes.NewReader(data)
 	}
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), bodyReader)
+	// Create the request template. Each attempt clones it and takes a fresh
+	// body from GetBody, so retried POSTs resend their payload.
+	proto, err := http.NewRequest(method, u.String(), bodyReader)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
 
 	// Set headers
-	c.mu.RLock()
-	for k, v := range c.headers {
-		req.Header.Set(k, v)
+	for k, v := range headers {
+		proto.Header.Set(k, v)
 	}
-	c.mu.RUnlock()
 
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
-	}
-
-	// Execute with retry
-	var resp *http.Response
-	maxRetries := 3
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		resp, err = c.client.Do(req)
-		if err == nil && resp.StatusCode < 500 {
-			break
-		}
-		if resp != nil {
-			resp.Body.Close()
-		}
-		if attempt < maxRetries-1 {
-			backoff := time.Duration(1<<uint(attempt)) * time.Second
-			log.Warn().
-				Str("method", method).
-				Str("url", u.String()).
-				Int("attempt", attempt+1).
-				Dur("backoff", backoff).
-				Msg("Retrying request")
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(backoff):
+	if _, form := body.(url.Values); form {
+		proto.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else if body != nil {
+		proto.Header.Set("Content-Type", "application/json")
+	}
+
+	// Execute with retry, bounded overall by requestTimeout and per attempt
+	// by attemptTimeout.
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	op := method + " " + path
+	instance, obs := InstanceFromContext(ctx), observer()
+	for attempt := 0; ; attempt++ {
+		waitStart := time.Now()
+		err := c.rateLimiter.Wait(ctx)
+		if obs != nil {
+			obs.RateLimitWait(instance, time.Since(waitStart))
+		}
+		if err != nil {
+			if parent.Err() == nil && ctx.Err() != nil {
+				return nil, &Error{Kind: ErrUpstreamUnavailable, Op: op, Message: "request timed out waiting for rate limiter", Err: err}
+			}
+			return nil, fmt.Errorf("rate limiter: %w", err)
+		}
+		if quota != nil {
+			if err := quota.take(quotaKeyFromContext(ctx), op); err != nil {
+				return nil, err
+			}
+		}
+
+		if signer != nil {
+			if err := signer(proto, data); err != nil {
+				return nil, &Error{Kind: ErrAuth, Op: op, Message: "sign request", Err: err}
+			}
+		}
+
+		sent := time.Now()
+		resp, err := c.roundTrip(ctx, proto, op)
+		if obs != nil {
+			status := 0
+			if resp != nil {
+				status = resp.status
 			}
+			obs.UpstreamRequest(instance, status, err, time.Since(sent))
+		}
+		class := RetryTransient
+		if err == nil {
+			class = c.classify(resp.status, resp.body)
+		} else if ctx.Err() != nil {
+			if parent.Err() != nil {
+				return nil, parent.Err()
+			}
+			// Overall budget exhausted; err already says what timed out.
+			return nil, err
+		}
+		if class == NoRetry {
+			c.rateLimiter.Recover()
+			resp.sessionGen = gen
+			return resp, nil
+		}
+
+		wait := backoff(attempt)
+		if class == RetryThrottled {
+			if ra := retryAfter(resp.header, time.Now()); ra > 0 {
+				wait = ra
+			}
+			c.rateLimiter.Throttle(wait)
+		}
+		deadline, _ := ctx.Deadline()
+		if attempt == maxAttempts-1 || wait > maxRetryAfter || time.Now().Add(wait).After(deadline) {
+			// Out of retries: let the caller classify the last response.
+			if err != nil {
+				return nil, err
+			}
+			resp.sessionGen = gen
+			return resp, nil
+		}
+
+		if obs != nil {
+			obs.UpstreamRetry(instance, class == RetryThrottled)
+		}
+		log.Warn().
+			Str("method", method).
+			Str("path", u.Path).
+			Int("attempt", attempt+1).
+			Bool("throttled", class == RetryThrottled).
+			Dur("backoff", wait).
+			Msg("Retrying request")
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
 		}
 	}
+}
+
+// roundTrip sends one attempt of proto, bounded by the per-attempt timeout,
+// and reads the whole response.
+func (c *HTTPClient) roundTrip(ctx context.Context, proto *http.Request, op string) (*response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.attemptTimeout)
+	defer cancel()
+
+	req := proto.Clone(ctx)
+	if proto.GetBody != nil {
+		body, err := proto.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("rewind request body: %w", err)
+		}
+		req.Body = body
+	}
+
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("HTTP %s %s: %w", method, path, err)
+		return nil, &Error{Kind: ErrUpstreamUnavailable, Op: op, Err: redactURLError(err, req.URL)}
 	}
 	defer resp.Body.Close()
 
-	// Read body
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("read response: %w", err)
+		return nil, &Error{Kind: ErrUpstreamUnavailable, Op: op, Message: "read response", Err: err}
 	}
+	return &response{status: resp.StatusCode, header: resp.Header, body: respBody}, nil
+}
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d from %s %s: %s", resp.StatusCode, method, path, string(respBody))
+// redactURLError drops the query from the URL a transport error reports, as
+// some vendors take credentials as query parameters (e.g. SolarEdge's
+// api_key).
+func redactURLError(err error, u *url.URL) error {
+	var uerr *url.Error
+	if !errors.As(err, &uerr) {
+		return err
 	}
+	return &url.Error{Op: uerr.Op, URL: redactURL(u), Err: uerr.Err}
+}
 
-	// Decode
-	if result != nil {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return fmt.Errorf("decode response from %s %s: %w (body: %s)", method, path, err, string(respBody[:min(len(respBody), 200)]))
-		}
-	}
+// redactURL returns u as scheme, host and path only.
+func redactURL(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
 
-	return nil
+// encodeBody marshals body to JSON and, if it is a JSON object, merges in the
+// given session fields.
+func encodeBody(body interface{}, fields map[string]json.RawMessage) ([]byte, error) {
+	// url.Values is sent as a form, e.g. to OAuth2 token endpoints
+	if form, ok := body.(url.Values); ok {
+		return []byte(form.Encode()), nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil || len(fields) == 0 {
+		return data, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return data, nil
+	}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return json.Marshal(obj)
 }
 
 // ── Rate Limiter ──
 
+// maxSlowdown bounds how far throttling can stretch the refill interval.
+const maxSlowdown = 16
+
+// RateLimiter is a token bucket refilled at a steady rate. When a vendor
+// throttles us it pauses and halves its refill rate, then speeds back up
+// towards the configured rate as calls succeed.
 type RateLimiter struct {
 	ticker *time.Ticker
 	tokens chan struct{}
+
+	mu          sync.Mutex
+	base        time.Duration // configured refill interval
+	interval    time.Duration // current refill interval
+	pausedUntil time.Time
 }
 
 func NewRateLimiter(rps int) *RateLimiter {
+	interval := time.Second / time.Duration(rps)
 	rl := &RateLimiter{
-		ticker: time.NewTicker(time.Second / time.Duration(rps)),
-		tokens: make(chan struct{}, rps),
+		ticker:   time.NewTicker(interval),
+		tokens:   make(chan struct{}, rps),
+		base:     interval,
+		interval: interval,
 	}
 	// Fill initial tokens
 	for i := 0; i < rps; i++ {
@@ -181,7 +420,27 @@ func NewRateLimiter(rps int) *RateLimiter {
 	return rl
 }
 
+// Wait blocks until a request may be sent. While the limiter is paused after
+// throttling it fails fast with ErrRateLimited if the pause is long or ctx
+// would expire first.
 func (rl *RateLimiter) Wait(ctx context.Context) error {
+	rl.mu.Lock()
+	until := rl.pausedUntil
+	rl.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		if deadline, ok := ctx.Deadline(); d > maxRetryAfter || ok && deadline.Before(until) {
+			return &Error{Kind: ErrRateLimited, Message: fmt.Sprintf("throttled by vendor for another %s", d.Round(time.Second))}
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
 	select {
 	case <-rl.tokens:
 		return nil
@@ -190,6 +449,44 @@ func (rl *RateLimiter) Wait(ctx context.Context) error {
 	}
 }
 
+// Throttle pauses the limiter for d, drops any saved-up burst and halves the
+// refill rate.
+func (rl *RateLimiter) Throttle(d time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(rl.pausedUntil) {
+		rl.pausedUntil = until
+	}
+	if rl.interval < rl.base*maxSlowdown {
+		rl.interval *= 2
+		rl.ticker.Reset(rl.interval)
+	}
+	for {
+		select {
+		case <-rl.tokens:
+		default:
+			return
+		}
+	}
+}
+
+// Recover moves the refill rate a quarter of the way back towards the
+// configured rate after a successful call.
+func (rl *RateLimiter) Recover() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.interval <= rl.base {
+		return
+	}
+	rl.interval -= (rl.interval - rl.base + 3) / 4
+	if rl.interval < rl.base {
+		rl.interval = rl.base
+	}
+	rl.ticker.Reset(rl.interval)
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestPostSendsURLValuesAsForm(t *testing.T) {
+	var contentType, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL, 5, 100)
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"a b&c"}}
+	var resp struct {
+		OK bool `json:"ok"`
+	}
+	if err := c.Post(context.Background(), "/oauth/token", form, &resp); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if body != "grant_type=refresh_token&refresh_token=a+b%26c" {
+		t.Errorf("body = %q", body)
+	}
+	if !resp.OK {
+		t.Error("response not decoded")
+	}
+
+	// Other bodies are still JSON
+	if err := c.Post(context.Background(), "/data", map[string]string{"a": "b"}, nil); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if contentType != "application/json" || body != `{"a":"b"}` {
+		t.Errorf("JSON body sent as %q: %q", contentType, body)
+	}
+}
+
+// captureLog sends the global logger's output to a buffer for the rest of
+// the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = prev })
+	return &buf
+}
+
+func TestTransportErrorsHideQuery(t *testing.T) {
+	// A server that is gone: the dial fails
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+
+	// A server that does not answer in time
+	hang := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer slow.Close()
+	defer close(hang)
+
+	for name, baseURL := range map[string]string{"refused": gone.URL, "timeout": slow.URL} {
+		t.Run(name, func(t *testing.T) {
+			logs := captureLog(t)
+			c := NewHTTPClient(baseURL, 1, 100)
+			c.attemptTimeout = 50 * time.Millisecond
+			// No time for a retry: the first error is returned
+			c.requestTimeout = 200 * time.Millisecond
+
+			err := c.Get(context.Background(), "/site/1/overview", url.Values{"api_key": {"SECRET"}}, nil)
+			if err == nil {
+				t.Fatal("request to an unreachable server succeeded")
+			}
+			if strings.Contains(err.Error(), "api_key") || strings.Contains(err.Error(), "SECRET") {
+				t.Errorf("error carries the query: %v", err)
+			}
+			if !strings.Contains(err.Error(), "/site/1/overview") {
+				t.Errorf("error lost the path: %v", err)
+			}
+			if !errors.Is(err, ErrUpstreamUnavailable) {
+				t.Errorf("error kind of %v, want upstream_unavailable", err)
+			}
+			if strings.Contains(logs.String(), "SECRET") {
+				t.Errorf("log carries the query: %s", logs)
+			}
+		})
+	}
+}
+
+func TestRetryLogHidesQuery(t *testing.T) {
+	logs := captureLog(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := NewHTTPClient(srv.URL, 5, 100)
+	if err := c.Get(context.Background(), "/site/1/overview", url.Values{"api_key": {"SECRET"}}, nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("%d attempts, want 2", calls.Load())
+	}
+	if !strings.Contains(logs.String(), "Retrying request") || !strings.Contains(logs.String(), "/site/1/overview") {
+		t.Errorf("retry not logged with its path: %s", logs)
+	}
+	if strings.Contains(logs.String(), "SECRET") {
+		t.Errorf("log carries the query: %s", logs)
+	}
+}
+
+// replayServer answers the data calls with 503, then 401 (an expired
+// session), then 200, and records every body it was sent.
+type replayServer struct {
+	mu     sync.Mutex
+	logins int
+	bodies []string
+	types  []string
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.ContentLength != int64(len(data)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.bodies = append(s.bodies, string(data))
+	s.types = append(s.types, r.Header.Get("Content-Type"))
+	switch len(s.bodies) {
+	case 1:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case 2:
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
+
+func (s *replayServer) login(c *HTTPClient) func(ctx context.Context) (time.Time, error) {
+	return func(ctx context.Context) (time.Time, error) {
+		s.mu.Lock()
+		s.logins++
+		session := fmt.Sprintf("s%d", s.logins)
+		s.mu.Unlock()
+		return time.Time{}, c.SetBodyField("session", session)
+	}
+}
+
+func TestPostBodyReplayedOnRetryAndReauth(t *testing.T) {
+	fastBackoff(t)
+	tests := []struct {
+		name  string
+		body  interface{}
+		want  []string // bodies of the three attempts
+		ctype string
+	}{
+		{
+			name: "JSON",
+			body: map[string]interface{}{"plant": "NE=1", "ids": []int{1, 2}},
+			want: []string{
+				`{"ids":[1,2],"plant":"NE=1","session":"s1"}`,
+				`{"ids":[1,2],"plant":"NE=1","session":"s1"}`,
+				// The session field changes with the login, the rest stays
+				`{"ids":[1,2],"plant":"NE=1","session":"s2"}`,
+			},
+			ctype: "application/json",
+		},
+		{
+			name:  "form",
+			body:  url.Values{"plant": {"NE=1"}, "ids": {"1", "2"}},
+			want:  []string{"ids=1&ids=2&plant=NE%3D1", "ids=1&ids=2&plant=NE%3D1", "ids=1&ids=2&plant=NE%3D1"},
+			ctype: "application/x-www-form-urlencoded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &replayServer{}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+			c := NewHTTPClient(srv.URL, 5, 100)
+			c.SetSession(Session{Login: s.login(c)})
+
+			if err := c.Post(context.Background(), "/data", tt.body, nil); err != nil {
+				t.Fatalf("Post: %v", err)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.logins != 2 {
+				t.Errorf("%d logins, want 2", s.logins)
+			}
+			if fmt.Sprint(s.bodies) != fmt.Sprint(tt.want) {
+				t.Errorf("bodies:\n%q\nwant:\n%q", s.bodies, tt.want)
+			}
+			for i, ct := range s.types {
+				if ct != tt.ctype {
+					t.Errorf("attempt %d sent as %q, want %q", i+1, ct, tt.ctype)
+				}
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package huawei
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -16,6 +18,8 @@ import (
 const (
 	defaultBaseURL = "https://eu5.fusionsolar.huawei.com/thirdData"
 	providerName   = "huawei"
+
+	huaweiXSRFHeader = "XSRF-TOKEN"
 )
 
 func init() {
@@ -31,16 +35,40 @@ func init() {
 //   - POST /getStationRealKpi — plant real-time KPIs
 //   - POST /getDevList — device list
 //   - POST /getDevRealKpi — device real-time KPIs
-//   - POST /getKpiStationHour/Day/Month/Year — historical data
+//   - POST /getDevFiveMinutes, /getDevKpiDay/Month/Year — device history
 //   - POST /getAlarmList — alarms
 type HuaweiProvider struct {
-	client    *provider.HTTPClient
-	config    provider.ProviderConfig
-	xsrfToken string
+	client *provider.HTTPClient
+	config provider.ProviderConfig
 }
 
 func (p *HuaweiProvider) Name() string { return providerName }
 
+func (p *HuaweiProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails),
+		// The northbound API has no hourly device KPIs
+		Granularities: []models.Granularity{
+			models.GranularityMinute, models.GranularityDay, models.GranularityMonth, models.GranularityYear,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricGrid, provider.MetricGridPhases,
+			provider.MetricEnvironment,
+		},
+		// getDevFiveMinutes and getDevKpi* return the period containing
+		// collectTime: the 5-minute points of a day, the days of a month,
+		// the months of a year
+		HistoryWindows: map[models.Granularity]provider.Window{
+			models.GranularityMinute: {Days: 1},
+			models.GranularityDay:    {Months: 1},
+			models.GranularityMonth:  {Years: 1},
+		},
+	}
+}
+
 func (p *HuaweiProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
 	p.config = cfg
 
@@ -56,11 +84,16 @@ func (p *HuaweiProvider) Initialize(ctx context.Context, cfg provider.ProviderCo
 
 	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
 	p.client.SetHeader("Content-Type", "application/json")
+	p.client.SetSession(provider.Session{
+		Login:   p.authenticate,
+		Expired: huaweiSessionExpired,
+	})
+	p.client.SetRetryClassifier(huaweiRetryClass)
 
-	return p.authenticate(ctx)
+	return p.client.Authenticate(ctx)
 }
 
-func (p *HuaweiProvider) authenticate(ctx context.Context) error {
+func (p *HuaweiProvider) authenticate(ctx context.Context) (time.Time, error) {
 	username := p.config.GetCredential("username")
 	password := p.config.GetCredential("systemCode")
 
@@ -70,19 +103,26 @@ func (p *HuaweiProvider) authenticate(ctx context.Context) error {
 	}
 
 	var resp huaweiLoginResponse
-	if err := p.client.Post(ctx, "/login", body, &resp); err != nil {
-		return fmt.Errorf("Huawei auth: %w", err)
+	header, err := p.client.PostWithHeaders(ctx, "/login", body, &resp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Huawei auth: %w", err)
 	}
 
 	if !resp.Success {
-		return fmt.Errorf("Huawei auth failed: failCode=%d message=%s", resp.FailCode, resp.Message)
+		return time.Time{}, huaweiError("auth", resp.huaweiBaseResponse)
+	}
+
+	// The session is carried by the XSRF-TOKEN cookie set on login, which
+	// every northbound call must echo back as the XSRF-TOKEN header.
+	token := huaweiXSRFToken(header)
+	if token == "" {
+		return time.Time{}, provider.NewError(provider.ErrAuth, providerName, "auth", "login response carried no XSRF-TOKEN cookie")
 	}
+	p.client.SetHeader(huaweiXSRFHeader, token)
 
-	// The XSRF token would come from the Set-Cookie header in a real implementation.
-	// For the normalized client, we store it for subsequent requests.
-	p.xsrfToken = "authenticated"
 	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
-	return nil
+	// FusionSolar does not report a lifetime; expiry is detected from failCode 305.
+	return time.Time{}, nil
 }
 
 // ── Plants ──
@@ -100,7 +140,7 @@ func (p *HuaweiProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlan
 			return nil, fmt.Errorf("Huawei GetPlants: %w", err)
 		}
 		if !resp.Success {
-			return nil, fmt.Errorf("Huawei GetPlants failed: %d %s", resp.FailCode, resp.Message)
+			return nil, huaweiError("GetPlants", resp.huaweiBaseResponse)
 		}
 
 		for _, raw := range resp.Data.List {
@@ -122,11 +162,13 @@ func (p *HuaweiProvider) GetPlantDetails(ctx context.Context, plantID string) (*
 	}
 	var resp huaweiStationRealKpiResponse
 	if err := p.client.Post(ctx, "/getStationRealKpi", body, &resp); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Huawei GetPlantDetails: %w", err)
 	}
-
-	if !resp.Success || len(resp.Data) == 0 {
-		return nil, fmt.Errorf("Huawei GetPlantDetails: no data")
+	if !resp.Success {
+		return nil, huaweiError("GetPlantDetails", resp.huaweiBaseResponse)
+	}
+	if len(resp.Data) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, "GetPlantDetails", "no data for station "+plantID)
 	}
 
 	plant := normalizeHuaweiStationKpi(resp.Data[0], plantID)
@@ -144,7 +186,7 @@ func (p *HuaweiProvider) GetDevices(ctx context.Context, plantID string) ([]mode
 		return nil, fmt.Errorf("Huawei GetDevices: %w", err)
 	}
 	if !resp.Success {
-		return nil, fmt.Errorf("Huawei GetDevices failed: %s", resp.Message)
+		return nil, huaweiError("GetDevices", resp.huaweiBaseResponse)
 	}
 
 	var devices []models.NormalizedDevice
@@ -155,7 +197,8 @@ func (p *HuaweiProvider) GetDevices(ctx context.Context, plantID string) ([]mode
 }
 
 func (p *HuaweiProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
-	return nil, fmt.Errorf("Huawei: use GetDevices with stationCode for device details")
+	// The northbound API has no single-device endpoint; details come with getDevList
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
 }
 
 // ── Real-Time Data ──
@@ -172,8 +215,11 @@ func (p *HuaweiProvider) GetRealTimeData(ctx context.Context, deviceID string) (
 	if err := p.client.Post(ctx, "/getDevRealKpi", body, &resp); err != nil {
 		return nil, fmt.Errorf("Huawei GetRealTimeData: %w", err)
 	}
-	if !resp.Success || len(resp.Data) == 0 {
-		return nil, fmt.Errorf("Huawei GetRealTimeData: no data")
+	if !resp.Success {
+		return nil, huaweiError("GetRealTimeData", resp.huaweiBaseResponse)
+	}
+	if len(resp.Data) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, "GetRealTimeData", "no data for device "+deviceID)
 	}
 
 	rt := normalizeHuaweiDevRealKpi(resp.Data[0], deviceID)
@@ -191,8 +237,11 @@ func (p *HuaweiProvider) GetEnergyStats(ctx context.Context, plantID string, per
 	if err := p.client.Post(ctx, "/getStationRealKpi", body, &resp); err != nil {
 		return nil, fmt.Errorf("Huawei GetEnergyStats: %w", err)
 	}
-	if !resp.Success || len(resp.Data) == 0 {
-		return nil, fmt.Errorf("Huawei GetEnergyStats: no data")
+	if !resp.Success {
+		return nil, huaweiError("GetEnergyStats", resp.huaweiBaseResponse)
+	}
+	if len(resp.Data) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, "GetEnergyStats", "no data for station "+plantID)
 	}
 
 	energy := normalizeHuaweiStationEnergy(resp.Data[0], plantID, period)
@@ -202,22 +251,30 @@ func (p *HuaweiProvider) GetEnergyStats(ctx context.Context, plantID string, per
 // ── Historical Data ──
 
 func (p *HuaweiProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
-	endpoint := huaweiKpiEndpoint(req.Granularity)
+	endpoint, ok := huaweiKpiEndpoint(req.Granularity)
+	if !ok {
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "granularity "+string(req.Granularity))
+	}
 
 	collectTime := time.Now().UnixMilli()
 	if t, err := time.Parse(time.RFC3339, req.StartTime); err == nil {
 		collectTime = t.UnixMilli()
 	}
 
+	// Like getDevRealKpi, assume an inverter
 	body := map[string]interface{}{
-		"stationCodes": deviceID,
-		"collectTime":  collectTime,
+		"devIds":      deviceID,
+		"devTypeId":   1,
+		"collectTime": collectTime,
 	}
 
 	var resp huaweiKpiHistoryResponse
 	if err := p.client.Post(ctx, endpoint, body, &resp); err != nil {
 		return nil, fmt.Errorf("Huawei GetHistoricalData: %w", err)
 	}
+	if !resp.Success {
+		return nil, huaweiError("GetHistoricalData", resp.huaweiBaseResponse)
+	}
 
 	history := normalizeHuaweiHistory(resp, deviceID, req)
 	return &history, nil
@@ -238,6 +295,9 @@ func (p *HuaweiProvider) GetAlarms(ctx context.Context, deviceID string) ([]mode
 	if err := p.client.Post(ctx, "/getAlarmList", body, &resp); err != nil {
 		return nil, fmt.Errorf("Huawei GetAlarms: %w", err)
 	}
+	if !resp.Success {
+		return nil, huaweiError("GetAlarms", resp.huaweiBaseResponse)
+	}
 
 	var alarms []models.NormalizedAlarm
 	for _, raw := range resp.Data {
@@ -246,12 +306,38 @@ func (p *HuaweiProvider) GetAlarms(ctx context.Context, deviceID string) ([]mode
 	return alarms, nil
 }
 
+// huaweiMaxStationCodes is the maximum number of stationCodes getAlarmList accepts per call.
+const huaweiMaxStationCodes = 100
+
 func (p *HuaweiProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
-	return p.GetAlarms(ctx, "")
+	// getAlarmList requires stationCodes, so query every plant in batches
+	plants, err := p.GetPlants(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Huawei GetAllAlarms: %w", err)
+	}
+
+	var allAlarms []models.NormalizedAlarm
+	for start := 0; start < len(plants); start += huaweiMaxStationCodes {
+		end := start + huaweiMaxStationCodes
+		if end > len(plants) {
+			end = len(plants)
+		}
+		codes := make([]string, 0, end-start)
+		for _, plant := range plants[start:end] {
+			codes = append(codes, plant.Meta.ProviderPlantID)
+		}
+
+		alarms, err := p.GetAlarms(ctx, strings.Join(codes, ","))
+		if err != nil {
+			return nil, fmt.Errorf("Huawei GetAllAlarms: %w", err)
+		}
+		allAlarms = append(allAlarms, alarms...)
+	}
+	return allAlarms, nil
 }
 
 func (p *HuaweiProvider) Healthy(ctx context.Context) bool {
-	return p.xsrfToken != ""
+	return p.client.HasSession()
 }
 
 func (p *HuaweiProvider) Close() error {
@@ -332,7 +418,7 @@ type huaweiKpiHistoryResponse struct {
 }
 
 type huaweiKpiHistoryEntry struct {
-	StationCode string                 `json:"stationCode"`
+	DevID       int64                  `json:"devId"`
 	CollectTime int64                  `json:"collectTime"`
 	DataItemMap map[string]interface{} `json:"dataItemMap"`
 }
@@ -578,10 +664,16 @@ func normalizeHuaweiHistory(resp huaweiKpiHistoryResponse, deviceID string, req
 			},
 		}
 
-		// Map Huawei historical KPIs
-		dp.PVEnergyKWh = extractFloatP(data, "inverter_power")
-		dp.GridExportEnergyKWh = extractFloatP(data, "ongrid_power")
-		dp.LoadEnergyKWh = extractFloatP(data, "use_power")
+		// Huawei inverter KPIs: "active_power" (kW) in 5-minute data,
+		// "product_power" (yield kWh) per day, month and year
+		if req.Granularity == models.GranularityMinute {
+			if kw := extractFloatP(data, "active_power"); kw != nil {
+				w := *kw * 1000
+				dp.PVPowerW = &w
+			}
+		} else {
+			dp.PVEnergyKWh = extractFloatP(data, "product_power")
+		}
 
 		result.DataPoints = append(result.DataPoints, dp)
 	}
@@ -673,18 +765,72 @@ func huaweiAlarmStatus(status int) models.AlarmStatus {
 	}
 }
 
-func huaweiKpiEndpoint(g models.Granularity) string {
+// huaweiXSRFToken extracts the session token from a login response. Some
+// FusionSolar deployments also echo it as a plain response header.
+func huaweiXSRFToken(header http.Header) string {
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		if strings.EqualFold(c.Name, huaweiXSRFHeader) && c.Value != "" {
+			return c.Value
+		}
+	}
+	return header.Get(huaweiXSRFHeader)
+}
+
+// huaweiSessionExpired reports whether a response says the login session is
+// gone (failCode 305 "USER_MUST_RELOGIN").
+func huaweiSessionExpired(status int, body []byte) bool {
+	var resp huaweiBaseResponse
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	return !resp.Success && resp.FailCode == 305
+}
+
+// huaweiRetryClass treats failCode 407 (ACCESS_FREQUENCY_IS_TOO_HIGH) as throttling.
+func huaweiRetryClass(status int, body []byte) provider.RetryClass {
+	var resp huaweiBaseResponse
+	if json.Unmarshal(body, &resp) == nil && !resp.Success && resp.FailCode == 407 {
+		return provider.RetryThrottled
+	}
+	return provider.NoRetry
+}
+
+// huaweiError classifies a FusionSolar failCode into the provider error taxonomy.
+func huaweiError(op string, resp huaweiBaseResponse) error {
+	var kind error
+	switch resp.FailCode {
+	case 305, 20001, 20002, 20003:
+		// session expired / must re-login, unknown, disabled or expired third-party account
+		kind = provider.ErrAuth
+	case 401:
+		// no data permission
+		kind = provider.ErrAuth
+	case 407:
+		// access frequency too high
+		kind = provider.ErrRateLimited
+	case 20004, 20005, 20006, 20007, 20008, 20009, 20010:
+		// missing or malformed request parameters
+		kind = provider.ErrInvalidRequest
+	default:
+		// an answer, so the API is up
+		kind = provider.ErrVendor
+	}
+	return provider.VendorError(kind, providerName, op, strconv.Itoa(resp.FailCode), resp.Message)
+}
+
+// huaweiKpiEndpoint returns the device history endpoint for a granularity.
+func huaweiKpiEndpoint(g models.Granularity) (string, bool) {
 	switch g {
-	case models.GranularityMinute, models.GranularityHour:
-		return "/getKpiStationHour"
+	case models.GranularityMinute:
+		return "/getDevFiveMinutes", true
 	case models.GranularityDay:
-		return "/getKpiStationDay"
+		return "/getDevKpiDay", true
 	case models.GranularityMonth:
-		return "/getKpiStationMonth"
+		return "/getDevKpiMonth", true
 	case models.GranularityYear:
-		return "/getKpiStationYear"
+		return "/getDevKpiYear", true
 	default:
-		return "/getKpiStationDay"
+		return "", false
 	}
 }
 
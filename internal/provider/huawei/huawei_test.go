@@ -0,0 +1,209 @@
+package huawei
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// fakeFusionSolar stands in for the FusionSolar northbound API. Every login
+// issues a new XSRF-TOKEN cookie; calls must echo the current one as a
+// header, or get failCode 305 like an expired session does.
+type fakeFusionSolar struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	logins  int
+	token   string   // the valid session token, empty when expired
+	tokens  []string // XSRF-TOKEN headers of the data calls
+	refused int      // data calls answered with failCode 305
+}
+
+func (f *fakeFusionSolar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/login":
+		var body struct {
+			UserName   string `json:"userName"`
+			SystemCode string `json:"systemCode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserName != "api-user" || body.SystemCode != "secret" {
+			fmt.Fprint(w, `{"success":false,"failCode":20001,"message":"user or password error"}`)
+			return
+		}
+		// Give concurrent callers time to pile up behind the login
+		time.Sleep(20 * time.Millisecond)
+
+		f.mu.Lock()
+		f.logins++
+		f.token = fmt.Sprintf("xsrf-%d", f.logins)
+		token := f.token
+		f.mu.Unlock()
+
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: token, Path: "/"})
+		fmt.Fprint(w, `{"success":true,"failCode":0,"data":null}`)
+
+	case "/getStationList":
+		f.mu.Lock()
+		header := r.Header.Get("XSRF-TOKEN")
+		f.tokens = append(f.tokens, header)
+		valid := f.token != "" && header == f.token
+		if !valid {
+			f.refused++
+		}
+		f.mu.Unlock()
+
+		if !valid {
+			fmt.Fprint(w, `{"success":false,"failCode":305,"message":"USER_MUST_RELOGIN"}`)
+			return
+		}
+		fmt.Fprint(w, `{"success":true,"failCode":0,"data":{"total":1,"pageCount":1,"list":[
+			{"stationCode":"NE=33685734","stationName":"Hillside","capacity":12.4}]}}`)
+
+	default:
+		f.t.Errorf("unexpected call %s", r.URL.Path)
+		http.NotFound(w, r)
+	}
+}
+
+// expire ends the session on the server side.
+func (f *fakeFusionSolar) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = ""
+}
+
+func (f *fakeFusionSolar) stats() (logins, refused int, tokens []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins, f.refused, append([]string(nil), f.tokens...)
+}
+
+func newTestProvider(t *testing.T, password string) (*HuaweiProvider, *fakeFusionSolar, error) {
+	t.Helper()
+	api := &fakeFusionSolar{t: t}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	p := &HuaweiProvider{}
+	err := p.Initialize(context.Background(), provider.ProviderConfig{
+		Name:         "huawei-test",
+		BaseURL:      srv.URL,
+		Credentials:  map[string]string{"username": "api-user", "systemCode": password},
+		RateLimitRPS: 1000,
+	})
+	return p, api, err
+}
+
+func TestSessionReloginAfterExpiry(t *testing.T) {
+	p, api, err := newTestProvider(t, "secret")
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	ctx := context.Background()
+
+	plants, err := p.GetPlants(ctx)
+	if err != nil {
+		t.Fatalf("GetPlants: %v", err)
+	}
+	if len(plants) != 1 || plants[0].Meta.ProviderPlantID != "NE=33685734" {
+		t.Fatalf("plants = %+v", plants)
+	}
+
+	api.expire()
+	if _, err := p.GetPlants(ctx); err != nil {
+		t.Fatalf("GetPlants after expiry: %v", err)
+	}
+
+	logins, refused, tokens := api.stats()
+	if logins != 2 || refused != 1 {
+		t.Errorf("logins %d, refused calls %d; want 2, 1", logins, refused)
+	}
+	// The cookie of each login is replayed as the header, the expired
+	// call is replayed with the new one
+	if want := []string{"xsrf-1", "xsrf-1", "xsrf-2"}; fmt.Sprint(tokens) != fmt.Sprint(want) {
+		t.Errorf("XSRF-TOKEN headers = %v, want %v", tokens, want)
+	}
+	if !p.Healthy(ctx) {
+		t.Error("provider unhealthy after re-login")
+	}
+}
+
+func TestSessionConcurrentCallersShareLogin(t *testing.T) {
+	p, api, err := newTestProvider(t, "secret")
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	api.expire()
+
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := p.GetPlants(context.Background()); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("GetPlants: %v", err)
+	}
+
+	logins, refused, tokens := api.stats()
+	if logins != 2 {
+		t.Errorf("%d logins for %d concurrent callers of an expired session, want 2 (initial and one re-login)", logins, callers)
+	}
+	if refused > callers {
+		t.Errorf("%d calls refused, want at most one per caller", refused)
+	}
+	if last := tokens[len(tokens)-1]; last != "xsrf-2" {
+		t.Errorf("last XSRF-TOKEN header %q, want xsrf-2", last)
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	_, api, err := newTestProvider(t, "wrong")
+	if !errors.Is(err, provider.ErrAuth) {
+		t.Fatalf("Initialize with a wrong password = %v, want ErrAuth", err)
+	}
+	if logins, _, _ := api.stats(); logins != 0 {
+		t.Errorf("%d sessions issued for a failed login", logins)
+	}
+}
+
+func TestHuaweiErrorKinds(t *testing.T) {
+	tests := []struct {
+		failCode int
+		kind     error
+	}{
+		{305, provider.ErrAuth},
+		{20001, provider.ErrAuth},
+		{407, provider.ErrRateLimited},
+		{20004, provider.ErrInvalidRequest},
+		// Unknown codes are still answers: they must not open the circuit
+		{20400, provider.ErrVendor},
+	}
+	for _, tt := range tests {
+		err := huaweiError("/getStationList", huaweiBaseResponse{FailCode: tt.failCode, Message: "x"})
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("failCode %d = %v, want %v", tt.failCode, err, tt.kind)
+		}
+		if errors.Is(err, provider.ErrUpstreamUnavailable) {
+			t.Errorf("failCode %d counts as an upstream failure", tt.failCode)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// ClientObserver receives events from every HTTPClient, e.g. to export
+// metrics. Methods are called synchronously on the requesting goroutine and
+// must not block. instance is the provider instance the request was made
+// for, as set with WithInstance; it is empty for requests made outside the
+// engine.
+type ClientObserver interface {
+	// UpstreamRequest reports one attempt of a request: the HTTP status, or
+	// 0 and the error if no response was received.
+	UpstreamRequest(instance string, status int, err error, d time.Duration)
+	// UpstreamRetry reports that a request is retried; throttled is set when
+	// the vendor asked us to slow down.
+	UpstreamRetry(instance string, throttled bool)
+	// RateLimitWait reports how long a request waited for the rate limiter.
+	RateLimitWait(instance string, d time.Duration)
+	// AuthRefresh reports a login, err being nil if it succeeded.
+	AuthRefresh(instance string, err error)
+}
+
+type observerBox struct{ ClientObserver }
+
+var clientObserver atomic.Value // observerBox
+
+// SetClientObserver installs o for all HTTP clients; nil removes it.
+func SetClientObserver(o ClientObserver) {
+	clientObserver.Store(observerBox{o})
+}
+
+func observer() ClientObserver {
+	box, _ := clientObserver.Load().(observerBox)
+	return box.ClientObserver
+}
+
+type instanceCtxKey struct{}
+
+// WithInstance names the provider instance requests made with ctx are for.
+func WithInstance(ctx context.Context, instance string) context.Context {
+	return context.WithValue(ctx, instanceCtxKey{}, instance)
+}
+
+// InstanceFromContext returns the instance set with WithInstance, if any.
+func InstanceFromContext(ctx context.Context) string {
+	instance, _ := ctx.Value(instanceCtxKey{}).(string)
+	return instance
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"time"
 
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
 )
@@ -12,12 +13,18 @@ import (
 // Each method returns already-normalized data — the adapter is responsible
 // for translating vendor-specific schemas into the universal models.
 type Provider interface {
-	// Name returns the canonical provider identifier (e.g., "sma", "huawei", "sungrow", "saj").
+	// Name returns the canonical provider type (e.g., "sma", "huawei", "sungrow", "saj").
+	// Instance names are assigned by the engine from ProviderConfig.Name.
 	Name() string
 
 	// Initialize sets up the provider with credentials and validates connectivity.
 	Initialize(ctx context.Context, cfg ProviderConfig) error
 
+	// Capabilities describes the operations, history granularities, energy
+	// periods and realtime metrics the provider supports. Methods outside the
+	// matrix return an error wrapping ErrNotSupported.
+	Capabilities() Capabilities
+
 	// ── Plant Operations ──
 
 	// GetPlants returns all plants/sites accessible with the configured credentials.
@@ -67,7 +74,9 @@ type ProviderConfig struct {
 	// Provider type identifier
 	Type string `yaml:"type"`
 
-	// Display name for this provider instance
+	// Unique instance name. Used as the ID prefix for normalized entities and
+	// as the ?provider= value in the API, so several accounts of the same
+	// type can run side by side (e.g. "saj-installer-a", "saj-installer-b").
 	Name string `yaml:"name"`
 
 	// Whether this provider is enabled
@@ -82,9 +91,16 @@ type ProviderConfig struct {
 	// Rate limit override (requests per second)
 	RateLimitRPS int `yaml:"rate_limit_rps"`
 
-	// Request timeout in seconds
+	// Timeout in seconds for a single request attempt; retries get their own
 	TimeoutSeconds int `yaml:"timeout_seconds"`
 
+	// Circuit breaker thresholds
+	CircuitBreaker BreakerConfig `yaml:"circuit_breaker"`
+
+	// Calls allowed per day for vendors with a daily quota (e.g. SolarEdge,
+	// per site); 0 uses the vendor's documented limit
+	DailyQuota int `yaml:"daily_quota"`
+
 	// Timezone for this provider's data (e.g. "Asia/Shanghai")
 	Timezone string `yaml:"timezone"`
 }
@@ -96,3 +112,17 @@ func (c ProviderConfig) GetCredential(key string) string {
 	}
 	return c.Credentials[key]
 }
+
+// CallInterval returns the gap between calls that keeps a background job
+// within share (0–1] of the instance's rate limit, leaving the rest for API
+// requests. Instances without rate_limit_rps are assumed to allow 5 per second.
+func (c ProviderConfig) CallInterval(share float64) time.Duration {
+	rps := c.RateLimitRPS
+	if rps <= 0 {
+		rps = 5
+	}
+	if share <= 0 || share > 1 {
+		share = 1
+	}
+	return time.Duration(float64(time.Second) / (float64(rps) * share))
+}
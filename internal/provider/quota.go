@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quota is a daily call budget per key, for vendors that cap the calls a day
+// on top of a per-second rate (e.g. SolarEdge allows 300 per site). Every
+// attempt the HTTP client sends counts, retries included. Days start at
+// midnight in the quota's location.
+type Quota struct {
+	limit int
+	loc   *time.Location
+	now   func() time.Time
+
+	mu   sync.Mutex
+	day  time.Time      // start of the day being counted
+	used map[string]int // key → calls made today
+}
+
+// NewQuota creates a budget of limit calls per key and day. loc may be nil
+// for UTC.
+func NewQuota(limit int, loc *time.Location) *Quota {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Quota{limit: limit, loc: loc, now: time.Now, used: make(map[string]int)}
+}
+
+// Take counts one call for key, or fails with ErrRateLimited if key has used
+// up today's budget.
+func (q *Quota) Take(key string) error {
+	return q.take(key, "")
+}
+
+func (q *Quota) take(key, op string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.rollover(q.now())
+	if q.used[key] >= q.limit {
+		return &Error{Kind: ErrRateLimited, Op: op, Message: fmt.Sprintf("daily quota of %d calls for %s used up until %s",
+			q.limit, quotaKeyName(key), q.day.AddDate(0, 0, 1).Format(time.RFC3339))}
+	}
+	q.used[key]++
+	return nil
+}
+
+// Remaining returns the calls key has left on the day of now and when that
+// day's budget resets.
+func (q *Quota) Remaining(key string, now time.Time) (int, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	day := q.dayOf(now)
+	if !day.Equal(q.day) {
+		// Nothing counted for that day yet
+		return q.limit, day.AddDate(0, 0, 1)
+	}
+	return max(q.limit-q.used[key], 0), day.AddDate(0, 0, 1)
+}
+
+// rollover starts a new count once the day has changed.
+func (q *Quota) rollover(now time.Time) {
+	if day := q.dayOf(now); !day.Equal(q.day) {
+		q.day = day
+		clear(q.used)
+	}
+}
+
+// dayOf returns the start of the quota day now falls in.
+func (q *Quota) dayOf(now time.Time) time.Time {
+	y, m, d := now.In(q.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, q.loc)
+}
+
+func quotaKeyName(key string) string {
+	if key == "" {
+		return "the account"
+	}
+	return key
+}
+
+// QuotaLimited is implemented by providers whose calls are charged against a
+// daily Quota, so background pollers can spread their calls over the day.
+type QuotaLimited interface {
+	// Quota returns the provider's budget.
+	Quota() *Quota
+	// RealtimeCost returns the calls per quota key that one GetRealTimeData
+	// for each of deviceIDs costs.
+	RealtimeCost(deviceIDs []string) map[string]int
+}
+
+// SetQuota makes the client charge every attempt against q, under the key set
+// on the request context with WithQuotaKey.
+func (c *HTTPClient) SetQuota(q *Quota) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quota = q
+}
+
+type quotaKeyCtxKey struct{}
+
+// WithQuotaKey names the quota key (e.g. a site ID) requests made with ctx
+// are charged to. Requests without one share the empty key.
+func WithQuotaKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, quotaKeyCtxKey{}, key)
+}
+
+func quotaKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(quotaKeyCtxKey{}).(string)
+	return key
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testQuota returns a quota on a clock the test moves by hand.
+func testQuota(limit int, loc *time.Location, start time.Time) (*Quota, *time.Time) {
+	now := start
+	q := NewQuota(limit, loc)
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestQuotaResetsAtMidnightUTC(t *testing.T) {
+	midnight := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+	q, now := testQuota(2, nil, midnight.Add(-time.Second))
+
+	for i := 0; i < 2; i++ {
+		if err := q.Take("site1"); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	err := q.Take("site1")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("call over the quota = %v, want ErrRateLimited", err)
+	}
+	if msg := err.Error(); msg != "daily quota of 2 calls for site1 used up until 2024-06-15T00:00:00Z" {
+		t.Errorf("error = %q", msg)
+	}
+	// Keys are counted apart
+	if err := q.Take("site2"); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+	if left, reset := q.Remaining("site1", *now); left != 0 || !reset.Equal(midnight) {
+		t.Errorf("Remaining = %d until %s, want 0 until %s", left, reset, midnight)
+	}
+
+	// Past midnight the budget is back, before any call is made
+	*now = midnight.Add(time.Second)
+	if left, reset := q.Remaining("site1", *now); left != 2 || !reset.Equal(midnight.AddDate(0, 0, 1)) {
+		t.Errorf("Remaining after midnight = %d until %s, want 2 until %s", left, reset, midnight.AddDate(0, 0, 1))
+	}
+	if err := q.Take("site1"); err != nil {
+		t.Fatalf("call after midnight: %v", err)
+	}
+	if left, _ := q.Remaining("site1", *now); left != 1 {
+		t.Errorf("Remaining = %d after one call, want 1", left)
+	}
+	if left, _ := q.Remaining("site2", *now); left != 2 {
+		t.Errorf("Remaining of the other key = %d, want 2", left)
+	}
+}
+
+func TestQuotaDayFollowsLocation(t *testing.T) {
+	// Midnight in UTC+10 is 14:00 UTC
+	loc := time.FixedZone("AEST", 10*3600)
+	q, now := testQuota(1, loc, time.Date(2024, 6, 14, 23, 59, 0, 0, time.UTC))
+
+	if err := q.Take(""); err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	*now = time.Date(2024, 6, 15, 0, 1, 0, 0, time.UTC)
+	if err := q.Take(""); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("call after midnight UTC = %v, want ErrRateLimited until midnight in %s", err, loc)
+	}
+	*now = time.Date(2024, 6, 15, 14, 0, 0, 0, time.UTC)
+	if err := q.Take(""); err != nil {
+		t.Errorf("call after local midnight: %v", err)
+	}
+}
+
+func TestClientChargesEveryAttempt(t *testing.T) {
+	fastBackoff(t)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	q := NewQuota(3, nil)
+	c := NewHTTPClient(srv.URL, 5, 100)
+	c.SetQuota(q)
+	ctx := WithQuotaKey(context.Background(), "site1")
+
+	// A retried call costs two
+	if err := c.Get(ctx, "/site/1/overview", nil, nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if left, _ := q.Remaining("site1", time.Now()); left != 1 {
+		t.Errorf("Remaining = %d after a retried call, want 1", left)
+	}
+	if err := c.Get(ctx, "/site/1/overview", nil, nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	// Out of budget: refused without a call
+	if err := c.Get(ctx, "/site/1/overview", nil, nil); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Get over the quota = %v, want ErrRateLimited", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("%d calls reached the vendor, want 3", n)
+	}
+}
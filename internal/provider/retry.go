@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAttempts   = 3
+	maxBackoff    = 30 * time.Second
+	maxRetryAfter = 2 * time.Minute // longer Retry-After values are not waited out
+)
+
+// baseBackoff is the nominal delay before the first retry; tests shorten it.
+var baseBackoff = 1 * time.Second
+
+// RetryClass tells the HTTP client what to do with a response.
+type RetryClass int
+
+const (
+	// NoRetry hands the response to the caller as is.
+	NoRetry RetryClass = iota
+	// RetryTransient retries after an exponential backoff.
+	RetryTransient
+	// RetryThrottled retries after Retry-After (or a backoff) and slows the
+	// client's rate limiter down.
+	RetryThrottled
+)
+
+// RetryClassifier recognises vendor-specific retryable responses, such as
+// throttling reported with HTTP 200 and an error code in the body. It is only
+// consulted for responses the status code alone does not classify.
+type RetryClassifier func(status int, body []byte) RetryClass
+
+// SetRetryClassifier installs the provider's retry classifier.
+func (c *HTTPClient) SetRetryClassifier(fn RetryClassifier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retryClassifier = fn
+}
+
+// classify decides whether a response should be retried. Transport errors and
+// 5xx are transient, 429 is throttling; everything else is up to the
+// provider's classifier.
+func (c *HTTPClient) classify(status int, body []byte) RetryClass {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return RetryThrottled
+	case status >= 500:
+		return RetryTransient
+	}
+	c.mu.RLock()
+	fn := c.retryClassifier
+	c.mu.RUnlock()
+	if fn == nil {
+		return NoRetry
+	}
+	return fn(status, body)
+}
+
+// backoff returns the jittered exponential delay before retry number attempt
+// (0-based): half the nominal delay plus a random share of the other half.
+func backoff(attempt int) time.Duration {
+	d := baseBackoff << uint(attempt)
+	if d <= 0 || d > maxBackoff {
+		d = maxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// backoffBudget is the longest total backoff between maxAttempts attempts.
+func backoffBudget() time.Duration {
+	var total time.Duration
+	for attempt := 0; attempt < maxAttempts-1; attempt++ {
+		d := baseBackoff << uint(attempt)
+		if d > maxBackoff {
+			d = maxBackoff
+		}
+		total += d
+	}
+	return total
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date. It returns 0 if the header is absent or unparseable.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
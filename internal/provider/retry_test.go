@@ -0,0 +1,273 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastBackoff shortens the retry backoff for the rest of the test. Clients
+// must be created after it, as their request timeout includes the backoff.
+func fastBackoff(t *testing.T) {
+	t.Helper()
+	prev := baseBackoff
+	baseBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { baseBackoff = prev })
+}
+
+// scriptedServer answers each request with the next of statuses, repeating
+// the last one, and records when each arrived.
+type scriptedServer struct {
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header // sent with non-200 answers
+	arrivals []time.Time
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.statuses[min(len(s.arrivals), len(s.statuses)-1)]
+	s.arrivals = append(s.arrivals, time.Now())
+	if status != http.StatusOK {
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(`{}`))
+}
+
+func (s *scriptedServer) attempts() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.arrivals...)
+}
+
+func newScripted(t *testing.T, header http.Header, statuses ...int) (*scriptedServer, *HTTPClient) {
+	t.Helper()
+	s := &scriptedServer{statuses: statuses, header: header}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, NewHTTPClient(srv.URL, 5, 100)
+}
+
+func TestClassify(t *testing.T) {
+	c := NewHTTPClient("http://vendor.invalid", 5, 1)
+	// A vendor reporting throttling as HTTP 200 with code 407
+	c.SetRetryClassifier(func(status int, body []byte) RetryClass {
+		if string(body) == `{"code":407}` {
+			return RetryThrottled
+		}
+		return NoRetry
+	})
+
+	tests := []struct {
+		status int
+		body   string
+		want   RetryClass
+	}{
+		{http.StatusOK, `{}`, NoRetry},
+		{http.StatusOK, `{"code":407}`, RetryThrottled},
+		{http.StatusBadRequest, `{}`, NoRetry},
+		{http.StatusUnauthorized, `{}`, NoRetry},
+		{http.StatusTooManyRequests, `{}`, RetryThrottled},
+		{http.StatusInternalServerError, `{}`, RetryTransient},
+		{http.StatusBadGateway, `{}`, RetryTransient},
+		{http.StatusServiceUnavailable, `{"code":407}`, RetryTransient},
+	}
+	for _, tt := range tests {
+		if got := c.classify(tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("classify(%d, %s) = %d, want %d", tt.status, tt.body, got, tt.want)
+		}
+	}
+
+	// Without a classifier only the status counts
+	if got := NewHTTPClient("http://vendor.invalid", 5, 1).classify(http.StatusOK, []byte(`{"code":407}`)); got != NoRetry {
+		t.Errorf("classify without a classifier = %d, want NoRetry", got)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	for attempt := 0; attempt < 8; attempt++ {
+		nominal := baseBackoff << uint(attempt)
+		if nominal > maxBackoff {
+			nominal = maxBackoff
+		}
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 100; i++ {
+			d := backoff(attempt)
+			if d < nominal/2 || d > nominal {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", attempt, d, nominal/2, nominal)
+			}
+			seen[d] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("backoff(%d) is not jittered: always %v", attempt, seen)
+		}
+	}
+	if want := 3 * time.Second; backoffBudget() != want {
+		t.Errorf("backoffBudget = %s, want %s", backoffBudget(), want)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 14, 11, 5, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"Fri, 14 Jun 2024 11:06:30 GMT", 90 * time.Second},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(header, now); got != tt.want {
+			t.Errorf("retryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	fastBackoff(t)
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		kind     error // nil for success
+	}{
+		{"success", []int{200}, 1, nil},
+		{"transient then success", []int{503, 502, 200}, 3, nil},
+		{"persistent 5xx", []int{500}, maxAttempts, ErrUpstreamUnavailable},
+		{"client error", []int{400}, 1, ErrInvalidRequest},
+		{"auth error", []int{401}, 1, ErrAuth},
+		{"persistent throttling", []int{429}, maxAttempts, ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newScripted(t, nil, tt.statuses...)
+			err := c.Get(context.Background(), "/data", nil, nil)
+			if n := len(s.attempts()); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+			if tt.kind == nil && err != nil {
+				t.Errorf("Get: %v", err)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Errorf("Get = %v, want %v", err, tt.kind)
+			}
+		})
+	}
+}
+
+func TestThrottledWaitsRetryAfter(t *testing.T) {
+	fastBackoff(t)
+	s, c := newScripted(t, http.Header{"Retry-After": {"1"}}, 429, 200)
+	base := c.rateLimiter.base
+
+	if err := c.Get(context.Background(), "/data", nil, nil); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	arrivals := s.attempts()
+	if len(arrivals) != 2 {
+		t.Fatalf("%d attempts, want 2", len(arrivals))
+	}
+	if waited := arrivals[1].Sub(arrivals[0]); waited < time.Second {
+		t.Errorf("retried after %s, want at least the Retry-After of 1s", waited)
+	}
+
+	// The limiter slowed down and has recovered only part of the way
+	c.rateLimiter.mu.Lock()
+	interval := c.rateLimiter.interval
+	c.rateLimiter.mu.Unlock()
+	if interval <= base || interval >= 2*base {
+		t.Errorf("refill interval %s after throttling, want between %s and %s", interval, base, 2*base)
+	}
+}
+
+func TestRetryAfterBeyondDeadlineNotWaited(t *testing.T) {
+	fastBackoff(t)
+	s, c := newScripted(t, http.Header{"Retry-After": {"60"}}, 429, 200)
+	c.requestTimeout = time.Second
+
+	start := time.Now()
+	err := c.Get(context.Background(), "/data", nil, nil)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Get = %v, want ErrRateLimited", err)
+	}
+	if n := len(s.attempts()); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %s instead of at once", elapsed)
+	}
+}
+
+func TestRateLimiterThrottleAndRecover(t *testing.T) {
+	rl := NewRateLimiter(10)
+	defer rl.ticker.Stop()
+	base := rl.base
+
+	rl.Throttle(200 * time.Millisecond)
+	if len(rl.tokens) != 0 {
+		t.Errorf("%d saved-up tokens kept after throttling", len(rl.tokens))
+	}
+	if rl.interval != 2*base {
+		t.Errorf("interval %s after one throttle, want %s", rl.interval, 2*base)
+	}
+
+	// A deadline inside the pause fails fast
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(ctx); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Wait with a deadline inside the pause = %v, want ErrRateLimited", err)
+	}
+
+	// Otherwise the pause is waited out
+	start := time.Now()
+	if err := rl.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("Wait returned after %s, inside the pause", waited)
+	}
+
+	// Repeated throttling is bounded
+	for i := 0; i < 10; i++ {
+		rl.Throttle(0)
+	}
+	if rl.interval != base*maxSlowdown {
+		t.Errorf("interval %s after repeated throttling, want %s", rl.interval, base*maxSlowdown)
+	}
+
+	// Each success closes a quarter of the gap, until the configured rate
+	rl.Recover()
+	if want := base*maxSlowdown - (base*maxSlowdown-base+3)/4; rl.interval != want {
+		t.Errorf("interval %s after one success, want %s", rl.interval, want)
+	}
+	for i := 0; i < 200 && rl.interval != base; i++ {
+		rl.Recover()
+	}
+	if rl.interval != base {
+		t.Errorf("interval %s after recovering, want %s", rl.interval, base)
+	}
+
+	// A pause longer than maxRetryAfter is not waited out
+	rl.Throttle(maxRetryAfter + time.Minute)
+	if err := rl.Wait(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Wait in a long pause = %v, want ErrRateLimited", err)
+	}
+}
@@ -2,6 +2,7 @@ package saj
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -26,15 +27,34 @@ func init() {
 
 // SAJProvider implements the Provider interface for SAJ Elekeeper Open Platform.
 type SAJProvider struct {
-	client   *provider.HTTPClient
-	config   provider.ProviderConfig
-	appID    string
-	token    string
-	tokenExp time.Time
+	client *provider.HTTPClient
+	config provider.ProviderConfig
+	appID  string
 }
 
 func (p *SAJProvider) Name() string { return providerName }
 
+func (p *SAJProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Operations: provider.AllOperations,
+		// uploadData has no hourly time unit
+		Granularities: []models.Granularity{
+			models.GranularityMinute, models.GranularityDay, models.GranularityMonth, models.GranularityYear,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodYear, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricBattery, provider.MetricGrid,
+			provider.MetricGridPhases, provider.MetricLoad, provider.MetricEnvironment,
+		},
+		// uploadData serves at most one day of minute data per call
+		HistoryWindows: map[models.Granularity]provider.Window{
+			models.GranularityMinute: {Days: 1},
+		},
+	}
+}
+
 func (p *SAJProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
 	p.config = cfg
 
@@ -51,11 +71,18 @@ func (p *SAJProvider) Initialize(ctx context.Context, cfg provider.ProviderConfi
 	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
 	p.client.SetHeader("content-language", "en_US")
 	p.appID = cfg.GetCredential("appId")
+	p.client.SetSession(provider.Session{
+		Login:   p.authenticate,
+		Expired: sajSessionExpired,
+	})
+	p.client.SetRetryClassifier(sajRetryClass)
 
-	return p.authenticate(ctx)
+	return p.client.Authenticate(ctx)
 }
 
-func (p *SAJProvider) authenticate(ctx context.Context) error {
+// authenticate obtains an accessToken. The HTTP client renews it shortly
+// before it expires and whenever SAJ reports the session as gone.
+func (p *SAJProvider) authenticate(ctx context.Context) (time.Time, error) {
 	appID := p.config.GetCredential("appId")
 	appSecret := p.config.GetCredential("appSecret")
 
@@ -66,34 +93,21 @@ func (p *SAJProvider) authenticate(ctx context.Context) error {
 
 	var resp sajTokenResponse
 	if err := p.client.Get(ctx, "/open/api/access_token", params, &resp); err != nil {
-		return fmt.Errorf("SAJ auth: %w", err)
+		return time.Time{}, fmt.Errorf("SAJ auth: %w", err)
 	}
 	if resp.Code != 200 {
-		return fmt.Errorf("SAJ auth failed: code=%d msg=%s", resp.Code, resp.Msg)
+		return time.Time{}, sajError("auth", resp.Code, resp.Msg)
 	}
 
-	p.token = resp.Data.AccessToken
-	p.tokenExp = time.Now().Add(time.Duration(resp.Data.Expires) * time.Second)
-	p.client.SetHeader("accessToken", p.token)
+	p.client.SetHeader("accessToken", resp.Data.AccessToken)
 
 	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
-	return nil
-}
-
-func (p *SAJProvider) ensureToken(ctx context.Context) error {
-	if time.Now().After(p.tokenExp.Add(-5 * time.Minute)) {
-		return p.authenticate(ctx)
-	}
-	return nil
+	return time.Now().Add(time.Duration(resp.Data.Expires) * time.Second), nil
 }
 
 // ── Plants ──
 
 func (p *SAJProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	var allPlants []models.NormalizedPlant
 	page := 1
 	for {
@@ -108,7 +122,7 @@ func (p *SAJProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant,
 			return nil, err
 		}
 		if resp.Code != 200 {
-			return nil, fmt.Errorf("SAJ GetPlants: code=%d msg=%s", resp.Code, resp.Msg)
+			return nil, sajError("GetPlants", resp.Code, resp.Msg)
 		}
 
 		for _, raw := range resp.Rows {
@@ -125,17 +139,13 @@ func (p *SAJProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant,
 }
 
 func (p *SAJProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{"plantId": {plantID}}
 	var resp sajPlantDetailsResponse
 	if err := p.client.Get(ctx, "/open/api/plant/details", params, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("SAJ GetPlantDetails: code=%d msg=%s", resp.Code, resp.Msg)
+		return nil, sajError("GetPlantDetails", resp.Code, resp.Msg)
 	}
 
 	plant := normalizeSAJPlantDetails(resp.Data)
@@ -145,10 +155,6 @@ func (p *SAJProvider) GetPlantDetails(ctx context.Context, plantID string) (*mod
 // ── Devices ──
 
 func (p *SAJProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{
 		"plantId": {plantID},
 		"userId":  {""},
@@ -159,7 +165,7 @@ func (p *SAJProvider) GetDevices(ctx context.Context, plantID string) ([]models.
 		return nil, err
 	}
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("SAJ GetDevices: code=%d msg=%s", resp.Code, resp.Msg)
+		return nil, sajError("GetDevices", resp.Code, resp.Msg)
 	}
 
 	var devices []models.NormalizedDevice
@@ -171,15 +177,15 @@ func (p *SAJProvider) GetDevices(ctx context.Context, plantID string) ([]models.
 }
 
 func (p *SAJProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{"deviceSn": {deviceID}}
 	var resp sajBaseInfoResponse
 	if err := p.client.Get(ctx, "/open/api/device/baseinfo", params, &resp); err != nil {
 		return nil, err
 	}
+	// baseinfo reports success as code 0 rather than 200
+	if resp.Code != 0 && resp.Code != 200 {
+		return nil, sajError("GetDeviceDetails", resp.Code, resp.Msg)
+	}
 
 	dev := normalizeSAJBaseInfo(resp.Data, deviceID)
 	return &dev, nil
@@ -188,15 +194,15 @@ func (p *SAJProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*m
 // ── Real-Time Data ──
 
 func (p *SAJProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{"deviceSn": {deviceID}}
 	var resp sajRealtimeResponse
 	if err := p.client.Get(ctx, "/open/api/device/realtimeDataCommon", params, &resp); err != nil {
 		return nil, err
 	}
+	if resp.ErrCode != "" && resp.ErrCode != "0" {
+		code, _ := strconv.Atoi(resp.ErrCode)
+		return nil, sajError("GetRealTimeData", code, resp.ErrMsg)
+	}
 
 	rt := normalizeSAJRealtime(resp.Data)
 	return &rt, nil
@@ -205,10 +211,6 @@ func (p *SAJProvider) GetRealTimeData(ctx context.Context, deviceID string) (*mo
 // ── Energy Stats ──
 
 func (p *SAJProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{
 		"plantId":    {plantID},
 		"clientDate": {time.Now().Format("2006-01-02 15:04:05")},
@@ -219,7 +221,7 @@ func (p *SAJProvider) GetEnergyStats(ctx context.Context, plantID string, period
 		return nil, err
 	}
 	if resp.Code != 200 {
-		return nil, fmt.Errorf("SAJ GetEnergyStats: code=%d msg=%s", resp.Code, resp.Msg)
+		return nil, sajError("GetEnergyStats", resp.Code, resp.Msg)
 	}
 
 	energy := normalizeSAJPlantStats(resp.Data, plantID, period)
@@ -229,10 +231,6 @@ func (p *SAJProvider) GetEnergyStats(ctx context.Context, plantID string, period
 // ── Historical Data ──
 
 func (p *SAJProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	timeUnit := granularityToSAJTimeUnit(req.Granularity)
 
 	params := url.Values{
@@ -246,6 +244,9 @@ func (p *SAJProvider) GetHistoricalData(ctx context.Context, deviceID string, re
 	if err := p.client.Get(ctx, "/open/api/device/uploadData", params, &resp); err != nil {
 		return nil, err
 	}
+	if resp.ErrCode != 0 {
+		return nil, sajError("GetHistoricalData", resp.ErrCode, resp.ErrMsg)
+	}
 
 	history := normalizeSAJHistory(resp, deviceID, req)
 	return &history, nil
@@ -254,10 +255,6 @@ func (p *SAJProvider) GetHistoricalData(ctx context.Context, deviceID string, re
 // ── Alarms ──
 
 func (p *SAJProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{
 		"deviceSn": {deviceID},
 		"status":   {"1,4"},
@@ -267,6 +264,9 @@ func (p *SAJProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.
 	if err := p.client.Get(ctx, "/open/api/device/alarmList", params, &resp); err != nil {
 		return nil, err
 	}
+	if resp.Code != 200 {
+		return nil, sajError("GetAlarms", resp.Code, resp.Msg)
+	}
 
 	var alarms []models.NormalizedAlarm
 	for _, raw := range resp.Data {
@@ -276,10 +276,6 @@ func (p *SAJProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.
 }
 
 func (p *SAJProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
-	if err := p.ensureToken(ctx); err != nil {
-		return nil, err
-	}
-
 	params := url.Values{
 		"appId":  {p.appID},
 		"status": {"1,4"},
@@ -289,6 +285,9 @@ func (p *SAJProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlar
 	if err := p.client.Get(ctx, "/open/api/device/alarmList", params, &resp); err != nil {
 		return nil, err
 	}
+	if resp.Code != 200 {
+		return nil, sajError("GetAllAlarms", resp.Code, resp.Msg)
+	}
 
 	var alarms []models.NormalizedAlarm
 	for _, raw := range resp.Data {
@@ -298,7 +297,7 @@ func (p *SAJProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlar
 }
 
 func (p *SAJProvider) Healthy(ctx context.Context) bool {
-	return p.token != "" && time.Now().Before(p.tokenExp)
+	return p.client.HasSession()
 }
 
 func (p *SAJProvider) Close() error {
@@ -973,6 +972,67 @@ func sajAlarmStatus(status int) models.AlarmStatus {
 	}
 }
 
+// sajSessionExpired reports whether a response says the accessToken is no
+// longer accepted (not logged in, logged out, invalid token).
+func sajSessionExpired(status int, body []byte) bool {
+	var resp struct {
+		Code int `json:"code"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	switch resp.Code {
+	case 10002, 10007, 200015:
+		return true
+	}
+	return false
+}
+
+// sajRetryClass treats code 10006 "too frequent access" as throttling. SAJ
+// shares the code with parameter errors, so the message decides.
+func sajRetryClass(status int, body []byte) provider.RetryClass {
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Code == 10006 && sajThrottled(resp.Msg) {
+		return provider.RetryThrottled
+	}
+	return provider.NoRetry
+}
+
+func sajThrottled(msg string) bool {
+	return strings.Contains(strings.ToLower(msg), "frequent")
+}
+
+// sajError classifies an SAJ response code into the provider error taxonomy.
+func sajError(op string, code int, msg string) error {
+	var kind error
+	switch code {
+	case 10002, 10004, 10005, 10007, 100009, 200008, 200010, 200014, 200015:
+		// not logged in, auth failed, no permission, logged out,
+		// bad appId/appSecret, unknown/unreleased app, bad accessToken
+		kind = provider.ErrAuth
+	case 10006:
+		// shared by "parameter error" and "too frequent access"
+		if sajThrottled(msg) {
+			kind = provider.ErrRateLimited
+		} else {
+			kind = provider.ErrInvalidRequest
+		}
+	case 10003:
+		kind = provider.ErrInvalidRequest
+	case 10001:
+		// server exception
+		kind = provider.ErrUpstreamUnavailable
+	default:
+		// 10016 device timeout, 10021 data exception, ...: an answer, so the
+		// API is up
+		kind = provider.ErrVendor
+	}
+	return provider.VendorError(kind, providerName, op, strconv.Itoa(code), msg)
+}
+
 func granularityToSAJTimeUnit(g models.Granularity) int {
 	switch g {
 	case models.GranularityMinute:
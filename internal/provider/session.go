@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sessionRefreshMargin is how long before a known expiry the session is
+// proactively renewed.
+const sessionRefreshMargin = 5 * time.Minute
+
+// Session describes how a provider logs in to its vendor API and how to
+// recognise a response that means the login is no longer valid. Once
+// installed with HTTPClient.SetSession, the client logs in lazily, renews the
+// session shortly before it expires and, when a response reports an expired
+// session, logs in again once and replays the request.
+type Session struct {
+	// Login authenticates against the vendor and installs the resulting
+	// credentials with SetHeader / SetBodyField. It returns when the session
+	// expires, or the zero time if the vendor does not say. Requests made by
+	// Login itself bypass session handling.
+	Login func(ctx context.Context) (time.Time, error)
+
+	// Expired reports whether a response means the session is no longer
+	// valid. Many vendors answer HTTP 200 with an error code in the body, so
+	// both are passed. If nil, HTTP 401 is treated as expiry.
+	Expired func(status int, body []byte) bool
+}
+
+type loginCtxKey struct{}
+
+// SetSession installs the session handling for this client.
+func (c *HTTPClient) SetSession(s Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = &s
+	c.sessionValid = false
+}
+
+// SetBodyField sets a field that is merged into every JSON object request
+// body sent within the session, for vendors that expect the session token in
+// the body rather than in a header.
+func (c *HTTPClient) SetBodyField(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal body field %q: %w", key, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodyFields[key] = data
+	return nil
+}
+
+// Authenticate logs in now. Concurrent callers share a single login.
+func (c *HTTPClient) Authenticate(ctx context.Context) error {
+	c.mu.RLock()
+	gen := c.sessionGen
+	c.mu.RUnlock()
+	return c.reauthenticate(ctx, gen)
+}
+
+// HasSession reports whether the last login succeeded and has not expired.
+func (c *HTTPClient) HasSession() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.sessionValid {
+		return false
+	}
+	return c.sessionExpires.IsZero() || time.Now().Before(c.sessionExpires)
+}
+
+// activeSession returns the session to apply to a request, or nil if there is
+// none or the request is part of a login.
+func (c *HTTPClient) activeSession(ctx context.Context) *Session {
+	if ctx.Value(loginCtxKey{}) != nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.session
+}
+
+// ensureSession logs in if there is no valid session or it is about to expire.
+func (c *HTTPClient) ensureSession(ctx context.Context) error {
+	c.mu.RLock()
+	gen, valid, expires := c.sessionGen, c.sessionValid, c.sessionExpires
+	c.mu.RUnlock()
+
+	if valid && (expires.IsZero() || time.Now().Before(expires.Add(-sessionRefreshMargin))) {
+		return nil
+	}
+	return c.reauthenticate(ctx, gen)
+}
+
+// reauthenticate logs in again unless another caller already replaced the
+// session generation seenGen while we waited for the lock, in which case the
+// fresh session is reused.
+func (c *HTTPClient) reauthenticate(ctx context.Context, seenGen uint64) error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	c.mu.RLock()
+	session, gen := c.session, c.sessionGen
+	c.mu.RUnlock()
+	if session == nil {
+		return nil
+	}
+	if gen != seenGen {
+		return nil
+	}
+
+	expires, err := session.Login(context.WithValue(ctx, loginCtxKey{}, true))
+	if obs := observer(); obs != nil {
+		obs.AuthRefresh(InstanceFromContext(ctx), err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.sessionValid = false
+		return err
+	}
+	c.sessionGen++
+	c.sessionValid = true
+	c.sessionExpires = expires
+	return nil
+}
+
+func (s *Session) expired(status int, body []byte) bool {
+	if s.Expired == nil {
+		return status == http.StatusUnauthorized
+	}
+	return s.Expired(status, body)
+}
@@ -0,0 +1,21 @@
+package provider
+
+import (
+	"net/http"
+)
+
+// RequestSigner signs a request for vendors that authenticate every call
+// with a signature, e.g. an HMAC over the method, a body digest, the date and
+// the path. It may set or replace any header. body holds the exact bytes
+// sent, or nil for requests without one.
+//
+// The client calls it before every attempt, so a retried request carries a
+// fresh date and signature.
+type RequestSigner func(req *http.Request, body []byte) error
+
+// SetRequestSigner installs the provider's request signer.
+func (c *HTTPClient) SetRequestSigner(fn RequestSigner) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signer = fn
+}
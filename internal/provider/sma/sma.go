@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
@@ -15,6 +16,8 @@ import (
 const (
 	defaultBaseURL = "https://monitoring.smaapis.de/monitoring/v1"
 	sandboxBaseURL = "https://sandbox.smaapis.de/monitoring/v1"
+	defaultAuthURL = "https://auth.smaapis.de/oauth2/token"
+	sandboxAuthURL = "https://sandbox-auth.smaapis.de/oauth2/token"
 	providerName   = "sma"
 )
 
@@ -25,7 +28,9 @@ func init() {
 }
 
 // SMAProvider implements the Provider interface for SMA Monitoring API.
-// SMA uses OAuth2 Bearer tokens. Their API provides:
+// SMA uses OAuth2 Bearer tokens, renewed with the refresh token or the
+// client credentials grant. A static bearerToken from older configs is
+// still accepted but never renewed. Their API provides:
 //   - /plants — list of solar systems
 //   - /plants/{plantId}/devices — devices in a plant
 //   - /plants/{plantId}/measurements/sets/{setName}/{period} — energy data
@@ -33,13 +38,34 @@ func init() {
 //   - /plants/{plantId}/logs — plant log events
 //   - /devices/{deviceId}/logs — device log events
 type SMAProvider struct {
-	client *provider.HTTPClient
-	config provider.ProviderConfig
-	token  string
+	client     *provider.HTTPClient
+	authClient *provider.HTTPClient // token endpoint, outside the session
+	config     provider.ProviderConfig
+
+	staticToken bool // bearerToken credential in use, no session to renew
+
+	mu           sync.Mutex
+	refreshToken string // latest refresh token; SMA may rotate it
 }
 
 func (p *SMAProvider) Name() string { return providerName }
 
+func (p *SMAProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails),
+		Granularities: []models.Granularity{
+			models.GranularityMinute, models.GranularityHour, models.GranularityDay,
+			models.GranularityMonth, models.GranularityYear,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodWeek, models.PeriodMonth, models.PeriodYear, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricGrid, provider.MetricGridPhases,
+		},
+	}
+}
+
 func (p *SMAProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
 	p.config = cfg
 
@@ -53,17 +79,81 @@ func (p *SMAProvider) Initialize(ctx context.Context, cfg provider.ProviderConfi
 		rps = 5
 	}
 
+	authURL := cfg.GetCredential("authUrl")
+	if authURL == "" {
+		authURL = defaultAuthURL
+		if baseURL == sandboxBaseURL {
+			authURL = sandboxAuthURL
+		}
+	}
+
+	clientID := cfg.GetCredential("clientId")
+	clientSecret := cfg.GetCredential("clientSecret")
+	p.refreshToken = cfg.GetCredential("refreshToken")
+
 	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
+	if clientID == "" || clientSecret == "" {
+		token := cfg.GetCredential("bearerToken")
+		if token == "" {
+			return provider.NewError(provider.ErrAuth, providerName, "Initialize", "credentials clientId and clientSecret are required")
+		}
+		// Configs from before token renewal: the token works until it
+		// expires, after which calls fail with ErrAuth
+		p.client.SetHeader("Authorization", "Bearer "+token)
+		p.staticToken = true
+		log.Warn().Str("provider", providerName).
+			Msg("Using the static bearerToken credential, which is not renewed; set clientId and clientSecret instead")
+		return nil
+	}
+
+	p.authClient = provider.NewHTTPClient(authURL, cfg.TimeoutSeconds, rps)
+	p.client.SetSession(provider.Session{
+		Login: p.authenticate,
+		// Expired tokens get HTTP 401
+	})
 
-	// SMA uses OAuth2 Bearer token
-	p.token = cfg.GetCredential("bearerToken")
-	if p.token == "" {
-		return fmt.Errorf("SMA provider requires 'bearerToken' credential")
+	return p.client.Authenticate(ctx)
+}
+
+// authenticate obtains an access token with the refresh token from the
+// owner's authorization, or with the client credentials grant if there is
+// none.
+func (p *SMAProvider) authenticate(ctx context.Context) (time.Time, error) {
+	p.mu.Lock()
+	refresh := p.refreshToken
+	p.mu.Unlock()
+
+	form := url.Values{
+		"client_id":     {p.config.GetCredential("clientId")},
+		"client_secret": {p.config.GetCredential("clientSecret")},
+	}
+	if refresh != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", refresh)
+	} else {
+		form.Set("grant_type", "client_credentials")
 	}
-	p.client.SetHeader("Authorization", "Bearer "+p.token)
 
-	log.Info().Str("provider", providerName).Msg("Initialized")
-	return nil
+	var resp smaTokenResponse
+	if err := p.authClient.Post(ctx, "", form, &resp); err != nil {
+		return time.Time{}, fmt.Errorf("SMA auth (%s): %w", form.Get("grant_type"), err)
+	}
+	if resp.AccessToken == "" {
+		return time.Time{}, provider.NewError(provider.ErrAuth, providerName, "auth", "token response without access_token")
+	}
+
+	if resp.RefreshToken != "" {
+		p.mu.Lock()
+		p.refreshToken = resp.RefreshToken
+		p.mu.Unlock()
+	}
+
+	p.client.SetHeader("Authorization", "Bearer "+resp.AccessToken)
+	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
+	if resp.ExpiresIn <= 0 {
+		return time.Time{}, nil
+	}
+	return time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second), nil
 }
 
 // ── Plants ──
@@ -109,7 +199,7 @@ func (p *SMAProvider) GetDevices(ctx context.Context, plantID string) ([]models.
 
 func (p *SMAProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
 	// SMA doesn't have a dedicated single-device endpoint; info is within plant devices
-	return nil, fmt.Errorf("SMA: use GetDevices with plantID to retrieve device details")
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
 }
 
 // ── Real-Time Data ──
@@ -211,7 +301,7 @@ func (p *SMAProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlar
 }
 
 func (p *SMAProvider) Healthy(ctx context.Context) bool {
-	return p.token != ""
+	return p.staticToken || p.client.HasSession()
 }
 
 func (p *SMAProvider) Close() error {
@@ -222,6 +312,12 @@ func (p *SMAProvider) Close() error {
 // SMA raw API response types
 // ══════════════════════════════════════════════════════════════════
 
+type smaTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // seconds
+}
+
 type smaPlantListResponse struct {
 	Plants []smaPlant `json:"plants"`
 }
@@ -0,0 +1,134 @@
+package sma
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// fakeSMA stands in for the SMA token endpoint (/token) and the monitoring
+// API. Each token grant issues a new access token; /plants accepts only the
+// current one.
+type fakeSMA struct {
+	t *testing.T
+
+	mu     sync.Mutex
+	grants []string // grant_type of each token request
+	token  string
+}
+
+func (f *fakeSMA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/token":
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("client_id") != "client" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.grants = append(f.grants, r.PostForm.Get("grant_type"))
+		f.token = fmt.Sprintf("access-%d", len(f.grants))
+		fmt.Fprintf(w, `{"access_token":%q,"refresh_token":"refresh-%d","expires_in":3600}`, f.token, len(f.grants))
+
+	case "/plants":
+		if r.Header.Get("Authorization") != "Bearer "+f.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"plants":[{"plantId":"7190","name":"Barn"}]}`)
+
+	default:
+		f.t.Errorf("unexpected call %s", r.URL.Path)
+		http.NotFound(w, r)
+	}
+}
+
+// accept makes the server accept only the given access token.
+func (f *fakeSMA) accept(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token = token
+}
+
+func (f *fakeSMA) tokenGrants() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.grants...)
+}
+
+func newTestProvider(t *testing.T, creds map[string]string) (*SMAProvider, *fakeSMA, error) {
+	t.Helper()
+	api := &fakeSMA{t: t}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	creds["authUrl"] = srv.URL + "/token"
+	p := &SMAProvider{}
+	err := p.Initialize(context.Background(), provider.ProviderConfig{
+		Name:         "sma-test",
+		BaseURL:      srv.URL,
+		Credentials:  creds,
+		RateLimitRPS: 1000,
+	})
+	return p, api, err
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	p, api, err := newTestProvider(t, map[string]string{
+		"clientId": "client", "clientSecret": "secret", "refreshToken": "refresh-0",
+	})
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	plants, err := p.GetPlants(context.Background())
+	if err != nil || len(plants) != 1 {
+		t.Fatalf("GetPlants = %+v, %v", plants, err)
+	}
+	if grants := api.tokenGrants(); len(grants) != 1 || grants[0] != "refresh_token" {
+		t.Errorf("grants = %v", grants)
+	}
+	if p.refreshToken != "refresh-1" {
+		t.Errorf("rotated refresh token not kept: %q", p.refreshToken)
+	}
+	if !p.Healthy(context.Background()) {
+		t.Error("provider unhealthy with a session")
+	}
+}
+
+func TestStaticBearerToken(t *testing.T) {
+	p, api, err := newTestProvider(t, map[string]string{"bearerToken": "legacy"})
+	if err != nil {
+		t.Fatalf("Initialize with bearerToken: %v", err)
+	}
+	api.accept("legacy")
+	if _, err := p.GetPlants(context.Background()); err != nil {
+		t.Fatalf("GetPlants: %v", err)
+	}
+	if grants := api.tokenGrants(); len(grants) != 0 {
+		t.Errorf("token requested for a static token: %v", grants)
+	}
+	if !p.Healthy(context.Background()) {
+		t.Error("provider unhealthy with a static token")
+	}
+
+	// Expired, it is not renewed
+	api.accept("other")
+	if _, err := p.GetPlants(context.Background()); !errors.Is(err, provider.ErrAuth) {
+		t.Errorf("GetPlants with an expired static token = %v, want ErrAuth", err)
+	}
+}
+
+func TestMissingCredentials(t *testing.T) {
+	_, _, err := newTestProvider(t, map[string]string{"clientId": "client"})
+	if !errors.Is(err, provider.ErrAuth) {
+		t.Errorf("Initialize without clientSecret or bearerToken = %v, want ErrAuth", err)
+	}
+}
@@ -0,0 +1,959 @@
+package solaredge
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultBaseURL = "https://monitoringapi.solaredge.com"
+	providerName   = "solaredge"
+
+	// SolarEdge allows 300 calls per day for the account and for each site
+	defaultDailyQuota = 300
+
+	solaredgeTimeLayout = "2006-01-02 15:04:05"
+
+	// The power flow is shared by every inverter of a site and refreshed
+	// with the telemetry, every 5 minutes
+	powerFlowMaxAge = 5 * time.Minute
+)
+
+func init() {
+	provider.Register(providerName, func() provider.Provider {
+		return &SolarEdgeProvider{}
+	})
+}
+
+// SolarEdgeProvider implements the Provider interface for the SolarEdge
+// Monitoring API. Every call carries the account or site API key as the
+// api_key query parameter.
+// Key endpoints:
+//   - /sites/list, /site/{id}/details — plants
+//   - /site/{id}/inventory — inverters, meters, batteries, gateways, optimizers
+//   - /site/{id}/currentPowerFlow — site power flow (grid, load, storage)
+//   - /site/{id}/energyDetails — energy per meter
+//   - /equipment/{id}/{sn}/data — inverter telemetry
+//
+// Calls for a site are charged to the site's daily quota, account-wide calls
+// to the account's. Device IDs are "<siteId>-<serial>", since equipment data
+// is addressed by both.
+type SolarEdgeProvider struct {
+	client *provider.HTTPClient
+	config provider.ProviderConfig
+	apiKey string
+	loc    *time.Location // site-local times are read in this zone
+	quota  *provider.Quota
+
+	mu    sync.Mutex
+	kinds map[string]string // device ID → inventory group
+
+	flowMu      sync.Mutex
+	flows       map[string]solaredgeFlowEntry // site ID → latest power flow
+	flowFetches singleflight.Group            // power flow fetches in flight, by site ID
+}
+
+type solaredgeFlowEntry struct {
+	flow    solaredgePowerFlow
+	err     error
+	fetched time.Time
+}
+
+func (p *SolarEdgeProvider) Name() string { return providerName }
+
+func (p *SolarEdgeProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		// The Monitoring API exposes no alarms
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails, provider.OpGetAlarms, provider.OpGetAllAlarms),
+		Granularities: []models.Granularity{
+			models.GranularityMinute,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodWeek, models.PeriodMonth, models.PeriodYear,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricBattery, provider.MetricGrid, provider.MetricGridPhases,
+			provider.MetricLoad, provider.MetricEnvironment,
+		},
+		// equipment data serves at most a week per call
+		HistoryWindows: map[models.Granularity]provider.Window{
+			models.GranularityMinute: {Days: 7},
+		},
+	}
+}
+
+func (p *SolarEdgeProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
+	p.config = cfg
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	// SolarEdge allows 3 concurrent calls per source IP
+	rps := cfg.RateLimitRPS
+	if rps <= 0 {
+		rps = 3
+	}
+
+	quota := cfg.DailyQuota
+	if quota <= 0 {
+		quota = defaultDailyQuota
+	}
+
+	p.loc = time.UTC
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("SolarEdge: timezone: %w", err)
+		}
+		p.loc = loc
+	}
+
+	p.apiKey = cfg.GetCredential("apiKey")
+	if p.apiKey == "" {
+		return provider.NewError(provider.ErrAuth, providerName, "auth", "credential apiKey is required")
+	}
+
+	p.kinds = make(map[string]string)
+	p.flows = make(map[string]solaredgeFlowEntry)
+
+	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
+	p.client.SetHeader("Accept", "application/json")
+	// The quota resets at midnight in the site's timezone
+	p.quota = provider.NewQuota(quota, p.loc)
+	p.client.SetQuota(p.quota)
+
+	// API keys do not expire; listing one site validates the key
+	var resp solaredgeSiteListResponse
+	if err := p.client.Get(ctx, "/sites/list", p.params(url.Values{"size": {"1"}}), &resp); err != nil {
+		return fmt.Errorf("SolarEdge auth: %w", err)
+	}
+
+	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
+	return nil
+}
+
+// Quota returns the daily call budget shared by all calls of the instance.
+func (p *SolarEdgeProvider) Quota() *provider.Quota { return p.quota }
+
+// RealtimeCost returns the calls GetRealTimeData for deviceIDs costs per
+// site: one per inverter, plus the site's power flow. Devices of unknown kind
+// are counted as inverters.
+func (p *SolarEdgeProvider) RealtimeCost(deviceIDs []string) map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cost := make(map[string]int)
+	for _, deviceID := range deviceIDs {
+		siteID, _, err := splitSolarEdgeDeviceID("RealtimeCost", deviceID)
+		if err != nil {
+			continue
+		}
+		if kind, ok := p.kinds[deviceID]; ok && kind != "inverter" {
+			continue
+		}
+		if cost[siteID] == 0 {
+			cost[siteID] = 1 // power flow
+		}
+		cost[siteID]++
+	}
+	return cost
+}
+
+// params adds the API key to a call's query parameters.
+func (p *SolarEdgeProvider) params(v url.Values) url.Values {
+	if v == nil {
+		v = url.Values{}
+	}
+	v.Set("api_key", p.apiKey)
+	return v
+}
+
+// ── Plants ──
+
+func (p *SolarEdgeProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
+	var plants []models.NormalizedPlant
+	for {
+		params := p.params(url.Values{
+			"size":       {"100"},
+			"startIndex": {strconv.Itoa(len(plants))},
+		})
+
+		var resp solaredgeSiteListResponse
+		if err := p.client.Get(ctx, "/sites/list", params, &resp); err != nil {
+			return nil, fmt.Errorf("SolarEdge GetPlants: %w", err)
+		}
+
+		for _, raw := range resp.Sites.Site {
+			plants = append(plants, normalizeSolarEdgePlant(raw))
+		}
+		if len(resp.Sites.Site) == 0 || len(plants) >= resp.Sites.Count {
+			break
+		}
+	}
+	return plants, nil
+}
+
+func (p *SolarEdgeProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
+	ctx = provider.WithQuotaKey(ctx, plantID)
+
+	var resp solaredgeSiteDetailsResponse
+	if err := p.client.Get(ctx, fmt.Sprintf("/site/%s/details", plantID), p.params(nil), &resp); err != nil {
+		return nil, fmt.Errorf("SolarEdge GetPlantDetails: %w", err)
+	}
+
+	plant := normalizeSolarEdgePlant(resp.Details)
+	plant.Meta.RawDataAvailable = true
+	return &plant, nil
+}
+
+// ── Devices ──
+
+func (p *SolarEdgeProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
+	ctx = provider.WithQuotaKey(ctx, plantID)
+
+	var resp solaredgeInventoryResponse
+	if err := p.client.Get(ctx, fmt.Sprintf("/site/%s/inventory", plantID), p.params(nil), &resp); err != nil {
+		return nil, fmt.Errorf("SolarEdge GetDevices: %w", err)
+	}
+
+	inv := resp.Inventory
+	var devices []models.NormalizedDevice
+	for _, group := range []struct {
+		list       []solaredgeEquipment
+		kind       string
+		deviceType models.DeviceType
+	}{
+		{inv.Inverters, "inverter", models.DeviceTypeStringInverter},
+		{inv.Meters, "meter", models.DeviceTypeMeter},
+		{inv.Batteries, "battery", models.DeviceTypeBattery},
+		{inv.Gateways, "gateway", models.DeviceTypeGateway},
+		{inv.Optimizers, "optimizer", models.DeviceTypeOptimizer},
+	} {
+		for _, raw := range group.list {
+			devices = append(devices, normalizeSolarEdgeDevice(raw, plantID, group.kind, group.deviceType))
+		}
+	}
+
+	p.mu.Lock()
+	for _, dev := range devices {
+		p.kinds[dev.Meta.ProviderDeviceID] = dev.Meta.Extra["deviceType"]
+	}
+	p.mu.Unlock()
+	return devices, nil
+}
+
+// deviceKind returns the inventory group of a device, listing its site's
+// inventory if it has not been seen yet.
+func (p *SolarEdgeProvider) deviceKind(ctx context.Context, op, deviceID string) (string, error) {
+	p.mu.Lock()
+	kind, ok := p.kinds[deviceID]
+	p.mu.Unlock()
+	if ok {
+		return kind, nil
+	}
+
+	siteID, _, err := splitSolarEdgeDeviceID(op, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.GetDevices(ctx, siteID); err != nil {
+		return "", err
+	}
+	p.mu.Lock()
+	kind, ok = p.kinds[deviceID]
+	p.mu.Unlock()
+	if !ok {
+		return "", provider.NewError(provider.ErrNotFound, providerName, op, "unknown device "+deviceID)
+	}
+	return kind, nil
+}
+
+func (p *SolarEdgeProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
+	// Details come with the site inventory
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
+}
+
+// ── Real-Time Data ──
+
+// GetRealTimeData combines the inverter's latest telemetry with the site's
+// power flow. Each inverter costs one call against the site's quota; the
+// power flow is fetched once for all inverters of a site.
+func (p *SolarEdgeProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	siteID, serial, err := splitSolarEdgeDeviceID("GetRealTimeData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = provider.WithQuotaKey(ctx, siteID)
+
+	// Only inverters have equipment data
+	kind, err := p.deviceKind(ctx, "GetRealTimeData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "inverter" {
+		return nil, provider.NotSupported(providerName, provider.OpGetRealTimeData, "device type "+kind)
+	}
+
+	// Telemetry is reported every 5 minutes and may lag by as much again
+	now := time.Now().In(p.loc)
+	telemetries, err := p.equipmentData(ctx, siteID, serial, now.Add(-time.Hour), now)
+	if err != nil {
+		return nil, fmt.Errorf("SolarEdge GetRealTimeData: %w", err)
+	}
+	if len(telemetries) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, "GetRealTimeData", "no recent telemetry for device "+deviceID)
+	}
+
+	flow, flowErr := p.powerFlow(ctx, siteID)
+	if flowErr != nil {
+		log.Debug().Err(flowErr).Str("siteId", siteID).Msg("SolarEdge power flow unavailable")
+	}
+
+	rt := normalizeSolarEdgeRealtime(telemetries[len(telemetries)-1], deviceID, p.loc)
+	if flowErr == nil {
+		applySolarEdgePowerFlow(&rt, flow)
+	}
+	return &rt, nil
+}
+
+// powerFlow returns the site's current power flow, fetching it at most once
+// per powerFlowMaxAge. Failures are kept as long, so a site whose flow is
+// unavailable does not cost a call for every inverter.
+func (p *SolarEdgeProvider) powerFlow(ctx context.Context, siteID string) (solaredgePowerFlow, error) {
+	p.flowMu.Lock()
+	e, ok := p.flows[siteID]
+	p.flowMu.Unlock()
+	if ok && time.Since(e.fetched) < powerFlowMaxAge {
+		return e.flow, e.err
+	}
+
+	// Inverters of the same site share one fetch, which outlives the
+	// caller that started it; other sites are not held up
+	ch := p.flowFetches.DoChan(siteID, func() (interface{}, error) {
+		var resp solaredgePowerFlowResponse
+		err := p.client.Get(context.WithoutCancel(ctx), fmt.Sprintf("/site/%s/currentPowerFlow", siteID), p.params(nil), &resp)
+
+		p.flowMu.Lock()
+		p.flows[siteID] = solaredgeFlowEntry{flow: resp.SiteCurrentPowerFlow, err: err, fetched: time.Now()}
+		p.flowMu.Unlock()
+		return resp.SiteCurrentPowerFlow, err
+	})
+	select {
+	case res := <-ch:
+		flow, _ := res.Val.(solaredgePowerFlow)
+		return flow, res.Err
+	case <-ctx.Done():
+		return solaredgePowerFlow{}, ctx.Err()
+	}
+}
+
+func (p *SolarEdgeProvider) equipmentData(ctx context.Context, siteID, serial string, from, to time.Time) ([]solaredgeTelemetry, error) {
+	params := p.params(url.Values{
+		"startTime": {from.In(p.loc).Format(solaredgeTimeLayout)},
+		"endTime":   {to.In(p.loc).Format(solaredgeTimeLayout)},
+	})
+
+	var resp solaredgeEquipmentDataResponse
+	if err := p.client.Get(ctx, fmt.Sprintf("/equipment/%s/%s/data", siteID, serial), params, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data.Telemetries, nil
+}
+
+// ── Energy Stats ──
+
+func (p *SolarEdgeProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
+	ctx = provider.WithQuotaKey(ctx, plantID)
+
+	now := time.Now().In(p.loc)
+	start, timeUnit, ok := solaredgePeriod(now, period)
+	if !ok {
+		return nil, provider.NotSupported(providerName, provider.OpGetEnergyStats, "period "+string(period))
+	}
+
+	params := p.params(url.Values{
+		"meters":    {"PRODUCTION,CONSUMPTION,SELFCONSUMPTION,FEEDIN,PURCHASED"},
+		"timeUnit":  {timeUnit},
+		"startTime": {start.Format(solaredgeTimeLayout)},
+		"endTime":   {now.Format(solaredgeTimeLayout)},
+	})
+
+	var resp solaredgeEnergyDetailsResponse
+	if err := p.client.Get(ctx, fmt.Sprintf("/site/%s/energyDetails", plantID), params, &resp); err != nil {
+		return nil, fmt.Errorf("SolarEdge GetEnergyStats: %w", err)
+	}
+
+	energy := normalizeSolarEdgeEnergy(resp.EnergyDetails, plantID, period, start, now)
+	return &energy, nil
+}
+
+// ── Historical Data ──
+
+func (p *SolarEdgeProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
+	if req.Granularity != models.GranularityMinute {
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "granularity "+string(req.Granularity))
+	}
+	siteID, serial, err := splitSolarEdgeDeviceID("GetHistoricalData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	ctx = provider.WithQuotaKey(ctx, siteID)
+	kind, err := p.deviceKind(ctx, "GetHistoricalData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "inverter" {
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "device type "+kind)
+	}
+	from, err := p.parseTime(req.StartTime)
+	if err != nil {
+		return nil, provider.NewError(provider.ErrInvalidRequest, providerName, "GetHistoricalData", "invalid start time: "+err.Error())
+	}
+	to, err := p.parseTime(req.EndTime)
+	if err != nil {
+		return nil, provider.NewError(provider.ErrInvalidRequest, providerName, "GetHistoricalData", "invalid end time: "+err.Error())
+	}
+
+	telemetries, err := p.equipmentData(ctx, siteID, serial, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("SolarEdge GetHistoricalData: %w", err)
+	}
+
+	history := normalizeSolarEdgeHistory(telemetries, deviceID, req, p.loc)
+	return &history, nil
+}
+
+// parseTime reads an RFC 3339 time, or a site-local one without a zone.
+func (p *SolarEdgeProvider) parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(solaredgeTimeLayout, s, p.loc)
+}
+
+// ── Alarms ──
+
+func (p *SolarEdgeProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
+	return nil, provider.NotSupported(providerName, provider.OpGetAlarms, "")
+}
+
+func (p *SolarEdgeProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
+	return nil, provider.NotSupported(providerName, provider.OpGetAllAlarms, "")
+}
+
+func (p *SolarEdgeProvider) Healthy(ctx context.Context) bool {
+	return p.apiKey != ""
+}
+
+func (p *SolarEdgeProvider) Close() error {
+	return nil
+}
+
+// ══════════════════════════════════════════════════════════════════
+// SolarEdge raw response types
+// ══════════════════════════════════════════════════════════════════
+
+type solaredgeSiteListResponse struct {
+	Sites struct {
+		Count int             `json:"count"`
+		Site  []solaredgeSite `json:"site"`
+	} `json:"sites"`
+}
+
+type solaredgeSiteDetailsResponse struct {
+	Details solaredgeSite `json:"details"`
+}
+
+type solaredgeSite struct {
+	ID               int64   `json:"id"`
+	Name             string  `json:"name"`
+	Status           string  `json:"status"`
+	PeakPower        float64 `json:"peakPower"` // kWp
+	Currency         string  `json:"currency"`
+	InstallationDate string  `json:"installationDate"`
+	Type             string  `json:"type"`
+	Location         struct {
+		Country  string `json:"country"`
+		City     string `json:"city"`
+		Address  string `json:"address"`
+		Zip      string `json:"zip"`
+		TimeZone string `json:"timeZone"`
+	} `json:"location"`
+}
+
+type solaredgeInventoryResponse struct {
+	Inventory struct {
+		Inverters  []solaredgeEquipment `json:"inverters"`
+		Meters     []solaredgeEquipment `json:"meters"`
+		Batteries  []solaredgeEquipment `json:"batteries"`
+		Gateways   []solaredgeEquipment `json:"gateways"`
+		Optimizers []solaredgeEquipment `json:"optimizers"`
+	} `json:"Inventory"`
+}
+
+type solaredgeEquipment struct {
+	Name              string  `json:"name"`
+	Manufacturer      string  `json:"manufacturer"`
+	Model             string  `json:"model"`
+	SN                string  `json:"SN"`
+	SerialNumber      string  `json:"serialNumber"` // some meters report this instead of SN
+	FirmwareVersion   string  `json:"firmwareVersion"`
+	CPUVersion        string  `json:"cpuVersion"`
+	NameplateCapacity float64 `json:"nameplateCapacity"` // batteries, Wh
+	ConnectedTo       string  `json:"connectedSolaredgeDeviceSN"`
+}
+
+type solaredgePowerFlowResponse struct {
+	SiteCurrentPowerFlow solaredgePowerFlow `json:"siteCurrentPowerFlow"`
+}
+
+type solaredgePowerFlow struct {
+	Unit        string `json:"unit"` // "kW" or "W"
+	Connections []struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"connections"`
+	Grid    *solaredgeFlowNode `json:"GRID"`
+	Load    *solaredgeFlowNode `json:"LOAD"`
+	PV      *solaredgeFlowNode `json:"PV"`
+	Storage *solaredgeFlowNode `json:"STORAGE"`
+}
+
+type solaredgeFlowNode struct {
+	Status       string   `json:"status"` // "Active", "Idle", "Charging", "Discharging", …
+	CurrentPower float64  `json:"currentPower"`
+	ChargeLevel  *float64 `json:"chargeLevel"` // storage SOC %
+}
+
+type solaredgeEnergyDetailsResponse struct {
+	EnergyDetails solaredgeEnergyDetails `json:"energyDetails"`
+}
+
+type solaredgeEnergyDetails struct {
+	TimeUnit string `json:"timeUnit"`
+	Unit     string `json:"unit"` // "Wh"
+	Meters   []struct {
+		Type   string `json:"type"` // Production, Consumption, SelfConsumption, FeedIn, Purchased
+		Values []struct {
+			Date  string   `json:"date"`
+			Value *float64 `json:"value"`
+		} `json:"values"`
+	} `json:"meters"`
+}
+
+type solaredgeEquipmentDataResponse struct {
+	Data struct {
+		Count       int                  `json:"count"`
+		Telemetries []solaredgeTelemetry `json:"telemetries"`
+	} `json:"data"`
+}
+
+type solaredgeTelemetry struct {
+	Date                  string              `json:"date"`
+	TotalActivePower      *float64            `json:"totalActivePower"` // W
+	DCVoltage             *float64            `json:"dcVoltage"`
+	GroundFaultResistance *float64            `json:"groundFaultResistance"`
+	PowerLimit            *float64            `json:"powerLimit"`  // %
+	TotalEnergy           *float64            `json:"totalEnergy"` // Wh, lifetime
+	Temperature           *float64            `json:"temperature"` // °C
+	InverterMode          string              `json:"inverterMode"`
+	L1Data                *solaredgePhaseData `json:"L1Data"`
+	L2Data                *solaredgePhaseData `json:"L2Data"`
+	L3Data                *solaredgePhaseData `json:"L3Data"`
+}
+
+type solaredgePhaseData struct {
+	ACCurrent     *float64 `json:"acCurrent"`
+	ACVoltage     *float64 `json:"acVoltage"`
+	ACFrequency   *float64 `json:"acFrequency"`
+	ApparentPower *float64 `json:"apparentPower"`
+	ActivePower   *float64 `json:"activePower"`
+	ReactivePower *float64 `json:"reactivePower"`
+	CosPhi        *float64 `json:"cosPhi"`
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Normalization functions
+// ══════════════════════════════════════════════════════════════════
+
+func normalizeSolarEdgePlant(raw solaredgeSite) models.NormalizedPlant {
+	siteID := strconv.FormatInt(raw.ID, 10)
+	plant := models.NormalizedPlant{
+		ID:        fmt.Sprintf("%s_%s", providerName, siteID),
+		Provider:  providerName,
+		Name:      raw.Name,
+		Timezone:  raw.Location.TimeZone,
+		Address:   strings.TrimSpace(strings.Join([]string{raw.Location.Address, raw.Location.Zip, raw.Location.City}, " ")),
+		Country:   raw.Location.Country,
+		Currency:  raw.Currency,
+		PlantType: models.PlantTypeUnknown,
+		Meta: models.ProviderMeta{
+			Provider:        providerName,
+			ProviderPlantID: siteID,
+			FetchedAt:       time.Now().UTC(),
+			Extra:           map[string]string{},
+		},
+	}
+	if raw.Status != "" {
+		plant.Meta.Extra["status"] = raw.Status // "Active", "Pending", "Disabled"
+	}
+	if raw.InstallationDate != "" {
+		plant.Meta.Extra["installationDate"] = raw.InstallationDate
+	}
+	if raw.PeakPower > 0 {
+		peak := raw.PeakPower
+		plant.PeakPowerKWp = &peak
+	}
+	return plant
+}
+
+func normalizeSolarEdgeDevice(raw solaredgeEquipment, plantID, kind string, deviceType models.DeviceType) models.NormalizedDevice {
+	serial := raw.SN
+	if serial == "" {
+		serial = raw.SerialNumber
+	}
+	rawID := solarEdgeDeviceID(plantID, serial)
+	manufacturer := raw.Manufacturer
+	if manufacturer == "" {
+		manufacturer = "SolarEdge"
+	}
+
+	dev := models.NormalizedDevice{
+		ID:           fmt.Sprintf("%s_%s", providerName, rawID),
+		Provider:     providerName,
+		PlantID:      fmt.Sprintf("%s_%s", providerName, plantID),
+		Name:         raw.Name,
+		SerialNumber: serial,
+		Model:        raw.Model,
+		DeviceType:   deviceType,
+		Manufacturer: manufacturer,
+		// The inventory does not report device state
+		Status: models.DeviceStatusUnknown,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: rawID,
+			ProviderPlantID:  plantID,
+			FetchedAt:        time.Now().UTC(),
+			Extra: map[string]string{
+				"deviceType": kind,
+			},
+		},
+	}
+	if raw.FirmwareVersion != "" || raw.CPUVersion != "" {
+		dev.FirmwareInfo = &models.FirmwareInfo{MainVersion: raw.CPUVersion, DisplayVersion: raw.FirmwareVersion}
+	}
+	if raw.ConnectedTo != "" {
+		dev.Meta.Extra["connectedTo"] = raw.ConnectedTo
+	}
+	if deviceType == models.DeviceTypeBattery {
+		dev.BatteryInfo = &models.DeviceBatteryInfo{Count: 1, SerialNumbers: []string{serial}}
+		if raw.NameplateCapacity > 0 {
+			dev.BatteryInfo.CapacityUnit = "kWh"
+			dev.Meta.Extra["capacityKWh"] = strconv.FormatFloat(raw.NameplateCapacity/1000, 'f', -1, 64)
+		}
+	}
+	return dev
+}
+
+func normalizeSolarEdgeRealtime(t solaredgeTelemetry, deviceID string, loc *time.Location) models.NormalizedRealtime {
+	now := time.Now().UTC()
+	status, mode := solaredgeInverterMode(t.InverterMode)
+
+	rt := models.NormalizedRealtime{
+		DeviceID:          fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:          providerName,
+		Timestamp:         now,
+		OriginalTimestamp: t.Date,
+		OriginalTimezone:  loc.String(),
+		Status:            status,
+		OperatingMode:     mode,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: deviceID,
+			RawDataAvailable: true,
+			FetchedAt:        now,
+		},
+	}
+	if ts, err := time.ParseInLocation(solaredgeTimeLayout, t.Date, loc); err == nil {
+		rt.Timestamp = ts.UTC()
+	}
+
+	// Equipment data has no DC power; the AC output is the closest measure
+	acPower := deref(t.TotalActivePower)
+	rt.PV = &models.PVData{
+		TotalPowerW:    acPower,
+		TotalEnergyKWh: whToKWh(t.TotalEnergy),
+	}
+
+	phases := solaredgePhases(t)
+	var freq *float64
+	if len(phases) > 0 {
+		freq = phases[0].FrequencyHz
+	}
+	// Until the power flow says otherwise, the inverter output is exported
+	rt.Grid = &models.GridData{
+		TotalPowerW: -acPower,
+		Direction:   solaredgeGridDirection(-acPower),
+		FrequencyHz: freq,
+		Phases:      phases,
+	}
+
+	if t.Temperature != nil {
+		rt.Environment = &models.EnvironmentData{InverterTemperatureC: t.Temperature}
+	}
+
+	return rt
+}
+
+// applySolarEdgePowerFlow replaces the grid power with the site's meter
+// readings and adds load and storage.
+func applySolarEdgePowerFlow(rt *models.NormalizedRealtime, flow solaredgePowerFlow) {
+	scale := 1000.0 // kW
+	if strings.EqualFold(flow.Unit, "W") {
+		scale = 1
+	}
+	flows := make(map[string]bool, len(flow.Connections))
+	for _, c := range flow.Connections {
+		flows[strings.ToUpper(c.From)+">"+strings.ToUpper(c.To)] = true
+	}
+
+	if flow.Grid != nil {
+		power := flow.Grid.CurrentPower * scale
+		if flows["LOAD>GRID"] || flows["PV>GRID"] || flows["STORAGE>GRID"] {
+			power = -power
+		}
+		rt.Grid.TotalPowerW = power
+		rt.Grid.Direction = solaredgeGridDirection(power)
+	}
+	if flow.Load != nil {
+		rt.Load = &models.LoadData{TotalPowerW: flow.Load.CurrentPower * scale}
+	}
+	if flow.Storage != nil {
+		power := flow.Storage.CurrentPower * scale
+		if flows["STORAGE>LOAD"] || flows["STORAGE>GRID"] || strings.EqualFold(flow.Storage.Status, "Discharging") {
+			power = -power
+		}
+		rt.Battery = &models.BatteryData{
+			SOCPercent: flow.Storage.ChargeLevel,
+			PowerW:     power,
+			Direction:  solaredgeBatteryDirection(power),
+		}
+	}
+}
+
+func normalizeSolarEdgeEnergy(details solaredgeEnergyDetails, plantID string, period models.Period, start, end time.Time) models.NormalizedEnergy {
+	energy := models.NormalizedEnergy{
+		ID:          fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:    providerName,
+		Period:      period,
+		Timestamp:   time.Now().UTC(),
+		PeriodStart: start.UTC(),
+		PeriodEnd:   end.UTC(),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	scale := 0.001 // Wh
+	if strings.EqualFold(details.Unit, "kWh") {
+		scale = 1
+	}
+	for _, meter := range details.Meters {
+		var total *float64
+		for _, v := range meter.Values {
+			if v.Value == nil {
+				continue
+			}
+			sum := deref(total) + *v.Value*scale
+			total = &sum
+		}
+		switch strings.ToLower(meter.Type) {
+		case "production":
+			energy.PVGenerationKWh = total
+		case "consumption":
+			energy.LoadConsumptionKWh = total
+		case "selfconsumption":
+			energy.SelfConsumptionKWh = total
+		case "feedin":
+			energy.GridExportKWh = total
+		case "purchased":
+			energy.GridImportKWh = total
+		}
+	}
+
+	if energy.SelfConsumptionKWh != nil && energy.PVGenerationKWh != nil && *energy.PVGenerationKWh > 0 {
+		rate := *energy.SelfConsumptionKWh / *energy.PVGenerationKWh
+		energy.SelfConsumptionRate = &rate
+	}
+	if energy.SelfConsumptionKWh != nil && energy.LoadConsumptionKWh != nil && *energy.LoadConsumptionKWh > 0 {
+		rate := *energy.SelfConsumptionKWh / *energy.LoadConsumptionKWh
+		energy.SelfSufficiencyRate = &rate
+	}
+
+	return energy
+}
+
+func normalizeSolarEdgeHistory(telemetries []solaredgeTelemetry, deviceID string, req models.HistoryRequest, loc *time.Location) models.HistoryResponse {
+	result := models.HistoryResponse{
+		DeviceID:    fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:    providerName,
+		Granularity: req.Granularity,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+	}
+
+	for _, t := range telemetries {
+		ts, err := time.ParseInLocation(solaredgeTimeLayout, t.Date, loc)
+		if err != nil {
+			continue
+		}
+		dp := models.NormalizedTimeSeries{
+			DeviceID:       result.DeviceID,
+			Provider:       providerName,
+			Timestamp:      ts.UTC(),
+			Granularity:    req.Granularity,
+			PVPowerW:       t.TotalActivePower,
+			InverterPhases: solaredgePhases(t),
+			Meta: models.ProviderMeta{
+				Provider:         providerName,
+				ProviderDeviceID: deviceID,
+				FetchedAt:        time.Now().UTC(),
+			},
+		}
+		result.DataPoints = append(result.DataPoints, dp)
+	}
+
+	result.TotalPoints = len(result.DataPoints)
+	return result
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Mapping helpers
+// ══════════════════════════════════════════════════════════════════
+
+func solarEdgeDeviceID(siteID, serial string) string {
+	return siteID + "-" + serial
+}
+
+// splitSolarEdgeDeviceID splits "<siteId>-<serial>"; site IDs are numeric,
+// serials may contain dashes.
+func splitSolarEdgeDeviceID(op, deviceID string) (siteID, serial string, err error) {
+	siteID, serial, ok := strings.Cut(deviceID, "-")
+	if !ok || siteID == "" || serial == "" {
+		return "", "", provider.NewError(provider.ErrInvalidRequest, providerName, op,
+			fmt.Sprintf("device ID %q is not of the form <siteId>-<serial>", deviceID))
+	}
+	return siteID, serial, nil
+}
+
+// solaredgePeriod returns the start of period and the energyDetails time
+// unit that sums it in a few values.
+func solaredgePeriod(now time.Time, period models.Period) (time.Time, string, bool) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch period {
+	case models.PeriodDay:
+		return today, "DAY", true
+	case models.PeriodWeek:
+		offset := (int(today.Weekday()) + 6) % 7 // weeks start on Monday
+		return today.AddDate(0, 0, -offset), "DAY", true
+	case models.PeriodMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location()), "MONTH", true
+	case models.PeriodYear:
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, now.Location()), "YEAR", true
+	default:
+		return time.Time{}, "", false
+	}
+}
+
+func solaredgePhases(t solaredgeTelemetry) []models.PhaseData {
+	var phases []models.PhaseData
+	for _, ph := range []struct {
+		data  *solaredgePhaseData
+		phase string
+	}{{t.L1Data, "A"}, {t.L2Data, "B"}, {t.L3Data, "C"}} {
+		if ph.data == nil {
+			continue
+		}
+		phases = append(phases, models.PhaseData{
+			Phase:            ph.phase,
+			VoltageV:         ph.data.ACVoltage,
+			CurrentA:         ph.data.ACCurrent,
+			PowerW:           ph.data.ActivePower,
+			FrequencyHz:      ph.data.ACFrequency,
+			PowerFactor:      ph.data.CosPhi,
+			ApparentPowerVA:  ph.data.ApparentPower,
+			ReactivePowerVAR: ph.data.ReactivePower,
+		})
+	}
+	return phases
+}
+
+// solaredgeInverterMode maps the telemetry inverterMode.
+func solaredgeInverterMode(mode string) (models.DeviceStatus, models.OperatingMode) {
+	switch {
+	case mode == "MPPT" || mode == "THROTTLED":
+		return models.DeviceStatusNormal, models.OperatingModeGridConnected
+	case mode == "STARTING":
+		return models.DeviceStatusNormal, models.OperatingModeInitializing
+	case mode == "SLEEPING" || mode == "STANDBY":
+		return models.DeviceStatusStandby, models.OperatingModeStandby
+	case mode == "OFF" || mode == "SHUTTING_DOWN":
+		return models.DeviceStatusStandby, models.OperatingModeShutdown
+	case mode == "FAULT":
+		return models.DeviceStatusFault, models.OperatingModeFault
+	case strings.HasPrefix(mode, "LOCKED"):
+		// e.g. LOCKED_INV_ARC_DETECTED, LOCKED_FIRE_FIGHTERS
+		return models.DeviceStatusWarning, models.OperatingModeShutdown
+	default:
+		return models.DeviceStatusUnknown, models.OperatingModeUnknown
+	}
+}
+
+func solaredgeGridDirection(power float64) models.GridDirection {
+	if power > 0 {
+		return models.GridDirectionImporting
+	} else if power < 0 {
+		return models.GridDirectionExporting
+	}
+	return models.GridDirectionIdle
+}
+
+func solaredgeBatteryDirection(power float64) models.EnergyDirection {
+	if power > 0 {
+		return models.DirectionCharging
+	} else if power < 0 {
+		return models.DirectionDischarging
+	}
+	return models.DirectionIdle
+}
+
+func whToKWh(wh *float64) *float64 {
+	if wh == nil {
+		return nil
+	}
+	kwh := *wh / 1000
+	return &kwh
+}
+
+func deref(f *float64) float64 {
+	if f == nil {
+		return 0
+	}
+	return *f
+}
@@ -0,0 +1,137 @@
+package solaredge
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+// fakeMonitoring stands in for the SolarEdge Monitoring API. Power flow
+// calls for the sites in hold wait until the site's channel is closed.
+type fakeMonitoring struct {
+	t    *testing.T
+	hold map[string]chan struct{}
+
+	mu    sync.Mutex
+	flows map[string]int // site ID → power flow calls
+}
+
+func (f *fakeMonitoring) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/sites/list":
+		fmt.Fprint(w, `{"sites":{"count":0,"site":[]}}`)
+
+	case strings.HasSuffix(r.URL.Path, "/currentPowerFlow"):
+		site := strings.Split(r.URL.Path, "/")[2]
+		f.mu.Lock()
+		f.flows[site]++
+		f.mu.Unlock()
+		if ch, ok := f.hold[site]; ok {
+			<-ch
+		}
+		fmt.Fprint(w, `{"siteCurrentPowerFlow":{"unit":"kW","GRID":{"status":"Active","currentPower":1.5}}}`)
+
+	default:
+		f.t.Errorf("unexpected call %s", r.URL.Path)
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeMonitoring) flowCalls(site string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flows[site]
+}
+
+func newTestProvider(t *testing.T, hold map[string]chan struct{}) (*SolarEdgeProvider, *fakeMonitoring) {
+	t.Helper()
+	api := &fakeMonitoring{t: t, hold: hold, flows: make(map[string]int)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	p := &SolarEdgeProvider{}
+	err := p.Initialize(context.Background(), provider.ProviderConfig{
+		Name:         "solaredge-test",
+		BaseURL:      srv.URL,
+		Credentials:  map[string]string{"apiKey": "key"},
+		RateLimitRPS: 1000,
+	})
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return p, api
+}
+
+func TestPowerFlowSharedPerSite(t *testing.T) {
+	release := make(chan struct{})
+	p, api := newTestProvider(t, map[string]chan struct{}{"1": release})
+
+	// Inverters of site 1 wait for one fetch
+	const inverters = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, inverters)
+	for i := 0; i < inverters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			flow, err := p.powerFlow(context.Background(), "1")
+			if err == nil && (flow.Grid == nil || flow.Grid.CurrentPower != 1.5) {
+				err = fmt.Errorf("flow = %+v", flow)
+			}
+			errs <- err
+		}()
+	}
+	for api.flowCalls("1") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Meanwhile another site is not held up
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.powerFlow(context.Background(), "2")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("site 2: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("site 2 waited for the fetch of site 1")
+	}
+
+	// A caller giving up does not cancel the shared fetch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.powerFlow(ctx, "1"); err != context.Canceled {
+		t.Errorf("cancelled caller got %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("site 1: %v", err)
+		}
+	}
+	if n := api.flowCalls("1"); n != 1 {
+		t.Errorf("%d power flow calls for %d inverters of a site, want 1", n, inverters)
+	}
+
+	// Later callers are served from the cache
+	if _, err := p.powerFlow(context.Background(), "1"); err != nil {
+		t.Errorf("cached flow: %v", err)
+	}
+	if n := api.flowCalls("1"); n != 1 {
+		t.Errorf("%d power flow calls after a cached read, want 1", n)
+	}
+}
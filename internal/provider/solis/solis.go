@@ -0,0 +1,1057 @@
+package solis
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultBaseURL = "https://www.soliscloud.com:13333"
+	providerName   = "solis"
+
+	solisContentType = "application/json;charset=UTF-8"
+)
+
+func init() {
+	provider.Register(providerName, func() provider.Provider {
+		return &SolisProvider{}
+	})
+}
+
+// SolisProvider implements the Provider interface for the SolisCloud
+// Platform API (Ginlong). There is no login: every request is signed with the
+// account's API key, see sign.
+// Key endpoints (all POST):
+//   - /v1/api/userStationList, /v1/api/stationDetail — plants and energy
+//   - /v1/api/inverterList, /v1/api/inverterDetail — inverters
+//   - /v1/api/inverterDay — 5-minute data of a day
+//   - /v1/api/inverterMonth — daily energy of a month
+//   - /v1/api/alarmList — alarms
+//
+// Values come with a separate unit field ("pac": 5.2, "pacStr": "kW"), read
+// with normalizer.ConvertReading. Device IDs are inverter serials.
+type SolisProvider struct {
+	client    *provider.HTTPClient
+	config    provider.ProviderConfig
+	keyID     string
+	keySecret []byte
+	loc       *time.Location // site-local days are computed in this zone
+	now       func() time.Time
+}
+
+func (p *SolisProvider) Name() string { return providerName }
+
+func (p *SolisProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Operations: provider.OperationsExcept(),
+		Granularities: []models.Granularity{
+			models.GranularityMinute, models.GranularityDay,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodYear, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricBattery, provider.MetricGrid,
+			provider.MetricGridPhases, provider.MetricLoad, provider.MetricEnvironment,
+		},
+	}
+}
+
+func (p *SolisProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
+	p.config = cfg
+	p.now = time.Now
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+
+	// SolisCloud allows 2 calls per second and endpoint
+	rps := cfg.RateLimitRPS
+	if rps <= 0 {
+		rps = 2
+	}
+
+	p.loc = time.UTC
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("Solis: timezone: %w", err)
+		}
+		p.loc = loc
+	}
+
+	p.keyID = cfg.GetCredential("keyId")
+	p.keySecret = []byte(cfg.GetCredential("keySecret"))
+	if p.keyID == "" || len(p.keySecret) == 0 {
+		return provider.NewError(provider.ErrAuth, providerName, "auth", "credentials keyId and keySecret are required")
+	}
+
+	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
+	p.client.SetRequestSigner(p.sign)
+	p.client.SetRetryClassifier(solisRetryClass)
+
+	// A cheap signed call validates the key
+	var resp solisStationListResponse
+	body := map[string]interface{}{"pageNo": 1, "pageSize": 1}
+	if err := p.client.Post(ctx, "/v1/api/userStationList", body, &resp); err != nil {
+		return fmt.Errorf("Solis auth: %w", err)
+	}
+	if !resp.ok() {
+		return solisError("auth", resp.solisBaseResponse)
+	}
+
+	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
+	return nil
+}
+
+// sign sets the SolisCloud signature headers:
+//
+//	Content-MD5:   base64(md5(body))
+//	Authorization: API <keyId>:base64(hmac-sha1(keySecret,
+//	               method \n Content-MD5 \n Content-Type \n Date \n path))
+func (p *SolisProvider) sign(req *http.Request, body []byte) error {
+	sum := md5.Sum(body)
+	contentMD5 := base64.StdEncoding.EncodeToString(sum[:])
+	date := p.now().UTC().Format(http.TimeFormat)
+
+	mac := hmac.New(sha1.New, p.keySecret)
+	mac.Write([]byte(strings.Join([]string{req.Method, contentMD5, solisContentType, date, req.URL.Path}, "\n")))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Content-Type", solisContentType)
+	req.Header.Set("Content-MD5", contentMD5)
+	req.Header.Set("Date", date)
+	req.Header.Set("Authorization", "API "+p.keyID+":"+signature)
+	return nil
+}
+
+// ── Plants ──
+
+func (p *SolisProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
+	var plants []models.NormalizedPlant
+	for page := 1; ; page++ {
+		body := map[string]interface{}{"pageNo": page, "pageSize": 100}
+
+		var resp solisStationListResponse
+		if err := p.client.Post(ctx, "/v1/api/userStationList", body, &resp); err != nil {
+			return nil, fmt.Errorf("Solis GetPlants: %w", err)
+		}
+		if !resp.ok() {
+			return nil, solisError("GetPlants", resp.solisBaseResponse)
+		}
+
+		for _, raw := range resp.Data.Page.Records {
+			plants = append(plants, normalizeSolisPlant(raw))
+		}
+		if len(resp.Data.Page.Records) == 0 || len(plants) >= resp.Data.Page.Total {
+			break
+		}
+	}
+	return plants, nil
+}
+
+func (p *SolisProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
+	data, err := p.stationDetail(ctx, "GetPlantDetails", plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	plant := normalizeSolisPlantDetail(data, plantID)
+	return &plant, nil
+}
+
+func (p *SolisProvider) stationDetail(ctx context.Context, op, stationID string) (map[string]interface{}, error) {
+	body := map[string]interface{}{"id": stationID}
+
+	var resp solisDataResponse
+	if err := p.client.Post(ctx, "/v1/api/stationDetail", body, &resp); err != nil {
+		return nil, fmt.Errorf("Solis %s: %w", op, err)
+	}
+	if !resp.ok() {
+		return nil, solisError(op, resp.solisBaseResponse)
+	}
+	if len(resp.Data) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, op, "unknown station "+stationID)
+	}
+	return resp.Data, nil
+}
+
+// ── Devices ──
+
+func (p *SolisProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
+	var devices []models.NormalizedDevice
+	for page := 1; ; page++ {
+		body := map[string]interface{}{"pageNo": page, "pageSize": 100, "stationId": plantID}
+
+		var resp solisInverterListResponse
+		if err := p.client.Post(ctx, "/v1/api/inverterList", body, &resp); err != nil {
+			return nil, fmt.Errorf("Solis GetDevices: %w", err)
+		}
+		if !resp.ok() {
+			return nil, solisError("GetDevices", resp.solisBaseResponse)
+		}
+
+		for _, raw := range resp.Data.Page.Records {
+			devices = append(devices, normalizeSolisDevice(raw))
+		}
+		if len(resp.Data.Page.Records) == 0 || len(devices) >= resp.Data.Page.Total {
+			break
+		}
+	}
+	return devices, nil
+}
+
+func (p *SolisProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
+	data, err := p.inverterDetail(ctx, "GetDeviceDetails", deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	dev := normalizeSolisDeviceDetail(data, deviceID)
+	return &dev, nil
+}
+
+func (p *SolisProvider) inverterDetail(ctx context.Context, op, sn string) (map[string]interface{}, error) {
+	body := map[string]interface{}{"sn": sn}
+
+	var resp solisDataResponse
+	if err := p.client.Post(ctx, "/v1/api/inverterDetail", body, &resp); err != nil {
+		return nil, fmt.Errorf("Solis %s: %w", op, err)
+	}
+	if !resp.ok() {
+		return nil, solisError(op, resp.solisBaseResponse)
+	}
+	if len(resp.Data) == 0 {
+		return nil, provider.NewError(provider.ErrNotFound, providerName, op, "no data for device "+sn)
+	}
+	return resp.Data, nil
+}
+
+// ── Real-Time Data ──
+
+func (p *SolisProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	data, err := p.inverterDetail(ctx, "GetRealTimeData", deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := normalizeSolisRealtime(data, deviceID)
+	return &rt, nil
+}
+
+// ── Energy Stats ──
+
+func (p *SolisProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
+	if period == models.PeriodWeek {
+		return nil, provider.NotSupported(providerName, provider.OpGetEnergyStats, "period "+string(period))
+	}
+
+	data, err := p.stationDetail(ctx, "GetEnergyStats", plantID)
+	if err != nil {
+		return nil, err
+	}
+
+	energy := normalizeSolisEnergy(data, plantID, period)
+	return &energy, nil
+}
+
+// ── Historical Data ──
+
+// GetHistoricalData returns an inverter's 5-minute data for the site-local
+// day of the start time, or its daily energy for the month of the start
+// time.
+func (p *SolisProvider) GetHistoricalData(ctx context.Context, deviceID string, req models.HistoryRequest) (*models.HistoryResponse, error) {
+	start, err := time.Parse(time.RFC3339, req.StartTime)
+	if err != nil {
+		return nil, provider.NewError(provider.ErrInvalidRequest, providerName, "GetHistoricalData", "invalid start time: "+err.Error())
+	}
+	day := start.In(p.loc)
+
+	var path string
+	body := map[string]interface{}{"sn": deviceID, "money": "EUR"} // money is required but only affects income
+	switch req.Granularity {
+	case models.GranularityMinute:
+		path = "/v1/api/inverterDay"
+		_, offset := day.Zone()
+		body["time"] = day.Format("2006-01-02")
+		body["timeZone"] = offset / 3600
+	case models.GranularityDay:
+		path = "/v1/api/inverterMonth"
+		body["month"] = day.Format("2006-01")
+	default:
+		return nil, provider.NotSupported(providerName, provider.OpGetHistoricalData, "granularity "+string(req.Granularity))
+	}
+
+	var resp solisListResponse
+	if err := p.client.Post(ctx, path, body, &resp); err != nil {
+		return nil, fmt.Errorf("Solis GetHistoricalData: %w", err)
+	}
+	if !resp.ok() {
+		return nil, solisError("GetHistoricalData", resp.solisBaseResponse)
+	}
+
+	history := normalizeSolisHistory(resp.Data, deviceID, req, p.loc)
+	return &history, nil
+}
+
+// ── Alarms ──
+
+func (p *SolisProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
+	return p.alarms(ctx, "GetAlarms", map[string]interface{}{"alarmDeviceSn": deviceID})
+}
+
+func (p *SolisProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
+	return p.alarms(ctx, "GetAllAlarms", nil)
+}
+
+// alarms pages through alarmList with the given filters.
+func (p *SolisProvider) alarms(ctx context.Context, op string, filter map[string]interface{}) ([]models.NormalizedAlarm, error) {
+	var alarms []models.NormalizedAlarm
+	for page := 1; ; page++ {
+		body := map[string]interface{}{"pageNo": page, "pageSize": 100}
+		for k, v := range filter {
+			body[k] = v
+		}
+
+		var resp solisAlarmListResponse
+		if err := p.client.Post(ctx, "/v1/api/alarmList", body, &resp); err != nil {
+			return nil, fmt.Errorf("Solis %s: %w", op, err)
+		}
+		if !resp.ok() {
+			return nil, solisError(op, resp.solisBaseResponse)
+		}
+
+		for _, raw := range resp.Data.Records {
+			alarms = append(alarms, normalizeSolisAlarm(raw))
+		}
+		if len(resp.Data.Records) == 0 || len(alarms) >= resp.Data.Total {
+			break
+		}
+	}
+	return alarms, nil
+}
+
+func (p *SolisProvider) Healthy(ctx context.Context) bool {
+	return p.keyID != ""
+}
+
+func (p *SolisProvider) Close() error {
+	return nil
+}
+
+// ══════════════════════════════════════════════════════════════════
+// SolisCloud raw response types
+// ══════════════════════════════════════════════════════════════════
+
+type solisBaseResponse struct {
+	Success bool   `json:"success"`
+	Code    string `json:"code"` // "0" = success
+	Msg     string `json:"msg"`
+}
+
+func (r solisBaseResponse) ok() bool {
+	return r.Success && (r.Code == "" || r.Code == "0")
+}
+
+type solisDataResponse struct {
+	solisBaseResponse
+	Data map[string]interface{} `json:"data"`
+}
+
+type solisListResponse struct {
+	solisBaseResponse
+	Data []map[string]interface{} `json:"data"`
+}
+
+type solisStationListResponse struct {
+	solisBaseResponse
+	Data struct {
+		Page struct {
+			Total   int            `json:"total"`
+			Records []solisStation `json:"records"`
+		} `json:"page"`
+	} `json:"data"`
+}
+
+type solisStation struct {
+	ID          string      `json:"id"`
+	StationName string      `json:"stationName"`
+	Addr        string      `json:"addr"`
+	Country     string      `json:"countryStr"`
+	Capacity    float64     `json:"capacity"`
+	CapacityStr string      `json:"capacityStr"` // "kWp"
+	State       int         `json:"state"`       // 1=online, 2=offline, 3=alarm
+	Latitude    interface{} `json:"latitude"`
+	Longitude   interface{} `json:"longitude"`
+	Type        int         `json:"type"` // 1=grid-tied, 2=storage
+}
+
+type solisInverterListResponse struct {
+	solisBaseResponse
+	Data struct {
+		Page struct {
+			Total   int             `json:"total"`
+			Records []solisInverter `json:"records"`
+		} `json:"page"`
+	} `json:"data"`
+}
+
+type solisInverter struct {
+	ID           string  `json:"id"`
+	SN           string  `json:"sn"`
+	StationID    string  `json:"stationId"`
+	Name         string  `json:"name"`
+	ProductModel string  `json:"productModel"`
+	Power        float64 `json:"power"` // rated
+	PowerStr     string  `json:"powerStr"`
+	State        int     `json:"state"` // 1=online, 2=offline, 3=alarm
+	InverterType int     `json:"type"`  // 1=grid-tied, 2=storage
+	Version      string  `json:"version"`
+}
+
+type solisAlarmListResponse struct {
+	solisBaseResponse
+	Data struct {
+		Total   int          `json:"total"`
+		Records []solisAlarm `json:"records"`
+	} `json:"data"`
+}
+
+type solisAlarm struct {
+	ID             string      `json:"id"`
+	StationID      string      `json:"stationId"`
+	StationName    string      `json:"stationName"`
+	AlarmDeviceSn  string      `json:"alarmDeviceSn"`
+	AlarmCode      string      `json:"alarmCode"`
+	AlarmMsg       string      `json:"alarmMsg"`
+	AlarmLevel     string      `json:"alarmLevel"`     // 1=tip, 2=general, 3=emergency
+	State          string      `json:"state"`          // 0=pending, 1=processed, 2=restored
+	AlarmBeginTime json.Number `json:"alarmBeginTime"` // Unix ms
+	AlarmEndTime   json.Number `json:"alarmEndTime"`
+	Advice         string      `json:"advice"`
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Normalization functions
+// ══════════════════════════════════════════════════════════════════
+
+func normalizeSolisPlant(raw solisStation) models.NormalizedPlant {
+	plant := models.NormalizedPlant{
+		ID:        fmt.Sprintf("%s_%s", providerName, raw.ID),
+		Provider:  providerName,
+		Name:      raw.StationName,
+		Address:   raw.Addr,
+		Country:   raw.Country,
+		PlantType: solisPlantType(raw.Type),
+		Meta: models.ProviderMeta{
+			Provider:        providerName,
+			ProviderPlantID: raw.ID,
+			FetchedAt:       time.Now().UTC(),
+		},
+	}
+
+	if kwp, ok := normalizer.ConvertReading(raw.Capacity, solisUnit(raw.CapacityStr, "kWp"), "kW"); ok && kwp > 0 {
+		plant.PeakPowerKWp = &kwp
+	}
+	lat, lng := solisFloat(raw.Latitude), solisFloat(raw.Longitude)
+	if lat != nil && lng != nil {
+		plant.Location = &models.LatLng{Latitude: *lat, Longitude: *lng}
+	}
+	return plant
+}
+
+func normalizeSolisPlantDetail(data map[string]interface{}, plantID string) models.NormalizedPlant {
+	plant := models.NormalizedPlant{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Name:      extractStr(data, "stationName"),
+		Address:   extractStr(data, "addr"),
+		Country:   extractStr(data, "countryStr"),
+		Currency:  extractStr(data, "money"),
+		PlantType: solisPlantType(int(normalizer.SafeFloat(solisFloat(data["type"])))),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	plant.PeakPowerKWp = solisValue(data, "capacity", "kWp", "kW")
+	lat, lng := solisFloat(data["latitude"]), solisFloat(data["longitude"])
+	if lat != nil && lng != nil {
+		plant.Location = &models.LatLng{Latitude: *lat, Longitude: *lng}
+	}
+	return plant
+}
+
+func normalizeSolisDevice(raw solisInverter) models.NormalizedDevice {
+	status := solisDeviceStatus(raw.State)
+	name := raw.Name
+	if name == "" {
+		name = raw.SN
+	}
+
+	dev := models.NormalizedDevice{
+		ID:           fmt.Sprintf("%s_%s", providerName, raw.SN),
+		Provider:     providerName,
+		PlantID:      fmt.Sprintf("%s_%s", providerName, raw.StationID),
+		Name:         name,
+		SerialNumber: raw.SN,
+		Model:        raw.ProductModel,
+		DeviceType:   solisDeviceType(raw.InverterType),
+		Manufacturer: "Solis",
+		Status:       status,
+		IsOnline:     status != models.DeviceStatusOffline,
+		HasAlarm:     raw.State == 3,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: raw.SN,
+			ProviderPlantID:  raw.StationID,
+			FetchedAt:        time.Now().UTC(),
+			Extra:            map[string]string{"inverterId": raw.ID},
+		},
+	}
+
+	if w, ok := normalizer.ConvertReading(raw.Power, solisUnit(raw.PowerStr, "kW"), "W"); ok && w > 0 {
+		dev.RatedPowerW = &w
+	}
+	if raw.Version != "" {
+		dev.FirmwareInfo = &models.FirmwareInfo{MainVersion: raw.Version}
+	}
+	return dev
+}
+
+func normalizeSolisDeviceDetail(data map[string]interface{}, sn string) models.NormalizedDevice {
+	state := int(normalizer.SafeFloat(solisFloat(data["state"])))
+	status := solisDeviceStatus(state)
+	stationID := extractStr(data, "stationId")
+
+	dev := models.NormalizedDevice{
+		ID:           fmt.Sprintf("%s_%s", providerName, sn),
+		Provider:     providerName,
+		PlantID:      fmt.Sprintf("%s_%s", providerName, stationID),
+		Name:         sn,
+		SerialNumber: sn,
+		Model:        extractStr(data, "productModel"),
+		DeviceType:   solisDeviceType(int(normalizer.SafeFloat(solisFloat(data["type"])))),
+		Manufacturer: "Solis",
+		Status:       status,
+		IsOnline:     status != models.DeviceStatusOffline,
+		HasAlarm:     state == 3,
+		RatedPowerW:  solisValue(data, "power", "kW", "W"),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: sn,
+			ProviderPlantID:  stationID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	if master := extractStr(data, "version"); master != "" {
+		dev.FirmwareInfo = &models.FirmwareInfo{MainVersion: master, SlaveVersion: extractStr(data, "version2")}
+	}
+	if soc := solisFloat(data["batteryCapacitySoc"]); soc != nil {
+		dev.BatteryInfo = &models.DeviceBatteryInfo{Count: 1, BatteryType: extractStr(data, "batteryModel")}
+	}
+	return dev
+}
+
+// normalizeSolisRealtime maps /v1/api/inverterDetail.
+func normalizeSolisRealtime(data map[string]interface{}, deviceID string) models.NormalizedRealtime {
+	now := time.Now().UTC()
+
+	rt := models.NormalizedRealtime{
+		DeviceID:  fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:  providerName,
+		Timestamp: now,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: deviceID,
+			ProviderPlantID:  extractStr(data, "stationId"),
+			RawDataAvailable: true,
+			FetchedAt:        now,
+		},
+	}
+	if ms := solisFloat(data["dataTimestamp"]); ms != nil && *ms > 0 {
+		rt.Timestamp = time.UnixMilli(int64(*ms)).UTC()
+		rt.OriginalTimestamp = extractStr(data, "dataTimestamp")
+	}
+	rt.OriginalTimezone = extractStr(data, "timeZoneStr")
+	rt.Status, rt.OperatingMode = solisRunStatus(int(normalizer.SafeFloat(solisFloat(data["state"]))), extractStr(data, "currentState"))
+
+	// SolisCloud inverterDetail keys (unit in "<key>Str"):
+	// "pac" (AC output, kW), "dcPac" (PV input, kW), "eToday", "eMonth",
+	// "eYear", "eTotal" (kWh), "uPv1".., "iPv1".., "pow1".. (per MPPT)
+	// "uAc1".."uAc3", "iAc1".."iAc3", "fac" (per phase)
+	// "psum" (grid, positive = export), "familyLoadPower"
+	// "batteryPower" (positive = charging), "batteryCapacitySoc"
+	// "inverterTemperature" (°C)
+	pvPower := solisValue(data, "dcPac", "kW", "W")
+	acPower := solisValue(data, "pac", "kW", "W")
+	if pvPower == nil {
+		pvPower = acPower
+	}
+	rt.PV = &models.PVData{
+		TotalPowerW:    normalizer.SafeFloat(pvPower),
+		TodayEnergyKWh: solisValue(data, "eToday", "kWh", "kWh"),
+		MonthEnergyKWh: solisValue(data, "eMonth", "kWh", "kWh"),
+		YearEnergyKWh:  solisValue(data, "eYear", "kWh", "kWh"),
+		TotalEnergyKWh: solisValue(data, "eTotal", "kWh", "kWh"),
+		Strings:        solisPVStrings(data),
+	}
+
+	freq := solisValue(data, "fac", "Hz", "Hz")
+	rt.Grid = &models.GridData{
+		FrequencyHz:    freq,
+		PowerFactor:    solisFloat(data["powerFactor"]),
+		TodayImportKWh: solisValue(data, "gridPurchasedTodayEnergy", "kWh", "kWh"),
+		TodayExportKWh: solisValue(data, "gridSellTodayEnergy", "kWh", "kWh"),
+		TotalImportKWh: solisValue(data, "gridPurchasedTotalEnergy", "kWh", "kWh"),
+		TotalExportKWh: solisValue(data, "gridSellTotalEnergy", "kWh", "kWh"),
+		Phases:         solisPhases(data, freq),
+	}
+	if psum := solisValue(data, "psum", "kW", "W"); psum != nil {
+		// Meter reading, positive when exporting
+		rt.Grid.TotalPowerW = -*psum
+	} else {
+		// Without a meter only the inverter's own output is known
+		rt.Grid.TotalPowerW = -normalizer.SafeFloat(acPower)
+	}
+	rt.Grid.Direction = solisGridDirection(rt.Grid.TotalPowerW)
+
+	if load := solisValue(data, "familyLoadPower", "kW", "W"); load != nil {
+		rt.Load = &models.LoadData{
+			TotalPowerW:    *load,
+			TodayEnergyKWh: solisValue(data, "homeLoadTodayEnergy", "kWh", "kWh"),
+			TotalEnergyKWh: solisValue(data, "homeLoadTotalEnergy", "kWh", "kWh"),
+		}
+	}
+
+	if soc := solisFloat(data["batteryCapacitySoc"]); soc != nil {
+		power := normalizer.SafeFloat(solisValue(data, "batteryPower", "kW", "W"))
+		rt.Battery = &models.BatteryData{
+			SOCPercent:        soc,
+			PowerW:            power,
+			Direction:         solisBatteryDirection(power),
+			VoltageDC:         solisValue(data, "batteryVoltage", "V", "V"),
+			CurrentDC:         solisValue(data, "bstteryCurrent", "A", "A"), // sic
+			TodayChargeKWh:    solisValue(data, "batteryTodayChargeEnergy", "kWh", "kWh"),
+			TodayDischargeKWh: solisValue(data, "batteryTodayDischargeEnergy", "kWh", "kWh"),
+			TotalChargeKWh:    solisValue(data, "batteryTotalChargeEnergy", "kWh", "kWh"),
+			TotalDischargeKWh: solisValue(data, "batteryTotalDischargeEnergy", "kWh", "kWh"),
+		}
+		if rt.Battery.CurrentDC == nil {
+			rt.Battery.CurrentDC = solisValue(data, "batteryCurrent", "A", "A")
+		}
+	}
+
+	if temp := solisValue(data, "inverterTemperature", "℃", "°C"); temp != nil {
+		rt.Environment = &models.EnvironmentData{InverterTemperatureC: temp}
+	}
+
+	return rt
+}
+
+func normalizeSolisEnergy(data map[string]interface{}, plantID string, period models.Period) models.NormalizedEnergy {
+	energy := models.NormalizedEnergy{
+		ID:        fmt.Sprintf("%s_%s", providerName, plantID),
+		Provider:  providerName,
+		Period:    period,
+		Timestamp: time.Now().UTC(),
+		Currency:  extractStr(data, "money"),
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderPlantID:  plantID,
+			RawDataAvailable: true,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	// stationDetail keys per period: dayEnergy, monthEnergy, yearEnergy,
+	// allEnergy; gridPurchased/gridSell/homeLoad/batteryCharge/
+	// batteryDischarge + Today/Month/Year/Total + Energy
+	prefix, suffix := "day", "Today"
+	switch period {
+	case models.PeriodMonth:
+		prefix, suffix = "month", "Month"
+	case models.PeriodYear:
+		prefix, suffix = "year", "Year"
+	case models.PeriodTotal:
+		prefix, suffix = "all", "Total"
+	}
+	energy.PVGenerationKWh = solisValue(data, prefix+"Energy", "kWh", "kWh")
+	energy.GridImportKWh = solisValue(data, "gridPurchased"+suffix+"Energy", "kWh", "kWh")
+	energy.GridExportKWh = solisValue(data, "gridSell"+suffix+"Energy", "kWh", "kWh")
+	energy.LoadConsumptionKWh = solisValue(data, "homeLoad"+suffix+"Energy", "kWh", "kWh")
+	energy.BatteryChargeKWh = solisValue(data, "batteryCharge"+suffix+"Energy", "kWh", "kWh")
+	energy.BatteryDischargeKWh = solisValue(data, "batteryDischarge"+suffix+"Energy", "kWh", "kWh")
+	energy.Revenue = solisFloat(data[prefix+"Income"])
+
+	if gen, exp := energy.PVGenerationKWh, energy.GridExportKWh; gen != nil && exp != nil && *gen > 0 {
+		rate := normalizer.CalculateSelfConsumptionRate(*gen, *exp)
+		energy.SelfConsumptionRate = &rate
+	}
+	if load, imp := energy.LoadConsumptionKWh, energy.GridImportKWh; load != nil && imp != nil && *load > 0 {
+		rate := normalizer.CalculateSelfSufficiencyRate(*load, *imp)
+		energy.SelfSufficiencyRate = &rate
+	}
+
+	energy.CurrentPowerW = solisValue(data, "power", "kW", "W")
+	status := solisDeviceStatus(int(normalizer.SafeFloat(solisFloat(data["state"]))))
+	energy.DeviceStatus = &status
+	energy.BatterySOC = solisFloat(data["batteryPercent"])
+
+	return energy
+}
+
+// normalizeSolisHistory maps inverterDay (power snapshots) and inverterMonth
+// (daily energy) records.
+func normalizeSolisHistory(records []map[string]interface{}, deviceID string, req models.HistoryRequest, loc *time.Location) models.HistoryResponse {
+	result := models.HistoryResponse{
+		DeviceID:    fmt.Sprintf("%s_%s", providerName, deviceID),
+		Provider:    providerName,
+		Granularity: req.Granularity,
+		StartTime:   req.StartTime,
+		EndTime:     req.EndTime,
+	}
+
+	var end time.Time
+	if req.EndTime != "" {
+		end, _ = time.Parse(time.RFC3339, req.EndTime)
+	}
+
+	for _, rec := range records {
+		dp := models.NormalizedTimeSeries{
+			DeviceID:    result.DeviceID,
+			Provider:    providerName,
+			Granularity: req.Granularity,
+			Meta: models.ProviderMeta{
+				Provider:         providerName,
+				ProviderDeviceID: deviceID,
+				FetchedAt:        time.Now().UTC(),
+			},
+		}
+
+		if req.Granularity == models.GranularityDay {
+			t, err := time.ParseInLocation("2006-01-02", extractStr(rec, "dateStr"), loc)
+			if err != nil {
+				continue
+			}
+			dp.Timestamp = t.UTC()
+			dp.PVEnergyKWh = solisValue(rec, "energy", "kWh", "kWh")
+			dp.GridImportEnergyKWh = solisValue(rec, "gridPurchasedEnergy", "kWh", "kWh")
+			dp.GridExportEnergyKWh = solisValue(rec, "gridSellEnergy", "kWh", "kWh")
+			dp.LoadEnergyKWh = solisValue(rec, "homeLoadEnergy", "kWh", "kWh")
+			dp.BatteryChargeKWh = solisValue(rec, "batteryChargeEnergy", "kWh", "kWh")
+			dp.BatteryDischargeKWh = solisValue(rec, "batteryDischargeEnergy", "kWh", "kWh")
+		} else {
+			ms := solisFloat(rec["dataTimestamp"])
+			if ms == nil {
+				continue
+			}
+			dp.Timestamp = time.UnixMilli(int64(*ms)).UTC()
+			dp.PVPowerW = solisValue(rec, "dcPac", "kW", "W")
+			if dp.PVPowerW == nil {
+				dp.PVPowerW = solisValue(rec, "pac", "kW", "W")
+			}
+			dp.LoadPowerW = solisValue(rec, "familyLoadPower", "kW", "W")
+			if psum := solisValue(rec, "psum", "kW", "W"); psum != nil {
+				grid := -*psum
+				dp.GridPowerW = &grid
+			}
+			if battery := solisValue(rec, "batteryPower", "kW", "W"); battery != nil {
+				dir := solisBatteryDirection(*battery)
+				dp.BatteryPowerW = battery
+				dp.BatteryDirection = &dir
+			}
+			dp.BatterySOC = solisFloat(rec["batteryCapacitySoc"])
+			dp.PVStrings = solisPVStrings(rec)
+		}
+
+		if !end.IsZero() && dp.Timestamp.After(end) {
+			continue
+		}
+		result.DataPoints = append(result.DataPoints, dp)
+	}
+
+	result.TotalPoints = len(result.DataPoints)
+	return result
+}
+
+func normalizeSolisAlarm(raw solisAlarm) models.NormalizedAlarm {
+	ts := time.Now().UTC()
+	if ms, err := raw.AlarmBeginTime.Int64(); err == nil && ms > 0 {
+		ts = time.UnixMilli(ms).UTC()
+	}
+
+	alarm := models.NormalizedAlarm{
+		ID:                 fmt.Sprintf("%s_alarm_%s_%s_%d", providerName, raw.AlarmDeviceSn, raw.AlarmCode, ts.Unix()),
+		Provider:           providerName,
+		DeviceID:           fmt.Sprintf("%s_%s", providerName, raw.AlarmDeviceSn),
+		PlantID:            fmt.Sprintf("%s_%s", providerName, raw.StationID),
+		Code:               raw.AlarmCode,
+		Name:               raw.AlarmMsg,
+		Message:            raw.Advice,
+		Severity:           solisSeverity(raw.AlarmLevel),
+		Status:             solisAlarmStatus(raw.State),
+		DeviceSerialNumber: raw.AlarmDeviceSn,
+		DeviceType:         models.DeviceTypeInverter,
+		PlantName:          raw.StationName,
+		StartTime:          ts,
+		Meta: models.ProviderMeta{
+			Provider:         providerName,
+			ProviderDeviceID: raw.AlarmDeviceSn,
+			ProviderPlantID:  raw.StationID,
+			FetchedAt:        time.Now().UTC(),
+		},
+	}
+
+	if ms, err := raw.AlarmEndTime.Int64(); err == nil && ms > 0 {
+		t := time.UnixMilli(ms).UTC()
+		alarm.EndTime = &t
+	}
+
+	return alarm
+}
+
+// ══════════════════════════════════════════════════════════════════
+// Mapping helpers
+// ══════════════════════════════════════════════════════════════════
+
+// solisDeviceStatus maps the station and inverter state: 1=online,
+// 2=offline, 3=alarm.
+func solisDeviceStatus(state int) models.DeviceStatus {
+	switch state {
+	case 1:
+		return models.DeviceStatusNormal
+	case 2:
+		return models.DeviceStatusOffline
+	case 3:
+		return models.DeviceStatusWarning
+	default:
+		return models.DeviceStatusUnknown
+	}
+}
+
+// solisRunStatus refines the state with the inverter's current state text
+// ("Generating", "Waiting", "Fault", "Off-grid", …).
+func solisRunStatus(state int, current string) (models.DeviceStatus, models.OperatingMode) {
+	status := solisDeviceStatus(state)
+	text := strings.ToLower(current)
+	switch {
+	case status == models.DeviceStatusOffline:
+		return status, models.OperatingModeShutdown
+	case strings.Contains(text, "fault"):
+		return models.DeviceStatusFault, models.OperatingModeFault
+	case strings.Contains(text, "off-grid") || strings.Contains(text, "off grid"):
+		return status, models.OperatingModeOffGrid
+	case strings.Contains(text, "wait") || strings.Contains(text, "standby"):
+		return models.DeviceStatusStandby, models.OperatingModeWaiting
+	case status == models.DeviceStatusNormal || status == models.DeviceStatusWarning:
+		return status, models.OperatingModeGridConnected
+	default:
+		return status, models.OperatingModeUnknown
+	}
+}
+
+func solisDeviceType(t int) models.DeviceType {
+	switch t {
+	case 1:
+		return models.DeviceTypeStringInverter
+	case 2:
+		return models.DeviceTypeHybridInverter
+	default:
+		return models.DeviceTypeInverter
+	}
+}
+
+func solisPlantType(t int) models.PlantType {
+	switch t {
+	case 1:
+		return models.PlantTypeGridTied
+	case 2:
+		return models.PlantTypeHybrid
+	default:
+		return models.PlantTypeUnknown
+	}
+}
+
+func solisSeverity(level string) models.AlarmSeverity {
+	switch level {
+	case "1":
+		return models.AlarmSeverityInfo
+	case "2":
+		return models.AlarmSeverityWarning
+	case "3":
+		return models.AlarmSeverityCritical
+	default:
+		return models.AlarmSeverityUnknown
+	}
+}
+
+func solisAlarmStatus(state string) models.AlarmStatus {
+	switch state {
+	case "0":
+		return models.AlarmStatusActive
+	case "1":
+		return models.AlarmStatusAcknowledged
+	case "2":
+		return models.AlarmStatusResolved
+	default:
+		return models.AlarmStatusUnknown
+	}
+}
+
+// solisPVStrings reads "uPv1".., "iPv1".. and "pow1".. for up to 32 MPPTs.
+func solisPVStrings(data map[string]interface{}) []models.PVString {
+	var pvStrings []models.PVString
+	for i := 1; i <= 32; i++ {
+		n := strconv.Itoa(i)
+		v := solisValue(data, "uPv"+n, "V", "V")
+		c := solisValue(data, "iPv"+n, "A", "A")
+		pw := solisValue(data, "pow"+n, "W", "W")
+		if (v == nil || *v == 0) && (c == nil || *c == 0) && (pw == nil || *pw == 0) {
+			continue
+		}
+		if pw == nil && v != nil && c != nil {
+			p := *v * *c
+			pw = &p
+		}
+		pvStrings = append(pvStrings, models.PVString{ID: i, VoltageV: v, CurrentA: c, PowerW: pw})
+	}
+	return pvStrings
+}
+
+// solisPhases reads "uAc1".."uAc3" and "iAc1".."iAc3" as phases A to C.
+func solisPhases(data map[string]interface{}, freq *float64) []models.PhaseData {
+	var phases []models.PhaseData
+	for i, phase := range []string{"A", "B", "C"} {
+		n := strconv.Itoa(i + 1)
+		voltage := solisValue(data, "uAc"+n, "V", "V")
+		current := solisValue(data, "iAc"+n, "A", "A")
+		if (voltage == nil || *voltage == 0) && (current == nil || *current == 0) {
+			continue
+		}
+		phases = append(phases, models.PhaseData{Phase: phase, VoltageV: voltage, CurrentA: current, FrequencyHz: freq})
+	}
+	return phases
+}
+
+func solisGridDirection(power float64) models.GridDirection {
+	if power > 0 {
+		return models.GridDirectionImporting
+	} else if power < 0 {
+		return models.GridDirectionExporting
+	}
+	return models.GridDirectionIdle
+}
+
+func solisBatteryDirection(power float64) models.EnergyDirection {
+	if power > 0 {
+		return models.DirectionCharging
+	} else if power < 0 {
+		return models.DirectionDischarging
+	}
+	return models.DirectionIdle
+}
+
+// solisRetryClass treats the call-frequency error as throttling.
+func solisRetryClass(status int, body []byte) provider.RetryClass {
+	var resp solisBaseResponse
+	if json.Unmarshal(body, &resp) == nil && resp.Code == "Z0001" {
+		return provider.RetryThrottled
+	}
+	return provider.NoRetry
+}
+
+// solisError classifies a SolisCloud error into the provider error taxonomy.
+func solisError(op string, resp solisBaseResponse) error {
+	var kind error
+	msg := strings.ToLower(resp.Msg)
+	switch {
+	case resp.Code == "Z0001" || strings.Contains(msg, "frequent"):
+		kind = provider.ErrRateLimited
+	case resp.Code == "403" || strings.Contains(msg, "sign") || strings.Contains(msg, "auth") || strings.Contains(msg, "permission"):
+		kind = provider.ErrAuth
+	case strings.Contains(msg, "not exist") || strings.Contains(msg, "not found"):
+		kind = provider.ErrNotFound
+	case strings.Contains(msg, "param"):
+		kind = provider.ErrInvalidRequest
+	default:
+		// an answer, so the API is up
+		kind = provider.ErrVendor
+	}
+	return provider.VendorError(kind, providerName, op, resp.Code, resp.Msg)
+}
+
+// ── Extraction helpers ──
+
+func extractStr(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	v, ok := m[key]
+	if !ok || v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// solisFloat reads a number that may be sent as a string.
+func solisFloat(v interface{}) *float64 {
+	switch val := v.(type) {
+	case float64:
+		return &val
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return nil
+		}
+		return &f
+	default:
+		return nil
+	}
+}
+
+// solisValue reads key in the unit named by key+"Str", or in defaultUnit
+// if there is none, converted to unit.
+func solisValue(m map[string]interface{}, key, defaultUnit, unit string) *float64 {
+	if m == nil {
+		return nil
+	}
+	v := solisFloat(m[key])
+	if v == nil {
+		return nil
+	}
+	converted, ok := normalizer.ConvertReading(*v, solisUnit(extractStr(m, key+"Str"), defaultUnit), unit)
+	if !ok {
+		return nil
+	}
+	return &converted
+}
+
+// solisUnit returns unit, or def if it is empty. Peak power units ("kWp")
+// are read as power.
+func solisUnit(unit, def string) string {
+	if unit == "" {
+		unit = def
+	}
+	return strings.TrimSuffix(unit, "p")
+}
@@ -0,0 +1,76 @@
+package solis
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/provider"
+)
+
+func TestSignVector(t *testing.T) {
+	// Computed independently with
+	//
+	//	printf '%s' "$body" | openssl dgst -md5 -binary | base64
+	//	printf 'POST\n%s\n%s\n%s\n%s' "$md5" "$type" "$date" "$path" |
+	//		openssl dgst -sha1 -hmac 6680182547 -binary | base64
+	p := &SolisProvider{
+		keyID:     "2424",
+		keySecret: []byte("6680182547"),
+		now:       func() time.Time { return time.Date(2024, 6, 14, 12, 5, 0, 0, time.FixedZone("CEST", 2*3600)) },
+	}
+	body := []byte(`{"pageNo":1,"pageSize":10}`)
+	req, _ := http.NewRequest(http.MethodPost, "https://www.soliscloud.com:13333/v1/api/userStationList", nil)
+	if err := p.sign(req, body); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	for header, want := range map[string]string{
+		"Content-Type":  "application/json;charset=UTF-8",
+		"Content-MD5":   "kxdxk7rbAsrzSIWgEwhH4w==",
+		"Date":          "Fri, 14 Jun 2024 10:05:00 GMT",
+		"Authorization": "API 2424:c37fRlYFoZxhQFJJxDTTOMruYeY=",
+	} {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestSignedBodyIsSent(t *testing.T) {
+	var checked bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := md5.Sum(body)
+		if got, want := r.Header.Get("Content-MD5"), base64.StdEncoding.EncodeToString(sum[:]); got != want {
+			t.Errorf("Content-MD5 %s does not match the body sent (%s)", got, want)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "API 2424:") {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		checked = true
+		fmt.Fprint(w, `{"success":true,"code":"0","data":{"page":{"records":[]}}}`)
+	}))
+	defer srv.Close()
+
+	p := &SolisProvider{}
+	err := p.Initialize(context.Background(), provider.ProviderConfig{
+		Name:         "solis-test",
+		BaseURL:      srv.URL,
+		Credentials:  map[string]string{"keyId": "2424", "keySecret": "6680182547"},
+		RateLimitRPS: 1000,
+	})
+	if err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	if !checked {
+		t.Error("no signed request reached the server")
+	}
+}
@@ -3,6 +3,7 @@ package sungrow
 import (
 	"context"
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -35,15 +36,30 @@ func init() {
 //   - /openapi/queryDeviceHistoryData — historical data
 //   - /openapi/getAlarmList — alarms
 type SungrowProvider struct {
-	client  *provider.HTTPClient
-	config  provider.ProviderConfig
-	appKey  string
-	token   string
-	userID  string
+	client *provider.HTTPClient
+	config provider.ProviderConfig
+	appKey string
 }
 
 func (p *SungrowProvider) Name() string { return providerName }
 
+func (p *SungrowProvider) Capabilities() provider.Capabilities {
+	return provider.Capabilities{
+		Operations: provider.OperationsExcept(provider.OpGetDeviceDetails),
+		Granularities: []models.Granularity{
+			models.GranularityMinute, models.GranularityHour, models.GranularityDay,
+			models.GranularityMonth, models.GranularityYear,
+		},
+		Periods: []models.Period{
+			models.PeriodDay, models.PeriodMonth, models.PeriodYear, models.PeriodTotal,
+		},
+		Metrics: []provider.Metric{
+			provider.MetricPV, provider.MetricPVStrings, provider.MetricGrid, provider.MetricGridPhases,
+			provider.MetricBattery, provider.MetricLoad,
+		},
+	}
+}
+
 func (p *SungrowProvider) Initialize(ctx context.Context, cfg provider.ProviderConfig) error {
 	p.config = cfg
 
@@ -60,11 +76,18 @@ func (p *SungrowProvider) Initialize(ctx context.Context, cfg provider.ProviderC
 	p.client = provider.NewHTTPClient(baseURL, cfg.TimeoutSeconds, rps)
 	p.client.SetHeader("Content-Type", "application/json")
 	p.appKey = cfg.GetCredential("appKey")
+	p.client.SetSession(provider.Session{
+		Login:   p.authenticate,
+		Expired: sungrowSessionExpired,
+	})
+	p.client.SetRetryClassifier(sungrowRetryClass)
 
-	return p.authenticate(ctx)
+	return p.client.Authenticate(ctx)
 }
 
-func (p *SungrowProvider) authenticate(ctx context.Context) error {
+// authenticate logs in and installs the session token, which iSolarCloud
+// expects in the request body rather than a header.
+func (p *SungrowProvider) authenticate(ctx context.Context) (time.Time, error) {
 	account := p.config.GetCredential("userAccount")
 	password := p.config.GetCredential("userPassword")
 
@@ -79,27 +102,30 @@ func (p *SungrowProvider) authenticate(ctx context.Context) error {
 
 	var resp sungrowLoginResponse
 	if err := p.client.Post(ctx, "/openapi/login", body, &resp); err != nil {
-		return fmt.Errorf("Sungrow auth: %w", err)
+		return time.Time{}, fmt.Errorf("Sungrow auth: %w", err)
 	}
 	if resp.ResultCode != "1" {
-		return fmt.Errorf("Sungrow auth failed: code=%s msg=%s", resp.ResultCode, resp.ResultMsg)
+		return time.Time{}, sungrowError("auth", resp.sungrowBaseResponse)
 	}
 
-	p.token = resp.ResultData.Token
-	p.userID = resp.ResultData.UserID
-	p.client.SetHeader("token", p.token)
+	p.client.SetHeader("token", resp.ResultData.Token)
+	if err := p.client.SetBodyField("token", resp.ResultData.Token); err != nil {
+		return time.Time{}, err
+	}
+	if err := p.client.SetBodyField("user_id", resp.ResultData.UserID); err != nil {
+		return time.Time{}, err
+	}
 
 	log.Info().Str("provider", providerName).Msg("Authenticated successfully")
-	return nil
+	// iSolarCloud does not report a lifetime; expiry is detected from E00003.
+	return time.Time{}, nil
 }
 
 // ── Plants ──
 
 func (p *SungrowProvider) GetPlants(ctx context.Context) ([]models.NormalizedPlant, error) {
 	body := map[string]interface{}{
-		"appkey":  p.appKey,
-		"token":   p.token,
-		"user_id": p.userID,
+		"appkey": p.appKey,
 	}
 
 	var resp sungrowPlantListResponse
@@ -107,7 +133,7 @@ func (p *SungrowProvider) GetPlants(ctx context.Context) ([]models.NormalizedPla
 		return nil, fmt.Errorf("Sungrow GetPlants: %w", err)
 	}
 	if resp.ResultCode != "1" {
-		return nil, fmt.Errorf("Sungrow GetPlants failed: %s", resp.ResultMsg)
+		return nil, sungrowError("GetPlants", resp.sungrowBaseResponse)
 	}
 
 	var plants []models.NormalizedPlant
@@ -120,7 +146,6 @@ func (p *SungrowProvider) GetPlants(ctx context.Context) ([]models.NormalizedPla
 func (p *SungrowProvider) GetPlantDetails(ctx context.Context, plantID string) (*models.NormalizedPlant, error) {
 	body := map[string]interface{}{
 		"appkey": p.appKey,
-		"token":  p.token,
 		"ps_id":  plantID,
 	}
 
@@ -128,6 +153,9 @@ func (p *SungrowProvider) GetPlantDetails(ctx context.Context, plantID string) (
 	if err := p.client.Post(ctx, "/openapi/getPowerStationDetail", body, &resp); err != nil {
 		return nil, fmt.Errorf("Sungrow GetPlantDetails: %w", err)
 	}
+	if resp.ResultCode != "1" {
+		return nil, sungrowError("GetPlantDetails", resp.sungrowBaseResponse)
+	}
 
 	plant := normalizeSungrowPlantDetail(resp.ResultData)
 	return &plant, nil
@@ -138,7 +166,6 @@ func (p *SungrowProvider) GetPlantDetails(ctx context.Context, plantID string) (
 func (p *SungrowProvider) GetDevices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
 	body := map[string]interface{}{
 		"appkey": p.appKey,
-		"token":  p.token,
 		"ps_id":  plantID,
 	}
 
@@ -147,7 +174,7 @@ func (p *SungrowProvider) GetDevices(ctx context.Context, plantID string) ([]mod
 		return nil, fmt.Errorf("Sungrow GetDevices: %w", err)
 	}
 	if resp.ResultCode != "1" {
-		return nil, fmt.Errorf("Sungrow GetDevices failed: %s", resp.ResultMsg)
+		return nil, sungrowError("GetDevices", resp.sungrowBaseResponse)
 	}
 
 	var devices []models.NormalizedDevice
@@ -158,7 +185,8 @@ func (p *SungrowProvider) GetDevices(ctx context.Context, plantID string) ([]mod
 }
 
 func (p *SungrowProvider) GetDeviceDetails(ctx context.Context, deviceID string) (*models.NormalizedDevice, error) {
-	return nil, fmt.Errorf("Sungrow: use GetDevices with ps_id for device details")
+	// iSolarCloud has no single-device endpoint; details come with getDeviceList
+	return nil, provider.NotSupported(providerName, provider.OpGetDeviceDetails, "")
 }
 
 // ── Real-Time Data ──
@@ -166,7 +194,6 @@ func (p *SungrowProvider) GetDeviceDetails(ctx context.Context, deviceID string)
 func (p *SungrowProvider) GetRealTimeData(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
 	body := map[string]interface{}{
 		"appkey":    p.appKey,
-		"token":     p.token,
 		"device_id": deviceID,
 	}
 
@@ -174,6 +201,9 @@ func (p *SungrowProvider) GetRealTimeData(ctx context.Context, deviceID string)
 	if err := p.client.Post(ctx, "/openapi/queryDeviceRealTimeData", body, &resp); err != nil {
 		return nil, fmt.Errorf("Sungrow GetRealTimeData: %w", err)
 	}
+	if resp.ResultCode != "1" {
+		return nil, sungrowError("GetRealTimeData", resp.sungrowBaseResponse)
+	}
 
 	rt := normalizeSungrowRealtime(resp.ResultData, deviceID)
 	return &rt, nil
@@ -184,7 +214,6 @@ func (p *SungrowProvider) GetRealTimeData(ctx context.Context, deviceID string)
 func (p *SungrowProvider) GetEnergyStats(ctx context.Context, plantID string, period models.Period) (*models.NormalizedEnergy, error) {
 	body := map[string]interface{}{
 		"appkey": p.appKey,
-		"token":  p.token,
 		"ps_id":  plantID,
 	}
 
@@ -192,6 +221,9 @@ func (p *SungrowProvider) GetEnergyStats(ctx context.Context, plantID string, pe
 	if err := p.client.Post(ctx, "/openapi/getPowerStationDetail", body, &resp); err != nil {
 		return nil, fmt.Errorf("Sungrow GetEnergyStats: %w", err)
 	}
+	if resp.ResultCode != "1" {
+		return nil, sungrowError("GetEnergyStats", resp.sungrowBaseResponse)
+	}
 
 	energy := normalizeSungrowEnergy(resp.ResultData, plantID, period)
 	return &energy, nil
@@ -204,7 +236,6 @@ func (p *SungrowProvider) GetHistoricalData(ctx context.Context, deviceID string
 
 	body := map[string]interface{}{
 		"appkey":     p.appKey,
-		"token":      p.token,
 		"device_id":  deviceID,
 		"start_time": req.StartTime,
 		"end_time":   req.EndTime,
@@ -215,6 +246,9 @@ func (p *SungrowProvider) GetHistoricalData(ctx context.Context, deviceID string
 	if err := p.client.Post(ctx, "/openapi/queryDeviceHistoryData", body, &resp); err != nil {
 		return nil, fmt.Errorf("Sungrow GetHistoricalData: %w", err)
 	}
+	if resp.ResultCode != "1" {
+		return nil, sungrowError("GetHistoricalData", resp.sungrowBaseResponse)
+	}
 
 	history := normalizeSungrowHistory(resp, deviceID, req)
 	return &history, nil
@@ -225,7 +259,6 @@ func (p *SungrowProvider) GetHistoricalData(ctx context.Context, deviceID string
 func (p *SungrowProvider) GetAlarms(ctx context.Context, deviceID string) ([]models.NormalizedAlarm, error) {
 	body := map[string]interface{}{
 		"appkey":    p.appKey,
-		"token":     p.token,
 		"device_id": deviceID,
 	}
 
@@ -233,6 +266,9 @@ func (p *SungrowProvider) GetAlarms(ctx context.Context, deviceID string) ([]mod
 	if err := p.client.Post(ctx, "/openapi/getAlarmList", body, &resp); err != nil {
 		return nil, fmt.Errorf("Sungrow GetAlarms: %w", err)
 	}
+	if resp.ResultCode != "1" {
+		return nil, sungrowError("GetAlarms", resp.sungrowBaseResponse)
+	}
 
 	var alarms []models.NormalizedAlarm
 	for _, raw := range resp.ResultData.PageList {
@@ -243,15 +279,16 @@ func (p *SungrowProvider) GetAlarms(ctx context.Context, deviceID string) ([]mod
 
 func (p *SungrowProvider) GetAllAlarms(ctx context.Context) ([]models.NormalizedAlarm, error) {
 	body := map[string]interface{}{
-		"appkey":  p.appKey,
-		"token":   p.token,
-		"user_id": p.userID,
+		"appkey": p.appKey,
 	}
 
 	var resp sungrowAlarmResponse
 	if err := p.client.Post(ctx, "/openapi/getAlarmList", body, &resp); err != nil {
 		return nil, fmt.Errorf("Sungrow GetAllAlarms: %w", err)
 	}
+	if resp.ResultCode != "1" {
+		return nil, sungrowError("GetAllAlarms", resp.sungrowBaseResponse)
+	}
 
 	var alarms []models.NormalizedAlarm
 	for _, raw := range resp.ResultData.PageList {
@@ -261,7 +298,7 @@ func (p *SungrowProvider) GetAllAlarms(ctx context.Context) ([]models.Normalized
 }
 
 func (p *SungrowProvider) Healthy(ctx context.Context) bool {
-	return p.token != ""
+	return p.client.HasSession()
 }
 
 func (p *SungrowProvider) Close() error {
@@ -708,6 +745,44 @@ func sungrowAlarmStatus(status int) models.AlarmStatus {
 	}
 }
 
+// sungrowSessionExpired reports whether a response says the login token is no
+// longer valid.
+func sungrowSessionExpired(status int, body []byte) bool {
+	var resp sungrowBaseResponse
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	return resp.ResultCode == "E00003" || resp.ResultCode == "er_token_login_invalid"
+}
+
+// sungrowRetryClass treats the call-frequency result codes as throttling.
+func sungrowRetryClass(status int, body []byte) provider.RetryClass {
+	var resp sungrowBaseResponse
+	if json.Unmarshal(body, &resp) == nil && (resp.ResultCode == "E900" || resp.ResultCode == "er_access_limit") {
+		return provider.RetryThrottled
+	}
+	return provider.NoRetry
+}
+
+// sungrowError classifies an iSolarCloud result_code into the provider error taxonomy.
+func sungrowError(op string, resp sungrowBaseResponse) error {
+	var kind error
+	switch resp.ResultCode {
+	case "E00003", "er_token_login_invalid", "er_invalid_appkey", "er_unauthorized":
+		// session expired, token invalid, bad appkey, no access to the resource
+		kind = provider.ErrAuth
+	case "E900", "er_access_limit":
+		// call frequency exceeded
+		kind = provider.ErrRateLimited
+	case "er_missing_parameter", "er_parameter_value_invalid":
+		kind = provider.ErrInvalidRequest
+	default:
+		// an answer, so the API is up
+		kind = provider.ErrVendor
+	}
+	return provider.VendorError(kind, providerName, op, resp.ResultCode, resp.ResultMsg)
+}
+
 func sungrowTimeType(g models.Granularity) int {
 	switch g {
 	case models.GranularityMinute:
@@ -0,0 +1,89 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diskBuffer keeps batches that could not be delivered as files in a
+// directory, one file per batch, so they survive a restart. Only the
+// sink's flushing goroutine uses it.
+type diskBuffer struct {
+	dir      string
+	maxBytes int64
+	seq      int
+}
+
+func openDiskBuffer(dir string, maxBytes int64) (*diskBuffer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create buffer directory: %w", err)
+	}
+	return &diskBuffer{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// push stores a batch behind the others. When the buffer is over its size
+// limit the oldest batches are dropped; push returns how many.
+func (d *diskBuffer) push(batch []byte) (dropped int, err error) {
+	d.seq++
+	name := fmt.Sprintf("%020d-%06d.lp", time.Now().UnixNano(), d.seq%1000000)
+	tmp := filepath.Join(d.dir, name+".tmp")
+	if err := os.WriteFile(tmp, batch, 0o644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, filepath.Join(d.dir, name)); err != nil {
+		return 0, err
+	}
+
+	files, total := d.files()
+	for len(files) > 1 && total > d.maxBytes {
+		if err := os.Remove(filepath.Join(d.dir, files[0].Name())); err != nil {
+			return dropped, err
+		}
+		total -= files[0].Size()
+		files = files[1:]
+		dropped++
+	}
+	return dropped, nil
+}
+
+// oldest returns the oldest buffered batch.
+func (d *diskBuffer) oldest() (name string, batch []byte, ok bool, err error) {
+	files, _ := d.files()
+	if len(files) == 0 {
+		return "", nil, false, nil
+	}
+	name = files[0].Name()
+	batch, err = os.ReadFile(filepath.Join(d.dir, name))
+	return name, batch, err == nil, err
+}
+
+func (d *diskBuffer) remove(name string) error {
+	return os.Remove(filepath.Join(d.dir, name))
+}
+
+// files lists the buffered batches, oldest first, and their total size.
+func (d *diskBuffer) files() ([]os.FileInfo, int64) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, 0
+	}
+	var files []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".lp") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, total
+}
@@ -0,0 +1,346 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	influxAttempts = 3
+	influxBackoff  = time.Second
+
+	// maxPendingBatches bounds the lines held in memory while the flusher is
+	// busy; beyond it new lines are dropped.
+	maxPendingBatches = 10
+)
+
+// InfluxConfig configures the InfluxDB v2 sink.
+type InfluxConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	URL    string `yaml:"url"` // e.g. "http://localhost:8086"
+	Org    string `yaml:"org"`
+	Bucket string `yaml:"bucket"`
+	Token  string `yaml:"token"`
+
+	// Timestamp precision: "s" (default), "ms", "us" or "ns".
+	Precision string `yaml:"precision"`
+
+	// Lines per write (default 5000); smaller batches are written every
+	// flush_interval_seconds (default 10).
+	BatchSize            int `yaml:"batch_size"`
+	FlushIntervalSeconds int `yaml:"flush_interval_seconds"`
+	TimeoutSeconds       int `yaml:"timeout_seconds"` // per write (default 10)
+
+	// Batches that cannot be written are kept in this directory and retried
+	// until InfluxDB is back, oldest first. Beyond max_buffer_mb (default
+	// 100) the oldest are dropped. Empty drops failed batches.
+	BufferDir   string `yaml:"buffer_dir"`
+	MaxBufferMB int    `yaml:"max_buffer_mb"`
+}
+
+// DefaultInfluxConfig returns the InfluxDB settings used when the config file
+// sets none.
+func DefaultInfluxConfig() InfluxConfig {
+	return InfluxConfig{
+		Precision:            "s",
+		BatchSize:            5000,
+		FlushIntervalSeconds: 10,
+		TimeoutSeconds:       10,
+		BufferDir:            "data/influx-buffer",
+		MaxBufferMB:          100,
+	}
+}
+
+var precisions = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// Influx writes to the InfluxDB v2 /api/v2/write endpoint in line protocol.
+type Influx struct {
+	cfg      InfluxConfig
+	client   *http.Client
+	writeURL string
+	enc      encoder
+	buffer   *diskBuffer // nil without buffer_dir
+
+	mu      sync.Mutex
+	pending []string
+	closed  bool
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// NewInflux creates the InfluxDB sink and starts its background flusher.
+// store may be nil; when set, it maps devices to plants for the plant tag.
+func NewInflux(cfg InfluxConfig, store storage.Store) (*Influx, error) {
+	def := DefaultInfluxConfig()
+	if cfg.Precision == "" {
+		cfg.Precision = def.Precision
+	}
+	precision, ok := precisions[cfg.Precision]
+	if !ok {
+		return nil, fmt.Errorf("influxdb: invalid precision %q (want s, ms, us or ns)", cfg.Precision)
+	}
+	if cfg.URL == "" || cfg.Bucket == "" {
+		return nil, errors.New("influxdb: url and bucket are required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.FlushIntervalSeconds <= 0 {
+		cfg.FlushIntervalSeconds = def.FlushIntervalSeconds
+	}
+	if cfg.TimeoutSeconds <= 0 {
+		cfg.TimeoutSeconds = def.TimeoutSeconds
+	}
+	if cfg.MaxBufferMB <= 0 {
+		cfg.MaxBufferMB = def.MaxBufferMB
+	}
+
+	params := url.Values{}
+	params.Set("org", cfg.Org)
+	params.Set("bucket", cfg.Bucket)
+	params.Set("precision", cfg.Precision)
+
+	s := &Influx{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		writeURL: strings.TrimRight(cfg.URL, "/") + "/api/v2/write?" + params.Encode(),
+		enc:      encoder{precision: precision, plants: &plantIndex{store: store}},
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if cfg.BufferDir != "" {
+		buf, err := openDiskBuffer(cfg.BufferDir, int64(cfg.MaxBufferMB)<<20)
+		if err != nil {
+			return nil, fmt.Errorf("influxdb: %w", err)
+		}
+		s.buffer = buf
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *Influx) WriteRealtime(rt *models.NormalizedRealtime) {
+	s.enqueue(s.enc.realtime(nil, rt))
+}
+
+func (s *Influx) WriteTimeSeries(points []models.NormalizedTimeSeries) {
+	var lines []string
+	for i := range points {
+		lines = s.enc.timeSeries(lines, &points[i])
+	}
+	s.enqueue(lines)
+}
+
+func (s *Influx) enqueue(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if len(s.pending)+len(lines) > maxPendingBatches*s.cfg.BatchSize {
+		log.Warn().Int("lines", len(lines)).Msg("InfluxDB sink is falling behind, dropping points")
+		return
+	}
+	s.pending = append(s.pending, lines...)
+	if len(s.pending) >= s.cfg.BatchSize {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close writes what is pending, buffering it on disk if InfluxDB cannot be
+// reached, and stops the flusher.
+func (s *Influx) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+func (s *Influx) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(time.Duration(s.cfg.FlushIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flushPending(false)
+		case <-s.flush:
+			s.flushPending(false)
+		case <-s.stop:
+			s.flushPending(true)
+			return
+		}
+	}
+}
+
+// flushPending writes the buffered batches, then the pending lines. While
+// InfluxDB is unreachable new batches go to the disk buffer behind the older
+// ones, so points are delivered in order once it is back. final makes a
+// single attempt per batch, for shutdown.
+func (s *Influx) flushPending(final bool) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	down := !s.replay()
+	for len(pending) > 0 {
+		n := min(len(pending), s.cfg.BatchSize)
+		batch := []byte(strings.Join(pending[:n], "\n"))
+		pending = pending[n:]
+
+		if !down {
+			attempts := influxAttempts
+			if final {
+				attempts = 1
+			}
+			err := s.writeWithRetry(batch, attempts)
+			if err == nil {
+				continue
+			}
+			if permanent(err) {
+				log.Error().Err(err).Int("lines", n).Msg("InfluxDB rejected batch, dropping it")
+				continue
+			}
+			log.Warn().Err(err).Msg("InfluxDB write failed")
+			down = true
+		}
+		s.spill(batch, n)
+	}
+}
+
+// replay writes the disk buffer, oldest first. It reports false if InfluxDB
+// is still unreachable.
+func (s *Influx) replay() bool {
+	if s.buffer == nil {
+		return true
+	}
+	for {
+		name, batch, ok, err := s.buffer.oldest()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read InfluxDB buffer")
+			return true
+		}
+		if !ok {
+			return true
+		}
+		if err := s.write(batch); err != nil && !permanent(err) {
+			return false
+		} else if err != nil {
+			log.Error().Err(err).Str("file", name).Msg("InfluxDB rejected buffered batch, dropping it")
+		}
+		if err := s.buffer.remove(name); err != nil {
+			log.Error().Err(err).Str("file", name).Msg("Failed to remove delivered InfluxDB batch")
+			return true
+		}
+	}
+}
+
+func (s *Influx) spill(batch []byte, lines int) {
+	if s.buffer == nil {
+		log.Error().Int("lines", lines).Msg("InfluxDB unreachable and no buffer_dir set, dropping batch")
+		return
+	}
+	dropped, err := s.buffer.push(batch)
+	if err != nil {
+		log.Error().Err(err).Int("lines", lines).Msg("Failed to buffer InfluxDB batch, dropping it")
+		return
+	}
+	if dropped > 0 {
+		log.Warn().Int("batches", dropped).Msg("InfluxDB buffer full, dropped oldest batches")
+	}
+}
+
+func (s *Influx) writeWithRetry(batch []byte, attempts int) error {
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(influxBackoff << uint(attempt-1))
+		}
+		if err = s.write(batch); err == nil || permanent(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// writeError is an error response from InfluxDB.
+type writeError struct {
+	status int
+	body   string
+}
+
+func (e *writeError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.status, e.body)
+}
+
+// permanent reports whether retrying a batch cannot help: InfluxDB rejected
+// its content (e.g. a field type conflict, or points outside the retention).
+func permanent(err error) bool {
+	var werr *writeError
+	if !errors.As(err, &werr) {
+		return false
+	}
+	switch werr.status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+func (s *Influx) write(batch []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.writeURL, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.cfg.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 300 {
+		return &writeError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package sink
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+)
+
+// fakeInflux stands in for the InfluxDB v2 write endpoint.
+type fakeInflux struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	status  int        // answer to writes
+	writes  [][]string // lines of each accepted write
+	queries []string
+	refused int
+}
+
+func newFakeInflux(t *testing.T) (*fakeInflux, *httptest.Server) {
+	f := &fakeInflux{t: t, status: http.StatusNoContent}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeInflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/api/v2/write" {
+		f.t.Errorf("unexpected call %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	if got := r.Header.Get("Authorization"); got != "Token secret" {
+		f.t.Errorf("Authorization = %q", got)
+	}
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, r.URL.RawQuery)
+	if f.status >= 300 {
+		f.refused++
+		w.WriteHeader(f.status)
+		io.WriteString(w, `{"code":"invalid","message":"rejected"}`)
+		return
+	}
+	f.writes = append(f.writes, strings.Split(string(body), "\n"))
+	w.WriteHeader(f.status)
+}
+
+func (f *fakeInflux) setStatus(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakeInflux) stats() (writes [][]string, queries []string, refused int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writes, f.queries, f.refused
+}
+
+// lines returns the lines written so far, in the order they arrived.
+func (f *fakeInflux) lines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var lines []string
+	for _, w := range f.writes {
+		lines = append(lines, w...)
+	}
+	return lines
+}
+
+func newTestInflux(t *testing.T, url string, cfg InfluxConfig) *Influx {
+	t.Helper()
+	cfg.URL = url
+	cfg.Org = "home"
+	cfg.Bucket = "solar"
+	cfg.Token = "secret"
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	// Flushes come from a full batch or Close, not the ticker
+	cfg.FlushIntervalSeconds = 3600
+	s, err := NewInflux(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewInflux: %v", err)
+	}
+	return s
+}
+
+func ptr(f float64) *float64 { return &f }
+
+var testTime = time.Date(2024, 6, 14, 11, 5, 0, 0, time.UTC)
+
+func point(minute int, power float64) models.NormalizedTimeSeries {
+	return models.NormalizedTimeSeries{
+		DeviceID:    "huawei_inv1",
+		Timestamp:   testTime.Add(time.Duration(minute) * time.Minute),
+		Granularity: models.GranularityMinute,
+		PVPowerW:    &power,
+		Meta:        models.ProviderMeta{Instance: "huawei"},
+	}
+}
+
+func pointLine(minute int, power string) string {
+	ts := testTime.Add(time.Duration(minute) * time.Minute).Unix()
+	return "history,provider=huawei,device=huawei_inv1,granularity=minute pv_power_w=" + power + " " + strconv.FormatInt(ts, 10)
+}
+
+func TestInfluxEscapingAndPrecision(t *testing.T) {
+	api, srv := newFakeInflux(t)
+	s := newTestInflux(t, srv.URL, InfluxConfig{Precision: "ms"})
+
+	s.WriteRealtime(&models.NormalizedRealtime{
+		DeviceID:      `sma_roof west,1=a`,
+		Timestamp:     testTime,
+		Status:        models.DeviceStatus(`say "hi" \o/`),
+		OperatingMode: models.OperatingModeGridConnected,
+		Grid: &models.GridData{
+			TotalPowerW: -1500.5,
+			Phases:      []models.PhaseData{{Phase: "L 1", VoltageV: ptr(231.2)}},
+		},
+		Meta: models.ProviderMeta{Instance: "sma", ProviderPlantID: "p 1"},
+	})
+	s.Close()
+
+	_, queries, _ := api.stats()
+	if len(queries) != 1 {
+		t.Fatalf("%d writes, want 1", len(queries))
+	}
+	if q := queries[0]; q != "bucket=solar&org=home&precision=ms" {
+		t.Errorf("query = %q", q)
+	}
+	tags := `provider=sma,plant=sma_p\ 1,device=sma_roof\ west\,1\=a`
+	want := []string{
+		`device,` + tags + ` status="say \"hi\" \\o/",operating_mode="` + string(models.OperatingModeGridConnected) + `" 1718363100000`,
+		`grid,` + tags + ` power_w=-1500.5 1718363100000`,
+		`grid_phase,` + tags + `,phase=L\ 1 voltage_v=231.2 1718363100000`,
+	}
+	got := api.lines()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestInfluxBatching(t *testing.T) {
+	api, srv := newFakeInflux(t)
+	s := newTestInflux(t, srv.URL, InfluxConfig{BatchSize: 2})
+
+	var points []models.NormalizedTimeSeries
+	var want []string
+	for i := 0; i < 5; i++ {
+		points = append(points, point(i, float64(100+i)))
+		want = append(want, pointLine(i, strconv.Itoa(100+i)))
+	}
+	s.WriteTimeSeries(points)
+	s.Close()
+
+	if got := api.lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	writes, queries, _ := api.stats()
+	if len(writes) != 3 {
+		t.Errorf("%d writes of 5 lines in batches of 2, want 3", len(writes))
+	}
+	for _, w := range writes {
+		if len(w) > 2 {
+			t.Errorf("write of %d lines exceeds the batch size", len(w))
+		}
+	}
+	if q := queries[0]; !strings.Contains(q, "precision=s") {
+		t.Errorf("default precision missing from %q", q)
+	}
+}
+
+func TestInfluxBuffersWhileDownAndReplaysInOrder(t *testing.T) {
+	api, srv := newFakeInflux(t)
+	dir := t.TempDir()
+	api.setStatus(http.StatusServiceUnavailable)
+
+	// Two runs while InfluxDB is down: each batch is buffered behind the last
+	s := newTestInflux(t, srv.URL, InfluxConfig{BufferDir: dir})
+	s.WriteTimeSeries([]models.NormalizedTimeSeries{point(0, 1), point(1, 2)})
+	s.Close()
+	s = newTestInflux(t, srv.URL, InfluxConfig{BufferDir: dir})
+	s.WriteTimeSeries([]models.NormalizedTimeSeries{point(2, 3)})
+	s.Close()
+
+	if files, _ := (&diskBuffer{dir: dir}).files(); len(files) != 2 {
+		t.Fatalf("%d batches buffered, want 2", len(files))
+	}
+	if len(api.lines()) != 0 {
+		t.Fatal("lines accepted while InfluxDB was down")
+	}
+
+	// Back up: the buffer is replayed, oldest first, before new points
+	api.setStatus(http.StatusNoContent)
+	s = newTestInflux(t, srv.URL, InfluxConfig{BufferDir: dir})
+	s.WriteTimeSeries([]models.NormalizedTimeSeries{point(3, 4)})
+	s.Close()
+
+	want := []string{pointLine(0, "1"), pointLine(1, "2"), pointLine(2, "3"), pointLine(3, "4")}
+	if got := api.lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("%d files left in the buffer after replay", len(entries))
+	}
+}
+
+func TestInfluxDropsRejectedBatch(t *testing.T) {
+	api, srv := newFakeInflux(t)
+	dir := t.TempDir()
+	api.setStatus(http.StatusBadRequest)
+
+	// A full batch is flushed with retries; a 400 must not be retried
+	s := newTestInflux(t, srv.URL, InfluxConfig{BatchSize: 1, BufferDir: dir})
+	s.WriteTimeSeries([]models.NormalizedTimeSeries{point(0, 1)})
+	s.Close()
+
+	if _, _, refused := api.stats(); refused != 1 {
+		t.Errorf("rejected batch sent %d times, want 1", refused)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("rejected batch buffered: %d files", len(entries))
+	}
+
+	// Nothing of it is replayed later
+	api.setStatus(http.StatusNoContent)
+	s = newTestInflux(t, srv.URL, InfluxConfig{BufferDir: dir})
+	s.WriteTimeSeries([]models.NormalizedTimeSeries{point(1, 2)})
+	s.Close()
+
+	if got := api.lines(); len(got) != 1 || got[0] != pointLine(1, "2") {
+		t.Errorf("lines = %q", got)
+	}
+}
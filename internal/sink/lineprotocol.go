@@ -0,0 +1,213 @@
+package sink
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+)
+
+// Measurements written for realtime snapshots, all tagged with provider,
+// plant and device:
+//
+//	device       status, operating_mode
+//	pv           power_w, today_energy_kwh, total_energy_kwh
+//	pv_string    (tag string) voltage_v, current_a, power_w
+//	battery      power_w, soc_percent, temperature_c, today/total charge and discharge
+//	grid         power_w, frequency_hz, power_factor, today/total import and export
+//	grid_phase   (tag phase) voltage_v, current_a, power_w, frequency_hz, power_factor
+//	load         power_w, today_energy_kwh, total_energy_kwh
+//
+// History points go to "history", tagged with granularity as well, and their
+// grid phases to "history_grid_phase".
+
+// tag is a line protocol tag; tags with an empty value are left out.
+type tag struct{ key, value string }
+
+// fields collects the fields of a line; nil and non-finite values are left out.
+type fields struct {
+	keys   []string
+	values []string
+}
+
+func (f *fields) float(key string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	f.keys = append(f.keys, key)
+	f.values = append(f.values, strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func (f *fields) floatPtr(key string, v *float64) {
+	if v != nil {
+		f.float(key, *v)
+	}
+}
+
+func (f *fields) str(key, v string) {
+	if v == "" {
+		return
+	}
+	f.keys = append(f.keys, key)
+	f.values = append(f.values, `"`+fieldEscaper.Replace(v)+`"`)
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+	fieldEscaper       = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// encoder renders normalized data as InfluxDB line protocol.
+type encoder struct {
+	precision time.Duration
+	plants    *plantIndex
+}
+
+// line appends one line to lines. Lines without fields are not written.
+func (e *encoder) line(lines []string, measurement string, tags []tag, f fields, t time.Time) []string {
+	if len(f.keys) == 0 {
+		return lines
+	}
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+	for _, tg := range tags {
+		if tg.value == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(tg.key))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tg.value))
+	}
+	for i, key := range f.keys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(key))
+		b.WriteByte('=')
+		b.WriteString(f.values[i])
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(t.UnixNano()/int64(e.precision), 10))
+	return append(lines, b.String())
+}
+
+func (e *encoder) realtime(lines []string, rt *models.NormalizedRealtime) []string {
+	t := rt.Timestamp
+	if t.IsZero() {
+		t = rt.Meta.FetchedAt
+	}
+	tags := []tag{
+		{"provider", rt.Meta.Instance},
+		{"plant", e.plants.lookup(rt.DeviceID, &rt.Meta)},
+		{"device", rt.DeviceID},
+	}
+
+	var dev fields
+	dev.str("status", string(rt.Status))
+	dev.str("operating_mode", string(rt.OperatingMode))
+	lines = e.line(lines, "device", tags, dev, t)
+
+	if pv := rt.PV; pv != nil {
+		var f fields
+		f.float("power_w", pv.TotalPowerW)
+		f.floatPtr("today_energy_kwh", pv.TodayEnergyKWh)
+		f.floatPtr("total_energy_kwh", pv.TotalEnergyKWh)
+		lines = e.line(lines, "pv", tags, f, t)
+		for _, s := range pv.Strings {
+			var f fields
+			f.floatPtr("voltage_v", s.VoltageV)
+			f.floatPtr("current_a", s.CurrentA)
+			f.floatPtr("power_w", s.PowerW)
+			lines = e.line(lines, "pv_string", append(tags, tag{"string", strconv.Itoa(s.ID)}), f, t)
+		}
+		for _, m := range pv.Modules {
+			var f fields
+			f.floatPtr("power_w", m.PowerW)
+			f.floatPtr("energy_kwh", m.EnergyKWh)
+			lines = e.line(lines, "pv_module", append(tags, tag{"module", m.SerialNumber}), f, t)
+		}
+	}
+
+	if bat := rt.Battery; bat != nil {
+		var f fields
+		f.float("power_w", bat.PowerW)
+		f.floatPtr("soc_percent", bat.SOCPercent)
+		f.floatPtr("temperature_c", bat.TemperatureC)
+		f.floatPtr("today_charge_kwh", bat.TodayChargeKWh)
+		f.floatPtr("today_discharge_kwh", bat.TodayDischargeKWh)
+		f.floatPtr("total_charge_kwh", bat.TotalChargeKWh)
+		f.floatPtr("total_discharge_kwh", bat.TotalDischargeKWh)
+		f.str("direction", string(bat.Direction))
+		lines = e.line(lines, "battery", tags, f, t)
+	}
+
+	if grid := rt.Grid; grid != nil {
+		var f fields
+		f.float("power_w", grid.TotalPowerW)
+		f.floatPtr("frequency_hz", grid.FrequencyHz)
+		f.floatPtr("power_factor", grid.PowerFactor)
+		f.floatPtr("today_import_kwh", grid.TodayImportKWh)
+		f.floatPtr("today_export_kwh", grid.TodayExportKWh)
+		f.floatPtr("total_import_kwh", grid.TotalImportKWh)
+		f.floatPtr("total_export_kwh", grid.TotalExportKWh)
+		f.str("direction", string(grid.Direction))
+		lines = e.line(lines, "grid", tags, f, t)
+		lines = e.phases(lines, "grid_phase", tags, grid.Phases, t)
+	}
+
+	if load := rt.Load; load != nil {
+		var f fields
+		f.float("power_w", load.TotalPowerW)
+		f.floatPtr("today_energy_kwh", load.TodayEnergyKWh)
+		f.floatPtr("total_energy_kwh", load.TotalEnergyKWh)
+		lines = e.line(lines, "load", tags, f, t)
+	}
+	return lines
+}
+
+func (e *encoder) timeSeries(lines []string, dp *models.NormalizedTimeSeries) []string {
+	tags := []tag{
+		{"provider", dp.Meta.Instance},
+		{"plant", e.plants.lookup(dp.DeviceID, &dp.Meta)},
+		{"device", dp.DeviceID},
+		{"granularity", string(dp.Granularity)},
+	}
+
+	var f fields
+	f.floatPtr("pv_power_w", dp.PVPowerW)
+	f.floatPtr("load_power_w", dp.LoadPowerW)
+	f.floatPtr("grid_power_w", dp.GridPowerW)
+	f.floatPtr("grid_import_power_w", dp.GridImportPowerW)
+	f.floatPtr("grid_export_power_w", dp.GridExportPowerW)
+	f.floatPtr("battery_power_w", dp.BatteryPowerW)
+	f.floatPtr("battery_soc_percent", dp.BatterySOC)
+	f.floatPtr("self_use_power_w", dp.SelfUsePowerW)
+	f.floatPtr("pv_energy_kwh", dp.PVEnergyKWh)
+	f.floatPtr("load_energy_kwh", dp.LoadEnergyKWh)
+	f.floatPtr("grid_import_energy_kwh", dp.GridImportEnergyKWh)
+	f.floatPtr("grid_export_energy_kwh", dp.GridExportEnergyKWh)
+	f.floatPtr("battery_charge_kwh", dp.BatteryChargeKWh)
+	f.floatPtr("battery_discharge_kwh", dp.BatteryDischargeKWh)
+	f.floatPtr("self_consumption_kwh", dp.SelfConsumptionKWh)
+	lines = e.line(lines, "history", tags, f, dp.Timestamp)
+	return e.phases(lines, "history_grid_phase", tags, dp.GridPhases, dp.Timestamp)
+}
+
+func (e *encoder) phases(lines []string, measurement string, tags []tag, phases []models.PhaseData, t time.Time) []string {
+	for _, ph := range phases {
+		var f fields
+		f.floatPtr("voltage_v", ph.VoltageV)
+		f.floatPtr("current_a", ph.CurrentA)
+		f.floatPtr("power_w", ph.PowerW)
+		f.floatPtr("frequency_hz", ph.FrequencyHz)
+		f.floatPtr("power_factor", ph.PowerFactor)
+		lines = e.line(lines, measurement, append(tags, tag{"phase", ph.Phase}), f, t)
+	}
+	return lines
+}
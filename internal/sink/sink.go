@@ -0,0 +1,86 @@
+// Package sink exports normalized data to external time series databases.
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/normalizer"
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// Sink receives normalized data for export. Writes are called from engine
+// hooks and must not block: implementations queue the data and deliver it in
+// the background. The data passed in is shared and must not be modified.
+type Sink interface {
+	WriteRealtime(rt *models.NormalizedRealtime)
+	WriteTimeSeries(points []models.NormalizedTimeSeries)
+
+	// Close delivers what is queued, as far as possible, and stops the sink.
+	Close() error
+}
+
+// Config selects the output sinks.
+type Config struct {
+	InfluxDB InfluxConfig `yaml:"influxdb"`
+}
+
+// DefaultConfig returns the sink settings used when the config file sets none.
+func DefaultConfig() Config {
+	return Config{InfluxDB: DefaultInfluxConfig()}
+}
+
+// Attach feeds s every realtime snapshot and history response the engine
+// fetches, including those fetched by the collector and backfills.
+func Attach(engine *normalizer.Engine, s Sink) {
+	engine.OnRealtime(s.WriteRealtime)
+	engine.OnHistory(func(history *models.HistoryResponse) {
+		if len(history.DataPoints) > 0 {
+			s.WriteTimeSeries(history.DataPoints)
+		}
+	})
+}
+
+// plantRefresh is how often the device → plant mapping is reloaded from the
+// store.
+const plantRefresh = 10 * time.Minute
+
+// plantIndex finds the plant of a device: from the plant ID the vendor put in
+// the data if there is one, else from the devices the collector stored.
+type plantIndex struct {
+	store storage.Store // may be nil
+
+	mu     sync.Mutex
+	plants map[string]string
+	loaded time.Time
+}
+
+func (p *plantIndex) lookup(deviceID string, meta *models.ProviderMeta) string {
+	if meta.ProviderPlantID != "" {
+		return normalizer.FormatID(meta.Instance, meta.ProviderPlantID)
+	}
+	if p.store == nil {
+		return ""
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.loaded) > plantRefresh {
+		p.loaded = time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		devices, err := p.store.Devices(ctx, "")
+		if err != nil {
+			log.Warn().Err(err).Msg("Sink could not read devices from store")
+		} else {
+			p.plants = make(map[string]string, len(devices))
+			for _, dev := range devices {
+				p.plants[dev.ID] = dev.PlantID
+			}
+		}
+	}
+	return p.plants[deviceID]
+}
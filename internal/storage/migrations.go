@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrations are applied in order and recorded in schema_migrations; the
+// version of a migration is its index + 1. Never edit an applied migration,
+// append a new one instead.
+//
+// Entities are stored as their JSON encoding in data, with the columns used
+// for lookups and retention split out. Times are Unix milliseconds.
+var migrations = []string{
+	// 1: initial schema
+	`CREATE TABLE plants (
+		id         TEXT PRIMARY KEY,
+		provider   TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE TABLE devices (
+		id         TEXT PRIMARY KEY,
+		plant_id   TEXT NOT NULL,
+		provider   TEXT NOT NULL,
+		data       TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	CREATE INDEX devices_plant ON devices (plant_id);
+	CREATE TABLE realtime (
+		device_id TEXT NOT NULL,
+		ts        INTEGER NOT NULL,
+		data      TEXT NOT NULL,
+		PRIMARY KEY (device_id, ts)
+	) WITHOUT ROWID;
+	CREATE INDEX realtime_ts ON realtime (ts);
+	CREATE TABLE timeseries (
+		device_id   TEXT NOT NULL,
+		granularity TEXT NOT NULL,
+		ts          INTEGER NOT NULL,
+		data        TEXT NOT NULL,
+		PRIMARY KEY (device_id, granularity, ts)
+	) WITHOUT ROWID;
+	CREATE INDEX timeseries_ts ON timeseries (ts);
+	CREATE TABLE alarms (
+		id         TEXT PRIMARY KEY,
+		device_id  TEXT NOT NULL,
+		plant_id   TEXT NOT NULL,
+		status     TEXT NOT NULL,
+		start_time INTEGER NOT NULL,
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX alarms_device_start ON alarms (device_id, start_time);
+	CREATE INDEX alarms_plant_start ON alarms (plant_id, start_time);
+	CREATE INDEX alarms_start ON alarms (start_time);`,
+
+	// 2: resumable job checkpoints
+	`CREATE TABLE checkpoints (
+		key        TEXT PRIMARY KEY,
+		data       TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+
+	// 3: alarm lifecycle events
+	`CREATE TABLE alarm_events (
+		id        TEXT PRIMARY KEY,
+		provider  TEXT NOT NULL,
+		device_id TEXT NOT NULL,
+		plant_id  TEXT NOT NULL,
+		type      TEXT NOT NULL,
+		ts        INTEGER NOT NULL,
+		data      TEXT NOT NULL
+	);
+	CREATE INDEX alarm_events_ts ON alarm_events (ts);
+	CREATE INDEX alarm_events_device_ts ON alarm_events (device_id, ts);`,
+
+	// 4: plants and devices keyed by provider instance, as alarm events
+	// are; rows saved before held the provider type
+	`UPDATE plants SET provider = json_extract(data, '$.meta.instance')
+		WHERE COALESCE(json_extract(data, '$.meta.instance'), '') != '';
+	UPDATE devices SET provider = json_extract(data, '$.meta.instance')
+		WHERE COALESCE(json_extract(data, '$.meta.instance'), '') != '';`,
+
+	// 5: an event stays open until its alarm (provider instance, device and
+	// code) is cleared, so the active alarms can be restored without
+	// reading the whole history
+	`ALTER TABLE alarm_events ADD COLUMN code TEXT NOT NULL DEFAULT '';
+	ALTER TABLE alarm_events ADD COLUMN cleared_at INTEGER;
+	UPDATE alarm_events SET code = COALESCE(json_extract(data, '$.code'), '');
+	UPDATE alarm_events SET cleared_at = (
+		SELECT MIN(c.ts) FROM alarm_events c
+		WHERE c.type = 'cleared' AND c.provider = alarm_events.provider
+			AND c.device_id = alarm_events.device_id AND c.code = alarm_events.code
+			AND c.ts >= alarm_events.ts
+	);
+	CREATE INDEX alarm_events_open ON alarm_events (provider, device_id, code) WHERE cleared_at IS NULL;
+	CREATE TRIGGER alarm_events_clear AFTER INSERT ON alarm_events WHEN NEW.type = 'cleared'
+	BEGIN
+		UPDATE alarm_events SET cleared_at = NEW.ts
+		WHERE provider = NEW.provider AND device_id = NEW.device_id AND code = NEW.code
+			AND cleared_at IS NULL AND ts <= NEW.ts;
+	END;`,
+}
+
+// migrate brings the schema up to date.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this build (%d)", current, len(migrations))
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, version, time.Now().UnixMilli()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
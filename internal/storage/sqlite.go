@@ -0,0 +1,394 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+	"github.com/rs/zerolog/log"
+
+	_ "modernc.org/sqlite" // pure-Go driver, registered as "sqlite"
+)
+
+// pruneInterval is how often the retention policy is applied.
+const pruneInterval = time.Hour
+
+// SQLiteStore is a Store backed by an embedded SQLite database.
+type SQLiteStore struct {
+	db        *sql.DB
+	retention RetentionConfig
+
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+	closeErr error
+	once     sync.Once
+}
+
+// OpenSQLite opens (creating if needed) the database at path, applies pending
+// migrations and starts pruning data per retention. An empty path opens a
+// private in-memory database.
+func OpenSQLite(path string, retention RetentionConfig) (*SQLiteStore, error) {
+	dsn := "file::memory:"
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("create storage directory: %w", err)
+		}
+		dsn = "file:" + path + "?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)"
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", path, err)
+	}
+	// SQLite allows one writer at a time, and every connection to an
+	// in-memory database would get its own empty database.
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate sqlite %s: %w", path, err)
+	}
+
+	s := &SQLiteStore{db: db, retention: retention, stop: make(chan struct{})}
+	s.stopped.Add(1)
+	go s.pruneLoop()
+	return s, nil
+}
+
+func (s *SQLiteStore) pruneLoop() {
+	defer s.stopped.Done()
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.Prune(context.Background())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to prune storage")
+		} else if n > 0 {
+			log.Info().Int64("rows", n).Msg("Pruned expired data from storage")
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops pruning and closes the database.
+func (s *SQLiteStore) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+		s.stopped.Wait()
+		s.closeErr = s.db.Close()
+	})
+	return s.closeErr
+}
+
+// ── Plants & devices ──
+
+func (s *SQLiteStore) SavePlants(ctx context.Context, plants []models.NormalizedPlant) error {
+	now := time.Now().UnixMilli()
+	return s.saveAll(ctx, `INSERT OR REPLACE INTO plants (id, provider, data, updated_at) VALUES (?, ?, ?, ?)`,
+		len(plants), func(i int) ([]interface{}, error) {
+			data, err := json.Marshal(&plants[i])
+			return []interface{}{plants[i].ID, instanceOf(plants[i].Meta, plants[i].Provider), string(data), now}, err
+		})
+}
+
+func (s *SQLiteStore) Plants(ctx context.Context) ([]models.NormalizedPlant, error) {
+	return queryJSON[models.NormalizedPlant](ctx, s.db, `SELECT data FROM plants ORDER BY id`)
+}
+
+func (s *SQLiteStore) SaveDevices(ctx context.Context, devices []models.NormalizedDevice) error {
+	now := time.Now().UnixMilli()
+	return s.saveAll(ctx, `INSERT OR REPLACE INTO devices (id, plant_id, provider, data, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		len(devices), func(i int) ([]interface{}, error) {
+			data, err := json.Marshal(&devices[i])
+			return []interface{}{devices[i].ID, devices[i].PlantID, instanceOf(devices[i].Meta, devices[i].Provider), string(data), now}, err
+		})
+}
+
+func (s *SQLiteStore) Devices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error) {
+	if plantID == "" {
+		return queryJSON[models.NormalizedDevice](ctx, s.db, `SELECT data FROM devices ORDER BY id`)
+	}
+	return queryJSON[models.NormalizedDevice](ctx, s.db, `SELECT data FROM devices WHERE plant_id = ? ORDER BY id`, plantID)
+}
+
+// ── Realtime ──
+
+func (s *SQLiteStore) SaveRealtime(ctx context.Context, rt *models.NormalizedRealtime) error {
+	data, err := json.Marshal(rt)
+	if err != nil {
+		return fmt.Errorf("encode realtime %s: %w", rt.DeviceID, err)
+	}
+	ts := rt.Timestamp
+	if ts.IsZero() {
+		ts = rt.Meta.FetchedAt
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT OR REPLACE INTO realtime (device_id, ts, data) VALUES (?, ?, ?)`,
+		rt.DeviceID, ts.UnixMilli(), string(data))
+	if err != nil {
+		return fmt.Errorf("save realtime %s: %w", rt.DeviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) LatestRealtime(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error) {
+	rows, err := queryJSON[models.NormalizedRealtime](ctx, s.db,
+		`SELECT data FROM realtime WHERE device_id = ? ORDER BY ts DESC LIMIT 1`, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+func (s *SQLiteStore) RealtimeRange(ctx context.Context, deviceID string, from, to time.Time) ([]models.NormalizedRealtime, error) {
+	return queryJSON[models.NormalizedRealtime](ctx, s.db,
+		`SELECT data FROM realtime WHERE device_id = ? AND ts >= ? AND ts < ? ORDER BY ts`,
+		deviceID, from.UnixMilli(), to.UnixMilli())
+}
+
+// ── Time series ──
+
+func (s *SQLiteStore) SaveTimeSeries(ctx context.Context, points []models.NormalizedTimeSeries) error {
+	return s.saveAll(ctx, `INSERT OR REPLACE INTO timeseries (device_id, granularity, ts, data) VALUES (?, ?, ?, ?)`,
+		len(points), func(i int) ([]interface{}, error) {
+			dp := &points[i]
+			data, err := json.Marshal(dp)
+			return []interface{}{dp.DeviceID, string(dp.Granularity), dp.Timestamp.UnixMilli(), string(data)}, err
+		})
+}
+
+func (s *SQLiteStore) TimeSeriesRange(ctx context.Context, deviceID string, granularity models.Granularity, from, to time.Time) ([]models.NormalizedTimeSeries, error) {
+	return queryJSON[models.NormalizedTimeSeries](ctx, s.db,
+		`SELECT data FROM timeseries WHERE device_id = ? AND granularity = ? AND ts >= ? AND ts < ? ORDER BY ts`,
+		deviceID, string(granularity), from.UnixMilli(), to.UnixMilli())
+}
+
+// ── Alarms ──
+
+func (s *SQLiteStore) SaveAlarms(ctx context.Context, alarms []models.NormalizedAlarm) error {
+	return s.saveAll(ctx, `INSERT OR REPLACE INTO alarms (id, device_id, plant_id, status, start_time, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		len(alarms), func(i int) ([]interface{}, error) {
+			a := &alarms[i]
+			data, err := json.Marshal(a)
+			return []interface{}{alarmKey(a), a.DeviceID, a.PlantID, string(a.Status), a.StartTime.UnixMilli(), string(data)}, err
+		})
+}
+
+func (s *SQLiteStore) Alarms(ctx context.Context, q AlarmQuery) ([]models.NormalizedAlarm, error) {
+	var where []string
+	var args []interface{}
+	if q.DeviceID != "" {
+		where = append(where, "device_id = ?")
+		args = append(args, q.DeviceID)
+	}
+	if q.PlantID != "" {
+		where = append(where, "plant_id = ?")
+		args = append(args, q.PlantID)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "start_time >= ?")
+		args = append(args, q.From.UnixMilli())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "start_time < ?")
+		args = append(args, q.To.UnixMilli())
+	}
+
+	query := `SELECT data FROM alarms`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY start_time DESC`
+	return queryJSON[models.NormalizedAlarm](ctx, s.db, query, args...)
+}
+
+func (s *SQLiteStore) SaveAlarmEvents(ctx context.Context, events []models.AlarmEvent) error {
+	// The alarm_events_clear trigger closes the events of cleared alarms.
+	return s.saveAll(ctx, `INSERT OR REPLACE INTO alarm_events (id, provider, device_id, plant_id, code, type, ts, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		len(events), func(i int) ([]interface{}, error) {
+			ev := &events[i]
+			data, err := json.Marshal(ev)
+			return []interface{}{ev.ID, ev.Provider, ev.DeviceID, ev.PlantID, ev.Code, string(ev.Type), ev.Time.UnixMilli(), string(data)}, err
+		})
+}
+
+func (s *SQLiteStore) OpenAlarmEvents(ctx context.Context) ([]models.AlarmEvent, error) {
+	return queryJSON[models.AlarmEvent](ctx, s.db, `SELECT data FROM alarm_events WHERE cleared_at IS NULL ORDER BY ts DESC, rowid DESC`)
+}
+
+func (s *SQLiteStore) AlarmEvents(ctx context.Context, q AlarmEventQuery) ([]models.AlarmEvent, error) {
+	var where []string
+	var args []interface{}
+	for _, f := range []struct{ column, value string }{
+		{"provider", q.Provider},
+		{"device_id", q.DeviceID},
+		{"plant_id", q.PlantID},
+		{"type", string(q.Type)},
+	} {
+		if f.value != "" {
+			where = append(where, f.column+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	if !q.From.IsZero() {
+		where = append(where, "ts >= ?")
+		args = append(args, q.From.UnixMilli())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "ts < ?")
+		args = append(args, q.To.UnixMilli())
+	}
+
+	query := `SELECT data FROM alarm_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// Events detected in the same millisecond keep their insertion order.
+	query += ` ORDER BY ts DESC, rowid DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+	return queryJSON[models.AlarmEvent](ctx, s.db, query, args...)
+}
+
+// instanceOf returns the provider instance recorded in meta, falling back to
+// the provider type for data normalized without one.
+func instanceOf(meta models.ProviderMeta, providerType string) string {
+	if meta.Instance != "" {
+		return meta.Instance
+	}
+	return providerType
+}
+
+// alarmKey identifies an alarm. Vendors that report no alarm ID are keyed by
+// device, code and start time.
+func alarmKey(a *models.NormalizedAlarm) string {
+	if a.ID != "" {
+		return a.ID
+	}
+	return fmt.Sprintf("%s/%s/%d", a.DeviceID, a.Code, a.StartTime.UnixMilli())
+}
+
+// ── Checkpoints ──
+
+func (s *SQLiteStore) Checkpoint(ctx context.Context, key string) (*Checkpoint, error) {
+	rows, err := queryJSON[Checkpoint](ctx, s.db, `SELECT data FROM checkpoints WHERE key = ?`, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+func (s *SQLiteStore) SaveCheckpoint(ctx context.Context, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint %s: %w", cp.Key, err)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT OR REPLACE INTO checkpoints (key, data, updated_at) VALUES (?, ?, ?)`,
+		cp.Key, string(data), time.Now().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.Key, err)
+	}
+	return nil
+}
+
+// ── Retention ──
+
+func (s *SQLiteStore) Prune(ctx context.Context) (int64, error) {
+	now := time.Now()
+	cutoff := func(days int) int64 { return now.AddDate(0, 0, -days).UnixMilli() }
+
+	var total int64
+	for _, rule := range []struct {
+		days  int
+		query string
+	}{
+		{s.retention.RealtimeDays, `DELETE FROM realtime WHERE ts < ?`},
+		{s.retention.TimeSeriesDays, `DELETE FROM timeseries WHERE ts < ?`},
+		{s.retention.AlarmsDays, `DELETE FROM alarms WHERE start_time < ? AND status <> 'active'`},
+		{s.retention.AlarmsDays, `DELETE FROM alarm_events WHERE ts < ?`},
+	} {
+		if rule.days <= 0 {
+			continue
+		}
+		res, err := s.db.ExecContext(ctx, rule.query, cutoff(rule.days))
+		if err != nil {
+			return total, fmt.Errorf("prune: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+// ── Helpers ──
+
+// saveAll runs query once per row inside a single transaction.
+func (s *SQLiteStore) saveAll(ctx context.Context, query string, n int, args func(i int) ([]interface{}, error)) error {
+	if n == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i := 0; i < n; i++ {
+		row, err := args(i)
+		if err != nil {
+			return fmt.Errorf("encode row %d: %w", i, err)
+		}
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryJSON runs a query selecting a single JSON column and decodes each row.
+func queryJSON[T any](ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []T
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("decode stored row: %w", err)
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+)
+
+// undoMigration5 rolls the schema back to version 4.
+const undoMigration5 = `DROP TRIGGER alarm_events_clear; DROP INDEX alarm_events_open;
+	ALTER TABLE alarm_events DROP COLUMN code; ALTER TABLE alarm_events DROP COLUMN cleared_at;
+	DELETE FROM schema_migrations WHERE version = 5;`
+
+// providerColumns returns the provider column of every plant and device row.
+func providerColumns(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT provider FROM plants UNION ALL SELECT provider FROM devices`)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var p string
+		rows.Scan(&p)
+		got = append(got, p)
+	}
+	return got
+}
+
+func TestPlantsAndDevicesStoreInstance(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.db")
+	s, err := OpenSQLite(path, RetentionConfig{})
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+
+	meta := models.ProviderMeta{Provider: "huawei", Instance: "huawei-eu"}
+	if err := s.SavePlants(ctx, []models.NormalizedPlant{{ID: "huawei-eu_NE=1", Provider: "huawei", Meta: meta}}); err != nil {
+		t.Fatalf("SavePlants: %v", err)
+	}
+	if err := s.SaveDevices(ctx, []models.NormalizedDevice{{ID: "huawei-eu_inv1", PlantID: "huawei-eu_NE=1", Provider: "huawei", Meta: meta}}); err != nil {
+		t.Fatalf("SaveDevices: %v", err)
+	}
+	for _, p := range providerColumns(t, s.db) {
+		if p != "huawei-eu" {
+			t.Errorf("provider column %q, want the instance huawei-eu", p)
+		}
+	}
+
+	// Rows written before migration 4 hold the provider type; reopening
+	// after rolling the migration back applies it again
+	if _, err := s.db.Exec(undoMigration5 + `UPDATE plants SET provider = 'huawei'; UPDATE devices SET provider = 'huawei';
+		DELETE FROM schema_migrations WHERE version = 4`); err != nil {
+		t.Fatalf("roll back: %v", err)
+	}
+	s.Close()
+	s, err = OpenSQLite(path, RetentionConfig{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	got := providerColumns(t, s.db)
+	if len(got) != 2 || got[0] != "huawei-eu" || got[1] != "huawei-eu" {
+		t.Errorf("provider columns after migration = %q, want the instance", got)
+	}
+}
+
+// alarmEvent returns an event of type typ for the alarm code on inv1 of
+// instance, detected at minute min.
+func alarmEvent(id, instance, code string, typ models.AlarmEventType, min int) models.AlarmEvent {
+	return models.AlarmEvent{
+		ID:       id,
+		Type:     typ,
+		Time:     time.Date(2024, 6, 14, 10, min, 0, 0, time.UTC),
+		Provider: instance,
+		DeviceID: "inv1",
+		Code:     code,
+		Alarm:    models.NormalizedAlarm{DeviceID: "inv1", Code: code},
+	}
+}
+
+// eventIDs returns the IDs of events.
+func eventIDs(events []models.AlarmEvent) string {
+	ids := make([]string, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestOpenAlarmEvents(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "store.db")
+	s, err := OpenSQLite(path, RetentionConfig{})
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+
+	events := []models.AlarmEvent{
+		alarmEvent("a1", "huawei", "E1", models.AlarmEventRaised, 0),
+		alarmEvent("b1", "huawei", "E2", models.AlarmEventRaised, 1),
+		alarmEvent("a2", "huawei", "E1", models.AlarmEventUpdated, 2),
+		alarmEvent("b2", "huawei", "E2", models.AlarmEventCleared, 3),
+		// The same code on another instance is another alarm
+		alarmEvent("c1", "huawei-eu", "E2", models.AlarmEventRaised, 3),
+		alarmEvent("b3", "huawei", "E2", models.AlarmEventRaised, 4),
+	}
+	// Saved in two batches, as the tracker delivers them
+	if err := s.SaveAlarmEvents(ctx, events[:3]); err != nil {
+		t.Fatalf("SaveAlarmEvents: %v", err)
+	}
+	if err := s.SaveAlarmEvents(ctx, events[3:]); err != nil {
+		t.Fatalf("SaveAlarmEvents: %v", err)
+	}
+	const want = "b3,c1,a2,a1"
+	open, err := s.OpenAlarmEvents(ctx)
+	if err != nil {
+		t.Fatalf("OpenAlarmEvents: %v", err)
+	}
+	if got := eventIDs(open); got != want {
+		t.Errorf("open events = %s, want %s", got, want)
+	}
+
+	// Events stored before migration 5 are closed by it
+	if _, err := s.db.Exec(undoMigration5); err != nil {
+		t.Fatalf("roll back: %v", err)
+	}
+	s.Close()
+	s, err = OpenSQLite(path, RetentionConfig{})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+	if open, err = s.OpenAlarmEvents(ctx); err != nil {
+		t.Fatalf("OpenAlarmEvents after migration: %v", err)
+	}
+	if got := eventIDs(open); got != want {
+		t.Errorf("open events after migration = %s, want %s", got, want)
+	}
+}
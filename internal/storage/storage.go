@@ -0,0 +1,179 @@
+// Package storage persists normalized data so history can be kept beyond what
+// the vendor APIs retain and API requests can be answered without calling the
+// vendor clouds.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/muasiq/universal-inverter-data-normalizer/internal/models"
+)
+
+// ErrNotFound is returned when the store holds no data for a query.
+var ErrNotFound = errors.New("not found in store")
+
+// Store is the repository for normalized entities. All IDs are normalized
+// IDs as returned by the engine. Saving an entity that is already stored
+// replaces it.
+type Store interface {
+	SavePlants(ctx context.Context, plants []models.NormalizedPlant) error
+	Plants(ctx context.Context) ([]models.NormalizedPlant, error)
+
+	SaveDevices(ctx context.Context, devices []models.NormalizedDevice) error
+	// Devices returns the devices of a plant, or all devices if plantID is empty.
+	Devices(ctx context.Context, plantID string) ([]models.NormalizedDevice, error)
+
+	// SaveRealtime records a snapshot, keyed by device and Timestamp.
+	SaveRealtime(ctx context.Context, rt *models.NormalizedRealtime) error
+	// LatestRealtime returns the newest snapshot of a device, or ErrNotFound.
+	LatestRealtime(ctx context.Context, deviceID string) (*models.NormalizedRealtime, error)
+	// RealtimeRange returns the snapshots of a device taken in [from, to),
+	// oldest first.
+	RealtimeRange(ctx context.Context, deviceID string, from, to time.Time) ([]models.NormalizedRealtime, error)
+
+	// SaveTimeSeries records history points, keyed by device, granularity
+	// and Timestamp.
+	SaveTimeSeries(ctx context.Context, points []models.NormalizedTimeSeries) error
+	// TimeSeriesRange returns the points of a device at one granularity in
+	// [from, to), oldest first.
+	TimeSeriesRange(ctx context.Context, deviceID string, granularity models.Granularity, from, to time.Time) ([]models.NormalizedTimeSeries, error)
+
+	SaveAlarms(ctx context.Context, alarms []models.NormalizedAlarm) error
+	// Alarms returns the stored alarms matching q, newest first.
+	Alarms(ctx context.Context, q AlarmQuery) ([]models.NormalizedAlarm, error)
+
+	// SaveAlarmEvents records alarm lifecycle events, keyed by event ID.
+	SaveAlarmEvents(ctx context.Context, events []models.AlarmEvent) error
+	// AlarmEvents returns the stored events matching q, newest first.
+	AlarmEvents(ctx context.Context, q AlarmEventQuery) ([]models.AlarmEvent, error)
+	// OpenAlarmEvents returns the stored events of alarms not cleared
+	// since, newest first.
+	OpenAlarmEvents(ctx context.Context) ([]models.AlarmEvent, error)
+
+	// Checkpoint returns the saved progress of a resumable job, or ErrNotFound.
+	Checkpoint(ctx context.Context, key string) (*Checkpoint, error)
+	SaveCheckpoint(ctx context.Context, cp *Checkpoint) error
+
+	// Prune deletes data older than the retention policy and returns the
+	// number of rows removed.
+	Prune(ctx context.Context) (int64, error)
+
+	Close() error
+}
+
+// AlarmQuery filters stored alarms. Zero fields do not filter.
+type AlarmQuery struct {
+	DeviceID string
+	PlantID  string
+	From     time.Time // alarms that started at or after From
+	To       time.Time // alarms that started before To
+}
+
+// AlarmEventQuery filters stored alarm events. Zero fields do not filter.
+type AlarmEventQuery struct {
+	Provider string // provider instance
+	DeviceID string
+	PlantID  string
+	Type     models.AlarmEventType
+	From     time.Time // events detected at or after From
+	To       time.Time // events detected before To
+	Limit    int
+}
+
+// Matches reports whether ev passes the filters of q, ignoring Limit.
+func (q AlarmEventQuery) Matches(ev *models.AlarmEvent) bool {
+	return (q.Provider == "" || ev.Provider == q.Provider) &&
+		(q.DeviceID == "" || ev.DeviceID == q.DeviceID) &&
+		(q.PlantID == "" || ev.PlantID == q.PlantID) &&
+		(q.Type == "" || ev.Type == q.Type) &&
+		(q.From.IsZero() || !ev.Time.Before(q.From)) &&
+		(q.To.IsZero() || ev.Time.Before(q.To))
+}
+
+// Checkpoint records which spans of a resumable job, such as a history
+// backfill, are done.
+type Checkpoint struct {
+	Key  string `json:"key"`
+	Done []Span `json:"done,omitempty"` // sorted, non-overlapping
+}
+
+// Span is the time range [From, To).
+type Span struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Covers reports whether s is entirely inside a done span.
+func (cp *Checkpoint) Covers(s Span) bool {
+	for _, d := range cp.Done {
+		if !s.From.Before(d.From) && !s.To.After(d.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add marks s as done, merging it with overlapping or adjacent spans.
+func (cp *Checkpoint) Add(s Span) {
+	merged := make([]Span, 0, len(cp.Done)+1)
+	placed := false
+	for _, d := range cp.Done {
+		switch {
+		case d.To.Before(s.From):
+			merged = append(merged, d)
+		case s.To.Before(d.From):
+			if !placed {
+				merged = append(merged, s)
+				placed = true
+			}
+			merged = append(merged, d)
+		default:
+			if d.From.Before(s.From) {
+				s.From = d.From
+			}
+			if d.To.After(s.To) {
+				s.To = d.To
+			}
+		}
+	}
+	if !placed {
+		merged = append(merged, s)
+	}
+	cp.Done = merged
+}
+
+// Config selects and configures the store.
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// SQLite database file. Empty keeps the database in memory, so it is lost
+	// on restart.
+	Path string `yaml:"path"`
+
+	Retention RetentionConfig `yaml:"retention"`
+}
+
+// RetentionConfig sets how many days of data are kept. 0 keeps data forever.
+// Plants and devices are never pruned.
+type RetentionConfig struct {
+	RealtimeDays   int `yaml:"realtime_days"`
+	TimeSeriesDays int `yaml:"timeseries_days"`
+	AlarmsDays     int `yaml:"alarms_days"` // resolved alarms and alarm events
+}
+
+// DefaultConfig returns the storage settings used when the config file sets none.
+func DefaultConfig() Config {
+	return Config{
+		Retention: RetentionConfig{
+			RealtimeDays: 30,
+			AlarmsDays:   365,
+		},
+	}
+}
+
+// Open opens the store described by cfg.
+func Open(cfg Config) (Store, error) {
+	return OpenSQLite(cfg.Path, cfg.Retention)
+}